@@ -167,6 +167,7 @@ func (d DeferredBatchOp) Finish() error {
 //	InternalKeyKindIngestSST      varstring
 //	InternalKeyKindSet            varstring varstring
 //	InternalKeyKindMerge          varstring varstring
+//	InternalKeyKindDeleteSized    varstring varstring
 //	InternalKeyKindRangeDelete    varstring varstring
 //	InternalKeyKindRangeKeySet    varstring varstring
 //	InternalKeyKindRangeKeyUnset  varstring varstring
@@ -229,6 +230,11 @@ type Batch struct {
 	// every time a RANGEKEYSET, RANGEKEYUNSET or RANGEKEYDEL key is added.
 	countRangeKeys uint64
 
+	// minimumFormatMajorVersion is the minimum format major version required
+	// to commit the batch. It's raised by operations that write key kinds
+	// unknown to older formats (eg, DELSIZED).
+	minimumFormatMajorVersion FormatMajorVersion
+
 	// A deferredOp struct, stored in the Batch so that a pointer can be returned
 	// from the *Deferred() methods rather than a value.
 	deferredOp DeferredBatchOp
@@ -281,11 +287,54 @@ type Batch struct {
 	// will also need to be in this separate struct.
 	commit    sync.WaitGroup
 	fsyncWait sync.WaitGroup
+	// fsyncDone, if non-nil, is closed once the WAL fsync awaited by fsyncWait
+	// completes. It allows DB.ApplyWithContext to stop waiting for the fsync
+	// when its context is done.
+	fsyncDone chan struct{}
 
 	commitStats BatchCommitStats
 
 	commitErr error
 	applied   atomic.Bool
+
+	// commitCheck, if set, is invoked by the commit pipeline to validate the
+	// batch before it is sequenced. It's first invoked with a minSeqNum of zero
+	// without blocking other commits, and then again once all batches sequenced
+	// before this one are visible, with the visible sequence number at the time
+	// of the first invocation, so that only the writes committed concurrently
+	// with the first invocation need to be checked. If it returns an error the
+	// batch is not committed. It is used by Txn to detect conflicts.
+	commitCheck func(minSeqNum uint64) error
+
+	// conditions holds the preconditions added by the batch's conditional
+	// writes, which are evaluated by the commit pipeline at the same point as
+	// commitCheck. See Batch.SetIfAbsent.
+	conditions []batchCondition
+}
+
+// batchCondition is a precondition on the value of a key that must hold for a
+// batch to commit.
+type batchCondition struct {
+	key []byte
+	// value is the expected value of key. It is only meaningful if exists is
+	// true.
+	value []byte
+	// exists is true if the key is expected to be present, and false if the
+	// key is expected to be absent.
+	exists bool
+}
+
+// ConditionFailedError is returned when committing a batch if the
+// precondition of one of its conditional writes does not hold. None of the
+// batch's writes are applied.
+type ConditionFailedError struct {
+	// Key is the user key whose precondition failed.
+	Key []byte
+}
+
+// Error implements the error interface.
+func (e *ConditionFailedError) Error() string {
+	return fmt.Sprintf("pebble: condition failed for key %q", e.Key)
 }
 
 // BatchCommitStats exposes stats related to committing a batch.
@@ -321,6 +370,10 @@ type BatchCommitStats struct {
 	// high read amplification in L0 (due to not compacting fast enough out of
 	// L0).
 	L0ReadAmpWriteStallDuration time.Duration
+	// WriteThrottleDuration is the delay imposed by gradual write throttling as
+	// the DB approached a write stall. See
+	// Options.Experimental.WriteThrottleRate.
+	WriteThrottleDuration time.Duration
 	// WALRotationDuration is the wait time for WAL rotation, which includes
 	// syncing and closing the old WAL and creating (or reusing) a new one.
 	WALRotationDuration time.Duration
@@ -413,6 +466,7 @@ func (b *Batch) refreshMemTableSize() {
 
 	b.countRangeDels = 0
 	b.countRangeKeys = 0
+	b.minimumFormatMajorVersion = 0
 	for r := b.Reader(); ; {
 		kind, key, value, ok := r.Next()
 		if !ok {
@@ -423,6 +477,10 @@ func (b *Batch) refreshMemTableSize() {
 			b.countRangeDels++
 		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
 			b.countRangeKeys++
+		case InternalKeyKindDeleteSized:
+			if b.minimumFormatMajorVersion < FormatDeleteSized {
+				b.minimumFormatMajorVersion = FormatDeleteSized
+			}
 		case InternalKeyKindIngestSST:
 			// This key kind doesn't contribute to the memtable size.
 			continue
@@ -453,6 +511,10 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 	b.data = append(b.data, batch.data[batchHeaderLen:]...)
 
 	b.setCount(b.Count() + batch.Count())
+	b.conditions = append(b.conditions, batch.conditions...)
+	if b.minimumFormatMajorVersion < batch.minimumFormatMajorVersion {
+		b.minimumFormatMajorVersion = batch.minimumFormatMajorVersion
+	}
 
 	if b.db != nil || b.index != nil {
 		// Only iterate over the new entries if we need to track memTableSize or in
@@ -512,7 +574,7 @@ func (b *Batch) Get(key []byte) ([]byte, io.Closer, error) {
 	if b.index == nil {
 		return nil, nil, ErrNotIndexed
 	}
-	return b.db.getInternal(key, b, nil /* snapshot */)
+	return b.db.getInternal(key, b, snapshotIterOpts{})
 }
 
 func (b *Batch) prepareDeferredKeyValueRecord(keyLen, valueLen int, kind InternalKeyKind) {
@@ -680,6 +742,52 @@ func (b *Batch) DeleteDeferred(keyLen int) *DeferredBatchOp {
 	return &b.deferredOp
 }
 
+// DeleteSized behaves identically to Delete, but takes an additional
+// argument indicating the size of the value being deleted. DeleteSized
+// should be preferred when the caller has the expectation that there exists
+// a single internal KV pair for the key (eg, the key has not been
+// overwritten recently), and the caller knows the size of its value.
+//
+// DeleteSized will record the value size within the tombstone and use it to
+// inform compaction-picking heuristics which strive to reduce space
+// amplification in the LSM. This "calling your shot" mechanic allows the
+// storage engine to more accurately estimate and reduce space amplification.
+//
+// It is safe to modify the contents of the arguments after DeleteSized
+// returns.
+func (b *Batch) DeleteSized(key []byte, deletedValueSize uint32, _ *WriteOptions) error {
+	deferredOp := b.DeleteSizedDeferred(len(key), deletedValueSize)
+	copy(b.deferredOp.Key, key)
+	// TODO(peter): Manually inline DeferredBatchOp.Finish(). Check if in a
+	// later Go release this is unnecessary.
+	if b.index != nil {
+		if err := b.index.Add(deferredOp.offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSizedDeferred is similar to DeleteSized in that it adds a sized delete
+// operation to the batch, except it only takes in key length instead of a
+// complete key slice, letting the caller encode into the DeferredBatchOp.Key
+// slice and then call Finish() on the returned object.
+func (b *Batch) DeleteSizedDeferred(keyLen int, deletedValueSize uint32) *DeferredBatchOp {
+	if b.minimumFormatMajorVersion < FormatDeleteSized {
+		b.minimumFormatMajorVersion = FormatDeleteSized
+	}
+
+	// The value of a DELSIZED key is the size of the entry it deletes: the sum
+	// of the key length and the deleted value's length, encoded as a uvarint.
+	v := uint64(keyLen) + uint64(deletedValueSize)
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	b.prepareDeferredKeyValueRecord(keyLen, n, InternalKeyKindDeleteSized)
+	copy(b.deferredOp.Value, buf[:n])
+	b.deferredOp.index = b.index
+	return &b.deferredOp
+}
+
 // SingleDelete adds an action to the batch that single deletes the entry for key.
 // See Writer.SingleDelete for more details on the semantics of SingleDelete.
 //
@@ -875,6 +983,56 @@ func (b *Batch) LogData(data []byte, _ *WriteOptions) error {
 	return nil
 }
 
+// SetIfAbsent adds an action to the batch that sets the key to map to the
+// value, conditional on the key being absent from the DB when the batch is
+// committed. If the key is present, committing the batch fails with a
+// ConditionFailedError and none of the batch's writes are applied.
+//
+// The conditions of a batch are evaluated atomically against the latest state
+// of the DB immediately before the batch is sequenced, and do not observe the
+// batch's own writes. Conditions are not part of the batch's Repr.
+//
+// It is safe to modify the contents of the arguments after SetIfAbsent
+// returns.
+func (b *Batch) SetIfAbsent(key, value []byte, _ *WriteOptions) error {
+	b.addCondition(key, nil, false)
+	return b.Set(key, value, nil)
+}
+
+// CompareAndSet adds an action to the batch that sets the key to map to the
+// value, conditional on the key mapping to the expected value when the batch
+// is committed. If the key is absent or maps to a different value, committing
+// the batch fails with a ConditionFailedError and none of the batch's writes
+// are applied. See SetIfAbsent for the semantics of conditions.
+//
+// It is safe to modify the contents of the arguments after CompareAndSet
+// returns.
+func (b *Batch) CompareAndSet(key, expected, value []byte, _ *WriteOptions) error {
+	b.addCondition(key, expected, true)
+	return b.Set(key, value, nil)
+}
+
+// CompareAndDelete adds an action to the batch that deletes the key,
+// conditional on the key mapping to the expected value when the batch is
+// committed. If the key is absent or maps to a different value, committing the
+// batch fails with a ConditionFailedError and none of the batch's writes are
+// applied. See SetIfAbsent for the semantics of conditions.
+//
+// It is safe to modify the contents of the arguments after CompareAndDelete
+// returns.
+func (b *Batch) CompareAndDelete(key, expected []byte, _ *WriteOptions) error {
+	b.addCondition(key, expected, true)
+	return b.Delete(key, nil)
+}
+
+func (b *Batch) addCondition(key, value []byte, exists bool) {
+	c := batchCondition{key: append([]byte(nil), key...), exists: exists}
+	if exists {
+		c.value = append([]byte{}, value...)
+	}
+	b.conditions = append(b.conditions, c)
+}
+
 // IngestSST adds the FileNum for an sstable to the batch. The data will only be
 // written to the WAL (not added to memtables or sstables).
 func (b *Batch) ingestSST(fileNum base.FileNum) {
@@ -954,7 +1112,7 @@ func (b *Batch) NewIterWithContext(ctx context.Context, o *IterOptions) *Iterato
 	if b.index == nil {
 		return &Iterator{err: ErrNotIndexed}
 	}
-	return b.db.newIter(ctx, b, nil /* snapshot */, o)
+	return b.db.newIter(ctx, b, snapshotIterOpts{}, o)
 }
 
 // newInternalIter creates a new internalIterator that iterates over the
@@ -1155,6 +1313,12 @@ func (b *Batch) Commit(o *WriteOptions) error {
 	return b.db.Apply(b, o)
 }
 
+// CommitWithContext applies the batch to its parent writer, stopping waiting
+// if ctx is done. See DB.ApplyWithContext.
+func (b *Batch) CommitWithContext(ctx context.Context, o *WriteOptions) error {
+	return b.db.ApplyWithContext(ctx, b, o)
+}
+
 // Close closes the batch without committing it.
 func (b *Batch) Close() error {
 	b.release()
@@ -1187,6 +1351,7 @@ func (b *Batch) Reset() {
 	b.count = 0
 	b.countRangeDels = 0
 	b.countRangeKeys = 0
+	b.minimumFormatMajorVersion = 0
 	b.memTableSize = 0
 	b.deferredOp = DeferredBatchOp{}
 	b.tombstones = nil
@@ -1196,8 +1361,11 @@ func (b *Batch) Reset() {
 	b.flushable = nil
 	b.commit = sync.WaitGroup{}
 	b.fsyncWait = sync.WaitGroup{}
+	b.fsyncDone = nil
 	b.commitStats = BatchCommitStats{}
 	b.commitErr = nil
+	b.commitCheck = nil
+	b.conditions = nil
 	b.applied.Store(false)
 	if b.data != nil {
 		if cap(b.data) > batchMaxRetainedSize {
@@ -1365,7 +1533,8 @@ func (r *BatchReader) Next() (kind InternalKeyKind, ukey []byte, value []byte, o
 	}
 	switch kind {
 	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete,
-		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
+		InternalKeyKindDeleteSized:
 		*r, value, ok = batchDecodeStr(*r)
 		if !ok {
 			return 0, nil, nil, false
@@ -1374,6 +1543,215 @@ func (r *BatchReader) Next() (kind InternalKeyKind, ukey []byte, value []byte, o
 	return kind, ukey, value, true
 }
 
+// SplitBatchRepr splits a batch representation into consecutive batch
+// representations of at most maxSize bytes each, including the batch header.
+// Records are never split, so a record that does not fit within maxSize on its
+// own is placed alone in a batch that exceeds maxSize. If the batch's sequence
+// number is set, the sequence number of each split batch is that of its first
+// record. An empty batch is returned as a single empty batch. The returned
+// representations do not alias repr.
+func SplitBatchRepr(repr []byte, maxSize int) ([][]byte, error) {
+	if maxSize <= batchHeaderLen {
+		return nil, errors.Newf("pebble: batch size limit %d does not exceed the batch header size", maxSize)
+	}
+	if len(repr) < batchHeaderLen {
+		return nil, base.CorruptionErrorf("pebble: invalid batch")
+	}
+	seqNum := binary.LittleEndian.Uint64(repr[:batchCountOffset])
+
+	var reprs [][]byte
+	var cur []byte
+	// count is the number of records in cur that consume a sequence number,
+	// and seqNumOffset is the number of such records preceding cur.
+	var count, seqNumOffset uint64
+	finish := func() {
+		binary.LittleEndian.PutUint32(cur[batchCountOffset:batchHeaderLen], uint32(count))
+		reprs = append(reprs, cur)
+		seqNumOffset += count
+		cur, count = nil, 0
+	}
+	err := forEachBatchRecord(repr, func(kind InternalKeyKind, _, _, rec []byte) error {
+		if cur != nil && len(cur)+len(rec) > maxSize {
+			finish()
+		}
+		if cur == nil {
+			n := maxSize
+			if n > len(repr) {
+				n = len(repr)
+			}
+			cur = make([]byte, batchHeaderLen, n)
+			if seqNum != 0 {
+				binary.LittleEndian.PutUint64(cur[:batchCountOffset], seqNum+seqNumOffset)
+			}
+		}
+		cur = append(cur, rec...)
+		if kind != InternalKeyKindLogData {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cur == nil {
+		cur = make([]byte, batchHeaderLen)
+		binary.LittleEndian.PutUint64(cur[:batchCountOffset], seqNum)
+	}
+	finish()
+	return reprs, nil
+}
+
+// MergeBatchReprs returns a batch representation containing the records of
+// each of the provided batch representations, in order. The merged batch has
+// the sequence number of the first batch. Batches of ingested sstables may
+// only be merged with one another.
+func MergeBatchReprs(reprs ...[]byte) ([]byte, error) {
+	n := batchHeaderLen
+	for _, repr := range reprs {
+		if len(repr) < batchHeaderLen {
+			return nil, base.CorruptionErrorf("pebble: invalid batch")
+		}
+		n += len(repr) - batchHeaderLen
+	}
+	if uint64(n) >= maxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	merged := make([]byte, batchHeaderLen, n)
+	if len(reprs) > 0 {
+		copy(merged[:batchCountOffset], reprs[0][:batchCountOffset])
+	}
+	var count uint64
+	var ingestedSSTs, other bool
+	for _, repr := range reprs {
+		err := forEachBatchRecord(repr, func(kind InternalKeyKind, _, _, rec []byte) error {
+			switch kind {
+			case InternalKeyKindLogData:
+			case InternalKeyKindIngestSST:
+				ingestedSSTs = true
+				count++
+			default:
+				other = true
+				count++
+			}
+			merged = append(merged, rec...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ingestedSSTs && other {
+		return nil, errors.New("pebble: cannot merge a batch of ingested sstables with other records")
+	}
+	if count >= invalidBatchCount {
+		return nil, ErrBatchTooLarge
+	}
+	binary.LittleEndian.PutUint32(merged[batchCountOffset:batchHeaderLen], uint32(count))
+	return merged, nil
+}
+
+// FilterBatchRepr returns a batch representation containing the records of
+// repr that overlap the key span [start, end), in order. A nil start or end
+// leaves the span unbounded in that direction. Range deletions and range keys
+// are truncated to the span. LogData and ingested sstable records, which have
+// no user key, are always retained. The filtered batch has the sequence
+// number of repr, so the sequence numbers of its records may differ from
+// those in repr if records are filtered out.
+func FilterBatchRepr(repr []byte, cmp Compare, start, end []byte) ([]byte, error) {
+	if len(repr) < batchHeaderLen {
+		return nil, base.CorruptionErrorf("pebble: invalid batch")
+	}
+	filtered := make([]byte, batchHeaderLen, len(repr))
+	copy(filtered[:batchCountOffset], repr[:batchCountOffset])
+	var count uint64
+	err := forEachBatchRecord(repr, func(kind InternalKeyKind, ukey, value, rec []byte) error {
+		switch kind {
+		case InternalKeyKindLogData, InternalKeyKindIngestSST:
+		case InternalKeyKindRangeDelete, InternalKeyKindRangeKeySet,
+			InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+			spanEnd, suffixes := value, []byte(nil)
+			if kind != InternalKeyKindRangeDelete {
+				var ok bool
+				if spanEnd, suffixes, ok = rangekey.DecodeEndKey(kind, value); !ok {
+					return base.CorruptionErrorf("pebble: corrupt range key in batch")
+				}
+			}
+			if (end != nil && cmp(ukey, end) >= 0) || (start != nil && cmp(spanEnd, start) <= 0) {
+				return nil
+			}
+			truncStart := start != nil && cmp(ukey, start) < 0
+			truncEnd := end != nil && cmp(spanEnd, end) > 0
+			if truncStart || truncEnd {
+				if truncStart {
+					ukey = start
+				}
+				if truncEnd {
+					spanEnd = end
+				}
+				value = spanEnd
+				if kind == InternalKeyKindRangeKeySet || kind == InternalKeyKindRangeKeyUnset {
+					value = binary.AppendUvarint(nil, uint64(len(spanEnd)))
+					value = append(append(value, spanEnd...), suffixes...)
+				}
+				rec = appendBatchRecord(nil, kind, ukey, value)
+			}
+		default:
+			if (start != nil && cmp(ukey, start) < 0) || (end != nil && cmp(ukey, end) >= 0) {
+				return nil
+			}
+		}
+		if kind != InternalKeyKindLogData {
+			count++
+		}
+		filtered = append(filtered, rec...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(filtered[batchCountOffset:batchHeaderLen], uint32(count))
+	return filtered, nil
+}
+
+// forEachBatchRecord calls fn with the kind, user key and value of each record
+// in the batch representation repr, along with the record's encoding. It
+// returns an error if repr is corrupt.
+func forEachBatchRecord(
+	repr []byte, fn func(kind InternalKeyKind, ukey, value, rec []byte) error,
+) error {
+	if len(repr) < batchHeaderLen {
+		return base.CorruptionErrorf("pebble: invalid batch")
+	}
+	for r := BatchReader(repr[batchHeaderLen:]); len(r) > 0; {
+		rec := []byte(r)
+		kind, ukey, value, ok := r.Next()
+		if !ok {
+			return base.CorruptionErrorf("pebble: corrupt batch")
+		}
+		if err := fn(kind, ukey, value, rec[:len(rec)-len(r)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendBatchRecord appends the encoding of a batch record to dst. The value
+// is only encoded for key kinds that carry a value in batches.
+func appendBatchRecord(dst []byte, kind InternalKeyKind, ukey, value []byte) []byte {
+	dst = append(dst, byte(kind))
+	dst = binary.AppendUvarint(dst, uint64(len(ukey)))
+	dst = append(dst, ukey...)
+	switch kind {
+	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete,
+		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
+		InternalKeyKindDeleteSized:
+		dst = binary.AppendUvarint(dst, uint64(len(value)))
+		dst = append(dst, value...)
+	}
+	return dst
+}
+
 // Note: batchIter mirrors the implementation of flushableBatchIter. Keep the
 // two in sync.
 type batchIter struct {
@@ -1500,7 +1878,8 @@ func (i *batchIter) value() []byte {
 
 	switch InternalKeyKind(data[offset]) {
 	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete,
-		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
+		InternalKeyKindDeleteSized:
 		_, value, ok := batchDecodeStr(data[keyEnd:])
 		if !ok {
 			return nil
@@ -1944,7 +2323,8 @@ func (i *flushableBatchIter) value() base.LazyValue {
 	var ok bool
 	switch kind {
 	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete,
-		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
+		InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete,
+		InternalKeyKindDeleteSized:
 		keyEnd := i.offsets[i.index].keyEnd
 		_, value, ok = batchDecodeStr(i.data[keyEnd:])
 		if !ok {
@@ -2052,7 +2432,8 @@ func (i flushFlushableBatchIter) valueSize() uint64 {
 	}
 	var length uint64
 	switch kind {
-	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete:
+	case InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindRangeDelete,
+		InternalKeyKindDeleteSized:
 		keyEnd := i.offsets[i.index].keyEnd
 		v, n := binary.Uvarint(i.data[keyEnd:])
 		if n <= 0 {
@@ -63,6 +63,18 @@ func TestBatch(t *testing.T) {
 		}
 		return base.FileNum(val)
 	}
+	// encodeDeletedSize encodes the value of a DELSIZED key deleting an
+	// entry with the given key and value size.
+	encodeDeletedSize := func(key string, valueSize uint32) string {
+		return string(binary.AppendUvarint(nil, uint64(len(key))+uint64(valueSize)))
+	}
+	decodeDeletedValueSize := func(key, value []byte) uint32 {
+		v, n := binary.Uvarint(value)
+		if n <= 0 {
+			t.Fatalf("invalid deleted size encoding")
+		}
+		return uint32(v - uint64(len(key)))
+	}
 
 	// RangeKeySet and RangeKeyUnset are untested here because they don't expose
 	// deferred variants. This is a consequence of these keys' more complex
@@ -93,6 +105,8 @@ func TestBatch(t *testing.T) {
 		{InternalKeyKindLogData, "", ""},
 		{InternalKeyKindRangeKeyDelete, "grass", "green"},
 		{InternalKeyKindRangeKeyDelete, "", ""},
+		{InternalKeyKindDeleteSized, "lilies", encodeDeletedSize("lilies", 5)},
+		{InternalKeyKindDeleteSized, "", encodeDeletedSize("", 1000)},
 	}
 	var b Batch
 	for _, tc := range testCases {
@@ -105,6 +119,8 @@ func TestBatch(t *testing.T) {
 			_ = b.Delete([]byte(tc.key), nil)
 		case InternalKeyKindSingleDelete:
 			_ = b.SingleDelete([]byte(tc.key), nil)
+		case InternalKeyKindDeleteSized:
+			_ = b.DeleteSized([]byte(tc.key), decodeDeletedValueSize([]byte(tc.key), []byte(tc.value)), nil)
 		case InternalKeyKindRangeDelete:
 			_ = b.DeleteRange([]byte(tc.key), []byte(tc.value), nil)
 		case InternalKeyKindLogData:
@@ -144,6 +160,10 @@ func TestBatch(t *testing.T) {
 			copy(d.Key, key)
 			copy(d.Value, value)
 			d.Finish()
+		case InternalKeyKindDeleteSized:
+			d := b.DeleteSizedDeferred(len(key), decodeDeletedValueSize(key, value))
+			copy(d.Key, key)
+			d.Finish()
 		case InternalKeyKindRangeDelete:
 			d := b.DeleteRangeDeferred(len(key), len(value))
 			copy(d.Key, key)
@@ -1553,3 +1573,300 @@ func TestBatchSpanCaching(t *testing.T) {
 		}
 	}
 }
+
+func TestBatchConditions(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	requireConditionFailed := func(err error, key string) {
+		var condErr *ConditionFailedError
+		require.True(t, errors.As(err, &condErr), "%v", err)
+		require.Equal(t, key, string(condErr.Key))
+	}
+
+	// SetIfAbsent succeeds for an absent key, and fails once it's present.
+	b := d.NewBatch()
+	require.NoError(t, b.SetIfAbsent([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "1", get("a"))
+
+	b = d.NewBatch()
+	require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, b.SetIfAbsent([]byte("a"), []byte("2"), nil))
+	requireConditionFailed(b.Commit(nil), "a")
+	require.NoError(t, b.Close())
+	// None of the batch's writes are applied.
+	require.Equal(t, "1", get("a"))
+	require.Equal(t, "<not found>", get("b"))
+
+	// CompareAndSet only succeeds if the current value matches.
+	b = d.NewBatch()
+	require.NoError(t, b.CompareAndSet([]byte("a"), []byte("2"), []byte("3"), nil))
+	requireConditionFailed(d.Apply(b, nil), "a")
+	require.NoError(t, b.Close())
+	b = d.NewBatch()
+	require.NoError(t, b.CompareAndSet([]byte("b"), nil, []byte("3"), nil))
+	requireConditionFailed(d.Apply(b, nil), "b")
+	require.NoError(t, b.Close())
+	b = d.NewBatch()
+	require.NoError(t, b.CompareAndSet([]byte("a"), []byte("1"), []byte("3"), nil))
+	require.NoError(t, d.Apply(b, nil))
+	require.Equal(t, "3", get("a"))
+
+	// A batch whose condition fails is never synced, so SyncWait returns the
+	// commit's error rather than waiting for a sync.
+	b = d.NewBatch()
+	require.NoError(t, b.SetIfAbsent([]byte("a"), []byte("4"), nil))
+	requireConditionFailed(d.ApplyNoSyncWait(b, Sync), "a")
+	requireConditionFailed(b.SyncWait(), "a")
+	require.NoError(t, b.Close())
+
+	// Conditions do not observe the batch's own writes.
+	b = d.NewIndexedBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("4"), nil))
+	require.NoError(t, b.CompareAndSet([]byte("a"), []byte("4"), []byte("5"), nil))
+	requireConditionFailed(b.Commit(nil), "a")
+	require.NoError(t, b.Close())
+	require.Equal(t, "3", get("a"))
+
+	// Conditions are carried over by Batch.Apply and cleared by Batch.Reset.
+	b = d.NewBatch()
+	require.NoError(t, b.CompareAndDelete([]byte("a"), []byte("1"), nil))
+	b2 := d.NewBatch()
+	require.NoError(t, b2.Apply(b, nil))
+	requireConditionFailed(b2.Commit(nil), "a")
+	require.NoError(t, b2.Close())
+	b.Reset()
+	require.NoError(t, b.Delete([]byte("a"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "<not found>", get("a"))
+
+	// CompareAndDelete deletes the key if the current value matches.
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	b = d.NewBatch()
+	require.NoError(t, b.CompareAndDelete([]byte("c"), []byte("1"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.Equal(t, "<not found>", get("c"))
+}
+
+func TestBatchConditionsConcurrent(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	const workers = 4
+	const increments = 50
+	key := []byte("counter")
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; {
+				var count int
+				b := d.NewBatch()
+				v, closer, err := d.Get(key)
+				if err == nil {
+					count, err = strconv.Atoi(string(v))
+					if err == nil {
+						err = b.CompareAndSet(key, v, []byte(strconv.Itoa(count+1)), nil)
+					}
+					closer.Close()
+				} else if errors.Is(err, ErrNotFound) {
+					err = b.SetIfAbsent(key, []byte("1"), nil)
+				}
+				if err == nil {
+					err = b.Commit(nil)
+				}
+				var condErr *ConditionFailedError
+				if errors.As(err, &condErr) {
+					_ = b.Close()
+					continue
+				} else if err != nil {
+					errs <- err
+					return
+				}
+				_ = b.Close()
+				n++
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	v, closer, err := d.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(workers*increments), string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestBatchConditionsConcurrentWriter(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+
+	// While the conditions are evaluated without blocking other commits,
+	// another writer commits to the key. The writer must not be blocked by
+	// the evaluation, and the write must fail the condition once it's
+	// rechecked.
+	checkConditions := d.commit.env.checkConditions
+	var checks []uint64
+	d.commit.env.checkConditions = func(b *Batch, minSeqNum uint64) error {
+		checks = append(checks, minSeqNum)
+		err := checkConditions(b, minSeqNum)
+		if minSeqNum == 0 {
+			done := make(chan error)
+			go func() { done <- d.Set([]byte("a"), []byte("2"), nil) }()
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("concurrent writer blocked by the condition evaluation")
+			}
+		}
+		return err
+	}
+	b := d.NewBatch()
+	require.NoError(t, b.CompareAndSet([]byte("a"), []byte("1"), []byte("3"), nil))
+	err = b.Commit(nil)
+	var condErr *ConditionFailedError
+	require.True(t, errors.As(err, &condErr), "expected condition failure, got %v", err)
+	require.Equal(t, "a", string(condErr.Key))
+	require.NoError(t, b.Close())
+
+	// The evaluation without blocking other commits is followed by a check of
+	// the writes that were committed concurrently.
+	require.Equal(t, 2, len(checks))
+	require.Zero(t, checks[0])
+	require.Less(t, uint64(0), checks[1])
+}
+
+func TestBatchReprUtilities(t *testing.T) {
+	var b Batch
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b.LogData([]byte("log"), nil))
+	require.NoError(t, b.Merge([]byte("b"), []byte("2"), nil))
+	require.NoError(t, b.DeleteRange([]byte("b"), []byte("e"), nil))
+	require.NoError(t, b.Delete([]byte("c"), nil))
+	require.NoError(t, b.DeleteSized([]byte("d"), 10, nil))
+	require.NoError(t, b.SingleDelete([]byte("e"), nil))
+	require.NoError(t, b.RangeKeySet([]byte("a"), []byte("f"), []byte("@1"), []byte("v"), nil))
+	require.NoError(t, b.RangeKeyUnset([]byte("c"), []byte("z"), []byte("@2"), nil))
+	require.NoError(t, b.RangeKeyDelete([]byte("e"), []byte("g"), nil))
+	repr := append([]byte(nil), b.Repr()...)
+
+	// format returns the records of a batch representation, one per line.
+	format := func(repr []byte) string {
+		var buf strings.Builder
+		r, count := ReadBatch(repr)
+		fmt.Fprintf(&buf, "seq=%d count=%d\n", binary.LittleEndian.Uint64(repr), count)
+		for len(r) > 0 {
+			kind, ukey, value, ok := r.Next()
+			require.True(t, ok)
+			fmt.Fprintf(&buf, "%s:%s", kind, ukey)
+			if value != nil {
+				fmt.Fprintf(&buf, "=%q", value)
+			}
+			buf.WriteString("\n")
+		}
+		return buf.String()
+	}
+
+	t.Run("split-merge", func(t *testing.T) {
+		for _, maxSize := range []int{batchHeaderLen + 1, 20, 30, 64, len(repr), 1 << 20} {
+			reprs, err := SplitBatchRepr(repr, maxSize)
+			require.NoError(t, err)
+			var count uint32
+			for _, r := range reprs {
+				_, n := ReadBatch(r)
+				count += n
+				// Only a batch with a single record may exceed the limit.
+				if len(r) > maxSize {
+					rr := BatchReader(r[batchHeaderLen:])
+					_, _, _, ok := rr.Next()
+					require.True(t, ok)
+					require.Empty(t, rr)
+				}
+			}
+			require.Equal(t, b.Count(), count)
+			merged, err := MergeBatchReprs(reprs...)
+			require.NoError(t, err)
+			require.Equal(t, repr, merged)
+		}
+
+		_, err := SplitBatchRepr(repr, batchHeaderLen)
+		require.Error(t, err)
+		_, err = SplitBatchRepr(repr[:batchHeaderLen+2], 64)
+		require.True(t, errors.Is(err, ErrCorruption))
+
+		// Split batches are assigned the sequence numbers of their first
+		// records, skipping LogData which does not consume a sequence number.
+		seqRepr := append([]byte(nil), repr...)
+		binary.LittleEndian.PutUint64(seqRepr, 100)
+		reprs, err := SplitBatchRepr(seqRepr, 20)
+		require.NoError(t, err)
+		require.Greater(t, len(reprs), 1)
+		seqNum := uint64(100)
+		for _, r := range reprs {
+			require.Equal(t, seqNum, binary.LittleEndian.Uint64(r))
+			_, count := ReadBatch(r)
+			seqNum += uint64(count)
+		}
+		require.Equal(t, uint64(100)+uint64(b.Count()), seqNum)
+	})
+
+	t.Run("merge-ingest", func(t *testing.T) {
+		var ingest Batch
+		ingest.ingestSST(1)
+		ingest.ingestSST(2)
+		merged, err := MergeBatchReprs(ingest.Repr(), ingest.Repr())
+		require.NoError(t, err)
+		_, count := ReadBatch(merged)
+		require.Equal(t, uint32(4), count)
+		_, err = MergeBatchReprs(ingest.Repr(), repr)
+		require.Error(t, err)
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		filtered, err := FilterBatchRepr(repr, DefaultComparer.Compare, []byte("c"), []byte("e"))
+		require.NoError(t, err)
+		require.Equal(t, `seq=0 count=5
+LOGDATA:log
+RANGEDEL:c="e"
+DEL:c
+DELSIZED:d="\v"
+RANGEKEYSET:c="\x01e\x02@1\x01v"
+RANGEKEYUNSET:c="\x01e\x02@2"
+`, format(filtered))
+
+		filtered, err = FilterBatchRepr(repr, DefaultComparer.Compare, nil, []byte("b"))
+		require.NoError(t, err)
+		require.Equal(t, `seq=0 count=2
+SET:a="1"
+LOGDATA:log
+RANGEKEYSET:a="\x01b\x02@1\x01v"
+`, format(filtered))
+
+		filtered, err = FilterBatchRepr(repr, DefaultComparer.Compare, nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, repr, filtered)
+	})
+}
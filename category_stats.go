@@ -0,0 +1,108 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+	"time"
+)
+
+// BlockReadStats describes the sstable blocks loaded by iterators.
+type BlockReadStats struct {
+	// CacheHits is the count of blocks found in the block cache.
+	CacheHits uint64
+	// CacheMisses is the count of blocks read from storage, including blocks
+	// read ahead of time by prefetching (see IterOptions.PrefetchBlocks).
+	CacheMisses uint64
+	// BytesInCache is the total size of the blocks found in the block cache.
+	BytesInCache uint64
+	// BytesRead is the total size of the blocks read from storage.
+	BytesRead uint64
+	// ReadDuration is the time iterators spent blocked on reading blocks from
+	// storage.
+	ReadDuration time.Duration
+}
+
+// Merge adds the stats in o to s.
+func (s *BlockReadStats) Merge(o BlockReadStats) {
+	s.CacheHits += o.CacheHits
+	s.CacheMisses += o.CacheMisses
+	s.BytesInCache += o.BytesInCache
+	s.BytesRead += o.BytesRead
+	s.ReadDuration += o.ReadDuration
+}
+
+// subtract subtracts the stats in o from s.
+func (s *BlockReadStats) subtract(o BlockReadStats) {
+	s.CacheHits -= o.CacheHits
+	s.CacheMisses -= o.CacheMisses
+	s.BytesInCache -= o.BytesInCache
+	s.BytesRead -= o.BytesRead
+	s.ReadDuration -= o.ReadDuration
+}
+
+func makeBlockReadStats(s *InternalIteratorStats) BlockReadStats {
+	return BlockReadStats{
+		CacheHits:    s.BlockCacheHits,
+		CacheMisses:  s.BlockCacheMisses,
+		BytesInCache: s.BlockBytesInCache,
+		BytesRead:    s.BlockBytes - s.BlockBytesInCache,
+		ReadDuration: s.BlockReadDuration,
+	}
+}
+
+// LevelBlockReadStats breaks down BlockReadStats by LSM level. Reads of
+// sstables in any L0 sublevel are attributed to L0.
+type LevelBlockReadStats [numLevels]BlockReadStats
+
+// Merge adds the stats in o to s.
+func (s *LevelBlockReadStats) Merge(o *LevelBlockReadStats) {
+	for l := range s {
+		s[l].Merge(o[l])
+	}
+}
+
+// Total returns the stats summed across all levels.
+func (s *LevelBlockReadStats) Total() BlockReadStats {
+	var total BlockReadStats
+	for l := range s {
+		total.Merge(s[l])
+	}
+	return total
+}
+
+// categoryStats aggregates the block reads of the iterators of a DB by their
+// IterOptions.Category.
+type categoryStats struct {
+	mu         sync.Mutex
+	categories map[string]*LevelBlockReadStats
+}
+
+func (c *categoryStats) add(category string, s *LevelBlockReadStats) {
+	if *s == (LevelBlockReadStats{}) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.categories == nil {
+		c.categories = make(map[string]*LevelBlockReadStats)
+	}
+	agg := c.categories[category]
+	if agg == nil {
+		agg = &LevelBlockReadStats{}
+		c.categories[category] = agg
+	}
+	agg.Merge(s)
+}
+
+func (c *categoryStats) metrics() map[string]LevelBlockReadStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]LevelBlockReadStats, len(c.categories))
+	for category, s := range c.categories {
+		m[category] = *s
+	}
+	return m
+}
@@ -5,12 +5,14 @@
 package pebble
 
 import (
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/record"
 )
 
@@ -134,7 +136,17 @@ type commitEnv struct {
 	// and err != nil, a failure to persist the WAL will populate *err. Returns
 	// the memtable the batch should be applied to. Serial execution enforced by
 	// commitPipeline.mu.
-	write func(b *Batch, wg *sync.WaitGroup, err *error) (*memTable, error)
+	write func(b *Batch, wg record.SyncWaiter, err *error) (*memTable, error)
+	// Check the preconditions of the batch's conditional writes against the
+	// latest visible state. Called first without commitPipeline.mu held, with a
+	// minSeqNum of zero, and then with the mutex held and a minSeqNum limiting
+	// the check to the keys written at or above it.
+	checkConditions func(b *Batch, minSeqNum uint64) error
+	// Wait for any write stall that would block writing the batch to end,
+	// returning an error if ctx is done first. Only called for contexts that
+	// may be done, before the batch is sequenced. Called both without and with
+	// commitPipeline.mu held, as indicated by pipelineLocked.
+	waitForRoom func(ctx context.Context, b *Batch, pipelineLocked bool) error
 }
 
 // A commitPipeline manages the stages of committing a set of mutations
@@ -174,7 +186,9 @@ type commitEnv struct {
 //
 // The full outline of the commit pipeline operation is as follows:
 //
+//	(optionally) check the batch's commit check and conditions
 //	with commitPipeline mutex locked:
+//	  (optionally) recheck them against the writes visible since
 //	  assign batch sequence number
 //	  write batch to WAL
 //	(optionally) add batch to WAL sync list
@@ -289,15 +303,38 @@ func (p *commitPipeline) directWrite(b *Batch) error {
 // batch's mutations will be visible for reading.
 // REQUIRES: noSyncWait => syncWAL
 func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
+	return p.CommitWithContext(context.Background(), b, syncWAL, noSyncWait)
+}
+
+// CommitWithContext is like Commit, but stops waiting for room in the commit
+// queue or for a write stall to end if ctx is done before the batch is
+// sequenced, in which case it returns an error without having written
+// anything.
+// REQUIRES: noSyncWait => syncWAL
+func (p *commitPipeline) CommitWithContext(
+	ctx context.Context, b *Batch, syncWAL bool, noSyncWait bool,
+) error {
 	if b.Empty() {
 		return nil
 	}
 
 	commitStartTime := time.Now()
-	// Acquire semaphores.
-	p.commitQueueSem <- struct{}{}
+	// Acquire semaphores. If ctx is done while waiting for them, nothing has
+	// been written yet so the commit can be abandoned.
+	select {
+	case p.commitQueueSem <- struct{}{}:
+	case <-ctx.Done():
+		b.commitErr = errors.Mark(errors.Wrap(ctx.Err(), "pebble: waiting for commit queue"), errCommitAborted)
+		return b.commitErr
+	}
 	if syncWAL {
-		p.logSyncQSem <- struct{}{}
+		select {
+		case p.logSyncQSem <- struct{}{}:
+		case <-ctx.Done():
+			<-p.commitQueueSem
+			b.commitErr = errors.Mark(errors.Wrap(ctx.Err(), "pebble: waiting for commit queue"), errCommitAborted)
+			return b.commitErr
+		}
 	}
 	b.commitStats.SemaphoreWaitDuration = time.Since(commitStartTime)
 
@@ -307,9 +344,20 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	//
 	// NB: We set Batch.commitErr on error so that the batch won't be a candidate
 	// for reuse. See Batch.release().
-	mem, err := p.prepare(b, syncWAL, noSyncWait)
+	mem, err := p.prepare(ctx, b, syncWAL, noSyncWait)
 	if err != nil {
 		b.db = nil // prevent batch reuse on error
+		if errors.Is(err, errCommitAborted) {
+			// The batch's commit was aborted before it was enqueued in the
+			// pending queue. Record the error for Batch.SyncWait, which
+			// returns immediately.
+			b.commitErr = err
+			<-p.commitQueueSem
+			if syncWAL {
+				<-p.logSyncQSem
+			}
+			return err
+		}
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
 		// sitting in the pending queue. We should consider fixing this by also
 		// removing the batch from the pending queue.
@@ -419,12 +467,97 @@ func (p *commitPipeline) AllocateSeqNum(
 	<-p.commitQueueSem
 }
 
-func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memTable, error) {
+// errCommitAborted marks errors that abort the commit of a batch before it is
+// sequenced, such as a failed commit check, without affecting the commit
+// pipeline.
+var errCommitAborted = errors.New("pebble: batch commit aborted")
+
+// fsyncNotifier is the record.SyncWaiter for a batch whose WAL fsync is
+// awaited through Batch.fsyncDone in addition to Batch.fsyncWait.
+type fsyncNotifier struct {
+	wg   *sync.WaitGroup
+	done chan struct{}
+}
+
+// Done implements record.SyncWaiter.
+func (n *fsyncNotifier) Done() {
+	n.wg.Done()
+	close(n.done)
+}
+
+func (p *commitPipeline) prepare(
+	ctx context.Context, b *Batch, syncWAL bool, noSyncWait bool,
+) (*memTable, error) {
 	n := uint64(b.Count())
 	if n == invalidBatchCount {
 		return nil, ErrInvalidBatch
 	}
-	var syncWG *sync.WaitGroup
+	// Perform the bulk of the commit check and the evaluation of the batch's
+	// conditions without holding commitPipeline.mu, so that they don't block
+	// other commits. Once the mutex is held, only the writes that became
+	// visible in the meantime need to be checked.
+	var checkedSeqNum uint64
+	if b.commitCheck != nil || len(b.conditions) > 0 {
+		checkedSeqNum = p.env.visibleSeqNum.Load()
+		var err error
+		if b.commitCheck != nil {
+			err = b.commitCheck(0 /* minSeqNum */)
+		}
+		if err == nil && len(b.conditions) > 0 {
+			err = p.env.checkConditions(b, 0 /* minSeqNum */)
+		}
+		if err != nil {
+			return nil, errors.Mark(err, errCommitAborted)
+		}
+	}
+
+	waitForRoom := ctx.Done() != nil && p.env.waitForRoom != nil
+	if waitForRoom {
+		// Wait for room for the batch before acquiring commitPipeline.mu, since
+		// a batch that stalls in commitEnv.write blocks the pipeline while
+		// holding the mutex, and waiting to acquire the mutex cannot be
+		// abandoned if ctx is done.
+		if err := p.env.waitForRoom(ctx, b, false /* pipelineLocked */); err != nil {
+			return nil, errors.Mark(err, errCommitAborted)
+		}
+	}
+
+	p.mu.Lock()
+
+	if waitForRoom {
+		// A write stall may have begun while acquiring commitPipeline.mu. Wait
+		// again now that no other batch can be sequenced in the meantime.
+		if err := p.env.waitForRoom(ctx, b, true /* pipelineLocked */); err != nil {
+			p.mu.Unlock()
+			return nil, errors.Mark(err, errCommitAborted)
+		}
+	}
+
+	if b.commitCheck != nil || len(b.conditions) > 0 {
+		// Wait for any outstanding writes to the memtable to complete so that
+		// the commit check and conditions observe all of the batches sequenced
+		// before this one. As in AllocateSeqNum, the spin loop obviates the
+		// need for additional synchronization.
+		for p.env.visibleSeqNum.Load() != p.env.logSeqNum.Load() {
+			runtime.Gosched()
+		}
+		var err error
+		if b.commitCheck != nil {
+			err = b.commitCheck(checkedSeqNum)
+		}
+		if err == nil && len(b.conditions) > 0 {
+			err = p.env.checkConditions(b, checkedSeqNum)
+		}
+		if err != nil {
+			p.mu.Unlock()
+			return nil, errors.Mark(err, errCommitAborted)
+		}
+	}
+
+	// The batch can no longer be aborted, so the waits for its publish and WAL
+	// fsync may be set up. An aborted batch is never published or synced, and
+	// must not leave the commit or fsyncWait WaitGroups waiting.
+	var syncWG record.SyncWaiter
 	var syncErr *error
 	switch {
 	case !syncWAL:
@@ -434,6 +567,9 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	case noSyncWait:
 		syncErr = &b.commitErr
 		syncWG = &b.fsyncWait
+		if b.fsyncDone != nil {
+			syncWG = &fsyncNotifier{wg: &b.fsyncWait, done: b.fsyncDone}
+		}
 		// Only need to wait synchronously for the publish. The user will
 		// (asynchronously) wait on the batch's fsyncWait.
 		b.commit.Add(1)
@@ -445,8 +581,6 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 		b.commit.Add(2)
 	}
 
-	p.mu.Lock()
-
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/record"
@@ -49,7 +51,7 @@ func (e *testCommitEnv) apply(b *Batch, mem *memTable) error {
 	return nil
 }
 
-func (e *testCommitEnv) write(b *Batch, wg *sync.WaitGroup, _ *error) (*memTable, error) {
+func (e *testCommitEnv) write(b *Batch, wg record.SyncWaiter, _ *error) (*memTable, error) {
 	e.writeCount.Add(1)
 	if wg != nil {
 		wg.Done()
@@ -207,6 +209,45 @@ func TestCommitPipelineAllocateSeqNum(t *testing.T) {
 	}
 }
 
+func TestCommitPipelineContextCancelledInQueue(t *testing.T) {
+	var e testCommitEnv
+	p := newCommitPipeline(e.env())
+
+	// Fill the commit queue so that the next commit blocks acquiring a slot.
+	for i := 0; i < cap(p.commitQueueSem); i++ {
+		p.commitQueueSem <- struct{}{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		var b Batch
+		_ = b.Set([]byte("a"), nil, nil)
+		errCh <- p.CommitWithContext(ctx, &b, false, false)
+	}()
+	select {
+	case err := <-errCh:
+		t.Fatalf("commit unexpectedly completed: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cancel()
+	err := <-errCh
+	require.True(t, errors.Is(err, context.Canceled), "%v", err)
+	require.True(t, errors.Is(err, errCommitAborted), "%v", err)
+	require.EqualValues(t, 0, e.writeCount.Load())
+	require.EqualValues(t, 0, e.logSeqNum.Load())
+	require.Equal(t, cap(p.commitQueueSem), len(p.commitQueueSem))
+
+	// Once the queue drains, commits proceed.
+	for i := 0; i < cap(p.commitQueueSem); i++ {
+		<-p.commitQueueSem
+	}
+	var b Batch
+	_ = b.Set([]byte("a"), nil, nil)
+	require.NoError(t, p.CommitWithContext(context.Background(), &b, false, false))
+	require.EqualValues(t, 1, e.writeCount.Load())
+}
+
 type syncDelayFile struct {
 	vfs.File
 	done chan struct{}
@@ -244,7 +285,7 @@ func TestCommitPipelineWALClose(t *testing.T) {
 			walDone.Done()
 			return nil
 		},
-		write: func(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
+		write: func(b *Batch, syncWG record.SyncWaiter, syncErr *error) (*memTable, error) {
 			_, _, err := wal.SyncRecord(b.data, syncWG, syncErr)
 			return nil, err
 		},
@@ -303,7 +344,7 @@ func BenchmarkCommitPipeline(b *testing.B) {
 							mem.writerUnref()
 							return nil
 						},
-						write: func(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
+						write: func(b *Batch, syncWG record.SyncWaiter, syncErr *error) (*memTable, error) {
 							for {
 								err := mem.prepare(b)
 								if err == arenaskl.ErrArenaFull {
@@ -457,6 +457,7 @@ const (
 	compactionKindRead
 	compactionKindRewrite
 	compactionKindIngestedFlushable
+	compactionKindTombstoneDensity
 )
 
 func (k compactionKind) String() string {
@@ -477,6 +478,8 @@ func (k compactionKind) String() string {
 		return "rewrite"
 	case compactionKindIngestedFlushable:
 		return "ingested-flushable"
+	case compactionKindTombstoneDensity:
+		return "tombstone-density"
 	}
 	return "?"
 }
@@ -484,9 +487,13 @@ func (k compactionKind) String() string {
 // rangeKeyCompactionTransform is used to transform range key spans as part of the
 // keyspan.MergingIter. As part of this transformation step, we can elide range
 // keys in the last snapshot stripe, as well as coalesce range keys within
-// snapshot stripes.
+// snapshot stripes. Range keys at or above a non-zero historyHorizon, which
+// must also be present in snapshots, are retained as is.
 func rangeKeyCompactionTransform(
-	eq base.Equal, snapshots []uint64, elideRangeKey func(start, end []byte) bool,
+	eq base.Equal,
+	snapshots []uint64,
+	historyHorizon uint64,
+	elideRangeKey func(start, end []byte) bool,
 ) keyspan.Transformer {
 	return keyspan.TransformerFunc(func(cmp base.Compare, s keyspan.Span, dst *keyspan.Span) error {
 		elideInLastStripe := func(keys []keyspan.Key) []keyspan.Key {
@@ -511,6 +518,20 @@ func rangeKeyCompactionTransform(
 		dst.Keys = dst.Keys[:0]
 		i, j := len(snapshots)-1, 0
 		usedLen := 0
+		// Each sequence number at or above the history horizon is in its own
+		// snapshot stripe, which is never the last.
+		for historyHorizon != 0 && j < len(s.Keys) && s.Keys[j].SeqNum() >= historyHorizon {
+			start := j
+			for j < len(s.Keys) && s.Keys[j].SeqNum() == s.Keys[start].SeqNum() {
+				j++
+			}
+			keysDst := dst.Keys[usedLen:cap(dst.Keys)]
+			if err := rangekey.Coalesce(cmp, eq, s.Keys[start:j], &keysDst); err != nil {
+				return err
+			}
+			usedLen += len(keysDst)
+			dst.Keys = append(dst.Keys, keysDst...)
+		}
 		for i >= 0 {
 			start := j
 			for j < len(s.Keys) && !base.Visible(s.Keys[j].SeqNum(), snapshots[i], base.InternalKeySeqNumMax) {
@@ -592,6 +613,14 @@ type compaction struct {
 	bytesIterated uint64
 	// bytesWritten contains the number of bytes that have been written to outputs.
 	bytesWritten int64
+	// manual is non-nil if the compaction was picked on behalf of a manual
+	// compaction. It's used to observe cancellation of the manual compaction
+	// and to report the compaction's progress.
+	manual *manualCompactionState
+	// job is non-nil if the compaction is running a compaction job offloaded
+	// by another DB, in which case the job's snapshots and format major version
+	// are used in place of the DB's own.
+	job *CompactionJob
 
 	// The boundaries of the input data.
 	smallest InternalKey
@@ -647,6 +676,10 @@ type compaction struct {
 	// looking for an sstable which overlaps the bounds of the compaction at a
 	// lower level in the LSM during runCompaction.
 	allowedZeroSeqNum bool
+	// historyHorizon is the DB's history horizon when the compaction began
+	// running. Keys at or above it are never elided. See
+	// Options.Experimental.RetainHistory.
+	historyHorizon uint64
 
 	metrics map[int]*LevelMetrics
 }
@@ -1223,7 +1256,7 @@ func (c *compaction) newInputIter(
 			}
 			if rangeKeyIter := f.newRangeKeyIter(nil); rangeKeyIter != nil {
 				mi := &keyspan.MergingIter{}
-				mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIter)
+				mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.historyHorizon, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIter)
 				c.rangeKeyInterleaving.Init(c.comparer, iter, mi, nil /* hooks */, nil /* lowerBound */, nil /* upperBound */)
 				iter = &c.rangeKeyInterleaving
 			}
@@ -1250,7 +1283,7 @@ func (c *compaction) newInputIter(
 		var iter internalIterator = newMergingIter(c.logger, &c.stats, c.cmp, nil, iters...)
 		if len(rangeKeyIters) > 0 {
 			mi := &keyspan.MergingIter{}
-			mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIters...)
+			mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.historyHorizon, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIters...)
 			c.rangeKeyInterleaving.Init(c.comparer, iter, mi, nil /* hooks */, nil /* lowerBound */, nil /* upperBound */)
 			iter = &c.rangeKeyInterleaving
 		}
@@ -1522,7 +1555,7 @@ func (c *compaction) newInputIter(
 	pointKeyIter := newMergingIter(c.logger, &c.stats, c.cmp, nil, iters...)
 	if len(rangeKeyIters) > 0 {
 		mi := &keyspan.MergingIter{}
-		mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIters...)
+		mi.Init(c.cmp, rangeKeyCompactionTransform(c.equal, snapshots, c.historyHorizon, c.elideRangeKey), new(keyspan.MergingBuffers), rangeKeyIters...)
 		di := &keyspan.DefragmentingIter{}
 		di.Init(c.comparer, mi, keyspan.DefragmentInternal, keyspan.StaticDefragmentReducer, new(keyspan.DefragmentingBuffers))
 		c.rangeKeyInterleaving.Init(c.comparer, pointKeyIter, di, nil /* hooks */, nil /* lowerBound */, nil /* upperBound */)
@@ -1560,6 +1593,12 @@ type manualCompaction struct {
 	start       []byte
 	end         []byte
 	split       bool
+	// lowPriority manual compactions are only scheduled once no automatic
+	// compaction can be picked.
+	lowPriority bool
+	// state is shared by all the manual compactions that make up a single call
+	// to DB.Compact or DB.CompactWithOptions.
+	state *manualCompactionState
 }
 
 type readCompaction struct {
@@ -2067,6 +2106,7 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 		d.mu.mem.queue = d.mu.mem.queue[n:]
 		d.updateReadStateLocked(d.opts.DebugCheck)
 		d.updateTableStatsLocked(ve.NewFiles)
+		d.maybeTransitionSnapshotsToFileOnlyLocked()
 		if ingest {
 			d.mu.versions.metrics.Flush.AsIngestCount++
 			for _, l := range c.metrics {
@@ -2169,6 +2209,9 @@ func (d *DB) maybeScheduleCompactionPicker(
 		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
 		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
 	}
+	if age := d.opts.Experimental.PeriodicCompactionAge; age > 0 {
+		env.periodicCompactionCutoff = d.timeNow().Add(-age).Unix()
+	}
 
 	// Check for delete-only compactions first, because they're expected to be
 	// cheap and reduce future compaction work.
@@ -2178,8 +2221,24 @@ func (d *DB) maybeScheduleCompactionPicker(
 		!d.opts.DisableAutomaticCompactions {
 		v := d.mu.versions.currentVersion()
 		snapshots := d.mu.snapshots.toSlice()
-		inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, d.mu.compact.deletionHints, snapshots)
-		d.mu.compact.deletionHints = unresolvedHints
+		hints := d.mu.compact.deletionHints
+		var retainedHints []deleteCompactionHint
+		if horizon := d.mu.snapshots.historyHorizon; horizon != 0 {
+			// Hints whose tombstones are at or above the history horizon
+			// delete keys that remain readable through NewIterAt and GetAt.
+			// They're retained until the horizon advances beyond them.
+			snapshots = withHistoryHorizon(snapshots, horizon)
+			hints = hints[:0:0]
+			for _, h := range d.mu.compact.deletionHints {
+				if h.tombstoneLargestSeqNum >= horizon {
+					retainedHints = append(retainedHints, h)
+				} else {
+					hints = append(hints, h)
+				}
+			}
+		}
+		inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, hints, snapshots)
+		d.mu.compact.deletionHints = append(unresolvedHints, retainedHints...)
 
 		if len(inputs) > 0 {
 			c := newDeleteOnlyCompaction(d.opts, v, inputs)
@@ -2189,26 +2248,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 		}
 	}
 
-	for len(d.mu.compact.manual) > 0 && d.mu.compact.compactingCount < maxConcurrentCompactions {
-		manual := d.mu.compact.manual[0]
-		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
-		pc, retryLater := d.mu.versions.picker.pickManual(env, manual)
-		if pc != nil {
-			c := newCompaction(pc, d.opts)
-			d.mu.compact.manual = d.mu.compact.manual[1:]
-			d.mu.compact.compactingCount++
-			d.addInProgressCompaction(c)
-			go d.compact(c, manual.done)
-		} else if !retryLater {
-			// Noop
-			d.mu.compact.manual = d.mu.compact.manual[1:]
-			manual.done <- nil
-		} else {
-			// Inability to run head blocks later manual compactions.
-			manual.retries++
-			break
-		}
-	}
+	d.maybeScheduleManualCompactions(env, maxConcurrentCompactions, false /* lowPriority */)
 
 	for !d.opts.DisableAutomaticCompactions && d.mu.compact.compactingCount < maxConcurrentCompactions {
 		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
@@ -2217,6 +2257,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 			flushing:                 d.mu.compact.flushing || d.passedFlushThreshold(),
 			rescheduleReadCompaction: &d.mu.compact.rescheduleReadCompaction,
 		}
+		env.tombstoneDenseRead = &d.mu.compact.tombstoneDenseRead
 		pc := pickFunc(d.mu.versions.picker, env)
 		if pc == nil {
 			break
@@ -2226,6 +2267,46 @@ func (d *DB) maybeScheduleCompactionPicker(
 		d.addInProgressCompaction(c)
 		go d.compact(c, nil)
 	}
+
+	// Low-priority manual compactions are only scheduled if there are
+	// compaction slots remaining after picking automatic compactions.
+	d.maybeScheduleManualCompactions(env, maxConcurrentCompactions, true /* lowPriority */)
+}
+
+// maybeScheduleManualCompactions schedules queued manual compactions with the
+// given priority, in the order in which they were queued, while compaction
+// slots are available. A manual compaction that must be retried later blocks
+// the scheduling of subsequent manual compactions of the same priority.
+//
+// d.mu and the manifest lock must be held when calling this.
+func (d *DB) maybeScheduleManualCompactions(
+	env compactionEnv, maxConcurrentCompactions int, lowPriority bool,
+) {
+	for i := 0; i < len(d.mu.compact.manual) && d.mu.compact.compactingCount < maxConcurrentCompactions; {
+		manual := d.mu.compact.manual[i]
+		if manual.lowPriority != lowPriority {
+			i++
+			continue
+		}
+		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
+		pc, retryLater := d.mu.versions.picker.pickManual(env, manual)
+		if pc != nil {
+			c := newCompaction(pc, d.opts)
+			c.manual = manual.state
+			d.mu.compact.manual = append(d.mu.compact.manual[:i], d.mu.compact.manual[i+1:]...)
+			d.mu.compact.compactingCount++
+			d.addInProgressCompaction(c)
+			go d.compact(c, manual.done)
+		} else if !retryLater {
+			// Noop
+			d.mu.compact.manual = append(d.mu.compact.manual[:i], d.mu.compact.manual[i+1:]...)
+			manual.done <- nil
+		} else {
+			// Inability to run head blocks later manual compactions.
+			manual.retries++
+			break
+		}
+	}
 }
 
 // deleteCompactionHintType indicates whether the deleteCompactionHint was
@@ -2506,7 +2587,7 @@ func (d *DB) compact(c *compaction, errChannel chan error) {
 	pprof.Do(context.Background(), compactLabels, func(context.Context) {
 		d.mu.Lock()
 		defer d.mu.Unlock()
-		if err := d.compact1(c, errChannel); err != nil {
+		if err := d.compact1(c, errChannel); err != nil && !errors.Is(err, ErrCancelledCompaction) {
 			// TODO(peter): count consecutive compaction errors and backoff.
 			d.opts.EventListener.BackgroundError(err)
 		}
@@ -2535,7 +2616,14 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 	d.opts.EventListener.CompactionBegin(info)
 	startTime := d.timeNow()
 
-	ve, pendingOutputs, stats, err := d.runCompaction(jobID, c)
+	var ve *versionEdit
+	var pendingOutputs []physicalMeta
+	var stats compactStats
+	if d.canOffloadCompaction(c) {
+		ve, pendingOutputs, stats, err = d.runOffloadedCompaction(jobID, c)
+	} else {
+		ve, pendingOutputs, stats, err = d.runCompaction(jobID, c)
+	}
 
 	info.Duration = d.timeNow().Sub(startTime)
 	if err == nil {
@@ -2573,6 +2661,10 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 	d.mu.snapshots.cumulativePinnedCount += stats.cumulativePinnedKeys
 	d.mu.snapshots.cumulativePinnedSize += stats.cumulativePinnedSize
 
+	if c.manual != nil && err == nil {
+		c.manual.recordCompleted(c)
+	}
+
 	d.maybeUpdateDeleteCompactionHints(c)
 	d.removeInProgressCompaction(c, err != nil)
 	d.mu.versions.incrementCompactions(c.kind, c.extraLevels)
@@ -2687,6 +2779,13 @@ func (d *DB) runCompaction(
 
 	snapshots := d.mu.snapshots.toSlice()
 	formatVers := d.mu.formatVers.vers
+	c.historyHorizon = d.mu.snapshots.historyHorizon
+	if c.job != nil {
+		snapshots = c.job.Snapshots
+		formatVers = c.job.FormatMajorVersion
+		c.historyHorizon = c.job.HistoryHorizon
+	}
+	snapshots = withHistoryHorizon(snapshots, c.historyHorizon)
 
 	// Release the d.mu lock while doing I/O.
 	// Note the unusual order: Unlock and then Lock.
@@ -2698,9 +2797,31 @@ func (d *DB) runCompaction(
 		return nil, pendingOutputs, stats, err
 	}
 	c.allowedZeroSeqNum = c.allowZeroSeqNum()
+	var singleDeleteMisuse func(userKey []byte, reason string) error
+	if d.opts.Experimental.DetectSingleDeleteMisuse {
+		singleDeleteMisuse = func(userKey []byte, reason string) error {
+			levels := make([]int, 0, len(c.inputs))
+			for i := range c.inputs {
+				if c.inputs[i].level == -1 || !c.inputs[i].files.Empty() {
+					levels = append(levels, c.inputs[i].level)
+				}
+			}
+			d.opts.EventListener.SingleDeleteMisuse(SingleDeleteMisuseInfo{
+				JobID:  jobID,
+				Key:    append([]byte(nil), userKey...),
+				Levels: levels,
+				Reason: reason,
+			})
+			if d.opts.Experimental.FailOnSingleDeleteMisuse {
+				return errors.Mark(errors.Errorf("pebble: SingleDelete misuse of key %s: %s",
+					c.formatKey(userKey), errors.Safe(reason)), ErrSingleDeleteMisuse)
+			}
+			return nil
+		}
+	}
 	iter := newCompactionIter(c.cmp, c.equal, c.formatKey, d.merge, iiter, snapshots,
-		&c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
-		c.elideRangeTombstone, d.FormatMajorVersion())
+		c.historyHorizon, &c.rangeDelFrag, &c.rangeKeyFrag, c.allowedZeroSeqNum, c.elideTombstone,
+		c.elideRangeTombstone, formatVers, singleDeleteMisuse)
 
 	var (
 		createdFiles    []base.DiskFileNum
@@ -2752,15 +2873,17 @@ func (d *DB) runCompaction(
 	// The table is typically written at the maximum allowable format implied by
 	// the current format major version of the DB.
 	tableFormat := formatVers.MaxTableFormat()
-	if tableFormat > sstable.TableFormatPebblev3 {
-		// Since TableFormatPebblev3 does not currently subsume
-		// TableFormatPebblev2, this panic ensures that we have carefully thought
-		// through what we are doing before we introduce a format beyond
-		// TableFormatPebblev3.
-		panic("cannot handle table format beyond TableFormatPebblev3")
-	}
-	if tableFormat == sstable.TableFormatPebblev3 &&
+	if tableFormat > sstable.TableFormatPebblev4 {
+		// Since TableFormatPebblev3 and TableFormatPebblev4 do not currently
+		// subsume TableFormatPebblev2, this panic ensures that we have carefully
+		// thought through what we are doing before we introduce a format beyond
+		// TableFormatPebblev4.
+		panic("cannot handle table format beyond TableFormatPebblev4")
+	}
+	if tableFormat >= sstable.TableFormatPebblev3 &&
 		(d.opts.Experimental.EnableValueBlocks == nil || !d.opts.Experimental.EnableValueBlocks()) {
+		// TableFormatPebblev4 builds on TableFormatPebblev3, so neither can be
+		// written without value blocks.
 		tableFormat = sstable.TableFormatPebblev2
 	}
 	writerOpts := d.opts.MakeWriterOptions(c.outputLevel.level, tableFormat)
@@ -3113,6 +3236,16 @@ func (d *DB) runCompaction(
 	if splitL0Outputs {
 		outputSplitters = append(outputSplitters, newLimitFuncSplitter(&iter.frontiers, c.findL0Limit))
 	}
+	if partitioner := d.opts.Experimental.OutputPartitioner; partitioner != nil {
+		outputSplitters = append(outputSplitters, newLimitFuncSplitter(&iter.frontiers, func(start []byte) []byte {
+			limit := partitioner(start)
+			if limit != nil && c.cmp(limit, start) <= 0 {
+				panic(errors.AssertionFailedf("pebble: OutputPartitioner returned boundary %s not greater than %s",
+					c.formatKey(limit), c.formatKey(start)))
+			}
+			return limit
+		}))
+	}
 	splitter := &splitterGroup{cmp: c.cmp, splitters: outputSplitters}
 
 	// Each outer loop iteration produces one output file. An iteration that
@@ -3149,6 +3282,9 @@ func (d *DB) runCompaction(
 
 		// Each inner loop iteration processes one key from the input iterator.
 		for ; key != nil; key, val = iter.Next() {
+			if c.manual != nil && c.manual.cancelled.Load() {
+				return nil, pendingOutputs, stats, ErrCancelledCompaction
+			}
 			if split := splitter.shouldSplitBefore(key, tw); split == splitNow {
 				break
 			}
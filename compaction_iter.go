@@ -19,6 +19,11 @@ import (
 	"github.com/cockroachdb/pebble/internal/rangekey"
 )
 
+// ErrSingleDeleteMisuse marks the errors of flushes and compactions that
+// detect the misuse of a SingleDelete. See
+// Options.Experimental.FailOnSingleDeleteMisuse.
+var ErrSingleDeleteMisuse = errors.New("pebble: SingleDelete misuse")
+
 // compactionIter provides a forward-only iterator that encapsulates the logic
 // for collapsing entries during compaction. It wraps an internal iterator and
 // collapses entries that are no longer necessary because they are shadowed by
@@ -213,6 +218,11 @@ type compactionIter struct {
 	// numbers define the snapshot stripes (see the Snapshots description
 	// above). The sequence numbers are in ascending order.
 	snapshots []uint64
+	// historyHorizon, if non-zero, is the DB's history horizon (see
+	// Options.Experimental.RetainHistory), which must also be present in
+	// snapshots. Every key with a sequence number at or above the horizon is
+	// placed within its own snapshot stripe, so that it is never elided.
+	historyHorizon uint64
 	// frontiers holds a heap of user keys that affect compaction behavior when
 	// they're exceeded. Before a new key is returned, the compaction iterator
 	// advances the frontier, notifying any code that subscribed to be notified
@@ -240,6 +250,10 @@ type compactionIter struct {
 	// The on-disk format major version. This informs the types of keys that
 	// may be written to disk during a compaction.
 	formatVersion FormatMajorVersion
+	// singleDeleteMisuse, if non-nil, is invoked when a SINGLEDEL is found to
+	// delete a key that was set more than once or merged. A non-nil error
+	// fails the iterator. See Options.Experimental.DetectSingleDeleteMisuse.
+	singleDeleteMisuse func(userKey []byte, reason string) error
 }
 
 func newCompactionIter(
@@ -249,18 +263,21 @@ func newCompactionIter(
 	merge Merge,
 	iter internalIterator,
 	snapshots []uint64,
+	historyHorizon uint64,
 	rangeDelFrag *keyspan.Fragmenter,
 	rangeKeyFrag *keyspan.Fragmenter,
 	allowZeroSeqNum bool,
 	elideTombstone func(key []byte) bool,
 	elideRangeTombstone func(start, end []byte) bool,
 	formatVersion FormatMajorVersion,
+	singleDeleteMisuse func(userKey []byte, reason string) error,
 ) *compactionIter {
 	i := &compactionIter{
 		equal:               equal,
 		merge:               merge,
 		iter:                iter,
 		snapshots:           snapshots,
+		historyHorizon:      historyHorizon,
 		frontiers:           frontiers{cmp: cmp},
 		rangeDelFrag:        rangeDelFrag,
 		rangeKeyFrag:        rangeKeyFrag,
@@ -268,6 +285,7 @@ func newCompactionIter(
 		elideTombstone:      elideTombstone,
 		elideRangeTombstone: elideRangeTombstone,
 		formatVersion:       formatVersion,
+		singleDeleteMisuse:  singleDeleteMisuse,
 	}
 	i.rangeDelFrag.Cmp = cmp
 	i.rangeDelFrag.Format = formatKey
@@ -289,7 +307,7 @@ func (i *compactionIter) First() (*InternalKey, []byte) {
 		return nil, nil
 	}
 	if i.iterKey != nil {
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(i.iterKey.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(i.iterKey.SeqNum())
 	}
 	i.pos = iterPosNext
 	i.iterStripeChange = newStripeNewKey
@@ -386,7 +404,7 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 		}
 
 		switch i.iterKey.Kind() {
-		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 			if i.elideTombstone(i.iterKey.UserKey) {
 				if i.curSnapshotIdx == 0 {
 					// If we're at the last snapshot stripe and the tombstone
@@ -413,8 +431,14 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 			case InternalKeyKindSingleDelete:
 				if i.singleDeleteNext() {
 					return &i.key, i.value
+				} else if i.err != nil {
+					return nil, nil
 				}
 				continue
+
+			case InternalKeyKindDeleteSized:
+				i.deleteSizedNext()
+				return &i.key, i.value
 			}
 
 		case InternalKeyKindSet, InternalKeyKindSetWithDelete:
@@ -508,6 +532,21 @@ func snapshotIndex(seq uint64, snapshots []uint64) (int, uint64) {
 	return index, snapshots[index]
 }
 
+// snapshotIndex returns the index of the snapshot stripe containing seq, and
+// the sequence number of the snapshot bounding the stripe from above. Keys at
+// or above the history horizon are each assigned a stripe of their own,
+// following the stripes defined by the snapshots.
+func (i *compactionIter) snapshotIndex(seq uint64) (int, uint64) {
+	if i.historyHorizon == 0 || seq < i.historyHorizon {
+		return snapshotIndex(seq, i.snapshots)
+	}
+	index := len(i.snapshots) + 1 + int(seq-i.historyHorizon)
+	if seq >= InternalKeySeqNumMax {
+		return index, InternalKeySeqNumMax
+	}
+	return index, seq + 1
+}
+
 // skipInStripe skips over skippable keys in the same stripe and user key.
 func (i *compactionIter) skipInStripe() {
 	i.skip = true
@@ -583,14 +622,14 @@ func (i *compactionIter) nextInStripeHelper() stripeChangeType {
 			prevKey.Trailer = i.keyTrailer
 			panic(fmt.Sprintf("pebble: invariant violation: %s and %s out of order", key, prevKey))
 		}
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 		return newStripeNewKey
 	} else if !i.equal(i.key.UserKey, key.UserKey) {
-		i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+		i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 		return newStripeNewKey
 	}
 	origSnapshotIdx := i.curSnapshotIdx
-	i.curSnapshotIdx, i.curSnapshotSeqNum = snapshotIndex(key.SeqNum(), i.snapshots)
+	i.curSnapshotIdx, i.curSnapshotSeqNum = i.snapshotIndex(key.SeqNum())
 	switch key.Kind() {
 	case InternalKeyKindRangeDelete:
 		// Range tombstones need to be exposed by the compactionIter to the upper level
@@ -690,7 +729,8 @@ func (i *compactionIter) setNext() {
 			// stop looking and emit a SETWITHDEL. Subsequent keys are
 			// eligible for skipping.
 			if i.iterKey.Kind() == InternalKeyKindDelete ||
-				i.iterKey.Kind() == InternalKeyKindSingleDelete {
+				i.iterKey.Kind() == InternalKeyKindSingleDelete ||
+				i.iterKey.Kind() == InternalKeyKindDeleteSized {
 				i.key.SetKind(InternalKeyKindSetWithDelete)
 				i.skip = true
 				return
@@ -715,7 +755,7 @@ func (i *compactionIter) mergeNext(valueMerger ValueMerger) stripeChangeType {
 		}
 		key := i.iterKey
 		switch key.Kind() {
-		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 			// We've hit a deletion tombstone. Return everything up to this point and
 			// then skip entries until the next snapshot stripe. We change the kind
 			// of the result key to a Set so that it shadows keys in lower
@@ -802,15 +842,29 @@ func (i *compactionIter) singleDeleteNext() bool {
 
 		key := i.iterKey
 		switch key.Kind() {
-		case InternalKeyKindDelete, InternalKeyKindMerge, InternalKeyKindSetWithDelete:
-			// We've hit a Delete, Merge or SetWithDelete, transform the
-			// SingleDelete into a full Delete.
+		case InternalKeyKindDelete, InternalKeyKindMerge, InternalKeyKindSetWithDelete,
+			InternalKeyKindDeleteSized:
+			if key.Kind() == InternalKeyKindMerge && !i.checkSingleDelete("SINGLEDEL meets MERGE") {
+				return false
+			}
+			// We've hit a Delete, Merge, SetWithDelete or DeleteSized, transform
+			// the SingleDelete into a full Delete.
 			i.key.SetKind(InternalKeyKindDelete)
 			i.skip = true
 			return true
 
 		case InternalKeyKindSet:
-			i.nextInStripe()
+			// The SingleDelete and the Set annihilate. If the key was Set more
+			// than once, the next key in the stripe is an older Set (or Merge),
+			// which will now be resurrected.
+			if i.nextInStripe() == sameStripeSkippable {
+				switch i.iterKey.Kind() {
+				case InternalKeyKindSet, InternalKeyKindSetWithDelete, InternalKeyKindMerge:
+					if !i.checkSingleDelete("SINGLEDEL meets multiple SETs") {
+						return false
+					}
+				}
+			}
 			i.valid = false
 			return false
 
@@ -825,6 +879,52 @@ func (i *compactionIter) singleDeleteNext() bool {
 	}
 }
 
+// checkSingleDelete reports a misuse of the SINGLEDEL held in i.key, returning
+// false if the iterator must fail.
+func (i *compactionIter) checkSingleDelete(reason string) bool {
+	if i.singleDeleteMisuse == nil {
+		return true
+	}
+	if err := i.singleDeleteMisuse(i.key.UserKey, reason); err != nil {
+		i.err = err
+		i.valid = false
+		return false
+	}
+	return true
+}
+
+// deleteSizedNext processes a DELSIZED tombstone. DELSIZED tombstones have
+// the same semantics as DEL tombstones, but carry the size of the entry they
+// are expected to delete for the benefit of compaction heuristics (see
+// pointDeletionsBytesEstimate).
+func (i *compactionIter) deleteSizedNext() {
+	// Save the current key and value. The value is the size of the deleted
+	// entry, and must be copied before the iterator is advanced.
+	i.saveKey()
+	i.valueBuf = append(i.valueBuf[:0], i.iterValue...)
+	i.value = i.valueBuf
+	i.valid = true
+	i.skip = true
+
+	switch i.nextInStripe() {
+	case sameStripeSkippable:
+		// The tombstone shadows a key within this compaction. That key will be
+		// skipped and its space reclaimed, so the tombstone no longer deletes
+		// the entry it describes. Transform it into a DEL so that the size is
+		// not counted again when the tombstone is later compacted. Subsequent
+		// keys in the stripe are skipped by Next.
+		i.key.SetKind(InternalKeyKindDelete)
+		i.value = i.valueBuf[:0]
+	case sameStripeNonSkippable:
+		// Preserve i.skip so that the stripe's remaining point keys are
+		// skipped once the non-skippable key has been emitted.
+		i.pos = iterPosNext
+	default:
+		i.pos = iterPosNext
+		i.skip = false
+	}
+}
+
 func (i *compactionIter) saveKey() {
 	i.keyBuf = append(i.keyBuf[:0], i.iterKey.UserKey...)
 	i.key.UserKey = i.keyBuf
@@ -907,7 +1007,7 @@ func (i *compactionIter) emitRangeDelChunk(fragmented keyspan.Span) {
 	currentIdx := -1
 	keys := fragmented.Keys[:0]
 	for _, k := range fragmented.Keys {
-		idx, _ := snapshotIndex(k.SeqNum(), i.snapshots)
+		idx, _ := i.snapshotIndex(k.SeqNum())
 		if currentIdx == idx {
 			continue
 		}
@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 	"github.com/cockroachdb/pebble/internal/rangekey"
@@ -80,8 +81,11 @@ func TestCompactionIter(t *testing.T) {
 	var rangeKeys []keyspan.Span
 	var vals [][]byte
 	var snapshots []uint64
+	var historyHorizon uint64
 	var elideTombstones bool
 	var allowZeroSeqnum bool
+	var singleDeleteMisuse string
+	var misuses []string
 	var interleavingIter *keyspan.InterleavingIter
 
 	// The input to the data-driven test is dependent on the format major
@@ -121,7 +125,8 @@ func TestCompactionIter(t *testing.T) {
 			DefaultComparer.FormatKey,
 			merge,
 			iter,
-			snapshots,
+			withHistoryHorizon(snapshots, historyHorizon),
+			historyHorizon,
 			&keyspan.Fragmenter{},
 			&keyspan.Fragmenter{},
 			allowZeroSeqnum,
@@ -132,6 +137,15 @@ func TestCompactionIter(t *testing.T) {
 				return elideTombstones
 			},
 			formatVersion,
+			func(userKey []byte, reason string) error {
+				switch singleDeleteMisuse {
+				case "report":
+					misuses = append(misuses, fmt.Sprintf("misuse: %s: %s", userKey, reason))
+				case "fail":
+					return errors.Newf("%s: %s", userKey, reason)
+				}
+				return nil
+			},
 		)
 	}
 
@@ -163,8 +177,10 @@ func TestCompactionIter(t *testing.T) {
 
 			case "iter":
 				snapshots = snapshots[:0]
+				historyHorizon = 0
 				elideTombstones = false
 				allowZeroSeqnum = false
+				singleDeleteMisuse = ""
 				printSnapshotPinned := false
 				for _, arg := range d.CmdArgs {
 					switch arg.Key {
@@ -176,6 +192,12 @@ func TestCompactionIter(t *testing.T) {
 							}
 							snapshots = append(snapshots, uint64(seqNum))
 						}
+					case "history-horizon":
+						var err error
+						historyHorizon, err = strconv.ParseUint(arg.Vals[0], 10, 64)
+						if err != nil {
+							return err.Error()
+						}
 					case "elide-tombstones":
 						var err error
 						elideTombstones, err = strconv.ParseBool(arg.Vals[0])
@@ -190,6 +212,8 @@ func TestCompactionIter(t *testing.T) {
 						}
 					case "print-snapshot-pinned":
 						printSnapshotPinned = true
+					case "single-delete-misuse":
+						singleDeleteMisuse = arg.Vals[0]
 					default:
 						return fmt.Sprintf("%s: unknown arg: %s", d.Cmd, arg.Key)
 					}
@@ -235,6 +259,10 @@ func TestCompactionIter(t *testing.T) {
 					default:
 						return fmt.Sprintf("unknown op: %s", parts[0])
 					}
+					for _, m := range misuses {
+						fmt.Fprintf(&b, "%s\n", m)
+					}
+					misuses = misuses[:0]
 					if iter.Valid() {
 						snapshotPinned := ""
 						if printSnapshotPinned {
@@ -0,0 +1,425 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+// CompactionJobRunner runs compactions offloaded by a DB, typically by sending
+// them to a CompactionWorker in a separate process that has access to the same
+// shared storage. See Options.Experimental.CompactionJobRunner.
+type CompactionJobRunner interface {
+	// RunCompactionJob runs the compaction job, returning the metadata of its
+	// output sstables, which must have been written to shared storage.
+	RunCompactionJob(ctx context.Context, job *CompactionJob) (*CompactionJobResult, error)
+	// ReleaseCompactionJob is called once the DB has attached the outputs of a
+	// successful compaction job to its object provider, or has failed to do
+	// so. The runner may then drop its own references to the outputs.
+	ReleaseCompactionJob(result *CompactionJobResult) error
+}
+
+// CompactionJob describes a compaction of sstables on shared storage that a DB
+// has offloaded to a CompactionWorker. A CompactionJob is self-contained: it
+// holds the compaction's inputs and all of the owning DB's state that the
+// compaction must observe, and it can be serialized using Encode.
+type CompactionJob struct {
+	// Comparer and Merger are the names of the owning DB's Comparer and
+	// Merger. The worker must be configured with the same ones.
+	Comparer string
+	Merger   string
+	// FormatMajorVersion is the owning DB's format major version. It
+	// determines the format of the output sstables.
+	FormatMajorVersion FormatMajorVersion
+	// Inputs holds the compaction's input sstables in its start level and in
+	// its output level, in that order.
+	Inputs []CompactionJobLevel
+	// Smallest and Largest are the bounds of the compaction's inputs.
+	Smallest, Largest InternalKey
+	// Snapshots are the sequence numbers of the owning DB's open snapshots,
+	// in increasing order.
+	Snapshots []uint64
+	// HistoryHorizon is the owning DB's history horizon, if it retains history
+	// (see Options.Experimental.RetainHistory). Keys at or above it must not be
+	// elided.
+	HistoryHorizon uint64
+	// InUseKeyRanges are the user key ranges of the sstables below the output
+	// level that overlap the compaction. Keys and tombstones within these
+	// ranges are never elided.
+	InUseKeyRanges []CompactionJobKeyRange
+	// Grandparents are the sstables in the level below the output level that
+	// overlap the compaction, used to limit the overlap of each output with
+	// the level below it. Their backings are not set.
+	Grandparents []CompactionJobTable
+	// MaxOutputFileSize is the target size of output sstables, and
+	// MaxOverlapBytes the maximum number of bytes of grandparents that an
+	// output may overlap.
+	MaxOutputFileSize uint64
+	MaxOverlapBytes   uint64
+}
+
+// CompactionJobLevel holds the input sstables of a compaction job in one
+// level.
+type CompactionJobLevel struct {
+	Level  int
+	Tables []CompactionJobTable
+}
+
+// CompactionJobKeyRange is a range of user keys, inclusive of both its start
+// and end keys.
+type CompactionJobKeyRange struct {
+	Start, End []byte
+}
+
+// CompactionJobTable describes an sstable on shared storage that is an input
+// or output of a compaction job.
+type CompactionJobTable struct {
+	// FileNum is the file number of the sstable in the DB or worker that
+	// described it.
+	FileNum FileNum
+	// Backing holds the information needed to attach the sstable's shared
+	// object to another objstorage.Provider.
+	Backing objstorage.SharedObjectBacking
+	// Size is the size of the sstable, in bytes.
+	Size uint64
+	// SmallestSeqNum and LargestSeqNum bound the sequence numbers of the
+	// sstable's keys.
+	SmallestSeqNum uint64
+	LargestSeqNum  uint64
+	// The bounds of the sstable's point keys (including range deletions), if
+	// HasPointKeys, and of its range keys, if HasRangeKeys.
+	HasPointKeys     bool
+	SmallestPointKey InternalKey
+	LargestPointKey  InternalKey
+	HasRangeKeys     bool
+	SmallestRangeKey InternalKey
+	LargestRangeKey  InternalKey
+}
+
+// CompactionJobResult describes the outputs of a compaction job.
+type CompactionJobResult struct {
+	// ID identifies the job within the worker that ran it.
+	ID uint64
+	// Outputs are the output sstables, in key order.
+	Outputs []CompactionJobTable
+	// BytesRead is the number of bytes read from the inputs.
+	BytesRead uint64
+	// PinnedKeys and PinnedSize are the count and size of the keys written to
+	// the outputs only because an open snapshot prevented their elision.
+	PinnedKeys uint64
+	PinnedSize uint64
+}
+
+// Encode encodes the compaction job, so that it may be sent to a worker in
+// another process.
+func (j *CompactionJob) Encode() ([]byte, error) {
+	return json.Marshal(j)
+}
+
+// DecodeCompactionJob decodes a compaction job encoded by
+// CompactionJob.Encode.
+func DecodeCompactionJob(buf []byte) (*CompactionJob, error) {
+	j := &CompactionJob{}
+	if err := json.Unmarshal(buf, j); err != nil {
+		return nil, errors.Wrap(err, "pebble: decoding compaction job")
+	}
+	return j, nil
+}
+
+// Encode encodes the compaction job result, so that it may be sent back to the
+// DB that created the job.
+func (r *CompactionJobResult) Encode() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// DecodeCompactionJobResult decodes a compaction job result encoded by
+// CompactionJobResult.Encode.
+func DecodeCompactionJobResult(buf []byte) (*CompactionJobResult, error) {
+	r := &CompactionJobResult{}
+	if err := json.Unmarshal(buf, r); err != nil {
+		return nil, errors.Wrap(err, "pebble: decoding compaction job result")
+	}
+	return r, nil
+}
+
+func makeCompactionJobTable(
+	f *fileMetadata, backing objstorage.SharedObjectBacking,
+) CompactionJobTable {
+	return CompactionJobTable{
+		FileNum:          f.FileNum,
+		Backing:          backing,
+		Size:             f.Size,
+		SmallestSeqNum:   f.SmallestSeqNum,
+		LargestSeqNum:    f.LargestSeqNum,
+		HasPointKeys:     f.HasPointKeys,
+		SmallestPointKey: f.SmallestPointKey,
+		LargestPointKey:  f.LargestPointKey,
+		HasRangeKeys:     f.HasRangeKeys,
+		SmallestRangeKey: f.SmallestRangeKey,
+		LargestRangeKey:  f.LargestRangeKey,
+	}
+}
+
+// fileMetadata constructs the metadata of a physical sstable with the
+// provided file number and the described bounds.
+func (t *CompactionJobTable) fileMetadata(cmp Compare, fileNum FileNum) *fileMetadata {
+	m := &fileMetadata{
+		FileNum:        fileNum,
+		Size:           t.Size,
+		SmallestSeqNum: t.SmallestSeqNum,
+		LargestSeqNum:  t.LargestSeqNum,
+	}
+	if t.HasPointKeys {
+		m.ExtendPointKeyBounds(cmp, t.SmallestPointKey, t.LargestPointKey)
+	}
+	if t.HasRangeKeys {
+		m.ExtendRangeKeyBounds(cmp, t.SmallestRangeKey, t.LargestRangeKey)
+	}
+	m.InitPhysicalBacking()
+	return m
+}
+
+// canOffloadCompaction returns true if the compaction may be run by the
+// configured CompactionJobRunner. Only compactions from L1 and below, of
+// physical sstables on shared storage, are offloaded; flushes, L0 compactions
+// (which require L0 sublevels), multi-level compactions and compactions
+// without any output (e.g. moves) are always run locally.
+func (d *DB) canOffloadCompaction(c *compaction) bool {
+	if d.opts.Experimental.CompactionJobRunner == nil {
+		return false
+	}
+	switch c.kind {
+	case compactionKindDefault, compactionKindRead, compactionKindRewrite,
+		compactionKindElisionOnly, compactionKindTombstoneDensity:
+	default:
+		return false
+	}
+	if c.startLevel.level == 0 || len(c.extraLevels) > 0 {
+		return false
+	}
+	for _, cl := range c.inputs {
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			if f.Virtual {
+				return false
+			}
+			meta, err := d.objProvider.Lookup(fileTypeTable, f.FileBacking.DiskFileNum)
+			if err != nil || !meta.IsShared() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// makeCompactionJobLocked describes the compaction as a compaction job. The
+// returned backing handles keep the inputs' shared objects alive, and must be
+// closed once the job completes.
+//
+// d.mu must be held when calling this.
+func (d *DB) makeCompactionJobLocked(
+	c *compaction,
+) (*CompactionJob, []objstorage.SharedObjectBackingHandle, error) {
+	job := &CompactionJob{
+		Comparer:           d.opts.Comparer.Name,
+		Merger:             d.opts.Merger.Name,
+		FormatMajorVersion: d.mu.formatVers.vers,
+		Inputs:             make([]CompactionJobLevel, len(c.inputs)),
+		Smallest:           c.smallest,
+		Largest:            c.largest,
+		Snapshots:          d.mu.snapshots.toSlice(),
+		HistoryHorizon:     d.mu.snapshots.historyHorizon,
+		MaxOutputFileSize:  c.maxOutputFileSize,
+		MaxOverlapBytes:    c.maxOverlapBytes,
+	}
+	var handles []objstorage.SharedObjectBackingHandle
+	for i, cl := range c.inputs {
+		job.Inputs[i].Level = cl.level
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			meta, err := d.objProvider.Lookup(fileTypeTable, f.FileBacking.DiskFileNum)
+			if err != nil {
+				return nil, handles, err
+			}
+			h, err := d.objProvider.SharedObjectBacking(&meta)
+			if err != nil {
+				return nil, handles, err
+			}
+			handles = append(handles, h)
+			backing, err := h.Get()
+			if err != nil {
+				return nil, handles, err
+			}
+			job.Inputs[i].Tables = append(job.Inputs[i].Tables, makeCompactionJobTable(f, backing))
+		}
+	}
+	for _, r := range c.inuseKeyRanges {
+		job.InUseKeyRanges = append(job.InUseKeyRanges, CompactionJobKeyRange{Start: r.Start, End: r.End})
+	}
+	iter := c.grandparents.Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		job.Grandparents = append(job.Grandparents, makeCompactionJobTable(f, nil))
+	}
+	return job, handles, nil
+}
+
+// runOffloadedCompaction runs a compaction through the configured
+// CompactionJobRunner, attaching the job's outputs to the DB's object provider
+// and returning the version edit that installs them in place of the inputs.
+//
+// d.mu must be held when calling this, but the mutex is dropped while the job
+// runs.
+func (d *DB) runOffloadedCompaction(
+	jobID int, c *compaction,
+) (ve *versionEdit, pendingOutputs []physicalMeta, stats compactStats, retErr error) {
+	runner := d.opts.Experimental.CompactionJobRunner
+	job, handles, err := d.makeCompactionJobLocked(c)
+	defer func() {
+		for _, h := range handles {
+			h.Close()
+		}
+	}()
+	if err != nil {
+		return nil, nil, stats, err
+	}
+
+	// The job is aborted if the manual compaction it's performed on behalf of
+	// is cancelled, or the DB is closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var manualCancelled <-chan struct{}
+	if c.manual != nil {
+		manualCancelled = c.manual.cancelledCh
+	}
+	go func() {
+		select {
+		case <-manualCancelled:
+		case <-d.closedCh:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	d.mu.Unlock()
+	res, err := runner.RunCompactionJob(ctx, job)
+	d.mu.Lock()
+	if err != nil {
+		if c.manual != nil && c.manual.cancelled.Load() {
+			return nil, nil, stats, ErrCancelledCompaction
+		}
+		return nil, nil, stats, errors.Wrapf(err, "pebble: offloaded compaction job %d", errors.Safe(jobID))
+	}
+	if c.manual != nil && c.manual.cancelled.Load() {
+		return nil, nil, stats, firstError(ErrCancelledCompaction, runner.ReleaseCompactionJob(res))
+	}
+
+	ve = &versionEdit{
+		DeletedFiles: map[deletedFileEntry]*fileMetadata{},
+	}
+	objs := make([]objstorage.SharedObjectToAttach, len(res.Outputs))
+	for i := range res.Outputs {
+		fileNum := d.mu.versions.getNextFileNum()
+		meta := res.Outputs[i].fileMetadata(d.cmp, fileNum)
+		meta.CreationTime = d.timeNow().Unix()
+		pendingOutputs = append(pendingOutputs, meta.PhysicalMeta())
+		ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: c.outputLevel.level, Meta: meta})
+		objs[i] = objstorage.SharedObjectToAttach{
+			FileNum:  fileNum.DiskFileNum(),
+			FileType: fileTypeTable,
+			Backing:  res.Outputs[i].Backing,
+		}
+	}
+
+	// Attach the outputs while not holding d.mu, since it performs I/O. Once
+	// the outputs are attached (or failed to attach), the runner no longer
+	// needs to keep them alive.
+	d.mu.Unlock()
+	_, err = d.objProvider.AttachSharedObjects(objs)
+	if releaseErr := runner.ReleaseCompactionJob(res); releaseErr != nil {
+		d.opts.Logger.Infof("[JOB %d] failed to release offloaded compaction outputs: %s", jobID, releaseErr)
+	}
+	d.mu.Lock()
+	if err != nil {
+		return nil, nil, stats, err
+	}
+
+	outputMetrics := &LevelMetrics{
+		BytesIn:   c.startLevel.files.SizeSum(),
+		BytesRead: c.outputLevel.files.SizeSum(),
+	}
+	outputMetrics.BytesRead += outputMetrics.BytesIn
+	c.metrics = map[int]*LevelMetrics{
+		c.outputLevel.level: outputMetrics,
+	}
+	if c.metrics[c.startLevel.level] == nil {
+		c.metrics[c.startLevel.level] = &LevelMetrics{}
+	}
+	for _, nf := range ve.NewFiles {
+		outputMetrics.TablesCompacted++
+		outputMetrics.BytesCompacted += nf.Meta.Size
+		outputMetrics.Size += int64(nf.Meta.Size)
+		outputMetrics.NumFiles++
+		c.bytesWritten += int64(nf.Meta.Size)
+	}
+	// The compaction's bytes written are subtracted from the in-progress
+	// compaction bytes once the compaction completes.
+	d.mu.versions.incrementCompactionBytes(c.bytesWritten)
+	c.bytesIterated = res.BytesRead
+	for _, cl := range c.inputs {
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			c.metrics[cl.level].NumFiles--
+			c.metrics[cl.level].Size -= int64(f.Size)
+			ve.DeletedFiles[deletedFileEntry{
+				Level:   cl.level,
+				FileNum: f.FileNum,
+			}] = f
+		}
+	}
+	stats.cumulativePinnedKeys = res.PinnedKeys
+	stats.cumulativePinnedSize = res.PinnedSize
+	return ve, pendingOutputs, stats, nil
+}
+
+// newCompactionJobCompaction constructs the compaction that runs a compaction
+// job within a CompactionWorker, over the provided input and grandparent
+// sstables.
+func newCompactionJobCompaction(
+	opts *Options, job *CompactionJob, inputs [2]manifest.LevelSlice, grandparents manifest.LevelSlice,
+) *compaction {
+	c := &compaction{
+		kind:      compactionKindDefault,
+		cmp:       opts.Comparer.Compare,
+		equal:     opts.equal(),
+		comparer:  opts.Comparer,
+		formatKey: opts.Comparer.FormatKey,
+		inputs: []compactionLevel{
+			{level: job.Inputs[0].Level, files: inputs[0]},
+			{level: job.Inputs[1].Level, files: inputs[1]},
+		},
+		smallest:          job.Smallest,
+		largest:           job.Largest,
+		logger:            opts.Logger,
+		maxOutputFileSize: job.MaxOutputFileSize,
+		maxOverlapBytes:   job.MaxOverlapBytes,
+		grandparents:      grandparents,
+		job:               job,
+	}
+	c.startLevel = &c.inputs[0]
+	c.outputLevel = &c.inputs[1]
+	for _, r := range job.InUseKeyRanges {
+		c.inuseKeyRanges = append(c.inuseKeyRanges, manifest.UserKeyRange{Start: r.Start, End: r.End})
+	}
+	if len(c.inuseKeyRanges) > 0 {
+		c.inuseEntireRange = c.cmp(c.inuseKeyRanges[0].Start, c.smallest.UserKey) <= 0 &&
+			c.cmp(c.inuseKeyRanges[0].End, c.largest.UserKey) >= 0
+	}
+	return c
+}
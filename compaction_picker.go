@@ -25,6 +25,13 @@ type compactionEnv struct {
 	earliestSnapshotSeqNum  uint64
 	inProgressCompactions   []compactionInfo
 	readCompactionEnv       readCompactionEnv
+	// periodicCompactionCutoff is the creation time, in seconds since the Unix
+	// epoch, before which sstables are eligible for a periodic rewrite
+	// compaction. Zero disables periodic compactions.
+	periodicCompactionCutoff int64
+	// tombstoneDenseRead, if non-nil, holds reads' requests for a tombstone
+	// density compaction.
+	tombstoneDenseRead *tombstoneDenseRead
 }
 
 type compactionPicker interface {
@@ -1273,6 +1280,10 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		return pc
 	}
 
+	if pc := p.pickTombstoneDensityCompaction(env); pc != nil {
+		return pc
+	}
+
 	// NB: This should only be run if a read compaction wasn't
 	// scheduled.
 	//
@@ -1310,6 +1321,16 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		}
 	}
 
+	// Finally, look for files that have outlived
+	// Options.Experimental.PeriodicCompactionAge. Such files are rewritten in
+	// place just like files marked for compaction, which drops any obsolete
+	// keys they contain and upgrades them to the current table format.
+	if env.periodicCompactionCutoff > 0 {
+		if pc := p.pickPeriodicCompaction(env); pc != nil {
+			return pc
+		}
+	}
+
 	return nil
 }
 
@@ -1418,6 +1439,47 @@ func markedMergeHelper(f *fileMetadata, dst interface{}) (interface{}, bool) {
 	return dst, true
 }
 
+// creationTimeAnnotator implements the manifest.Annotator interface,
+// annotating B-Tree nodes with the *fileMetadata of the file with the oldest
+// creation time within the subtree. Files without a recorded creation time are
+// ignored. If multiple files have the same creation time, it chooses whichever
+// file has the lowest LargestSeqNum.
+type creationTimeAnnotator struct{}
+
+var _ manifest.Annotator = creationTimeAnnotator{}
+
+func (a creationTimeAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a creationTimeAnnotator) Accumulate(f *fileMetadata, dst interface{}) (interface{}, bool) {
+	if f.CreationTime == 0 {
+		return dst, true
+	}
+	return oldestMergeHelper(f, dst)
+}
+
+func (a creationTimeAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	accum, _ = oldestMergeHelper(v.(*fileMetadata), accum)
+	return accum
+}
+
+// REQUIRES: f is non-nil, and f.CreationTime is non-zero.
+func oldestMergeHelper(f *fileMetadata, dst interface{}) (interface{}, bool) {
+	if dst == nil {
+		return f, true
+	}
+	dstV := dst.(*fileMetadata)
+	if dstV.CreationTime > f.CreationTime ||
+		(dstV.CreationTime == f.CreationTime && dstV.LargestSeqNum > f.LargestSeqNum) {
+		return f, true
+	}
+	return dst, true
+}
+
 // pickElisionOnlyCompaction looks for compactions of sstables in the
 // bottommost level containing obsolete records that may now be dropped.
 func (p *compactionPickerByScore) pickElisionOnlyCompaction(
@@ -1468,55 +1530,87 @@ func (p *compactionPickerByScore) pickRewriteCompaction(env compactionEnv) (pc *
 			// Try the next level.
 			continue
 		}
-		candidate := v.(*fileMetadata)
-		if candidate.IsCompacting() {
+		if pc := p.pickRewriteCompactionOfFile(env, l, v.(*fileMetadata)); pc != nil {
+			return pc
+		}
+	}
+	return nil
+}
+
+// pickPeriodicCompaction attempts to construct a rewrite compaction of the
+// oldest file created before env.periodicCompactionCutoff, preferring files in
+// lower levels of the LSM.
+func (p *compactionPickerByScore) pickPeriodicCompaction(env compactionEnv) (pc *pickedCompaction) {
+	for l := numLevels - 1; l >= 0; l-- {
+		v := p.vers.Levels[l].Annotation(creationTimeAnnotator{})
+		if v == nil {
 			// Try the next level.
 			continue
 		}
-		lf := p.vers.Levels[l].Find(p.opts.Comparer.Compare, candidate)
-		if lf == nil {
-			panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, numLevels-1))
+		candidate := v.(*fileMetadata)
+		if candidate.CreationTime >= env.periodicCompactionCutoff {
+			// The oldest file in the level is young enough; try the next level.
+			continue
+		}
+		if pc := p.pickRewriteCompactionOfFile(env, l, candidate); pc != nil {
+			return pc
 		}
+	}
+	return nil
+}
 
-		inputs := lf.Slice()
-		// L0 files generated by a flush have never been split such that
-		// adjacent files can contain the same user key. So we do not need to
-		// rewrite an atomic compaction unit for L0. Note that there is nothing
-		// preventing two different flushes from producing files that are
-		// non-overlapping from an InternalKey perspective, but span the same
-		// user key. However, such files cannot be in the same L0 sublevel,
-		// since each sublevel requires non-overlapping user keys (unlike other
-		// levels).
-		if l > 0 {
-			// Find this file's atomic compaction unit. This is only relevant
-			// for levels L1+.
-			var isCompacting bool
-			inputs, isCompacting = expandToAtomicUnit(
-				p.opts.Comparer.Compare,
-				inputs,
-				false, /* disableIsCompacting */
-			)
-			if isCompacting {
-				// Try the next level.
-				continue
-			}
+// pickRewriteCompactionOfFile constructs a compaction that rewrites the
+// candidate file within level l in place, pulling in adjacent files in the
+// file's atomic compaction unit if necessary. It returns nil if the candidate
+// or its atomic compaction unit are already compacting.
+func (p *compactionPickerByScore) pickRewriteCompactionOfFile(
+	env compactionEnv, l int, candidate *fileMetadata,
+) (pc *pickedCompaction) {
+	if candidate.IsCompacting() {
+		return nil
+	}
+	lf := p.vers.Levels[l].Find(p.opts.Comparer.Compare, candidate)
+	if lf == nil {
+		panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, l))
+	}
+
+	inputs := lf.Slice()
+	// L0 files generated by a flush have never been split such that
+	// adjacent files can contain the same user key. So we do not need to
+	// rewrite an atomic compaction unit for L0. Note that there is nothing
+	// preventing two different flushes from producing files that are
+	// non-overlapping from an InternalKey perspective, but span the same
+	// user key. However, such files cannot be in the same L0 sublevel,
+	// since each sublevel requires non-overlapping user keys (unlike other
+	// levels).
+	if l > 0 {
+		// Find this file's atomic compaction unit. This is only relevant
+		// for levels L1+.
+		var isCompacting bool
+		inputs, isCompacting = expandToAtomicUnit(
+			p.opts.Comparer.Compare,
+			inputs,
+			false, /* disableIsCompacting */
+		)
+		if isCompacting {
+			return nil
 		}
+	}
 
-		pc = newPickedCompaction(p.opts, p.vers, l, l, p.baseLevel)
-		pc.outputLevel.level = l
-		pc.kind = compactionKindRewrite
-		pc.startLevel.files = inputs
-		pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
+	pc = newPickedCompaction(p.opts, p.vers, l, l, p.baseLevel)
+	pc.outputLevel.level = l
+	pc.kind = compactionKindRewrite
+	pc.startLevel.files = inputs
+	pc.smallest, pc.largest = manifest.KeyRange(pc.cmp, pc.startLevel.files.Iter())
 
-		// Fail-safe to protect against compacting the same sstable concurrently.
-		if !inputRangeAlreadyCompacting(env, pc) {
-			if pc.startLevel.level == 0 {
-				pc.l0SublevelInfo = generateSublevelInfo(pc.cmp, pc.startLevel.files)
-			}
-			return pc
-		}
+	// Fail-safe to protect against compacting the same sstable concurrently.
+	if inputRangeAlreadyCompacting(env, pc) {
+		return nil
 	}
-	return nil
+	if pc.startLevel.level == 0 {
+		pc.l0SublevelInfo = generateSublevelInfo(pc.cmp, pc.startLevel.files)
+	}
+	return pc
 }
 
 // pickAutoLPositive picks an automatic compaction for the candidate
@@ -1780,6 +1874,107 @@ func pickReadTriggeredCompactionHelper(
 	return pc
 }
 
+// tombstoneDenseRead records requests for a tombstone density compaction,
+// made by iterators that skipped over many keys. See
+// Options.Experimental.TombstoneDenseBlockRatio.
+type tombstoneDenseRead struct {
+	// pending is true if a tombstone density compaction has been requested
+	// since the compaction picker last considered one.
+	pending bool
+	// [lower, upper) is the union of the bounds of the requesting iterators.
+	// A nil bound is unbounded.
+	lower, upper []byte
+}
+
+// add adds a request for a tombstone density compaction of tables within the
+// provided bounds. The bounds are copied.
+func (r *tombstoneDenseRead) add(cmp Compare, lower, upper []byte) {
+	if !r.pending {
+		r.pending = true
+		r.lower, r.upper = cloneBound(lower), cloneBound(upper)
+		return
+	}
+	if r.lower != nil && (lower == nil || cmp(lower, r.lower) < 0) {
+		r.lower = cloneBound(lower)
+	}
+	if r.upper != nil && (upper == nil || cmp(upper, r.upper) > 0) {
+		r.upper = cloneBound(upper)
+	}
+}
+
+// cloneBound returns a copy of the provided iterator bound, preserving nil.
+func cloneBound(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// pickTombstoneDensityCompaction picks a compaction of the table with the
+// highest fraction of tombstone-dense data blocks that overlaps the bounds of
+// the reads requesting a tombstone density compaction, compacting it into the
+// next level. Tables in L0 are left to L0 compactions, and tables in the
+// bottommost level are left to elision-only compactions.
+//
+// The pending request is consumed whether or not a compaction is picked;
+// subsequent reads that skip over many keys will request another.
+func (p *compactionPickerByScore) pickTombstoneDensityCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	r := env.tombstoneDenseRead
+	if r == nil || !r.pending {
+		return nil
+	}
+	lower, upper := r.lower, r.upper
+	*r = tombstoneDenseRead{}
+
+	cmp := p.opts.Comparer.Compare
+	threshold := p.opts.Experimental.TombstoneDenseCompactionThreshold
+	var candidate *fileMetadata
+	var candidateLevel int
+	for l := p.baseLevel; l < numLevels-1; l++ {
+		// Seek to the first file overlapping the bounds, so that the cost of
+		// picking scales with the number of files within them.
+		iter := p.vers.Levels[l].Iter()
+		f := iter.First()
+		if lower != nil {
+			f = iter.SeekGE(cmp, lower)
+		}
+		for ; f != nil; f = iter.Next() {
+			if upper != nil && cmp(f.Smallest.UserKey, upper) >= 0 {
+				break
+			}
+			if f.IsCompacting() || !f.StatsValid() {
+				continue
+			}
+			ratio := f.Stats.TombstoneDenseBlocksRatio
+			if ratio < threshold || (candidate != nil && ratio <= candidate.Stats.TombstoneDenseBlocksRatio) {
+				continue
+			}
+			candidate, candidateLevel = f, l
+		}
+	}
+	if candidate == nil {
+		return nil
+	}
+
+	lf := p.vers.Levels[candidateLevel].Find(cmp, candidate)
+	if lf == nil {
+		panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, candidateLevel))
+	}
+	pc = newPickedCompaction(p.opts, p.vers, candidateLevel,
+		defaultOutputLevel(candidateLevel, p.baseLevel), p.baseLevel)
+	pc.startLevel.files = lf.Slice()
+	if !pc.setupInputs(p.opts, p.diskAvailBytes(), pc.startLevel) {
+		return nil
+	}
+	if inputRangeAlreadyCompacting(env, pc) {
+		return nil
+	}
+	pc.kind = compactionKindTombstoneDensity
+	return pc
+}
+
 func (p *compactionPickerByScore) forceBaseLevel1() {
 	p.baseLevel = 1
 }
@@ -32,6 +32,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/objstorage/shared"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
@@ -840,6 +841,7 @@ func TestCompactionTransform(t *testing.T) {
 		switch td.Cmd {
 		case "transform":
 			var snapshots []uint64
+			var historyHorizon uint64
 			var keyRanges []manifest.UserKeyRange
 			disableElision := false
 			for i := range td.CmdArgs {
@@ -864,6 +866,12 @@ func TestCompactionTransform(t *testing.T) {
 					}
 				case "disable-elision":
 					disableElision = true
+				case "history-horizon":
+					var err error
+					historyHorizon, err = strconv.ParseUint(td.CmdArgs[i].Vals[0], 10, 64)
+					if err != nil {
+						return err.Error()
+					}
 				}
 			}
 			span := keyspan.ParseSpan(td.Input)
@@ -881,7 +889,8 @@ func TestCompactionTransform(t *testing.T) {
 				disableSpanElision: disableElision,
 				inuseKeyRanges:     keyRanges,
 			}
-			transformer := rangeKeyCompactionTransform(base.DefaultComparer.Equal, snapshots, c.elideRangeTombstone)
+			transformer := rangeKeyCompactionTransform(base.DefaultComparer.Equal,
+				withHistoryHorizon(snapshots, historyHorizon), historyHorizon, c.elideRangeTombstone)
 			if err := transformer.Transform(base.DefaultComparer.Compare, span, &outSpan); err != nil {
 				return fmt.Sprintf("error: %s", err)
 			}
@@ -3252,6 +3261,65 @@ func TestFlushInvariant(t *testing.T) {
 	}
 }
 
+func TestCompactionOutputPartitioner(t *testing.T) {
+	// Partition the keyspace by the first byte of each user key.
+	partitioner := func(userKey []byte) []byte {
+		return []byte{userKey[0] + 1}
+	}
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+	}).WithFSDefaults()
+	opts.Experimental.OutputPartitioner = partitioner
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for _, prefix := range []byte("abcd") {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%c/%02d", prefix, i)), []byte("value"), nil))
+		}
+	}
+	// A range deletion straddling a partition boundary must be truncated to
+	// the boundary in each output.
+	require.NoError(t, d.DeleteRange([]byte("b/50"), []byte("c/50"), nil))
+
+	checkPartitioned := func(expectedLevel int) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		v := d.mu.versions.currentVersion()
+		var n int
+		for l := range v.Levels {
+			iter := v.Levels[l].Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				require.Equal(t, expectedLevel, l)
+				n++
+				boundary := partitioner(f.Smallest.UserKey)
+				if c := d.cmp(f.Largest.UserKey, boundary); c > 0 || (c == 0 && !f.Largest.IsExclusiveSentinel()) {
+					t.Fatalf("L%d.%s spans partition boundary %q: %s", l, f.FileNum, boundary, f.DebugString(d.opts.Comparer.FormatKey, false))
+				}
+			}
+		}
+		// There must be at least one output per partition.
+		require.GreaterOrEqual(t, n, 4)
+	}
+
+	require.NoError(t, d.Flush())
+	checkPartitioned(0)
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	checkPartitioned(numLevels - 1)
+
+	// The data must be unaffected by the partitioning.
+	iter := d.NewIter(nil)
+	var count int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		count++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, 300, count)
+}
+
 func TestCompactFlushQueuedMemTableAndFlushMetrics(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("test is flaky on windows")
@@ -3814,6 +3882,349 @@ func TestMarkedForCompaction(t *testing.T) {
 	})
 }
 
+func TestPeriodicCompaction(t *testing.T) {
+	var d *DB
+	defer func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	var buf bytes.Buffer
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+		EventListener: &EventListener{
+			CompactionEnd: func(info CompactionInfo) {
+				// Fix the job ID and durations for determinism.
+				info.JobID = 100
+				info.Duration = time.Second
+				info.TotalDuration = 2 * time.Second
+				fmt.Fprintln(&buf, info)
+			},
+		},
+	}).WithFSDefaults()
+	opts.Experimental.PeriodicCompactionAge = 24 * time.Hour
+
+	// All times in the test are expressed in hours relative to now.
+	now := time.Unix(1_000_000_000, 0)
+	datadriven.RunTest(t, "testdata/periodic_compaction", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "define":
+			if d != nil {
+				if err := d.Close(); err != nil {
+					return err.Error()
+				}
+			}
+			var err error
+			if d, err = runDBDefineCmd(td, opts); err != nil {
+				return err.Error()
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.timeNow = func() time.Time { return now }
+			return d.mu.versions.currentVersion().DebugString(base.DefaultFormatter)
+
+		case "set-age":
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			vers := d.mu.versions.currentVersion()
+			var fileNum uint64
+			var hours int
+			td.ScanArgs(t, "file", &fileNum)
+			td.ScanArgs(t, "hours", &hours)
+			for l, lm := range vers.Levels {
+				iter := lm.Iter()
+				for f := iter.First(); f != nil; f = iter.Next() {
+					if f.FileNum != base.FileNum(fileNum) {
+						continue
+					}
+					f.CreationTime = now.Add(-time.Duration(hours) * time.Hour).Unix()
+					vers.Levels[l].InvalidateAnnotation(creationTimeAnnotator{})
+					return fmt.Sprintf("L%d.%s: %dh", l, f.FileNum, hours)
+				}
+			}
+			return "not-found"
+
+		case "file-ages":
+			m := d.Metrics()
+			var b strings.Builder
+			for l := range m.Levels {
+				if m.Levels[l].NumFiles == 0 {
+					continue
+				}
+				fmt.Fprintf(&b, "L%d: %v\n", l, m.Levels[l].Additional.FileAges)
+			}
+			return b.String()
+
+		case "maybe-compact":
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.opts.DisableAutomaticCompactions = false
+			d.maybeScheduleCompaction()
+			for d.mu.compact.compactingCount > 0 {
+				d.mu.compact.cond.Wait()
+			}
+			d.opts.DisableAutomaticCompactions = true
+
+			fmt.Fprintln(&buf, d.mu.versions.currentVersion().DebugString(base.DefaultFormatter))
+			s := strings.TrimSpace(buf.String())
+			buf.Reset()
+			return s
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+func TestTombstoneDensityCompaction(t *testing.T) {
+	var d *DB
+	defer func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+	}()
+
+	var buf bytes.Buffer
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+		EventListener: &EventListener{
+			CompactionEnd: func(info CompactionInfo) {
+				// Fix the job ID and durations for determinism.
+				info.JobID = 100
+				info.Duration = time.Second
+				info.TotalDuration = 2 * time.Second
+				fmt.Fprintln(&buf, info)
+			},
+		},
+	}).WithFSDefaults()
+	// Write a single key per data block.
+	opts.Levels = []LevelOptions{{BlockSize: 1}}
+	opts.Experimental.TombstoneDenseBlockRatio = 0.5
+	opts.Experimental.TombstoneDenseCompactionThreshold = 0.5
+	opts.Experimental.TombstoneDenseReadThreshold = 4
+
+	datadriven.RunTest(t, "testdata/tombstone_density_compaction", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "define":
+			if d != nil {
+				if err := d.Close(); err != nil {
+					return err.Error()
+				}
+			}
+			var err error
+			if d, err = runDBDefineCmd(td, opts); err != nil {
+				return err.Error()
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return d.mu.versions.currentVersion().DebugString(base.DefaultFormatter)
+
+		case "table-stats":
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.waitTableStats()
+			var b strings.Builder
+			for l, lm := range d.mu.versions.currentVersion().Levels {
+				iter := lm.Iter()
+				for f := iter.First(); f != nil; f = iter.Next() {
+					fmt.Fprintf(&b, "L%d.%s: tombstone-dense-blocks-ratio=%.2f\n",
+						l, f.FileNum, f.Stats.TombstoneDenseBlocksRatio)
+				}
+			}
+			return b.String()
+
+		case "iter":
+			var iterOpts IterOptions
+			for _, arg := range td.CmdArgs {
+				switch arg.Key {
+				case "lower":
+					iterOpts.LowerBound = []byte(arg.Vals[0])
+				case "upper":
+					iterOpts.UpperBound = []byte(arg.Vals[0])
+				default:
+					return fmt.Sprintf("unknown argument %q", arg.Key)
+				}
+			}
+			iter := d.NewIter(&iterOpts)
+			var keys []string
+			for valid := iter.First(); valid; valid = iter.Next() {
+				keys = append(keys, string(iter.Key()))
+			}
+			stats := iter.Stats()
+			if err := iter.Close(); err != nil {
+				return err.Error()
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			r := d.mu.compact.tombstoneDenseRead
+			return fmt.Sprintf("keys: %s\nsteps: %d, internal steps: %d\npending: %t [%q, %q)",
+				strings.Join(keys, ","), stats.ForwardStepCount[InterfaceCall],
+				stats.ForwardStepCount[InternalIterCall], r.pending, r.lower, r.upper)
+
+		case "maybe-compact":
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.opts.DisableAutomaticCompactions = false
+			d.maybeScheduleCompaction()
+			for d.mu.compact.compactingCount > 0 {
+				d.mu.compact.cond.Wait()
+			}
+			d.opts.DisableAutomaticCompactions = true
+
+			fmt.Fprintln(&buf, d.mu.versions.currentVersion().DebugString(base.DefaultFormatter))
+			fmt.Fprintf(&buf, "tombstone-density compactions: %d\n",
+				d.mu.versions.metrics.Compact.TombstoneDensityCount)
+			s := strings.TrimSpace(buf.String())
+			buf.Reset()
+			return s
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+// encodingCompactionJobRunner runs compaction jobs on a CompactionWorker,
+// round-tripping the jobs and their results through their encodings as a
+// worker in another process would.
+type encodingCompactionJobRunner struct {
+	w    *CompactionWorker
+	jobs int
+	// started, if non-nil, is signalled once a job starts, and the job then
+	// blocks until its context is cancelled.
+	started chan struct{}
+}
+
+func (r *encodingCompactionJobRunner) RunCompactionJob(
+	ctx context.Context, job *CompactionJob,
+) (*CompactionJobResult, error) {
+	r.jobs++
+	if r.started != nil {
+		r.started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	buf, err := job.Encode()
+	if err != nil {
+		return nil, err
+	}
+	if job, err = DecodeCompactionJob(buf); err != nil {
+		return nil, err
+	}
+	res, err := r.w.RunCompactionJob(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	if buf, err = res.Encode(); err != nil {
+		return nil, err
+	}
+	return DecodeCompactionJobResult(buf)
+}
+
+func (r *encodingCompactionJobRunner) ReleaseCompactionJob(res *CompactionJobResult) error {
+	return r.w.ReleaseCompactionJob(res)
+}
+
+func TestOffloadedCompaction(t *testing.T) {
+	sharedStorage := shared.NewInMem()
+
+	workerOpts := &Options{FS: vfs.NewMem()}
+	workerOpts.Experimental.SharedStorage = sharedStorage
+	w, err := OpenCompactionWorker("", workerOpts, 2)
+	require.NoError(t, err)
+	runner := &encodingCompactionJobRunner{w: w}
+
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                          mem,
+		DisableAutomaticCompactions: true,
+		// Lower the base level so that sstables may be ingested into L5.
+		LBaseMaxBytes: 1,
+	}
+	opts.Experimental.SharedStorage = sharedStorage
+	opts.Experimental.CompactionJobRunner = runner
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.SetCreatorID(1))
+
+	// Ingest two overlapping sstables, the first of which is ingested into L6
+	// and the second into L5.
+	ingest := func(name string, kvs ...string) {
+		f, err := mem.Create(name)
+		require.NoError(t, err)
+		tw := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+			TableFormat: d.FormatMajorVersion().MaxTableFormat(),
+		})
+		for i := 0; i < len(kvs); i += 2 {
+			if kvs[i+1] == "" {
+				require.NoError(t, tw.Delete([]byte(kvs[i])))
+			} else {
+				require.NoError(t, tw.Set([]byte(kvs[i]), []byte(kvs[i+1])))
+			}
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, d.Ingest([]string{name}))
+	}
+	ingest("ext1", "a", "1", "b", "1", "c", "1", "d", "1")
+	ingest("ext2", "b", "2", "c", "", "e", "2")
+	d.mu.Lock()
+	require.Equal(t, 1, d.mu.versions.currentVersion().Levels[5].Len())
+	require.Equal(t, 1, d.mu.versions.currentVersion().Levels[6].Len())
+	d.mu.Unlock()
+
+	// Cancelling a manual compaction aborts its in-flight offloaded job,
+	// leaving the inputs in place.
+	runner.started = make(chan struct{})
+	m, err := d.CompactWithOptions(context.Background(), []byte("a"), []byte("z"), ManualCompactionOptions{})
+	require.NoError(t, err)
+	<-runner.started
+	m.Cancel()
+	require.ErrorIs(t, m.Wait(), ErrCancelledCompaction)
+	runner.started = nil
+	d.mu.Lock()
+	require.Equal(t, 1, d.mu.versions.currentVersion().Levels[5].Len())
+	require.Equal(t, 1, d.mu.versions.currentVersion().Levels[6].Len())
+	d.mu.Unlock()
+
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
+	require.Less(t, 0, runner.jobs)
+
+	d.mu.Lock()
+	v := d.mu.versions.currentVersion()
+	for l := 0; l < numLevels-1; l++ {
+		require.Equal(t, 0, v.Levels[l].Len())
+	}
+	iter := v.Levels[numLevels-1].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		meta, err := d.objProvider.Lookup(fileTypeTable, f.FileBacking.DiskFileNum)
+		require.NoError(t, err)
+		require.True(t, meta.IsShared())
+	}
+	d.mu.Unlock()
+
+	it := d.NewIter(nil)
+	var buf strings.Builder
+	for valid := it.First(); valid; valid = it.Next() {
+		fmt.Fprintf(&buf, "%s:%s ", it.Key(), it.Value())
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, "a:1 b:2 d:1 e:2 ", buf.String())
+
+	// The worker releases its references to the job's inputs and outputs once
+	// the DB has attached the outputs.
+	require.Empty(t, w.d.objProvider.List())
+
+	require.NoError(t, d.Close())
+	require.NoError(t, w.Close())
+}
+
 // createManifestErrorInjector injects errors (when enabled) into vfs.FS calls
 // to create MANIFEST files.
 type createManifestErrorInjector struct {
@@ -3844,6 +4255,60 @@ var _ errorfs.Injector = &createManifestErrorInjector{}
 // unrecoverable error during logAndApply.
 //
 // Regression test for #1669.
+func TestSingleDeleteMisuse(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fail=%t", fail), func(t *testing.T) {
+			var infos []SingleDeleteMisuseInfo
+			opts := &Options{
+				FS:                          vfs.NewMem(),
+				DisableAutomaticCompactions: true,
+				EventListener: &EventListener{
+					BackgroundError: func(error) {},
+					SingleDeleteMisuse: func(info SingleDeleteMisuseInfo) {
+						infos = append(infos, info)
+					},
+				},
+			}
+			opts.Experimental.DetectSingleDeleteMisuse = true
+			opts.Experimental.FailOnSingleDeleteMisuse = fail
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+
+			// Open a snapshot so that the compaction into the bottommost level
+			// does not elide the SingleDelete and everything beneath it.
+			snap := d.NewSnapshot()
+			defer func() { require.NoError(t, snap.Close()) }()
+
+			// Set the key twice before single deleting it. The keys are flushed
+			// separately so that the misuse is only observed by the compaction.
+			require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+			require.NoError(t, d.Flush())
+			require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+			require.NoError(t, d.Flush())
+			require.NoError(t, d.SingleDelete([]byte("a"), nil))
+			require.NoError(t, d.Flush())
+			require.Empty(t, infos)
+
+			err = d.Compact([]byte("a"), []byte("b"), false)
+			require.Len(t, infos, 1)
+			require.Equal(t, []byte("a"), infos[0].Key)
+			require.Equal(t, []int{0}, infos[0].Levels)
+			require.Equal(t, "SINGLEDEL meets multiple SETs", infos[0].Reason)
+			if fail {
+				require.True(t, errors.Is(err, ErrSingleDeleteMisuse), "%v", err)
+				return
+			}
+			require.NoError(t, err)
+			// Without failing the compaction, the oldest value is resurrected.
+			v, closer, err := d.Get([]byte("a"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("1"), v)
+			require.NoError(t, closer.Close())
+		})
+	}
+}
+
 func TestCompaction_LogAndApplyFails(t *testing.T) {
 	// flushKeys writes the given keys to the DB, flushing the resulting memtable.
 	var key = []byte("foo")
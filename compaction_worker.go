@@ -0,0 +1,231 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage"
+)
+
+// CompactionWorker runs compaction jobs offloaded by other DBs against shared
+// storage. A worker is typically run in a separate process, receiving encoded
+// CompactionJobs and replying with encoded CompactionJobResults, but it also
+// implements CompactionJobRunner so that it may be used directly.
+//
+// The worker keeps a private scratch store in its directory, which holds its
+// references to the inputs and outputs of in-progress jobs. The outputs of a
+// job remain referenced by the worker until ReleaseCompactionJob is called for
+// the job's result.
+type CompactionWorker struct {
+	d *DB
+
+	mu struct {
+		sync.Mutex
+		nextID uint64
+		jobs   map[uint64]*compactionWorkerJob
+	}
+}
+
+var _ CompactionJobRunner = (*CompactionWorker)(nil)
+
+// compactionWorkerJob holds the objects referenced by the worker on behalf of
+// a completed compaction job.
+type compactionWorkerJob struct {
+	objects []base.DiskFileNum
+	handles []objstorage.SharedObjectBackingHandle
+}
+
+// OpenCompactionWorker opens a compaction worker with its scratch store in the
+// provided directory. The options must configure the SharedStorage holding the
+// sstables of the DBs offloading compactions to the worker, and must otherwise
+// mirror those DBs' options: the comparer, merger, table property collectors,
+// block property collectors and level options all determine the contents of
+// the compaction outputs. The creator ID must be unique among the DBs and
+// workers sharing the storage.
+func OpenCompactionWorker(
+	dirname string, opts *Options, creatorID uint64,
+) (*CompactionWorker, error) {
+	if opts.Experimental.SharedStorage == nil {
+		return nil, errors.New("pebble: compaction worker requires shared storage")
+	}
+	opts = opts.Clone()
+	opts.DisableAutomaticCompactions = true
+	opts.Experimental.CompactionJobRunner = nil
+	opts.private.disableTableStats = true
+	d, err := Open(dirname, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.SetCreatorID(creatorID); err != nil {
+		return nil, firstError(err, d.Close())
+	}
+	w := &CompactionWorker{d: d}
+	w.mu.jobs = make(map[uint64]*compactionWorkerJob)
+	return w, nil
+}
+
+// RunCompactionJob implements the CompactionJobRunner interface. It runs the
+// compaction job, writing its outputs to shared storage. The job is aborted
+// if ctx is cancelled.
+func (w *CompactionWorker) RunCompactionJob(
+	ctx context.Context, job *CompactionJob,
+) (_ *CompactionJobResult, retErr error) {
+	d := w.d
+	if job.Comparer != d.opts.Comparer.Name {
+		return nil, errors.Errorf("pebble: compaction job comparer %q does not match worker comparer %q",
+			errors.Safe(job.Comparer), errors.Safe(d.opts.Comparer.Name))
+	}
+	if job.Merger != d.opts.Merger.Name {
+		return nil, errors.Errorf("pebble: compaction job merger %q does not match worker merger %q",
+			errors.Safe(job.Merger), errors.Safe(d.opts.Merger.Name))
+	}
+	if len(job.Inputs) != 2 {
+		return nil, errors.Errorf("pebble: compaction job has %d input levels", errors.Safe(len(job.Inputs)))
+	}
+
+	// Attach the inputs to the scratch store, under local file numbers.
+	var objs []objstorage.SharedObjectToAttach
+	var inputMetas [2][]*fileMetadata
+	d.mu.Lock()
+	for i := range job.Inputs {
+		for j := range job.Inputs[i].Tables {
+			t := &job.Inputs[i].Tables[j]
+			fileNum := d.mu.versions.getNextFileNum()
+			inputMetas[i] = append(inputMetas[i], t.fileMetadata(d.cmp, fileNum))
+			objs = append(objs, objstorage.SharedObjectToAttach{
+				FileNum:  fileNum.DiskFileNum(),
+				FileType: fileTypeTable,
+				Backing:  t.Backing,
+			})
+		}
+	}
+	d.mu.Unlock()
+	if _, err := d.objProvider.AttachSharedObjects(objs); err != nil {
+		return nil, err
+	}
+	wj := &compactionWorkerJob{}
+	for _, o := range objs {
+		wj.objects = append(wj.objects, o.FileNum)
+	}
+	defer func() {
+		if retErr != nil {
+			retErr = firstError(retErr, w.release(wj))
+		}
+	}()
+
+	// The grandparents are only used for their bounds and sizes, so they keep
+	// the file numbers of the DB that created the job.
+	grandparents := make([]*fileMetadata, len(job.Grandparents))
+	for i := range job.Grandparents {
+		t := &job.Grandparents[i]
+		grandparents[i] = t.fileMetadata(d.cmp, t.FileNum)
+	}
+	c := newCompactionJobCompaction(d.opts, job,
+		[2]manifest.LevelSlice{
+			manifest.NewLevelSliceKeySorted(d.cmp, inputMetas[0]),
+			manifest.NewLevelSliceKeySorted(d.cmp, inputMetas[1]),
+		},
+		manifest.NewLevelSliceKeySorted(d.cmp, grandparents))
+
+	// Cancellation of ctx is observed through the compaction's manual
+	// compaction state.
+	c.manual = newManualCompactionState()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.manual.cancel()
+		case <-done:
+		}
+	}()
+
+	d.mu.Lock()
+	jobID := d.mu.nextJobID
+	d.mu.nextJobID++
+	ve, _, stats, err := d.runCompaction(jobID, c)
+	d.mu.versions.incrementCompactionBytes(-c.bytesWritten)
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CompactionJobResult{
+		BytesRead:  c.bytesIterated,
+		PinnedKeys: stats.cumulativePinnedKeys,
+		PinnedSize: stats.cumulativePinnedSize,
+	}
+	for _, nf := range ve.NewFiles {
+		wj.objects = append(wj.objects, nf.Meta.FileBacking.DiskFileNum)
+		meta, err := d.objProvider.Lookup(fileTypeTable, nf.Meta.FileBacking.DiskFileNum)
+		if err != nil {
+			return nil, err
+		}
+		if !meta.IsShared() {
+			return nil, errors.Errorf("pebble: compaction job output %s is not on shared storage",
+				nf.Meta.FileNum)
+		}
+		h, err := d.objProvider.SharedObjectBacking(&meta)
+		if err != nil {
+			return nil, err
+		}
+		wj.handles = append(wj.handles, h)
+		backing, err := h.Get()
+		if err != nil {
+			return nil, err
+		}
+		res.Outputs = append(res.Outputs, makeCompactionJobTable(nf.Meta, backing))
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.mu.nextID++
+	res.ID = w.mu.nextID
+	w.mu.jobs[res.ID] = wj
+	return res, nil
+}
+
+// ReleaseCompactionJob implements the CompactionJobRunner interface. It drops
+// the worker's references to the inputs and outputs of the compaction job.
+func (w *CompactionWorker) ReleaseCompactionJob(res *CompactionJobResult) error {
+	w.mu.Lock()
+	wj, ok := w.mu.jobs[res.ID]
+	delete(w.mu.jobs, res.ID)
+	w.mu.Unlock()
+	if !ok {
+		return errors.Errorf("pebble: unknown compaction job %d", errors.Safe(res.ID))
+	}
+	return w.release(wj)
+}
+
+func (w *CompactionWorker) release(wj *compactionWorkerJob) error {
+	for _, h := range wj.handles {
+		h.Close()
+	}
+	var err error
+	for _, fileNum := range wj.objects {
+		err = firstError(err, w.d.objProvider.Remove(fileTypeTable, fileNum))
+	}
+	return firstError(err, w.d.objProvider.Sync())
+}
+
+// Close releases the objects referenced by any unreleased compaction jobs and
+// closes the worker.
+func (w *CompactionWorker) Close() error {
+	w.mu.Lock()
+	jobs := w.mu.jobs
+	w.mu.jobs = nil
+	w.mu.Unlock()
+	var err error
+	for _, wj := range jobs {
+		err = firstError(err, w.release(wj))
+	}
+	return firstError(err, w.d.Close())
+}
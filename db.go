@@ -6,10 +6,12 @@
 package pebble // import "github.com/cockroachdb/pebble"
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -36,6 +38,10 @@ const (
 	// numNonTableCacheFiles is an approximation for the number of files
 	// that we don't use for table caches, for a given db.
 	numNonTableCacheFiles = 10
+
+	// defaultPrefetchMemoryBudget is the default for
+	// IterOptions.PrefetchMemoryBudget.
+	defaultPrefetchMemoryBudget = 1 << 20
 )
 
 var (
@@ -48,6 +54,14 @@ var (
 	// ErrReadOnly is returned when a write operation is performed on a read-only
 	// database.
 	ErrReadOnly = errors.New("pebble: read-only")
+	// ErrSyncUnknown is returned by ApplyWithContext and Batch.CommitWithContext
+	// when the context is done while waiting for the WAL sync of a committed
+	// batch. The batch's writes are applied and visible, but may not be durable.
+	// Batch.SyncWait may be used to wait for the outcome of the sync.
+	ErrSyncUnknown = errors.New("pebble: batch committed but WAL sync status unknown")
+	// ErrHistoryUnavailable is returned by NewIterAt and GetAt when the
+	// requested sequence number is outside the DB's retained history window.
+	ErrHistoryUnavailable = errors.New("pebble: history unavailable")
 	// errNoSplit indicates that the user is trying to perform a range key
 	// operation but the configured Comparer does not provide a Split
 	// implementation.
@@ -96,6 +110,21 @@ type Writer interface {
 	// It is safe to modify the contents of the arguments after Delete returns.
 	Delete(key []byte, o *WriteOptions) error
 
+	// DeleteSized behaves identically to Delete, but takes an additional
+	// argument indicating the size of the value being deleted. DeleteSized
+	// should be preferred when the caller has the expectation that there
+	// exists a single internal KV pair for the key (eg, the key has not been
+	// overwritten recently), and the caller knows the size of its value.
+	//
+	// DeleteSized will record the value size within the tombstone and use it
+	// to inform compaction-picking heuristics which strive to reduce space
+	// amplification in the LSM. DeleteSized requires at least
+	// FormatDeleteSized.
+	//
+	// It is safe to modify the contents of the arguments after DeleteSized
+	// returns.
+	DeleteSized(key []byte, deletedValueSize uint32, o *WriteOptions) error
+
 	// SingleDelete is similar to Delete in that it deletes the value for the given key. Like Delete,
 	// it is a blind operation that will succeed even if the given key does not exist.
 	//
@@ -291,6 +320,22 @@ type DB struct {
 
 	deletionLimiter limiter
 
+	// writeThrottle delays commits as the DB approaches a write stall. It is
+	// nil if write throttling is disabled.
+	writeThrottle *writeThrottle
+
+	// mergeCache caches the results of resolving MERGE keys during reads. It
+	// is nil if the merge cache is disabled.
+	mergeCache *mergeCache
+
+	// rowCache caches the results of Get. It is nil if the row cache is
+	// disabled.
+	rowCache *rowCache
+
+	// categoryStats aggregates the block reads of iterators by their
+	// IterOptions.Category.
+	categoryStats categoryStats
+
 	// Async deletion jobs spawned by cleaners increment this WaitGroup, and
 	// call Done when completed. Once `d.mu.cleaning` is false, the db.Close()
 	// goroutine needs to call Wait on this WaitGroup to ensure all cleaning
@@ -410,6 +455,10 @@ type DB struct {
 			// compactions which we might have to perform.
 			readCompactions readCompactionQueue
 
+			// tombstoneDenseRead records iterators' requests for a tombstone
+			// density compaction.
+			tombstoneDenseRead tombstoneDenseRead
+
 			// Flush throughput metric.
 			flushWriteThroughput ThroughputMetric
 			// The idle start time for the flush "loop", i.e., when the flushing
@@ -440,6 +489,12 @@ type DB struct {
 			// sstables.
 			cumulativePinnedCount uint64
 			cumulativePinnedSize  uint64
+
+			// historyHorizon is the oldest sequence number at which the DB may
+			// be read through NewIterAt and GetAt. Flushes and compactions
+			// retain every version of a key with a sequence number at or above
+			// it. Zero if Options.Experimental.RetainHistory is disabled.
+			historyHorizon uint64
 		}
 
 		tableStats struct {
@@ -497,7 +552,7 @@ func (d *DB) TestOnlyWaitForCleaning() {
 // slice will remain valid until the returned Closer is closed. On success, the
 // caller MUST call closer.Close() or a memory leak will occur.
 func (d *DB) Get(key []byte) ([]byte, io.Closer, error) {
-	return d.getInternal(key, nil /* batch */, nil /* snapshot */)
+	return d.getInternal(key, nil /* batch */, snapshotIterOpts{})
 }
 
 type getIterAlloc struct {
@@ -512,22 +567,35 @@ var getIterAllocPool = sync.Pool{
 	},
 }
 
-func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer, error) {
+func (d *DB) getInternal(key []byte, b *Batch, s snapshotIterOpts) ([]byte, io.Closer, error) {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
 
+	// Only reads of the latest state of the DB use the row cache.
+	rowCacheable := d.rowCache != nil && b == nil && s == (snapshotIterOpts{})
+	if rowCacheable {
+		value, found, ok := d.rowCache.get(key, d.mu.versions.visibleSeqNum.Load())
+		if ok {
+			if !found {
+				return nil, nil, ErrNotFound
+			}
+			return value, noopCloser{}, nil
+		}
+	}
+
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
 	// compaction. The readState is unref'd by Iterator.Close().
-	readState := d.loadReadState()
+	readState := s.readState
+	if readState == nil {
+		readState = d.loadReadState()
+	}
 
 	// Determine the seqnum to read at after grabbing the read state (current and
 	// memtables) above.
-	var seqNum uint64
-	if s != nil {
-		seqNum = s.seqNum
-	} else {
+	seqNum := s.seqNum
+	if seqNum == 0 {
 		seqNum = d.mu.versions.visibleSeqNum.Load()
 	}
 
@@ -538,6 +606,7 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		logger:   d.opts.Logger,
 		cmp:      d.cmp,
 		equal:    d.equal,
+		split:    d.split,
 		newIters: d.newIters,
 		snapshot: seqNum,
 		key:      key,
@@ -569,14 +638,25 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		readState:    readState,
 		keyBuf:       buf.keyBuf,
 	}
+	if b == nil {
+		// Merges resolved through a batch cannot be cached. See
+		// Iterator.mergeCacheable.
+		i.mergeCache = d.mergeCache
+	}
 
 	if !i.First() {
 		err := i.Close()
 		if err != nil {
 			return nil, nil, err
 		}
+		if rowCacheable {
+			d.rowCache.add(key, seqNum, nil, false /* found */)
+		}
 		return nil, nil, ErrNotFound
 	}
+	if rowCacheable {
+		d.rowCache.add(key, seqNum, append([]byte(nil), i.Value()...), true /* found */)
+	}
 	return i.Value(), i, nil
 }
 
@@ -610,6 +690,23 @@ func (d *DB) Delete(key []byte, opts *WriteOptions) error {
 	return nil
 }
 
+// DeleteSized behaves identically to Delete, but takes an additional
+// argument indicating the size of the value being deleted. See
+// Writer.DeleteSized for more details.
+//
+// It is safe to modify the contents of the arguments after DeleteSized
+// returns.
+func (d *DB) DeleteSized(key []byte, deletedValueSize uint32, opts *WriteOptions) error {
+	b := newBatch(d)
+	_ = b.DeleteSized(key, deletedValueSize, opts)
+	if err := d.Apply(b, opts); err != nil {
+		return err
+	}
+	// Only release the batch on success.
+	b.release()
+	return nil
+}
+
 // SingleDelete adds an action to the batch that single deletes the entry for key.
 // See Writer.SingleDelete for more details on the semantics of SingleDelete.
 //
@@ -734,7 +831,41 @@ func (d *DB) RangeKeyDelete(start, end []byte, opts *WriteOptions) error {
 //
 // It is safe to modify the contents of the arguments after Apply returns.
 func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
-	return d.applyInternal(batch, opts, false)
+	return d.applyInternal(context.Background(), batch, opts, false)
+}
+
+// ApplyWithContext is like Apply, but stops waiting if ctx is done. If ctx is
+// done while the commit is throttled or waiting for a write stall to end,
+// ApplyWithContext returns an error wrapping ctx's error without having
+// written anything. If ctx is done while waiting for the WAL to sync (when
+// opts.Sync is true), the batch has been committed and ApplyWithContext
+// returns an error marked as ErrSyncUnknown; the batch may be closed without
+// waiting for the sync.
+//
+// A write stall that begins after the batch's room in the memtable has been
+// determined, but before the batch is written, is waited for regardless of
+// ctx.
+func (d *DB) ApplyWithContext(ctx context.Context, batch *Batch, opts *WriteOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !opts.GetSync() || ctx.Done() == nil || batch.Empty() {
+		return d.applyInternal(ctx, batch, opts, false)
+	}
+	fsyncDone := make(chan struct{})
+	batch.fsyncDone = fsyncDone
+	if err := d.applyInternal(ctx, batch, opts, true); err != nil {
+		return err
+	}
+	select {
+	case <-fsyncDone:
+		return batch.SyncWait()
+	case <-ctx.Done():
+		// The LogWriter may still write to the batch once the sync completes,
+		// so prevent the batch from being reused.
+		batch.db = nil
+		return errors.Mark(errors.Wrap(ctx.Err(), "pebble: waiting for WAL sync"), ErrSyncUnknown)
+	}
 }
 
 // ApplyNoSyncWait must only be used when opts.Sync is true and the caller
@@ -753,11 +884,13 @@ func (d *DB) ApplyNoSyncWait(batch *Batch, opts *WriteOptions) error {
 	if !opts.Sync {
 		return errors.Errorf("cannot request asynchonous apply when WriteOptions.Sync is false")
 	}
-	return d.applyInternal(batch, opts, true)
+	return d.applyInternal(context.Background(), batch, opts, true)
 }
 
 // REQUIRES: noSyncWait => opts.Sync
-func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) error {
+func (d *DB) applyInternal(
+	ctx context.Context, batch *Batch, opts *WriteOptions, noSyncWait bool,
+) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -793,10 +926,29 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	if batch.db == nil {
 		batch.refreshMemTableSize()
 	}
+	if batch.minimumFormatMajorVersion > d.FormatMajorVersion() {
+		panic(fmt.Sprintf(
+			"pebble: batch requires at least format major version %d (current: %d)",
+			batch.minimumFormatMajorVersion, d.FormatMajorVersion(),
+		))
+	}
 	if int(batch.memTableSize) >= d.largeBatchThreshold {
 		batch.flushable = newFlushableBatch(batch, d.opts.Comparer)
 	}
-	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+	var throttled time.Duration
+	if d.writeThrottle != nil {
+		var err error
+		if throttled, err = d.writeThrottle.wait(ctx, len(batch.data)); err != nil {
+			return errors.Wrap(err, "pebble: write throttled")
+		}
+	}
+	err := d.commit.CommitWithContext(ctx, batch, sync, noSyncWait)
+	batch.commitStats.WriteThrottleDuration = throttled
+	batch.commitStats.TotalDuration += throttled
+	if err != nil {
+		if errors.Is(err, errCommitAborted) {
+			return err
+		}
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
@@ -815,6 +967,11 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 }
 
 func (d *DB) commitApply(b *Batch, mem *memTable) error {
+	if d.rowCache != nil {
+		// Invalidate the cached rows of the batch's keys before the batch
+		// becomes visible.
+		d.rowCache.invalidateBatch(b)
+	}
 	if b.flushable != nil {
 		// This is a large batch which was already added to the immutable queue.
 		return nil
@@ -850,7 +1007,101 @@ func (d *DB) commitApply(b *Batch, mem *memTable) error {
 	return nil
 }
 
-func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
+// commitWaitForRoom waits for any write stall that would block writing the
+// batch in makeRoomForWrite to end, returning an error wrapping ctx's error if
+// ctx is done first. It is called by the commit pipeline before the batch is
+// sequenced. Like makeRoomForWrite, the stall is only reported to the
+// EventListener if commitPipeline.mu is held, since at most one batch may
+// then be waiting.
+func (d *DB) commitWaitForRoom(ctx context.Context, b *Batch, pipelineLocked bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var stopWatching chan struct{}
+	stalled := false
+	defer func() {
+		if stalled {
+			d.opts.EventListener.WriteStallEnd()
+		}
+	}()
+	for {
+		reason := d.writeStallReasonLocked(b)
+		if reason == "" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "pebble: write stalled")
+		}
+		if !stalled && pipelineLocked {
+			stalled = true
+			d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{Reason: reason})
+		}
+		if stopWatching == nil {
+			// Wake up the wait below once ctx is done.
+			stopWatching = make(chan struct{})
+			defer close(stopWatching)
+			go func() {
+				select {
+				case <-ctx.Done():
+					d.mu.Lock()
+					d.mu.compact.cond.Broadcast()
+					d.mu.Unlock()
+				case <-stopWatching:
+				}
+			}()
+		}
+		now := time.Now()
+		d.mu.compact.cond.Wait()
+		if reason == writeStallMemTableReason {
+			b.commitStats.MemTableWriteStallDuration += time.Since(now)
+		} else {
+			b.commitStats.L0ReadAmpWriteStallDuration += time.Since(now)
+		}
+	}
+}
+
+// commitCheckConditions returns a ConditionFailedError if the precondition of
+// any of the batch's conditional writes does not hold at the latest visible
+// sequence number. It is called by the commit pipeline before the batch is
+// sequenced: first without blocking other commits, and then once all
+// previously sequenced commits are visible, with a minSeqNum limiting the
+// check to the conditions on keys written by the commits that became visible
+// in the meantime.
+func (d *DB) commitCheckConditions(b *Batch, minSeqNum uint64) error {
+	for i := range b.conditions {
+		c := &b.conditions[i]
+		if minSeqNum > 0 {
+			written, err := d.findWriteSince(
+				[]txnRead{{start: c.key, end: c.key, endInclusive: true}}, minSeqNum)
+			if err != nil {
+				return err
+			}
+			if written == nil {
+				// The condition was already found to hold.
+				continue
+			}
+		}
+		var holds bool
+		value, closer, err := d.getInternal(c.key, nil, snapshotIterOpts{})
+		switch {
+		case err == ErrNotFound:
+			holds = !c.exists
+		case err != nil:
+			return err
+		default:
+			holds = c.exists && bytes.Equal(value, c.value)
+			if err := closer.Close(); err != nil {
+				return err
+			}
+		}
+		if !holds {
+			return &ConditionFailedError{Key: append([]byte(nil), c.key...)}
+		}
+	}
+	return nil
+}
+
+func (d *DB) commitWrite(b *Batch, syncWG record.SyncWaiter, syncErr *error) (*memTable, error) {
 	var size int64
 	repr := b.Repr()
 
@@ -884,6 +1135,9 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		// enough room to store the batch.
 		err = d.makeRoomForWrite(b)
 	}
+	if err == nil {
+		d.updateMemTableWriteThrottleLocked()
+	}
 
 	if err == nil && !d.opts.DisableWAL {
 		d.mu.log.bytesIn += uint64(len(repr))
@@ -934,7 +1188,9 @@ var iterAllocPool = sync.Pool{
 
 // newIter constructs a new iterator, merging in batch iterators as an extra
 // level.
-func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOptions) *Iterator {
+func (d *DB) newIter(
+	ctx context.Context, batch *Batch, s snapshotIterOpts, o *IterOptions,
+) *Iterator {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -949,7 +1205,7 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 	if o != nil && o.RangeKeyMasking.Suffix != nil && o.KeyTypes != IterKeyTypePointsAndRanges {
 		panic("pebble: range key masking requires IterKeyTypePointsAndRanges")
 	}
-	if (batch != nil || s != nil) && (o != nil && o.OnlyReadGuaranteedDurable) {
+	if (batch != nil || s.seqNum != 0) && (o != nil && o.OnlyReadGuaranteedDurable) {
 		// We could add support for OnlyReadGuaranteedDurable on snapshots if
 		// there was a need: this would require checking that the sequence number
 		// of the snapshot has been flushed, by comparing with
@@ -959,14 +1215,15 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
 	// compaction. The readState is unref'd by Iterator.Close().
-	readState := d.loadReadState()
+	readState := s.readState
+	if readState == nil {
+		readState = d.loadReadState()
+	}
 
 	// Determine the seqnum to read at after grabbing the read state (current and
 	// memtables) above.
-	var seqNum uint64
-	if s != nil {
-		seqNum = s.seqNum
-	} else {
+	seqNum := s.seqNum
+	if seqNum == 0 {
 		seqNum = d.mu.versions.visibleSeqNum.Load()
 	}
 
@@ -978,6 +1235,7 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 		ctx:                 ctx,
 		alloc:               buf,
 		merge:               d.merge,
+		mergeCache:          d.mergeCache,
 		comparer:            *d.opts.Comparer,
 		readState:           readState,
 		keyBuf:              buf.keyBuf,
@@ -987,6 +1245,7 @@ func (d *DB) newIter(ctx context.Context, batch *Batch, s *Snapshot, o *IterOpti
 		newIters:            d.newIters,
 		newIterRangeKey:     d.tableNewRangeKeyIter,
 		seqNum:              seqNum,
+		refreshable:         s.seqNum == 0,
 	}
 	if o != nil {
 		dbi.opts = *o
@@ -1134,7 +1393,22 @@ func (d *DB) ScanInternal(
 	visitRangeKey func(start, end []byte, keys []keyspan.Key) error,
 	visitSharedFile func(sst *SharedSSTMeta) error,
 ) error {
-	iter := d.newInternalIter(nil /* snapshot */, &scanInternalOptions{
+	return d.scanInternalAt(ctx, snapshotIterOpts{}, lower, upper,
+		visitPointKey, visitRangeDel, visitRangeKey, visitSharedFile)
+}
+
+// scanInternalAt implements ScanInternal for the view of the DB described by
+// s.
+func (d *DB) scanInternalAt(
+	ctx context.Context,
+	s snapshotIterOpts,
+	lower, upper []byte,
+	visitPointKey func(key *InternalKey, value LazyValue) error,
+	visitRangeDel func(start, end []byte, seqNum uint64) error,
+	visitRangeKey func(start, end []byte, keys []keyspan.Key) error,
+	visitSharedFile func(sst *SharedSSTMeta) error,
+) error {
+	iter := d.newInternalIter(s, &scanInternalOptions{
 		IterOptions: IterOptions{
 			KeyTypes:   IterKeyTypePointsAndRanges,
 			LowerBound: lower,
@@ -1153,22 +1427,23 @@ func (d *DB) ScanInternal(
 // TODO(bilal): This method has a lot of similarities with db.newIter as well as
 // finishInitializingIter. Both pairs of methods should be refactored to reduce
 // this duplication.
-func (d *DB) newInternalIter(s *Snapshot, o *scanInternalOptions) *scanInternalIterator {
+func (d *DB) newInternalIter(s snapshotIterOpts, o *scanInternalOptions) *scanInternalIterator {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
 	// compaction. The readState is unref'd by Iterator.Close().
-	readState := d.loadReadState()
+	readState := s.readState
+	if readState == nil {
+		readState = d.loadReadState()
+	}
 
 	// Determine the seqnum to read at after grabbing the read state (current and
 	// memtables) above.
-	var seqNum uint64
-	if s == nil {
+	seqNum := s.seqNum
+	if seqNum == 0 {
 		seqNum = d.mu.versions.visibleSeqNum.Load()
-	} else {
-		seqNum = s.seqNum
 	}
 
 	// Bundle various structures under a single umbrella in order to allocate
@@ -1231,10 +1506,17 @@ func (i *Iterator) constructPointIter(
 		// Already have one.
 		return
 	}
-	internalOpts := internalIterOpts{stats: &i.stats.InternalStats}
+	var internalOpts internalIterOpts
 	if i.opts.RangeKeyMasking.Filter != nil {
 		internalOpts.boundLimitedFilter = &i.rangeKeyMasking
 	}
+	if i.opts.PrefetchBlocks > 0 {
+		budget := i.opts.PrefetchMemoryBudget
+		if budget <= 0 {
+			budget = defaultPrefetchMemoryBudget
+		}
+		internalOpts.prefetcher = sstable.NewPrefetcher(i.opts.PrefetchBlocks, budget)
+	}
 
 	// Merging levels and levels from iterAlloc.
 	mlevels := buf.mlevels[:0]
@@ -1313,8 +1595,12 @@ func (i *Iterator) constructPointIter(
 	addLevelIterForFiles := func(files manifest.LevelIterator, level manifest.Level) {
 		li := &levels[levelsIndex]
 
+		// Each level accumulates its own stats, so that block reads may be
+		// attributed to levels.
+		levelOpts := internalOpts
+		levelOpts.stats = &i.levelStats[manifest.LevelToInt(level)]
 		li.init(
-			ctx, i.opts, i.comparer.Compare, i.comparer.Split, i.newIters, files, level, internalOpts)
+			ctx, i.opts, i.comparer.Compare, i.comparer.Split, i.newIters, files, level, levelOpts)
 		li.initRangeDel(&mlevels[mlevelsIndex].rangeDelIter)
 		li.initBoundaryContext(&mlevels[mlevelsIndex].levelIterBoundaryContext)
 		li.initCombinedIterState(&i.lazyCombinedIter.combinedIterState)
@@ -1378,7 +1664,7 @@ func (d *DB) NewIter(o *IterOptions) *Iterator {
 // NewIterWithContext is like NewIter, and additionally accepts a context for
 // tracing.
 func (d *DB) NewIterWithContext(ctx context.Context, o *IterOptions) *Iterator {
-	return d.newIter(ctx, nil /* batch */, nil /* snapshot */, o)
+	return d.newIter(ctx, nil /* batch */, snapshotIterOpts{}, o)
 }
 
 // NewSnapshot returns a point-in-time view of the current DB state. Iterators
@@ -1404,6 +1690,43 @@ func (d *DB) NewSnapshot() *Snapshot {
 	return s
 }
 
+// NewEventuallyFileOnlySnapshot returns a point-in-time view of the current DB
+// state for the keys within keyRanges, which must be non-empty. The snapshot
+// transitions to a file-only snapshot, which no longer constrains compactions,
+// once the memtables containing keys within keyRanges have been flushed. See
+// EventuallyFileOnlySnapshot.
+func (d *DB) NewEventuallyFileOnlySnapshot(keyRanges []KeyRange) *EventuallyFileOnlySnapshot {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if len(keyRanges) == 0 {
+		panic("pebble: eventually file-only snapshot requires key ranges")
+	}
+	for _, kr := range keyRanges {
+		if d.cmp(kr.Start, kr.End) >= 0 {
+			panic(errors.AssertionFailedf("pebble: invalid key range [%s, %s)",
+				d.opts.Comparer.FormatKey(kr.Start), d.opts.Comparer.FormatKey(kr.End)))
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	es := &EventuallyFileOnlySnapshot{
+		db:           d,
+		seqNum:       d.mu.versions.visibleSeqNum.Load(),
+		keyRanges:    keyRanges,
+		transitioned: make(chan struct{}),
+	}
+	if es.canTransitionLocked() {
+		es.transitionLocked()
+		return es
+	}
+	s := &Snapshot{db: d, seqNum: es.seqNum, efos: es}
+	es.mu.snap = s
+	d.mu.snapshots.pushBack(s)
+	return es
+}
+
 // Close closes the DB.
 //
 // It is not safe to close a DB until all outstanding iterators are closed
@@ -1439,6 +1762,9 @@ func (d *DB) Close() error {
 	close(d.closedCh)
 
 	defer d.opts.Cache.Unref()
+	if d.rowCache != nil {
+		d.rowCache.close()
+	}
 
 	for d.mu.compact.compactingCount > 0 || d.mu.compact.flushing {
 		d.mu.compact.cond.Wait()
@@ -1541,6 +1867,16 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	if err := d.validateManualCompaction(start, end, ManualCompactionOptions{}); err != nil {
+		return err
+	}
+	return d.compactRange(context.Background(), start, end,
+		ManualCompactionOptions{Parallelize: parallelize}, newManualCompactionState())
+}
+
+// validateManualCompaction returns an error if a manual compaction of the
+// range [start, end] with the provided options may not be performed.
+func (d *DB) validateManualCompaction(start, end []byte, opts ManualCompactionOptions) error {
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
@@ -1548,6 +1884,17 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 		return errors.Errorf("Compact start %s is not less than end %s",
 			d.opts.Comparer.FormatKey(start), d.opts.Comparer.FormatKey(end))
 	}
+	if opts.TargetLevel < 0 || opts.TargetLevel >= numLevels {
+		return errors.Errorf("Compact target level %d is not within [0, %d)", opts.TargetLevel, numLevels)
+	}
+	return nil
+}
+
+// compactRange performs a manual compaction of the range [start, end],
+// blocking until the compaction completes, fails, or ctx is cancelled.
+func (d *DB) compactRange(
+	ctx context.Context, start, end []byte, opts ManualCompactionOptions, state *manualCompactionState,
+) error {
 	iStart := base.MakeInternalKey(start, InternalKeySeqNumMax, InternalKeyKindMax)
 	iEnd := base.MakeInternalKey(end, 0, 0)
 	m := (&fileMetadata{}).ExtendPointKeyBounds(d.cmp, iStart, iEnd)
@@ -1562,6 +1909,13 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 			maxLevelWithFiles = level + 1
 		}
 	}
+	// If a target level was specified, compact every level above the target
+	// level into the next, regardless of which levels contain files.
+	endLevel := maxLevelWithFiles
+	if opts.TargetLevel > 0 {
+		endLevel = opts.TargetLevel
+	}
+	state.endLevel.Store(int32(endLevel))
 
 	// Determine if any memtable overlaps with the compaction range. We wait for
 	// any such overlap to flush (initiating a flush if necessary).
@@ -1601,12 +1955,16 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 		return err
 	}
 	if mem != nil {
-		<-mem.flushed
+		select {
+		case <-mem.flushed:
+		case <-ctx.Done():
+			return ErrCancelledCompaction
+		}
 	}
 
-	for level := 0; level < maxLevelWithFiles; {
-		if err := d.manualCompact(
-			iStart.UserKey, iEnd.UserKey, level, parallelize); err != nil {
+	for level := 0; level < endLevel; {
+		state.level.Store(int32(level))
+		if err := d.manualCompact(ctx, iStart.UserKey, iEnd.UserKey, level, opts, state); err != nil {
 			return err
 		}
 		level++
@@ -1616,10 +1974,20 @@ func (d *DB) Compact(start, end []byte, parallelize bool) error {
 			break
 		}
 	}
+	if endLevel > numLevels-1 {
+		endLevel = numLevels - 1
+	}
+	state.level.Store(int32(endLevel))
 	return nil
 }
 
-func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error {
+func (d *DB) manualCompact(
+	ctx context.Context,
+	start, end []byte,
+	level int,
+	opts ManualCompactionOptions,
+	state *manualCompactionState,
+) error {
 	d.mu.Lock()
 	curr := d.mu.versions.currentVersion()
 	files := curr.Overlaps(level, d.cmp, start, end, false)
@@ -1629,7 +1997,7 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 	}
 
 	var compactions []*manualCompaction
-	if parallelize {
+	if opts.Parallelize {
 		compactions = append(compactions, d.splitManualCompaction(start, end, level)...)
 	} else {
 		compactions = append(compactions, &manualCompaction{
@@ -1639,6 +2007,10 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 			end:   end,
 		})
 	}
+	for _, c := range compactions {
+		c.lowPriority = opts.Priority == ManualCompactionPriorityLow
+		c.state = state
+	}
 	d.mu.compact.manual = append(d.mu.compact.manual, compactions...)
 	d.maybeScheduleCompaction()
 	d.mu.Unlock()
@@ -1650,9 +2022,20 @@ func (d *DB) manualCompact(start, end []byte, level int, parallelize bool) error
 	// a value to the done channel. Since the channels are buffered, it is not
 	// necessary to read from each channel, and so we can exit early in the event
 	// of an error.
-	for _, compaction := range compactions {
-		if err := <-compaction.done; err != nil {
-			return err
+	for i, compaction := range compactions {
+		select {
+		case err := <-compaction.done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			// Cancel the queued and in-flight compactions, and wait for all the
+			// compactions that have not yet reported completion to do so.
+			d.cancelManualCompactions(state)
+			for _, compaction := range compactions[i:] {
+				<-compaction.done
+			}
+			return ErrCancelledCompaction
 		}
 	}
 	return nil
@@ -1789,14 +2172,19 @@ func (d *DB) Metrics() *Metrics {
 	if d.mu.compact.flushing {
 		metrics.Flush.NumInProgress = 1
 	}
+	now := d.timeNow()
 	for i := 0; i < numLevels; i++ {
 		metrics.Levels[i].Additional.ValueBlocksSize = valueBlocksSizeForLevel(vers, i)
+		metrics.Levels[i].Additional.FileAges = fileAgesForLevel(vers, i, now)
 	}
 
 	d.mu.Unlock()
 
 	metrics.BlockCache = d.opts.Cache.Metrics()
 	metrics.TableCache, metrics.Filter = d.tableCache.metrics()
+	metrics.MergeCache = d.mergeCache.metrics()
+	metrics.RowCache = d.rowCache.metrics()
+	metrics.IterCategories = d.categoryStats.metrics()
 	metrics.TableIters = int64(d.tableCache.iterCount())
 	return metrics
 }
@@ -1946,6 +2334,161 @@ func (d *DB) EstimateDiskUsage(start, end []byte) (uint64, error) {
 	return totalSize, nil
 }
 
+// EstimateKeyCount returns the estimated number of entries within the
+// sstables of the current version in the range [start, end). The estimate
+// counts every internal key, including tombstones and versions shadowed by
+// newer keys, and excludes the contents of memtables. Tables that are
+// contained within the range contribute their NumEntries property, while
+// tables that partially overlap it contribute a share of NumEntries
+// proportional to the size of their data blocks overlapping the range.
+func (d *DB) EstimateKeyCount(start, end []byte) (uint64, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.cmp(start, end) >= 0 {
+		return 0, errors.New("invalid key-range specified (start >= end)")
+	}
+
+	var count float64
+	err := d.forEachOverlappingTable(start, end, func(file *fileMetadata, r *sstable.Reader) error {
+		if r.Properties.DataSize == 0 {
+			return nil
+		}
+		if !file.Virtual && d.cmp(start, file.Smallest.UserKey) <= 0 &&
+			d.cmp(file.Largest.UserKey, end) < 0 {
+			count += float64(r.Properties.NumEntries)
+			return nil
+		}
+		lo, hi := d.clampToTable(file, start, end)
+		boundaries, err := r.DataBlockBoundaries(lo, hi)
+		if err != nil {
+			return err
+		}
+		entriesPerByte := float64(r.Properties.NumEntries) / float64(r.Properties.DataSize)
+		for _, b := range boundaries {
+			count += float64(b.Length) * entriesPerByte
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint64(count), nil
+}
+
+// SplitRange returns up to n-1 keys that split the range [start, end) into
+// subranges [start, k1), [k1, k2), ..., [kn-1, end) of roughly equal size,
+// suitable for scanning the range in parallel. Sizes are estimated from the
+// sstable boundaries and index block separators of the current version,
+// without reading any data blocks, and exclude the contents of memtables.
+// Fewer keys are returned if the range's sstables are too small to be split
+// n ways.
+func (d *DB) SplitRange(start, end []byte, n int) ([][]byte, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.cmp(start, end) >= 0 {
+		return nil, errors.New("invalid key-range specified (start >= end)")
+	}
+	if n < 1 {
+		return nil, errors.Errorf("invalid number of subranges %d", errors.Safe(n))
+	}
+	if n == 1 {
+		return nil, nil
+	}
+
+	// Attribute the size of each data block within the range to its index
+	// separator, and choose the separators at which the cumulative size
+	// crosses each multiple of 1/n of the total.
+	var boundaries []sstable.DataBlockBoundary
+	err := d.forEachOverlappingTable(start, end, func(file *fileMetadata, r *sstable.Reader) error {
+		lo, hi := d.clampToTable(file, start, end)
+		b, err := r.DataBlockBoundaries(lo, hi)
+		if err != nil {
+			return err
+		}
+		boundaries = append(boundaries, b...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return d.cmp(boundaries[i].Separator, boundaries[j].Separator) < 0
+	})
+	var total uint64
+	for _, b := range boundaries {
+		total += b.Length
+	}
+
+	var splits [][]byte
+	var cumulative uint64
+	next := uint64(1)
+	for _, b := range boundaries {
+		cumulative += b.Length
+		if next >= uint64(n) || cumulative*uint64(n) < total*next {
+			continue
+		}
+		for next < uint64(n) && cumulative*uint64(n) >= total*next {
+			next++
+		}
+		if d.cmp(b.Separator, start) <= 0 || d.cmp(b.Separator, end) >= 0 {
+			continue
+		}
+		if len(splits) > 0 && d.cmp(b.Separator, splits[len(splits)-1]) <= 0 {
+			continue
+		}
+		splits = append(splits, b.Separator)
+	}
+	return splits, nil
+}
+
+// forEachOverlappingTable invokes fn with the reader of each sstable in the
+// current version that overlaps the range [start, end).
+func (d *DB) forEachOverlappingTable(
+	start, end []byte, fn func(file *fileMetadata, r *sstable.Reader) error,
+) error {
+	// Grab and reference the current readState. This prevents the underlying
+	// files in the associated version from being deleted if there is a concurrent
+	// compaction.
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	for level, files := range readState.current.Levels {
+		iter := files.Iter()
+		if level > 0 {
+			overlaps := readState.current.Overlaps(level, d.cmp, start, end, true /* exclusiveEnd */)
+			iter = overlaps.Iter()
+		}
+		for file := iter.First(); file != nil; file = iter.Next() {
+			if d.cmp(file.Smallest.UserKey, end) >= 0 || d.cmp(start, file.Largest.UserKey) > 0 {
+				continue
+			}
+			if err := d.tableCache.withReader(file, func(r *sstable.Reader) error {
+				return fn(file, r)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clampToTable returns the intersection of the range [start, end) with the
+// bounds of the provided sstable. The returned end bound is inclusive of the
+// table's largest key. Clamping restricts the data blocks of a virtual
+// sstable's backing table to those within the virtual sstable.
+func (d *DB) clampToTable(file *fileMetadata, start, end []byte) (lo, hi []byte) {
+	lo, hi = start, end
+	if d.cmp(lo, file.Smallest.UserKey) < 0 {
+		lo = file.Smallest.UserKey
+	}
+	if d.cmp(hi, file.Largest.UserKey) > 0 {
+		hi = file.Largest.UserKey
+	}
+	return lo, hi
+}
+
 func (d *DB) walPreallocateSize() int {
 	// Set the WAL preallocate size to 110% of the memtable size. Note that there
 	// is a bit of apples and oranges in units here as the memtabls size
@@ -1960,6 +2503,24 @@ func (d *DB) walPreallocateSize() int {
 	return size
 }
 
+// walCompression returns the compression to use for the records of a new WAL
+// written at the provided format major version. Compression is only enabled
+// once the format major version guarantees that the WAL is readable by any
+// version that may open the DB.
+func (d *DB) walCompression(vers FormatMajorVersion) record.Compression {
+	if vers < FormatWALCompression {
+		return record.NoCompression
+	}
+	switch d.opts.Experimental.WALCompression {
+	case SnappyCompression:
+		return record.SnappyCompression
+	case ZstdCompression:
+		return record.ZstdCompression
+	default:
+		return record.NoCompression
+	}
+}
+
 func (d *DB) newMemTable(logNum FileNum, logSeqNum uint64) (*memTable, *flushableEntry) {
 	size := d.mu.mem.nextSize
 	if d.mu.mem.nextSize < d.opts.MemTableSize {
@@ -2005,6 +2566,32 @@ func (d *DB) newFlushableEntry(f flushable, logNum FileNum, logSeqNum uint64) *f
 	}
 }
 
+// The reasons for write stalls reported in WriteStallBeginInfo.
+const (
+	writeStallMemTableReason = "memtable count limit reached"
+	writeStallL0Reason       = "L0 file count limit exceeded"
+)
+
+// writeStallReasonLocked returns the reason that makeRoomForWrite would
+// currently stall writing the batch, or the empty string if the batch may be
+// written without stalling. DB.mu must be held.
+func (d *DB) writeStallReasonLocked(b *Batch) string {
+	if b.flushable == nil && b.memTableSize <= uint64(d.mu.mem.mutable.availBytes()) {
+		return ""
+	}
+	var size uint64
+	for i := range d.mu.mem.queue {
+		size += d.mu.mem.queue[i].totalBytes()
+	}
+	if size >= uint64(d.opts.MemTableStopWritesThreshold)*uint64(d.opts.MemTableSize) {
+		return writeStallMemTableReason
+	}
+	if d.mu.versions.currentVersion().L0Sublevels.ReadAmplification() >= d.opts.L0StopWritesThreshold {
+		return writeStallL0Reason
+	}
+	return ""
+}
+
 // makeRoomForWrite ensures that the memtable has room to hold the contents of
 // Batch. It reserves the space in the memtable and adds a reference to the
 // memtable. The caller must later ensure that the memtable is unreferenced. If
@@ -2048,7 +2635,7 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 				if !stalled {
 					stalled = true
 					d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
-						Reason: "memtable count limit reached",
+						Reason: writeStallMemTableReason,
 					})
 				}
 				now := time.Now()
@@ -2065,7 +2652,7 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 			if !stalled {
 				stalled = true
 				d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
-					Reason: "L0 file count limit exceeded",
+					Reason: writeStallL0Reason,
 				})
 			}
 			now := time.Now()
@@ -2279,6 +2866,7 @@ func (d *DB) recycleWAL() (newLogNum FileNum, prevLogSize uint64) {
 		WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
 		WALMinSyncInterval: d.opts.WALMinSyncInterval,
 		QueueSemChan:       d.commit.logSyncQSem,
+		Compression:        d.walCompression(d.mu.formatVers.vers),
 	})
 	if d.mu.log.registerLogWriterForTesting != nil {
 		d.mu.log.registerLogWriterForTesting(d.mu.log.LogWriter)
@@ -1477,3 +1477,244 @@ func verifyGetNotFound(t *testing.T, r Reader, key []byte) {
 		t.Fatalf("expected nil, but got %s", val)
 	}
 }
+
+// syncBlockingFS blocks syncs of WAL files while blocking is enabled.
+type syncBlockingFS struct {
+	vfs.FS
+	blocking atomic.Bool
+	unblock  chan struct{}
+}
+
+func (fs *syncBlockingFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	return fs.maybeWrap(name, f), err
+}
+
+func (fs *syncBlockingFS) ReuseForWrite(oldname, newname string) (vfs.File, error) {
+	f, err := fs.FS.ReuseForWrite(oldname, newname)
+	return fs.maybeWrap(newname, f), err
+}
+
+func (fs *syncBlockingFS) maybeWrap(name string, f vfs.File) vfs.File {
+	if f == nil || !strings.HasSuffix(name, ".log") {
+		return f
+	}
+	return &syncBlockingFile{File: f, fs: fs}
+}
+
+type syncBlockingFile struct {
+	vfs.File
+	fs *syncBlockingFS
+}
+
+func (f *syncBlockingFile) Sync() error {
+	if f.fs.blocking.Load() {
+		<-f.fs.unblock
+	}
+	return f.File.Sync()
+}
+
+func (f *syncBlockingFile) SyncData() error {
+	if f.fs.blocking.Load() {
+		<-f.fs.unblock
+	}
+	return f.File.SyncData()
+}
+
+func TestApplyWithContext(t *testing.T) {
+	get := func(d *DB, key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		d, err := Open("", &Options{FS: vfs.NewMem()})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+		require.True(t, errors.Is(b.CommitWithContext(ctx, nil), context.Canceled))
+		require.NoError(t, b.Close())
+		require.Equal(t, "<not found>", get(d, "a"))
+	})
+
+	t.Run("write-stall", func(t *testing.T) {
+		fs := &blockingCreateFS{
+			FS:      vfs.NewMem(),
+			created: make(chan struct{}),
+			unblock: make(chan struct{}),
+		}
+		var stalls atomic.Int32
+		d, err := Open("", &Options{
+			FS:                          fs,
+			MemTableSize:                initialMemTableSize,
+			MemTableStopWritesThreshold: 2,
+			EventListener: &EventListener{
+				WriteStallBegin: func(WriteStallBeginInfo) { stalls.Add(1) },
+			},
+		})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+
+		// Block a flush, so that the queue of memtables is full.
+		require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+		fs.blocking.Store(true)
+		flushed, err := d.AsyncFlush()
+		require.NoError(t, err)
+		<-fs.created
+
+		// A large batch requires rotating the memtable, and stalls until the
+		// flush completes.
+		value := bytes.Repeat([]byte("v"), initialMemTableSize/2)
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte("b"), value, nil))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = d.ApplyWithContext(ctx, b, Sync)
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+		require.Equal(t, "<not found>", get(d, "b"))
+		// The batch was never written, so there is no sync to wait for.
+		err = b.SyncWait()
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+		require.Greater(t, b.CommitStats().MemTableWriteStallDuration, time.Duration(0))
+		// The batch waited for the stall without blocking the commit pipeline,
+		// so no stall of the pipeline was reported.
+		require.Equal(t, int32(0), stalls.Load())
+
+		require.NoError(t, b.Close())
+
+		// The commit pipeline remains usable once the stall ends.
+		fs.blocking.Store(false)
+		close(fs.unblock)
+		<-flushed
+		b = d.NewBatch()
+		require.NoError(t, b.Set([]byte("b"), value, nil))
+		require.NoError(t, b.CommitWithContext(context.Background(), nil))
+		require.NoError(t, b.Close())
+		require.Equal(t, string(value), get(d, "b"))
+	})
+
+	t.Run("wal-sync", func(t *testing.T) {
+		fs := &syncBlockingFS{FS: vfs.NewMem(), unblock: make(chan struct{})}
+		d, err := Open("", &Options{FS: fs})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+
+		fs.blocking.Store(true)
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err = b.CommitWithContext(ctx, Sync)
+		require.True(t, errors.Is(err, ErrSyncUnknown), "%v", err)
+		require.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+		// The batch is committed, though its sync has not completed.
+		require.Equal(t, "1", get(d, "a"))
+
+		fs.blocking.Store(false)
+		close(fs.unblock)
+		require.NoError(t, b.SyncWait())
+		require.NoError(t, b.Close())
+
+		// Once syncs complete, a commit with a context waits for its sync.
+		b = d.NewBatch()
+		require.NoError(t, b.Set([]byte("b"), []byte("2"), nil))
+		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		require.NoError(t, b.CommitWithContext(ctx, Sync))
+		require.NoError(t, b.Close())
+		require.Equal(t, "2", get(d, "b"))
+	})
+}
+
+func TestSplitRange(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		Levels:                      []LevelOptions{{BlockSize: 512, TargetFileSize: 64 << 10}},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	start, end := []byte("a"), []byte("z")
+	splits, err := d.SplitRange(start, end, 4)
+	require.NoError(t, err)
+	require.Empty(t, splits)
+
+	const numKeys = 10000
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	value := bytes.Repeat([]byte("v"), 100)
+	b := d.NewBatch()
+	for i := 0; i < numKeys; i++ {
+		require.NoError(t, b.Set(key(i), value, nil))
+	}
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact(start, end, false /* parallelize */))
+	// Overwrite a subset of the keys, leaving an sstable in L0.
+	for i := 0; i < numKeys; i += 10 {
+		require.NoError(t, d.Set(key(i), value, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.Less(t, int64(1), d.Metrics().Levels[numLevels-1].NumFiles)
+
+	// The sstables are contained within the range, so their key counts are
+	// exact.
+	count, err := d.EstimateKeyCount(start, end)
+	require.NoError(t, err)
+	require.Equal(t, uint64(numKeys+numKeys/10), count)
+	count, err = d.EstimateKeyCount(key(2000), key(4000))
+	require.NoError(t, err)
+	require.InDelta(t, 2200, float64(count), 300)
+
+	countKeys := func(lower, upper []byte) int {
+		iter := d.NewIter(&IterOptions{LowerBound: lower, UpperBound: upper})
+		n := 0
+		for valid := iter.First(); valid; valid = iter.Next() {
+			n++
+		}
+		require.NoError(t, iter.Close())
+		return n
+	}
+	for _, n := range []int{2, 4, 7} {
+		splits, err := d.SplitRange(start, end, n)
+		require.NoError(t, err)
+		require.Len(t, splits, n-1)
+		bounds := append(append([][]byte{start}, splits...), end)
+		for i := 1; i < len(bounds); i++ {
+			require.Less(t, d.cmp(bounds[i-1], bounds[i]), 0)
+			require.InDelta(t, numKeys/n, countKeys(bounds[i-1], bounds[i]), float64(numKeys/n/5))
+		}
+	}
+
+	splits, err = d.SplitRange(key(1000), key(2000), 2)
+	require.NoError(t, err)
+	require.Len(t, splits, 1)
+	require.InDelta(t, 500, countKeys(key(1000), splits[0]), 100)
+
+	s := d.NewSnapshot()
+	defer s.Close()
+	snapSplits, err := s.SplitRange(start, end, 4)
+	require.NoError(t, err)
+	splits, err = d.SplitRange(start, end, 4)
+	require.NoError(t, err)
+	require.Equal(t, splits, snapSplits)
+
+	splits, err = d.SplitRange(start, end, 1)
+	require.NoError(t, err)
+	require.Empty(t, splits)
+	_, err = d.SplitRange(start, end, 0)
+	require.Error(t, err)
+	_, err = d.SplitRange(end, start, 2)
+	require.Error(t, err)
+	_, err = d.EstimateKeyCount(end, start)
+	require.Error(t, err)
+}
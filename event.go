@@ -358,6 +358,30 @@ func (i TableStatsInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("[JOB %d] all initial table stats loaded", redact.Safe(i.JobID))
 }
 
+// SingleDeleteMisuseInfo contains the info for a SingleDelete misuse event.
+// See Options.Experimental.DetectSingleDeleteMisuse.
+type SingleDeleteMisuseInfo struct {
+	// JobID is the ID of the flush or compaction that detected the misuse.
+	JobID int
+	// Key is the user key of the misused SingleDelete.
+	Key []byte
+	// Levels are the levels of the flush or compaction's inputs, in order. A
+	// level of -1 denotes the memtables being flushed.
+	Levels []int
+	// Reason describes the misuse.
+	Reason string
+}
+
+func (i SingleDeleteMisuseInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i SingleDeleteMisuseInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("[JOB %d] SingleDelete misuse of key %q in levels %v: %s",
+		redact.Safe(i.JobID), i.Key, redact.Safe(i.Levels), redact.Safe(i.Reason))
+}
+
 // TableValidatedInfo contains information on the result of a validation run
 // on an sstable.
 type TableValidatedInfo struct {
@@ -443,6 +467,31 @@ func (i WriteStallBeginInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("write stall beginning: %s", redact.Safe(i.Reason))
 }
 
+// WriteThrottleInfo contains the info for a write throttle change event.
+type WriteThrottleInfo struct {
+	// Level is the throttling level, between 0 (unthrottled) and 1.
+	Level float64
+	// Rate is the rate, in bytes per second, at which batches are admitted. It
+	// is 0 if writes are not throttled.
+	Rate int64
+	// Reason describes the limit that writes are approaching.
+	Reason string
+}
+
+func (i WriteThrottleInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i WriteThrottleInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	if i.Level == 0 {
+		w.Printf("write throttle released")
+		return
+	}
+	w.Printf("write throttle at %.2f (%s/s): %s", redact.Safe(i.Level),
+		redact.Safe(humanize.Uint64(uint64(i.Rate))), redact.Safe(i.Reason))
+}
+
 // EventListener contains a set of functions that will be invoked when various
 // significant DB events occur. Note that the functions should not run for an
 // excessive amount of time as they are invoked synchronously by the DB and may
@@ -489,6 +538,10 @@ type EventListener struct {
 	// ManifestDeleted is invoked after a manifest has been deleted.
 	ManifestDeleted func(ManifestDeleteInfo)
 
+	// SingleDeleteMisuse is invoked when a flush or compaction detects the
+	// misuse of a SingleDelete. See Options.Experimental.DetectSingleDeleteMisuse.
+	SingleDeleteMisuse func(SingleDeleteMisuseInfo)
+
 	// TableCreated is invoked when a table has been created.
 	TableCreated func(TableCreateInfo)
 
@@ -517,6 +570,11 @@ type EventListener struct {
 
 	// WriteStallEnd is invoked when delayed writes are released.
 	WriteStallEnd func()
+
+	// WriteThrottleChanged is invoked when the level at which writes are
+	// gradually throttled changes significantly. See
+	// Options.Experimental.WriteThrottleRate.
+	WriteThrottleChanged func(WriteThrottleInfo)
 }
 
 // EnsureDefaults ensures that background error events are logged to the
@@ -557,6 +615,9 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.ManifestDeleted == nil {
 		l.ManifestDeleted = func(info ManifestDeleteInfo) {}
 	}
+	if l.SingleDeleteMisuse == nil {
+		l.SingleDeleteMisuse = func(info SingleDeleteMisuseInfo) {}
+	}
 	if l.TableCreated == nil {
 		l.TableCreated = func(info TableCreateInfo) {}
 	}
@@ -584,6 +645,9 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.WriteStallEnd == nil {
 		l.WriteStallEnd = func() {}
 	}
+	if l.WriteThrottleChanged == nil {
+		l.WriteThrottleChanged = func(info WriteThrottleInfo) {}
+	}
 }
 
 // MakeLoggingEventListener creates an EventListener that logs all events to the
@@ -621,6 +685,9 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		ManifestDeleted: func(info ManifestDeleteInfo) {
 			logger.Infof("%s", info)
 		},
+		SingleDeleteMisuse: func(info SingleDeleteMisuseInfo) {
+			logger.Infof("%s", info)
+		},
 		TableCreated: func(info TableCreateInfo) {
 			logger.Infof("%s", info)
 		},
@@ -648,6 +715,9 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		WriteStallEnd: func() {
 			logger.Infof("write stall ending")
 		},
+		WriteThrottleChanged: func(info WriteThrottleInfo) {
+			logger.Infof("%s", info)
+		},
 	}
 }
 
@@ -692,6 +762,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.ManifestDeleted(info)
 			b.ManifestDeleted(info)
 		},
+		SingleDeleteMisuse: func(info SingleDeleteMisuseInfo) {
+			a.SingleDeleteMisuse(info)
+			b.SingleDeleteMisuse(info)
+		},
 		TableCreated: func(info TableCreateInfo) {
 			a.TableCreated(info)
 			b.TableCreated(info)
@@ -728,5 +802,9 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.WriteStallEnd()
 			b.WriteStallEnd()
 		},
+		WriteThrottleChanged: func(info WriteThrottleInfo) {
+			a.WriteThrottleChanged(info)
+			b.WriteThrottleChanged(info)
+		},
 	}
 }
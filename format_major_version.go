@@ -151,6 +151,25 @@ const (
 	// compactions for files marked for compaction are complete.
 	FormatPrePebblev1MarkedCompacted
 
+	// FormatWALCompression is a format major version that enables compression
+	// of WAL records (see Options.Experimental.WALCompression). Compressed
+	// records use chunk types that earlier versions are unable to read.
+	FormatWALCompression
+
+	// FormatDeleteSized is a format major version that adds support for
+	// deletion tombstones that encode the size of the value they're expected
+	// to delete (see DB.DeleteSized). These DELSIZED keys are written to the
+	// WAL, memtables and sstables, and earlier versions are unable to read
+	// them.
+	FormatDeleteSized
+
+	// FormatPartitionedFilters is a format major version that adds support for
+	// sstables with partitioned filters (sstable.TableFormatPebblev4). When a
+	// table has a two-level index, its filter is split into partitions aligned
+	// with the index partitions, so that point reads only need to load the
+	// relevant partition into the block cache.
+	FormatPartitionedFilters
+
 	// FormatNewest always contains the most recent format major version.
 	FormatNewest FormatMajorVersion = iota - 1
 )
@@ -169,8 +188,10 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 		FormatUnusedPrePebblev1MarkedCompacted:
 		return sstable.TableFormatPebblev2
 	case FormatSSTableValueBlocks, FormatFlushableIngest,
-		FormatPrePebblev1MarkedCompacted:
+		FormatPrePebblev1MarkedCompacted, FormatWALCompression, FormatDeleteSized:
 		return sstable.TableFormatPebblev3
+	case FormatPartitionedFilters:
+		return sstable.TableFormatPebblev4
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
 	}
@@ -187,7 +208,8 @@ func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 		return sstable.TableFormatLevelDB
 	case FormatMinTableFormatPebblev1, FormatPrePebblev1Marked,
 		FormatUnusedPrePebblev1MarkedCompacted, FormatSSTableValueBlocks,
-		FormatFlushableIngest, FormatPrePebblev1MarkedCompacted:
+		FormatFlushableIngest, FormatPrePebblev1MarkedCompacted, FormatWALCompression,
+		FormatDeleteSized, FormatPartitionedFilters:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -320,6 +342,15 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 		}
 		return d.finalizeFormatVersUpgrade(FormatPrePebblev1MarkedCompacted)
 	},
+	FormatWALCompression: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatWALCompression)
+	},
+	FormatDeleteSized: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatDeleteSized)
+	},
+	FormatPartitionedFilters: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatPartitionedFilters)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -21,6 +21,7 @@ type getIter struct {
 	logger       Logger
 	cmp          Compare
 	equal        Equal
+	split        Split
 	newIters     tableNewIters
 	snapshot     uint64
 	key          []byte
@@ -149,7 +150,14 @@ func (g *getIter) Next() (*InternalKey, base.LazyValue) {
 			g.iter = m.newIter(nil)
 			g.rangeDelIter = m.newRangeDelIter(nil)
 			g.mem = g.mem[:n-1]
-			g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+			if g.split != nil {
+				// A prefix seek allows memtable representations partitioned by
+				// prefix to search a single partition.
+				prefix := g.key[:g.split(g.key)]
+				g.iterKey, g.iterValue = g.iter.SeekPrefixGE(prefix, g.key, base.SeekGEFlagsNone)
+			} else {
+				g.iterKey, g.iterValue = g.iter.SeekGE(g.key, base.SeekGEFlagsNone)
+			}
 			continue
 		}
 
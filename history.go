@@ -0,0 +1,119 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/cockroachdb/errors"
+)
+
+// VisibleSeqNum returns the DB's visible sequence number. Reads observe the
+// writes with sequence numbers less than it.
+func (d *DB) VisibleSeqNum() uint64 {
+	return d.mu.versions.visibleSeqNum.Load()
+}
+
+// HistoryHorizon returns the oldest sequence number at which the DB may be read
+// through NewIterAt and GetAt. It returns zero if
+// Options.Experimental.RetainHistory is disabled.
+func (d *DB) HistoryHorizon() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.mu.snapshots.historyHorizon
+}
+
+// SetHistoryHorizon advances the DB's history horizon to seqNum, permitting
+// flushes and compactions to discard the versions of keys that are only
+// visible to reads at sequence numbers older than seqNum. The horizon may not
+// move backwards, nor beyond the DB's visible sequence number. Requires
+// Options.Experimental.RetainHistory.
+func (d *DB) SetHistoryHorizon(seqNum uint64) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if !d.opts.Experimental.RetainHistory {
+		return errors.New("pebble: history retention is not enabled")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if seqNum < d.mu.snapshots.historyHorizon {
+		return errors.Errorf("pebble: history horizon %d precedes the current horizon %d",
+			errors.Safe(seqNum), errors.Safe(d.mu.snapshots.historyHorizon))
+	}
+	if visible := d.mu.versions.visibleSeqNum.Load(); seqNum > visible {
+		return errors.Errorf("pebble: history horizon %d exceeds the visible sequence number %d",
+			errors.Safe(seqNum), errors.Safe(visible))
+	}
+	d.mu.snapshots.historyHorizon = seqNum
+	return nil
+}
+
+// NewIterAt returns an iterator over the DB as of the sequence number seqNum,
+// observing the writes with sequence numbers less than seqNum. The sequence
+// number must lie within the DB's retained history window, between
+// HistoryHorizon and VisibleSeqNum inclusive; otherwise NewIterAt returns an
+// error marked with ErrHistoryUnavailable. Requires
+// Options.Experimental.RetainHistory.
+func (d *DB) NewIterAt(seqNum uint64, o *IterOptions) (*Iterator, error) {
+	s, err := d.historyIterOpts(seqNum)
+	if err != nil {
+		return nil, err
+	}
+	return d.newIter(context.Background(), nil /* batch */, s, o), nil
+}
+
+// GetAt is like Get, but reads the DB as of the sequence number seqNum. See
+// NewIterAt.
+func (d *DB) GetAt(key []byte, seqNum uint64) ([]byte, io.Closer, error) {
+	s, err := d.historyIterOpts(seqNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.getInternal(key, nil /* batch */, s)
+}
+
+// historyIterOpts validates that seqNum lies within the retained history
+// window and returns the options for reading at it. The read state is loaded
+// while d.mu is held, so a concurrent advance of the horizon cannot discard
+// the history the read observes.
+func (d *DB) historyIterOpts(seqNum uint64) (snapshotIterOpts, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if !d.opts.Experimental.RetainHistory {
+		return snapshotIterOpts{}, errors.New("pebble: history retention is not enabled")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	horizon := d.mu.snapshots.historyHorizon
+	visible := d.mu.versions.visibleSeqNum.Load()
+	if seqNum < horizon || seqNum > visible {
+		return snapshotIterOpts{}, errors.Mark(
+			errors.Errorf("pebble: sequence number %d is outside the retained history [%d, %d]",
+				errors.Safe(seqNum), errors.Safe(horizon), errors.Safe(visible)),
+			ErrHistoryUnavailable)
+	}
+	return snapshotIterOpts{seqNum: seqNum, readState: d.loadReadState()}, nil
+}
+
+// withHistoryHorizon returns the sorted snapshots with the history horizon
+// inserted, if non-zero, such that the versions of keys visible at the horizon
+// are retained. The provided slice is not modified.
+func withHistoryHorizon(snapshots []uint64, horizon uint64) []uint64 {
+	if horizon == 0 {
+		return snapshots
+	}
+	i := sort.Search(len(snapshots), func(i int) bool { return snapshots[i] >= horizon })
+	if i < len(snapshots) && snapshots[i] == horizon {
+		return snapshots
+	}
+	s := make([]uint64, 0, len(snapshots)+1)
+	s = append(s, snapshots[:i]...)
+	s = append(s, horizon)
+	return append(s, snapshots[i:]...)
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetainHistory(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	}
+	opts.Experimental.RetainHistory = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	getAt := func(key string, seqNum uint64) string {
+		v, closer, err := d.GetAt([]byte(key), seqNum)
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	scan := func(iter *Iterator) string {
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, fmt.Sprintf("%s:%s", iter.Key(), iter.Value()))
+		}
+		require.NoError(t, iter.Close())
+		return strings.Join(keys, " ")
+	}
+	scanAt := func(seqNum uint64) string {
+		iter, err := d.NewIterAt(seqNum, nil)
+		require.NoError(t, err)
+		return scan(iter)
+	}
+	compact := func() {
+		// Overwrite a key within the bounds of the existing sstable, so that
+		// the compaction rewrites it rather than moving a flushed sstable.
+		require.NoError(t, d.Set([]byte("aa"), []byte("x"), nil))
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.Compact([]byte("a"), []byte("z"), false /* parallelize */))
+	}
+
+	start := d.VisibleSeqNum()
+	require.Equal(t, start, d.HistoryHorizon())
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	s1 := d.VisibleSeqNum()
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.DeleteRange([]byte("b"), []byte("c"), nil))
+	s2 := d.VisibleSeqNum()
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	s3 := d.VisibleSeqNum()
+
+	// Flushes and compactions into the bottommost level retain every version
+	// newer than the horizon, including tombstones.
+	for i := 0; i < 2; i++ {
+		require.Equal(t, "<not found>", getAt("a", start))
+		require.Equal(t, "1", getAt("a", s1))
+		require.Equal(t, "2", getAt("a", s2))
+		require.Equal(t, "<not found>", getAt("a", s3))
+		require.Equal(t, "", scanAt(start))
+		require.Equal(t, "a:1 b:1", scanAt(s1))
+		require.Equal(t, "a:2", scanAt(s2))
+		require.Equal(t, "", scanAt(s3))
+		compact()
+	}
+
+	// Sequence numbers outside of the window are rejected.
+	_, _, err = d.GetAt([]byte("a"), start-1)
+	require.True(t, errors.Is(err, ErrHistoryUnavailable))
+	_, err = d.NewIterAt(d.VisibleSeqNum()+1, nil)
+	require.True(t, errors.Is(err, ErrHistoryUnavailable))
+
+	// Advancing the horizon permits compactions to discard the history
+	// preceding it.
+	require.NoError(t, d.SetHistoryHorizon(s2))
+	require.Equal(t, s2, d.HistoryHorizon())
+	_, _, err = d.GetAt([]byte("a"), s1)
+	require.True(t, errors.Is(err, ErrHistoryUnavailable))
+	require.Error(t, d.SetHistoryHorizon(s1))
+	require.Error(t, d.SetHistoryHorizon(d.VisibleSeqNum()+1))
+	compact()
+	require.Equal(t, "2", getAt("a", s2))
+	require.Equal(t, "<not found>", getAt("a", s3))
+	// The versions preceding the horizon collapsed into the state at the
+	// horizon, whose sequence numbers were zeroed. Bypass the validation of
+	// NewIterAt to observe it.
+	iter := d.newIter(context.Background(), nil /* batch */, snapshotIterOpts{seqNum: s1}, nil)
+	require.Equal(t, "a:2", scan(iter))
+
+	require.NoError(t, d.SetHistoryHorizon(d.VisibleSeqNum()))
+	compact()
+	iter = d.newIter(context.Background(), nil /* batch */, snapshotIterOpts{seqNum: s2}, nil)
+	require.Equal(t, "aa:x", scan(iter))
+	require.Equal(t, "aa:x", scanAt(d.VisibleSeqNum()))
+}
+
+func TestRetainHistoryDisabled(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.Zero(t, d.HistoryHorizon())
+	require.Error(t, d.SetHistoryHorizon(d.VisibleSeqNum()))
+	_, err = d.NewIterAt(d.VisibleSeqNum(), nil)
+	require.Error(t, err)
+	_, _, err = d.GetAt([]byte("a"), d.VisibleSeqNum())
+	require.Error(t, err)
+}
+
+func TestWithHistoryHorizon(t *testing.T) {
+	require.Equal(t, []uint64{1, 2}, withHistoryHorizon([]uint64{1, 2}, 0))
+	require.Equal(t, []uint64{5}, withHistoryHorizon(nil, 5))
+	require.Equal(t, []uint64{1, 5, 9}, withHistoryHorizon([]uint64{1, 9}, 5))
+	require.Equal(t, []uint64{1, 5, 9}, withHistoryHorizon([]uint64{1, 5, 9}, 5))
+	require.Equal(t, []uint64{1, 9, 10}, withHistoryHorizon([]uint64{1, 9}, 10))
+
+	// The provided slice is not modified.
+	s := []uint64{1, 9, 12}
+	withHistoryHorizon(s[:2], 5)
+	require.Equal(t, []uint64{1, 9, 12}, s)
+}
@@ -851,6 +851,12 @@ func (d *DB) ingest(
 	prepare := func(seqNum uint64) {
 		// Note that d.commit.mu is held by commitPipeline when calling prepare.
 
+		if d.rowCache != nil {
+			// Invalidate the row cache before the ingested sstables become
+			// visible.
+			d.rowCache.invalidateAll(seqNum + uint64(len(meta)) - 1)
+		}
+
 		d.mu.Lock()
 		defer d.mu.Unlock()
 
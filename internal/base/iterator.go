@@ -351,6 +351,11 @@ type InternalIteratorStats struct {
 	BlockBytes uint64
 	// Subset of BlockBytes that were in the block cache.
 	BlockBytesInCache uint64
+	// BlockCacheHits and BlockCacheMisses count the blocks that were, and were
+	// not, found in the block cache when loaded. Blocks read ahead of time by
+	// prefetching count as misses.
+	BlockCacheHits   uint64
+	BlockCacheMisses uint64
 	// BlockReadDuration accumulates the duration spent fetching blocks
 	// due to block cache misses.
 	// TODO(sumeer): this currently excludes the time spent in Reader creation,
@@ -392,12 +397,24 @@ type InternalIteratorStats struct {
 		// blocks) that were retrieved.
 		ValueBytesFetched uint64
 	}
+
+	// Stats related to the asynchronous prefetching of blocks. See
+	// IterOptions.PrefetchBlocks.
+	Prefetch struct {
+		// Hits is the count of blocks loaded from blocks that were prefetched.
+		Hits uint64
+		// Misses is the count of blocks loaded sequentially that had not
+		// been prefetched, and were read synchronously.
+		Misses uint64
+	}
 }
 
 // Merge merges the stats in from into the given stats.
 func (s *InternalIteratorStats) Merge(from InternalIteratorStats) {
 	s.BlockBytes += from.BlockBytes
 	s.BlockBytesInCache += from.BlockBytesInCache
+	s.BlockCacheHits += from.BlockCacheHits
+	s.BlockCacheMisses += from.BlockCacheMisses
 	s.BlockReadDuration += from.BlockReadDuration
 	s.KeyBytes += from.KeyBytes
 	s.ValueBytes += from.ValueBytes
@@ -406,4 +423,6 @@ func (s *InternalIteratorStats) Merge(from InternalIteratorStats) {
 	s.SeparatedPointValue.Count += from.SeparatedPointValue.Count
 	s.SeparatedPointValue.ValueBytes += from.SeparatedPointValue.ValueBytes
 	s.SeparatedPointValue.ValueBytesFetched += from.SeparatedPointValue.ValueBytesFetched
+	s.Prefetch.Hits += from.Prefetch.Hits
+	s.Prefetch.Misses += from.Prefetch.Misses
 }
@@ -76,6 +76,29 @@ type DeletableValueMerger interface {
 	DeletableFinish(includesBase bool) (value []byte, delete bool, closer io.Closer, err error)
 }
 
+// LazyValueMerger is an extension to ValueMerger which receives merge operands
+// as LazyValues, allowing a merger to avoid fetching operands it does not need.
+// For example, an operand stored in an sstable's value block is only read if
+// the merger calls LazyValue.Value. When a ValueMerger implements
+// LazyValueMerger, iterators submit all operands other than the one passed to
+// Merge through MergeNewerLazy or MergeOlderLazy, instead of MergeNewer or
+// MergeOlder.
+type LazyValueMerger interface {
+	ValueMerger
+
+	// MergeNewerLazy adds an operand that is newer than all existing
+	// operands. The LazyValue, and any value it returns, is only valid for the
+	// duration of the call, and must be copied if it is retained. See
+	// MergeNewer.
+	MergeNewerLazy(value LazyValue) error
+
+	// MergeOlderLazy adds an operand that is older than all existing
+	// operands. The LazyValue, and any value it returns, is only valid for the
+	// duration of the call, and must be copied if it is retained. See
+	// MergeOlder.
+	MergeOlderLazy(value LazyValue) error
+}
+
 // Merger defines an associative merge operation. The merge operation merges
 // two or more values for a single key. A merge operation is requested by
 // writing a value using {Batch,DB}.Merge(). The value at that key is merged
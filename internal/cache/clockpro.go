@@ -52,6 +52,74 @@ func (k key) String() string {
 	return fmt.Sprintf("%d/%d/%d", k.id, k.fileNum, k.offset)
 }
 
+// Priority is the priority class of a cached value. Unreferenced high
+// priority values are retained in preference to low priority values, while
+// the high priority values occupy less than the cache's high priority
+// fraction. The fraction is shared by the high priority values of every
+// BlockKind; there is no separate fraction per kind of block. See
+// Cache.SetHighPriorityFraction.
+type Priority int8
+
+const (
+	// LowPriority is the priority of values that are unlikely to be reused
+	// soon, such as the data blocks read by scans.
+	LowPriority Priority = iota
+	// HighPriority is the priority of values that are likely to be reused,
+	// such as index and filter blocks.
+	HighPriority
+)
+
+func (p Priority) String() string {
+	switch p {
+	case LowPriority:
+		return "low"
+	case HighPriority:
+		return "high"
+	}
+	return "unknown"
+}
+
+// BlockKind identifies the kind of a cached block. The cache records its hits
+// and misses per kind of block.
+type BlockKind int8
+
+const (
+	// UnknownBlock is the kind of blocks retrieved through Cache.Get.
+	UnknownBlock BlockKind = iota
+	// DataBlock is the kind of sstable data blocks.
+	DataBlock
+	// ValueBlock is the kind of sstable value blocks.
+	ValueBlock
+	// IndexBlock is the kind of sstable index blocks, including top-level
+	// index blocks.
+	IndexBlock
+	// FilterBlock is the kind of sstable filter blocks.
+	FilterBlock
+	// MetadataBlock is the kind of other sstable blocks, such as range
+	// deletion, range key and value index blocks.
+	MetadataBlock
+	// NumBlockKinds is the number of kinds of blocks.
+	NumBlockKinds
+)
+
+func (k BlockKind) String() string {
+	switch k {
+	case UnknownBlock:
+		return "unknown"
+	case DataBlock:
+		return "data"
+	case ValueBlock:
+		return "value"
+	case IndexBlock:
+		return "index"
+	case FilterBlock:
+		return "filter"
+	case MetadataBlock:
+		return "metadata"
+	}
+	return "invalid"
+}
+
 // Handle provides a strong reference to a value in the cache. The reference
 // does not pin the value in the cache, but it does prevent the underlying byte
 // slice from being reused.
@@ -79,6 +147,9 @@ func (h Handle) Release() {
 type shard struct {
 	hits   int64
 	misses int64
+	// kindHits and kindMisses break down hits and misses by BlockKind.
+	kindHits   [NumBlockKinds]int64
+	kindMisses [NumBlockKinds]int64
 
 	mu sync.RWMutex
 
@@ -102,6 +173,11 @@ type shard struct {
 	sizeHot  int64
 	sizeCold int64
 	sizeTest int64
+	// sizeHigh is the size of the hot and cold entries with HighPriority.
+	sizeHigh int64
+	// highPriorityFraction is the fraction of the target size within which
+	// unreferenced high priority entries are protected from eviction.
+	highPriorityFraction float64
 
 	// The count fields are used exclusively for asserting expectations.
 	// We've seen infinite looping (cockroachdb/cockroach#70154) that
@@ -113,7 +189,7 @@ type shard struct {
 	countTest int64
 }
 
-func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
+func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64, kind BlockKind) Handle {
 	c.mu.RLock()
 	var value *Value
 	if e := c.blocks.Get(key{fileKey{id, fileNum}, offset}); e != nil {
@@ -125,13 +201,17 @@ func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
 	c.mu.RUnlock()
 	if value == nil {
 		atomic.AddInt64(&c.misses, 1)
+		atomic.AddInt64(&c.kindMisses[kind], 1)
 		return Handle{}
 	}
 	atomic.AddInt64(&c.hits, 1)
+	atomic.AddInt64(&c.kindHits[kind], 1)
 	return Handle{value: value}
 }
 
-func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value) Handle {
+func (c *shard) Set(
+	id uint64, fileNum base.DiskFileNum, offset uint64, value *Value, pri Priority,
+) Handle {
 	if n := value.refs(); n != 1 {
 		panic(fmt.Sprintf("pebble: Value has already been added to the cache: refs=%d", n))
 	}
@@ -146,11 +226,13 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 	case e == nil:
 		// no cache entry? add it
 		e = newEntry(c, k, int64(len(value.buf)))
+		e.priority = pri
 		e.setValue(value)
 		if c.metaAdd(k, e) {
 			value.ref.trace("add-cold")
 			c.sizeCold += e.size
 			c.countCold++
+			c.addHigh(e, e.size)
 		} else {
 			value.ref.trace("skip-cold")
 			e.free()
@@ -162,7 +244,10 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 		e.setValue(value)
 		atomic.StoreInt32(&e.referenced, 1)
 		delta := int64(len(value.buf)) - e.size
+		c.addHigh(e, -e.size)
 		e.size = int64(len(value.buf))
+		e.priority = pri
+		c.addHigh(e, e.size)
 		if e.ptype == etHot {
 			value.ref.trace("add-hot")
 			c.sizeHot += delta
@@ -188,10 +273,12 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 		atomic.StoreInt32(&e.referenced, 0)
 		e.setValue(value)
 		e.ptype = etHot
+		e.priority = pri
 		if c.metaAdd(k, e) {
 			value.ref.trace("add-hot")
 			c.sizeHot += e.size
 			c.countHot++
+			c.addHigh(e, e.size)
 		} else {
 			value.ref.trace("skip-hot")
 			e.free()
@@ -209,9 +296,11 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 func (c *shard) checkConsistency() {
 	// See the comment above the count{Hot,Cold,Test} fields.
 	switch {
-	case c.sizeHot < 0 || c.sizeCold < 0 || c.sizeTest < 0 || c.countHot < 0 || c.countCold < 0 || c.countTest < 0:
-		panic(fmt.Sprintf("pebble: unexpected negative: %d (%d bytes) hot, %d (%d bytes) cold, %d (%d bytes) test",
-			c.countHot, c.sizeHot, c.countCold, c.sizeCold, c.countTest, c.sizeTest))
+	case c.sizeHot < 0 || c.sizeCold < 0 || c.sizeTest < 0 || c.countHot < 0 || c.countCold < 0 || c.countTest < 0 || c.sizeHigh < 0:
+		panic(fmt.Sprintf("pebble: unexpected negative: %d (%d bytes) hot, %d (%d bytes) cold, %d (%d bytes) test, %d bytes high priority",
+			c.countHot, c.sizeHot, c.countCold, c.sizeCold, c.countTest, c.sizeTest, c.sizeHigh))
+	case c.sizeHigh > c.sizeHot+c.sizeCold:
+		panic(fmt.Sprintf("pebble: mismatch %d high priority size, %d hot size, %d cold size", c.sizeHigh, c.sizeHot, c.sizeCold))
 	case c.sizeHot > 0 && c.countHot == 0:
 		panic(fmt.Sprintf("pebble: mismatch %d hot size, %d hot count", c.sizeHot, c.countHot))
 	case c.sizeCold > 0 && c.countCold == 0:
@@ -308,6 +397,29 @@ func (c *shard) Size() int64 {
 	return size
 }
 
+// SetHighPriorityFraction sets the fraction of the target size within which
+// unreferenced high priority entries are protected from eviction.
+func (c *shard) SetHighPriorityFraction(fraction float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.highPriorityFraction = fraction
+}
+
+// addHigh adds delta to sizeHigh if e has HighPriority.
+func (c *shard) addHigh(e *entry, delta int64) {
+	if e.priority == HighPriority {
+		c.sizeHigh += delta
+	}
+}
+
+// protected returns true if e is a high priority entry that must not be
+// evicted, because the high priority entries occupy no more than their
+// fraction of the target size.
+func (c *shard) protected(e *entry) bool {
+	return e.priority == HighPriority &&
+		float64(c.sizeHigh) <= c.highPriorityFraction*float64(c.targetSize())
+}
+
 func (c *shard) targetSize() int64 {
 	target := c.maxSize - c.reservedSize
 	// Always return a positive integer for targetSize. This is so that we don't
@@ -419,7 +531,7 @@ func (c *shard) metaCheck(e *entry) {
 		// NB: c.hand{Hot,Cold,Test} are pointers into a single linked list. We
 		// only have to traverse one of them to check all of them.
 		var countHot, countCold, countTest int64
-		var sizeHot, sizeCold, sizeTest int64
+		var sizeHot, sizeCold, sizeTest, sizeHigh int64
 		for t := c.handHot.next(); t != nil; t = t.next() {
 			// Recompute count{Hot,Cold,Test} and size{Hot,Cold,Test}.
 			switch t.ptype {
@@ -433,6 +545,9 @@ func (c *shard) metaCheck(e *entry) {
 				countTest++
 				sizeTest += t.size
 			}
+			if t.ptype != etTest && t.priority == HighPriority {
+				sizeHigh += t.size
+			}
 			if e == t {
 				fmt.Fprintf(os.Stderr, "%p: %s unexpectedly found in blocks list\n%s",
 					e, e.key, debug.Stack())
@@ -443,12 +558,13 @@ func (c *shard) metaCheck(e *entry) {
 			}
 		}
 		if countHot != c.countHot || countCold != c.countCold || countTest != c.countTest ||
-			sizeHot != c.sizeHot || sizeCold != c.sizeCold || sizeTest != c.sizeTest {
+			sizeHot != c.sizeHot || sizeCold != c.sizeCold || sizeTest != c.sizeTest ||
+			sizeHigh != c.sizeHigh {
 			fmt.Fprintf(os.Stderr, `divergence of Hot,Cold,Test statistics
-				cache's statistics: hot %d, %d, cold %d, %d, test %d, %d
-				recalculated statistics: hot %d, %d, cold %d, %d, test %d, %d\n%s`,
-				c.countHot, c.sizeHot, c.countCold, c.sizeCold, c.countTest, c.sizeTest,
-				countHot, sizeHot, countCold, sizeCold, countTest, sizeTest,
+				cache's statistics: hot %d, %d, cold %d, %d, test %d, %d, high %d
+				recalculated statistics: hot %d, %d, cold %d, %d, test %d, %d, high %d\n%s`,
+				c.countHot, c.sizeHot, c.countCold, c.sizeCold, c.countTest, c.sizeTest, c.sizeHigh,
+				countHot, sizeHot, countCold, sizeCold, countTest, sizeTest, sizeHigh,
 				debug.Stack())
 			os.Exit(1)
 		}
@@ -460,9 +576,11 @@ func (c *shard) metaEvict(e *entry) {
 	case etHot:
 		c.sizeHot -= e.size
 		c.countHot--
+		c.addHigh(e, -e.size)
 	case etCold:
 		c.sizeCold -= e.size
 		c.countCold--
+		c.addHigh(e, -e.size)
 	case etTest:
 		c.sizeTest -= e.size
 		c.countTest--
@@ -491,7 +609,11 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 
 	e := c.handCold
 	if e.ptype == etCold {
-		if atomic.LoadInt32(&e.referenced) == 1 {
+		// A protected high priority entry is retained as though it had been
+		// referenced. The high priority fraction is less than 1, so while the
+		// cache is over its target size there are low priority entries to
+		// evict instead.
+		if atomic.LoadInt32(&e.referenced) == 1 || c.protected(e) {
 			atomic.StoreInt32(&e.referenced, 0)
 			e.ptype = etHot
 			c.sizeCold -= e.size
@@ -503,6 +625,7 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 			e.ptype = etTest
 			c.sizeCold -= e.size
 			c.countCold--
+			c.addHigh(e, -e.size)
 			c.sizeTest += e.size
 			c.countTest++
 			for c.targetSize() < c.sizeTest && c.handTest != nil {
@@ -582,6 +705,27 @@ type Metrics struct {
 	Hits int64
 	// The number of cache misses.
 	Misses int64
+	// The number of bytes in use by high priority values.
+	HighPrioritySize int64
+	// Hits and misses broken down by the kind of block, indexed by BlockKind.
+	BlockKinds [NumBlockKinds]BlockKindMetrics
+}
+
+// BlockKindMetrics holds the hits and misses of a kind of block.
+type BlockKindMetrics struct {
+	// The number of cache hits.
+	Hits int64
+	// The number of cache misses.
+	Misses int64
+}
+
+// HitRate returns the percentage of lookups that hit the cache, or 0 if there
+// were none.
+func (m BlockKindMetrics) HitRate() float64 {
+	if sum := m.Hits + m.Misses; sum != 0 {
+		return 100 * float64(m.Hits) / float64(sum)
+	}
+	return 0
 }
 
 // Cache implements Pebble's sharded block cache. The Clock-PRO algorithm is
@@ -633,6 +777,10 @@ type Cache struct {
 	}
 }
 
+// DefaultHighPriorityFraction is the default fraction of a cache's capacity
+// reserved for high priority values. See Cache.SetHighPriorityFraction.
+const DefaultHighPriorityFraction = 0.5
+
 // New creates a new cache of the specified size. Memory for the cache is
 // allocated on demand, not during initialization. The cache is created with a
 // reference count of 1. Each DB it is associated with adds a reference, so the
@@ -656,8 +804,9 @@ func newShards(size int64, shards int) *Cache {
 	c.trace("alloc", c.refs)
 	for i := range c.shards {
 		c.shards[i] = shard{
-			maxSize:    size / int64(len(c.shards)),
-			coldTarget: size / int64(len(c.shards)),
+			maxSize:              size / int64(len(c.shards)),
+			coldTarget:           size / int64(len(c.shards)),
+			highPriorityFraction: DefaultHighPriorityFraction,
 		}
 		if entriesGoAllocated {
 			c.shards[i].entries = make(map[*entry]struct{})
@@ -740,15 +889,49 @@ func (c *Cache) Unref() {
 // Get retrieves the cache value for the specified file and offset, returning
 // nil if no value is present.
 func (c *Cache) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
-	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset)
+	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset, UnknownBlock)
+}
+
+// GetBlock is like Get, but records the hit or miss against the provided
+// kind of block in addition to the cache's totals.
+func (c *Cache) GetBlock(
+	id uint64, fileNum base.DiskFileNum, offset uint64, kind BlockKind,
+) Handle {
+	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset, kind)
 }
 
 // Set sets the cache value for the specified file and offset, overwriting an
 // existing value if present. A Handle is returned which provides faster
 // retrieval of the cached value than Get (lock-free and avoidance of the map
-// lookup). The value must have been allocated by Cache.Alloc.
+// lookup). The value must have been allocated by Cache.Alloc. The value is
+// cached with LowPriority.
 func (c *Cache) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value) Handle {
-	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value)
+	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value, LowPriority)
+}
+
+// SetWithPriority is like Set, but caches the value with the provided
+// priority.
+func (c *Cache) SetWithPriority(
+	id uint64, fileNum base.DiskFileNum, offset uint64, value *Value, pri Priority,
+) Handle {
+	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value, pri)
+}
+
+// SetHighPriorityFraction sets the fraction of the cache's capacity reserved
+// for high priority values, which must be in [0, 1). While high priority
+// values occupy no more than the fraction of the cache, the cold hand retains
+// them even if they haven't been referenced, evicting low priority values
+// instead. Beyond the fraction, high priority values are replaced like low
+// priority values. A single fraction applies to all high priority values,
+// whatever the kind of block they hold. The fraction defaults to
+// DefaultHighPriorityFraction.
+func (c *Cache) SetHighPriorityFraction(fraction float64) {
+	if fraction < 0 || fraction >= 1 {
+		panic(fmt.Sprintf("pebble: invalid high priority fraction: %f", fraction))
+	}
+	for i := range c.shards {
+		c.shards[i].SetHighPriorityFraction(fraction)
+	}
 }
 
 // Delete deletes the cached value for the specified file and offset.
@@ -828,9 +1011,14 @@ func (c *Cache) Metrics() Metrics {
 		s.mu.RLock()
 		m.Count += int64(s.blocks.Count())
 		m.Size += s.sizeHot + s.sizeCold
+		m.HighPrioritySize += s.sizeHigh
 		s.mu.RUnlock()
 		m.Hits += atomic.LoadInt64(&s.hits)
 		m.Misses += atomic.LoadInt64(&s.misses)
+		for k := range m.BlockKinds {
+			m.BlockKinds[k].Hits += atomic.LoadInt64(&s.kindHits[k])
+			m.BlockKinds[k].Misses += atomic.LoadInt64(&s.kindMisses[k])
+		}
 	}
 	return m
 }
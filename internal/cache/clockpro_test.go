@@ -277,3 +277,60 @@ func TestReserveColdTarget(t *testing.T) {
 		t.Fatalf("expected positive cache size %d, but found %d", 48, cache.Size())
 	}
 }
+
+func TestCachePriority(t *testing.T) {
+	// Interleave high priority blocks with scans of low priority blocks, none
+	// of which are read again.
+	run := func(fraction float64) (found int, _ Metrics) {
+		cache := newShards(100, 1)
+		defer cache.Unref()
+		cache.SetHighPriorityFraction(fraction)
+		for i := 0; i < 20; i++ {
+			cache.SetWithPriority(1, base.FileNum(0).DiskFileNum(), uint64(i),
+				testValue(cache, "a", 10), HighPriority).Release()
+			for j := 0; j < 20; j++ {
+				cache.Set(1, base.FileNum(1).DiskFileNum(), uint64(100*i+j),
+					testValue(cache, "b", 10)).Release()
+			}
+		}
+		require.LessOrEqual(t, cache.Size(), int64(100))
+		for i := 0; i < 20; i++ {
+			h := cache.GetBlock(1, base.FileNum(0).DiskFileNum(), uint64(i), IndexBlock)
+			if h.Get() != nil {
+				found++
+			}
+			h.Release()
+		}
+		return found, cache.Metrics()
+	}
+
+	// The high priority blocks are protected from the scans while they occupy
+	// no more than half of the cache.
+	found, m := run(0.5)
+	require.Equal(t, 5, found)
+	require.Equal(t, int64(50), m.HighPrioritySize)
+	require.Equal(t, int64(5), m.BlockKinds[IndexBlock].Hits)
+	require.Equal(t, int64(15), m.BlockKinds[IndexBlock].Misses)
+	require.Equal(t, int64(0), m.BlockKinds[DataBlock].Hits+m.BlockKinds[DataBlock].Misses)
+	require.Equal(t, m.Hits, m.BlockKinds[IndexBlock].Hits)
+
+	// Without a high priority fraction, the scans evict them.
+	found, _ = run(0)
+	require.Less(t, found, 5)
+}
+
+func TestCachePriorityExceedsFraction(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+	cache.SetHighPriorityFraction(0.5)
+
+	// High priority blocks beyond the fraction are evicted like low priority
+	// blocks, so that a cache holding only high priority blocks makes progress.
+	for i := 0; i < 100; i++ {
+		cache.SetWithPriority(1, base.FileNum(0).DiskFileNum(), uint64(i),
+			testValue(cache, "a", 10), HighPriority).Release()
+	}
+	m := cache.Metrics()
+	require.LessOrEqual(t, m.Size, int64(100))
+	require.Equal(t, m.Size, m.HighPrioritySize)
+}
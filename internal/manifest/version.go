@@ -68,6 +68,11 @@ type TableStats struct {
 	RangeDeletionsBytesEstimate uint64
 	// Total size of value blocks and value index block.
 	ValueBlocksSize uint64
+	// TombstoneDenseBlocksRatio is the fraction of the table's data blocks
+	// that are tombstone-dense, as recorded by the built-in tombstone density
+	// block property collector. It's zero if the table was written without
+	// the collector.
+	TombstoneDenseBlocksRatio float64
 }
 
 // boundType represents the type of key (point or range) present as the smallest
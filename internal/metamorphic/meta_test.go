@@ -43,6 +43,8 @@ var (
 		"fail the test if the supplied regular expression matches the output")
 	traceFile = flag.String("trace-file", "",
 		"write an execution trace to `<run-dir>/file`")
+	singleDeleteMisuse = flag.Float64("single-delete-misuse", 0.0,
+		"probability of generating invalid SingleDeletes (0 ≤ p ≤ 1); disables comparing histories")
 	keep = flag.Bool("keep", false,
 		"keep the DB directory even on successful runs")
 	seed = flag.Uint64("seed", 0,
@@ -124,6 +126,9 @@ func TestMeta(t *testing.T) {
 		opts = append(opts, metamorphic.InjectErrorsRate(*errorRate))
 		onceOpts = append(onceOpts, metamorphic.InjectErrorsRate(*errorRate))
 	}
+	if *singleDeleteMisuse > 0 {
+		opts = append(opts, metamorphic.GenerateSingleDeleteMisuse(*singleDeleteMisuse))
+	}
 	if *traceFile != "" {
 		opts = append(opts, metamorphic.RuntimeTrace(*traceFile))
 	}
@@ -120,6 +120,15 @@ type IteratorStats struct {
 	ReverseStepCount [NumStatsKind]int
 	InternalStats    InternalIteratorStats
 	RangeKeyStats    RangeKeyIteratorStats
+	// Levels breaks down the blocks loaded by the iterator by the LSM level of
+	// the sstables they were loaded from. The totals are included in
+	// InternalStats.
+	Levels LevelBlockReadStats
+	// ValueBytesAvoided is the total length of the values stored apart from
+	// their keys, such as in sstable value blocks, of the point keys surfaced
+	// by an iterator configured with IterOptions.KeysOnly, which were never
+	// retrieved.
+	ValueBytesAvoided uint64
 }
 
 var _ redact.SafeFormatter = &IteratorStats{}
@@ -181,13 +190,16 @@ type Iterator struct {
 	// short-lived (since they pin memtables and sstables), (b) plumbing a
 	// context into every method is very painful, (c) they do not (yet) respect
 	// context cancellation and are only used for tracing.
-	ctx       context.Context
-	opts      IterOptions
-	merge     Merge
-	comparer  base.Comparer
-	iter      internalIterator
-	pointIter internalIterator
-	readState *readState
+	ctx   context.Context
+	opts  IterOptions
+	merge Merge
+	// mergeCache caches the results of resolving MERGE keys. It is nil if
+	// the DB's merge cache is disabled.
+	mergeCache *mergeCache
+	comparer   base.Comparer
+	iter       internalIterator
+	pointIter  internalIterator
+	readState  *readState
 	// rangeKey holds iteration state specific to iteration over range keys.
 	// The range key field may be nil if the Iterator has never been configured
 	// to iterate over range keys. Its non-nilness cannot be used to determine
@@ -224,7 +236,13 @@ type Iterator struct {
 	prefixOrFullSeekKey []byte
 	readSampling        readSampling
 	stats               IteratorStats
-	externalReaders     [][]*sstable.Reader
+	// levelStats holds the stats of the sstable iterators of each LSM level,
+	// which are combined with stats.InternalStats by Stats.
+	levelStats [numLevels]InternalIteratorStats
+	// categoryStatsReported holds the block reads of levelStats that have been
+	// reported to the DB's per-category stats.
+	categoryStatsReported LevelBlockReadStats
+	externalReaders       [][]*sstable.Reader
 
 	// Following fields used when constructing an iterator stack, eg, in Clone
 	// and SetOptions or when re-fragmenting a batch's range keys/range dels.
@@ -234,6 +252,9 @@ type Iterator struct {
 	newIterRangeKey  keyspan.TableNewSpanIter
 	lazyCombinedIter lazyCombinedIter
 	seqNum           uint64
+	// refreshable is true if the Iterator reads the DB's current state, rather
+	// than a snapshot, permitting calls to Refresh.
+	refreshable bool
 	// batchSeqNum is used by Iterators over indexed batches to detect when the
 	// underlying batch has been mutated. The batch beneath an indexed batch may
 	// be mutated while the Iterator is open, but new keys are not surfaced
@@ -568,7 +589,7 @@ func (i *Iterator) findNextEntry(limit []byte) {
 			i.iterValidityState = IterValid
 			return
 
-		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 			i.nextUserKey()
 			continue
 
@@ -631,7 +652,7 @@ func (i *Iterator) nextPointCurrentUserKey() bool {
 		i.err = base.CorruptionErrorf("pebble: unexpected range key set mid-user key")
 		return false
 
-	case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+	case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 		return false
 
 	case InternalKeyKindSet, InternalKeyKindSetWithDelete:
@@ -655,6 +676,19 @@ func (i *Iterator) nextPointCurrentUserKey() bool {
 //
 // mergeForward does not update iterValidityState.
 func (i *Iterator) mergeForward(key base.InternalKey) (valid bool) {
+	cacheable := i.mergeCacheable(key)
+	if cacheable {
+		if value, deleted, ok := i.mergeCache.get(key.UserKey, key.SeqNum()); ok {
+			// Leave the internal iterator positioned at the newest operand, as
+			// if the key were a SET. The next call to nextUserKey will step
+			// over the remaining operands.
+			i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
+			i.key = i.keyBuf
+			i.value = base.MakeInPlaceValue(value)
+			return !deleted
+		}
+	}
+
 	var iterValue []byte
 	iterValue, _, i.err = i.iterValue.Value(nil)
 	if i.err != nil {
@@ -666,6 +700,16 @@ func (i *Iterator) mergeForward(key base.InternalKey) (valid bool) {
 		return false
 	}
 
+	if i.keysOnlySkipsMerge(valueMerger) {
+		// Leave the internal iterator positioned at the newest operand, as if
+		// the key were a SET. The next call to nextUserKey will step over the
+		// remaining operands.
+		i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
+		i.key = i.keyBuf
+		i.value = i.iterValue
+		return true
+	}
+
 	i.mergeNext(key, valueMerger)
 	if i.err != nil {
 		return false
@@ -675,6 +719,19 @@ func (i *Iterator) mergeForward(key base.InternalKey) (valid bool) {
 	var value []byte
 	value, needDelete, i.valueCloser, i.err = finishValueMerger(
 		valueMerger, true /* includesBase */)
+	if i.err == nil && cacheable {
+		// The cache retains the value, so copy it out of any memory owned by
+		// the value merger's closer.
+		if needDelete {
+			value = nil
+		} else {
+			value = append([]byte(nil), value...)
+		}
+		i.err = i.closeValueCloser()
+		if i.err == nil {
+			i.mergeCache.add(i.key, key.SeqNum(), value, needDelete)
+		}
+	}
 	i.value = base.MakeInPlaceValue(value)
 	if i.err != nil {
 		return false
@@ -686,6 +743,30 @@ func (i *Iterator) mergeForward(key base.InternalKey) (valid bool) {
 	return true
 }
 
+// keysOnlySkipsMerge returns true if the iterator is configured with
+// IterOptions.KeysOnly and the key whose operands are merged by valueMerger
+// exists regardless of its operands, so that the merge may be skipped. A
+// DeletableValueMerger may delete the key, so it must always be merged.
+func (i *Iterator) keysOnlySkipsMerge(valueMerger ValueMerger) bool {
+	if !i.opts.KeysOnly {
+		return false
+	}
+	_, deletable := valueMerger.(DeletableValueMerger)
+	return !deletable
+}
+
+// mergeCacheable returns true if the result of the merge at key, the newest
+// visible entry for its user key, may be read from and added to the DB's
+// merge cache. Merges are only cached when every entry visible at the
+// iterator's sequence number is also visible to the iterator: the cache is
+// bypassed when reading through an indexed batch, or when table filters,
+// point key filters or range key masking may hide some of the key's operands.
+func (i *Iterator) mergeCacheable(key base.InternalKey) bool {
+	return i.mergeCache.cacheable(key.SeqNum()) && i.batch == nil &&
+		i.opts.TableFilter == nil && len(i.opts.PointKeyFilters) == 0 &&
+		i.opts.RangeKeyMasking.Suffix == nil
+}
+
 func (i *Iterator) closeValueCloser() error {
 	if i.valueCloser != nil {
 		i.err = i.valueCloser.Close()
@@ -727,6 +808,18 @@ func (i *Iterator) nextUserKey() {
 	}
 }
 
+// recordValueAvoided records the length of the current value in
+// IteratorStats.ValueBytesAvoided if the iterator is configured with
+// IterOptions.KeysOnly and the value is stored apart from its key, such as in
+// an sstable value block. Since keys-only iterators never fetch such values,
+// surfacing the key avoided reading the value. Values stored alongside their
+// keys were read regardless, and are not recorded.
+func (i *Iterator) recordValueAvoided() {
+	if i.opts.KeysOnly && i.iterValidityState == IterValid && i.value.Fetcher != nil {
+		i.stats.ValueBytesAvoided += uint64(i.value.Len())
+	}
+}
+
 func (i *Iterator) maybeSampleRead() {
 	// This method is only called when a public method of Iterator is
 	// returning, and below we exclude the case were the iterator is paused at
@@ -830,6 +923,34 @@ func (i *Iterator) sampleRead() {
 	}
 }
 
+// maybeRequestTombstoneDensityCompaction requests a tombstone density
+// compaction of the tables within the iterator's bounds if the iterator
+// stepped over many more internal keys than it returned, which is commonly
+// the result of iterating over dense tombstones. It's called when the
+// iterator is closed.
+func (i *Iterator) maybeRequestTombstoneDensityCompaction() {
+	db := i.readState.db
+	if db.opts.Experimental.TombstoneDenseBlockRatio <= 0 {
+		return
+	}
+	s := &i.stats
+	steps := s.ForwardStepCount[InterfaceCall] + s.ReverseStepCount[InterfaceCall]
+	internalSteps := s.ForwardStepCount[InternalIterCall] + s.ReverseStepCount[InternalIterCall]
+	if internalSteps-steps < db.opts.Experimental.TombstoneDenseReadThreshold {
+		return
+	}
+	db.mu.Lock()
+	pending := db.mu.compact.tombstoneDenseRead.pending
+	db.mu.compact.tombstoneDenseRead.add(i.cmp, i.opts.LowerBound, i.opts.UpperBound)
+	db.mu.Unlock()
+	if !pending {
+		// Read-heavy workloads may not flush frequently enough to schedule
+		// compactions.
+		db.compactionSchedulers.Add(1)
+		go db.maybeScheduleCompactionAsync()
+	}
+}
+
 func (i *Iterator) findPrevEntry(limit []byte) {
 	i.iterValidityState = IterExhausted
 	i.pos = iterPosCurReverse
@@ -848,6 +969,9 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 	}
 
 	var valueMerger ValueMerger
+	// mergeSkipped is set once a keys-only iterator skips the merge of the
+	// current key's operands, as its ValueMerger may not delete the key.
+	mergeSkipped := false
 	firstLoopIter := true
 	rangeKeyBoundary := false
 	// The code below compares with limit in multiple places. As documented in
@@ -929,10 +1053,11 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 			// return the key even if the MERGE point key is deleted.
 			rangeKeyBoundary = true
 
-		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 			i.value = LazyValue{}
 			i.iterValidityState = IterExhausted
 			valueMerger = nil
+			mergeSkipped = false
 			i.iterKey, i.iterValue = i.iter.Prev()
 			i.stats.ReverseStepCount[InternalIterCall]++
 			// Compare with the limit. We could optimize by only checking when
@@ -964,6 +1089,7 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 			i.iterKey, i.iterValue = i.iter.Prev()
 			i.stats.ReverseStepCount[InternalIterCall]++
 			valueMerger = nil
+			mergeSkipped = false
 			continue
 
 		case InternalKeyKindMerge:
@@ -981,6 +1107,15 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 					return
 				}
 				i.iterValidityState = IterValid
+				if i.keysOnlySkipsMerge(valueMerger) {
+					i.value, i.valueBuf = i.iterValue.Clone(i.valueBuf[:0], &i.fetcher)
+					valueMerger = nil
+					mergeSkipped = true
+				}
+			} else if mergeSkipped {
+				// The merge of the key's older operands was skipped, so the
+				// newer operands are skipped too.
+				i.value, i.valueBuf = i.iterValue.Clone(i.valueBuf[:0], &i.fetcher)
 			} else if valueMerger == nil {
 				// Extract value before iterValue since we use value before iterValue
 				// and the underlying iterator is not required to provide backing
@@ -995,25 +1130,21 @@ func (i *Iterator) findPrevEntry(limit []byte) {
 					return
 				}
 				valueMerger, i.err = i.merge(i.key, value)
-				var iterValue []byte
-				iterValue, _, i.err = i.iterValue.Value(nil)
-				if i.err != nil {
-					return
-				}
-				if i.err == nil {
-					i.err = valueMerger.MergeNewer(iterValue)
+				if i.err == nil && i.keysOnlySkipsMerge(valueMerger) {
+					// The key exists regardless of its operands, so the merge
+					// is skipped.
+					i.value, i.valueBuf = i.iterValue.Clone(i.valueBuf[:0], &i.fetcher)
+					valueMerger = nil
+					mergeSkipped = true
+				} else if i.err == nil {
+					i.err = mergeNewerLazy(valueMerger, i.iterValue)
 				}
 				if i.err != nil {
 					i.iterValidityState = IterExhausted
 					return
 				}
 			} else {
-				var iterValue []byte
-				iterValue, _, i.err = i.iterValue.Value(nil)
-				if i.err != nil {
-					return
-				}
-				i.err = valueMerger.MergeNewer(iterValue)
+				i.err = mergeNewerLazy(valueMerger, i.iterValue)
 				if i.err != nil {
 					i.iterValidityState = IterExhausted
 					return
@@ -1092,30 +1223,20 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 			return
 		}
 		switch key.Kind() {
-		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized:
 			// We've hit a deletion tombstone. Return everything up to this
 			// point.
 			return
 
 		case InternalKeyKindSet, InternalKeyKindSetWithDelete:
 			// We've hit a Set value. Merge with the existing value and return.
-			var iterValue []byte
-			iterValue, _, i.err = i.iterValue.Value(nil)
-			if i.err != nil {
-				return
-			}
-			i.err = valueMerger.MergeOlder(iterValue)
+			i.err = mergeOlderLazy(valueMerger, i.iterValue)
 			return
 
 		case InternalKeyKindMerge:
 			// We've hit another Merge value. Merge with the existing value and
 			// continue looping.
-			var iterValue []byte
-			iterValue, _, i.err = i.iterValue.Value(nil)
-			if i.err != nil {
-				return
-			}
-			i.err = valueMerger.MergeOlder(iterValue)
+			i.err = mergeOlderLazy(valueMerger, i.iterValue)
 			if i.err != nil {
 				return
 			}
@@ -1258,6 +1379,7 @@ func (i *Iterator) SeekGEWithLimit(key []byte, limit []byte) IterValidityState {
 	}
 	i.findNextEntry(limit)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	if i.Error() == nil {
 		// Prepare state for a future noop optimization.
 		i.prefixOrFullSeekKey = append(i.prefixOrFullSeekKey[:0], key...)
@@ -1412,6 +1534,7 @@ func (i *Iterator) SeekPrefixGE(key []byte) bool {
 	i.stats.ForwardSeekCount[InternalIterCall]++
 	i.findNextEntry(nil)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	if i.Error() == nil {
 		i.lastPositioningOp = seekPrefixGELastPositioningOp
 	}
@@ -1512,6 +1635,7 @@ func (i *Iterator) SeekLTWithLimit(key []byte, limit []byte) IterValidityState {
 	}
 	i.findPrevEntry(limit)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	if i.Error() == nil && i.batch == nil {
 		// Prepare state for a future noop optimization.
 		i.prefixOrFullSeekKey = append(i.prefixOrFullSeekKey[:0], key...)
@@ -1549,6 +1673,7 @@ func (i *Iterator) First() bool {
 	i.iterFirstWithinBounds()
 	i.findNextEntry(nil)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	return i.iterValidityState == IterValid
 }
 
@@ -1581,6 +1706,7 @@ func (i *Iterator) Last() bool {
 	i.iterLastWithinBounds()
 	i.findPrevEntry(nil)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	return i.iterValidityState == IterValid
 }
 
@@ -1726,6 +1852,7 @@ func (i *Iterator) nextPrefix() IterValidityState {
 	i.stats.ForwardStepCount[InterfaceCall]++
 	i.findNextEntry(nil /* limit */)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	return i.iterValidityState
 }
 
@@ -1839,6 +1966,7 @@ func (i *Iterator) nextWithLimit(limit []byte) IterValidityState {
 	}
 	i.findNextEntry(limit)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	return i.iterValidityState
 }
 
@@ -1937,6 +2065,7 @@ func (i *Iterator) PrevWithLimit(limit []byte) IterValidityState {
 	}
 	i.findPrevEntry(limit)
 	i.maybeSampleRead()
+	i.recordValueAvoided()
 	return i.iterValidityState
 }
 
@@ -2118,8 +2247,13 @@ func (i *Iterator) Value() []byte {
 }
 
 // ValueAndErr returns the value, and any error encountered in extracting the value.
+// If the iterator is configured with IterOptions.KeysOnly, the value is always
+// empty.
 // REQUIRES: i.Error()==nil and HasPointAndRange() returns true for hasPoint.
 func (i *Iterator) ValueAndErr() ([]byte, error) {
+	if i.opts.KeysOnly {
+		return nil, nil
+	}
 	val, callerOwned, err := i.value.Value(i.lazyValueBuf)
 	if err != nil {
 		i.err = err
@@ -2130,9 +2264,13 @@ func (i *Iterator) ValueAndErr() ([]byte, error) {
 	return val, err
 }
 
-// LazyValue returns the LazyValue. Only for advanced use cases.
+// LazyValue returns the LazyValue. Only for advanced use cases. If the iterator
+// is configured with IterOptions.KeysOnly, the value is always empty.
 // REQUIRES: i.Error()==nil and HasPointAndRange() returns true for hasPoint.
 func (i *Iterator) LazyValue() LazyValue {
+	if i.opts.KeysOnly {
+		return LazyValue{}
+	}
 	return i.value
 }
 
@@ -2209,6 +2347,8 @@ func (i *Iterator) Close() error {
 				go i.readState.db.maybeScheduleCompactionAsync()
 			}
 		}
+		i.maybeRequestTombstoneDensityCompaction()
+		i.reportCategoryStats()
 
 		i.readState.unref()
 		i.readState = nil
@@ -2386,6 +2526,13 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 	// positioning method to reposition the iterator.
 	i.requiresReposition = true
 
+	// Block reads performed so far are attributed to the previous category.
+	if o.Category != i.opts.Category {
+		i.reportCategoryStats()
+		i.opts.Category = o.Category
+	}
+	i.opts.KeysOnly = o.KeysOnly
+
 	// Check if global state requires we close all internal iterators.
 	//
 	// If the Iterator is in an error state, invalidate the existing iterators
@@ -2405,8 +2552,12 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 
 	// If either options specify block property filters for an iterator stack,
 	// reconstruct it.
+	//
+	// If the prefetching configuration changed, reconstruct the point iterator
+	// stack so that its sstable iterators use the new configuration.
 	if i.pointIter != nil && (closeBoth || len(o.PointKeyFilters) > 0 || len(i.opts.PointKeyFilters) > 0 ||
-		o.RangeKeyMasking.Filter != nil || i.opts.RangeKeyMasking.Filter != nil) {
+		o.RangeKeyMasking.Filter != nil || i.opts.RangeKeyMasking.Filter != nil ||
+		o.PrefetchBlocks != i.opts.PrefetchBlocks || o.PrefetchMemoryBudget != i.opts.PrefetchMemoryBudget) {
 		i.err = firstError(i.err, i.pointIter.Close())
 		i.pointIter = nil
 	}
@@ -2557,6 +2708,74 @@ func (i *Iterator) SetOptions(o *IterOptions) {
 	finishInitializingIter(i.ctx, i.alloc)
 }
 
+// Refresh updates the Iterator's view of the DB to the DB's current state,
+// allowing a long-lived iterator to observe writes committed since it was
+// created or last refreshed without being closed and recreated. The iterator
+// re-acquires the DB's current memtables and sstables, and releases those it
+// previously held. If the iterator reads through an indexed batch, its view of
+// the batch is also refreshed (see SetOptions).
+//
+// Like SetOptions, Refresh leaves the iterator unpositioned: the caller must
+// call an absolute positioning method, such as SeekGE with the last key
+// returned, before continuing iteration. Refresh returns an error if the
+// iterator reads a fixed view of the DB, as iterators created from a Snapshot,
+// a Txn or NewExternalIter do.
+func (i *Iterator) Refresh() error {
+	if !i.refreshable {
+		return errors.Errorf("pebble: Refresh is not supported by iterators over a fixed view of the DB")
+	}
+	if i.readState == nil {
+		return errors.Errorf("cannot Refresh a closed Iterator")
+	}
+	d := i.readState.db
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+
+	// Close the iterator stacks, which reference the memtables and sstables of
+	// the previous readState. They're reconstructed by finishInitializingIter.
+	if i.iter != nil {
+		i.err = firstError(i.err, i.iter.Close())
+		if i.pointIter != nil && !i.closePointIterOnce {
+			i.err = firstError(i.err, i.pointIter.Close())
+		}
+		if i.rangeKey != nil && i.rangeKey.rangeKeyIter != nil {
+			i.err = firstError(i.err, i.rangeKey.rangeKeyIter.Close())
+		}
+	}
+	i.iter, i.pointIter = nil, nil
+	if i.rangeKey != nil {
+		i.rangeKey.rangeKeyBuffers.PrepareForReuse()
+		*i.rangeKey = iteratorRangeKeyState{
+			rangeKeyBuffers: i.rangeKey.rangeKeyBuffers,
+		}
+		iterRangeKeyStateAllocPool.Put(i.rangeKey)
+		i.rangeKey = nil
+	}
+	if i.valueCloser != nil {
+		i.err = firstError(i.err, i.valueCloser.Close())
+		i.valueCloser = nil
+	}
+	err := i.err
+
+	// Grab the current readState before determining the seqnum to read at,
+	// mirroring DB.newIter.
+	readState := d.loadReadState()
+	i.readState.unref()
+	i.readState = readState
+	i.seqNum = d.mu.versions.visibleSeqNum.Load()
+	if i.batch != nil {
+		i.batchSeqNum = i.batch.nextSeqNum()
+		i.batchJustRefreshed = true
+	}
+
+	i.requiresReposition = true
+	i.invalidate()
+	i.lazyCombinedIter = lazyCombinedIter{}
+	finishInitializingIter(i.ctx, i.alloc)
+	return err
+}
+
 func (i *Iterator) invalidate() {
 	i.lastPositioningOp = invalidatedLastPositionOp
 	i.hasPrefix = false
@@ -2593,12 +2812,35 @@ func (i *Iterator) Metrics() IteratorMetrics {
 
 // ResetStats resets the stats to 0.
 func (i *Iterator) ResetStats() {
+	i.reportCategoryStats()
 	i.stats = IteratorStats{}
+	i.levelStats = [numLevels]InternalIteratorStats{}
+	i.categoryStatsReported = LevelBlockReadStats{}
 }
 
 // Stats returns the current stats.
 func (i *Iterator) Stats() IteratorStats {
-	return i.stats
+	stats := i.stats
+	for l := range i.levelStats {
+		stats.InternalStats.Merge(i.levelStats[l])
+		stats.Levels[l] = makeBlockReadStats(&i.levelStats[l])
+	}
+	return stats
+}
+
+// reportCategoryStats adds the block reads not yet reported to the DB's
+// per-category stats, attributing them to the iterator's current category.
+func (i *Iterator) reportCategoryStats() {
+	if i.readState == nil {
+		return
+	}
+	var s LevelBlockReadStats
+	for l := range i.levelStats {
+		s[l] = makeBlockReadStats(&i.levelStats[l])
+		s[l].subtract(i.categoryStatsReported[l])
+	}
+	i.readState.db.categoryStats.add(i.opts.Category, &s)
+	i.categoryStatsReported.Merge(&s)
 }
 
 // CloneOptions configures an iterator constructed through Iterator.Clone.
@@ -2659,6 +2901,7 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 		opts:                *opts.IterOptions,
 		alloc:               buf,
 		merge:               i.merge,
+		mergeCache:          i.mergeCache,
 		comparer:            i.comparer,
 		readState:           readState,
 		keyBuf:              buf.keyBuf,
@@ -2669,6 +2912,7 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 		newIters:            i.newIters,
 		newIterRangeKey:     i.newIterRangeKey,
 		seqNum:              i.seqNum,
+		refreshable:         i.refreshable,
 	}
 	dbi.processBounds(dbi.opts.LowerBound, dbi.opts.UpperBound)
 
@@ -2692,6 +2936,8 @@ func (stats *IteratorStats) Merge(o IteratorStats) {
 	}
 	stats.InternalStats.Merge(o.InternalStats)
 	stats.RangeKeyStats.Merge(o.RangeKeyStats)
+	stats.Levels.Merge(&o.Levels)
+	stats.ValueBytesAvoided += o.ValueBytesAvoided
 }
 
 func (stats *IteratorStats) String() string {
@@ -2724,13 +2970,16 @@ func (stats *IteratorStats) SafeFormat(s redact.SafePrinter, verb rune) {
 			humanize.SI.Uint64(stats.InternalStats.PointsCoveredByRangeTombstones),
 		)
 		if stats.InternalStats.SeparatedPointValue.Count != 0 {
-			s.Printf(", (separated: (count %s, bytes %s, fetched %s)))",
+			s.Printf(", (separated: (count %s, bytes %s, fetched %s))",
 				humanize.SI.Uint64(stats.InternalStats.SeparatedPointValue.Count),
 				humanize.IEC.Uint64(stats.InternalStats.SeparatedPointValue.ValueBytes),
 				humanize.IEC.Uint64(stats.InternalStats.SeparatedPointValue.ValueBytesFetched))
-		} else {
-			s.Printf(")")
 		}
+		if p := stats.InternalStats.Prefetch; p.Hits != 0 || p.Misses != 0 {
+			s.Printf(", (prefetch: (hits %s, misses %s))",
+				humanize.SI.Uint64(p.Hits), humanize.SI.Uint64(p.Misses))
+		}
+		s.Printf(")")
 	}
 	if stats.RangeKeyStats != (RangeKeyIteratorStats{}) {
 		s.SafeString(",\n(range-key-stats: ")
@@ -2739,4 +2988,8 @@ func (stats *IteratorStats) SafeFormat(s redact.SafePrinter, verb rune) {
 			stats.RangeKeyStats.ContainedPoints,
 			stats.RangeKeyStats.SkippedPoints)
 	}
+	if stats.ValueBytesAvoided != 0 {
+		s.Printf(",\n(keys-only: (value-bytes-avoided %s))",
+			humanize.IEC.Uint64(stats.ValueBytesAvoided))
+	}
 }
@@ -565,6 +565,12 @@ func TestIterator(t *testing.T) {
 					opts.LowerBound = []byte(arg.Vals[0])
 				case "upper":
 					opts.UpperBound = []byte(arg.Vals[0])
+				case "keys-only":
+					var err error
+					opts.KeysOnly, err = strconv.ParseBool(arg.Vals[0])
+					if err != nil {
+						return err.Error()
+					}
 				default:
 					return fmt.Sprintf("%s: unknown arg: %s", d.Cmd, arg.Key)
 				}
@@ -1560,6 +1566,338 @@ func TestIteratorGuaranteedDurable(t *testing.T) {
 	})
 }
 
+func TestIteratorRefresh(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	scan := func(iter *Iterator, from string) string {
+		var buf bytes.Buffer
+		for valid := iter.SeekGE([]byte(from)); valid; valid = iter.Next() {
+			hasPoint, hasRange := iter.HasPointAndRange()
+			fmt.Fprintf(&buf, "%s", iter.Key())
+			if hasPoint {
+				fmt.Fprintf(&buf, ":%s", iter.Value())
+			}
+			if hasRange {
+				start, end := iter.RangeBounds()
+				fmt.Fprintf(&buf, "[%s-%s)", start, end)
+			}
+			buf.WriteString(" ")
+		}
+		require.NoError(t, iter.Error())
+		return strings.TrimSpace(buf.String())
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), nil))
+	iter := d.NewIter(&IterOptions{KeyTypes: IterKeyTypePointsAndRanges})
+	require.Equal(t, "a:1 b:2", scan(iter, "a"))
+
+	// Writes committed after the iterator was created are not visible until
+	// the iterator is refreshed, including writes to a flushed memtable.
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("d"), []byte("4"), nil))
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	require.NoError(t, d.RangeKeySet([]byte("e"), []byte("f"), nil, []byte("x"), nil))
+	require.Equal(t, "b:2", scan(iter, "b"))
+	require.Equal(t, int64(1), d.Metrics().MemTable.ZombieCount)
+
+	require.NoError(t, iter.Refresh())
+	require.False(t, iter.Valid())
+	require.Equal(t, "b:2 c:3 d:4 e[e-f)", scan(iter, "b"))
+	require.Equal(t, "b:2 c:3 d:4 e[e-f)", scan(iter, "a"))
+	// The refreshed iterator no longer holds the flushed memtable.
+	require.Equal(t, int64(0), d.Metrics().MemTable.ZombieCount)
+	require.NoError(t, iter.Refresh())
+	require.Equal(t, "d:4 e[e-f)", scan(iter, "d"))
+	require.NoError(t, iter.Close())
+	require.Error(t, iter.Refresh())
+
+	// Iterators over an indexed batch observe both the batch and the DB.
+	b := d.NewIndexedBatch()
+	iter = b.NewIter(nil)
+	require.NoError(t, b.Set([]byte("f"), []byte("5"), nil))
+	require.NoError(t, d.Set([]byte("g"), []byte("6"), nil))
+	require.Equal(t, "d:4", scan(iter, "d"))
+	require.NoError(t, iter.Refresh())
+	require.Equal(t, "d:4 f:5 g:6", scan(iter, "d"))
+	require.NoError(t, iter.Close())
+	require.NoError(t, b.Close())
+
+	// Iterators over a snapshot cannot be refreshed.
+	snap := d.NewSnapshot()
+	iter = snap.NewIter(nil)
+	require.Error(t, iter.Refresh())
+	require.NoError(t, iter.Close())
+	require.NoError(t, snap.Close())
+}
+
+func TestIteratorCategoryStats(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write a table to L6 and another to L0.
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("c"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("d"), false /* parallelize */))
+	require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+	require.NoError(t, d.Flush())
+
+	scan := func(iter *Iterator) {
+		for valid := iter.First(); valid; valid = iter.Next() {
+		}
+		require.NoError(t, iter.Error())
+	}
+	requireConsistent := func(stats IteratorStats) {
+		total := stats.Levels.Total()
+		require.Equal(t, stats.InternalStats.BlockBytes, total.BytesRead+total.BytesInCache)
+		require.Equal(t, stats.InternalStats.BlockBytesInCache, total.BytesInCache)
+		require.Equal(t, stats.InternalStats.BlockCacheHits, total.CacheHits)
+		require.Equal(t, stats.InternalStats.BlockCacheMisses, total.CacheMisses)
+	}
+
+	iter := d.NewIter(&IterOptions{Category: "scan"})
+	scan(iter)
+	stats := iter.Stats()
+	requireConsistent(stats)
+	for _, l := range []int{0, 6} {
+		require.Less(t, uint64(0), stats.Levels[l].CacheMisses)
+		require.Less(t, uint64(0), stats.Levels[l].BytesRead)
+		require.Zero(t, stats.Levels[l].CacheHits)
+	}
+	require.Zero(t, stats.Levels[1])
+	// Resetting the stats reports the block reads to the DB.
+	iter.ResetStats()
+	require.Equal(t, stats.Levels, d.Metrics().IterCategories["scan"])
+
+	// The blocks are now cached.
+	scan(iter)
+	stats2 := iter.Stats()
+	requireConsistent(stats2)
+	for _, l := range []int{0, 6} {
+		require.Zero(t, stats2.Levels[l].CacheMisses)
+		require.Less(t, uint64(0), stats2.Levels[l].CacheHits)
+	}
+
+	// Block reads are attributed to the category at the time they're
+	// performed.
+	iter.SetOptions(&IterOptions{Category: "other"})
+	scan(iter)
+	require.NoError(t, iter.Close())
+	m := d.Metrics()
+	require.Len(t, m.IterCategories, 2)
+	expected := stats.Levels
+	expected.Merge(&stats2.Levels)
+	require.Equal(t, expected, m.IterCategories["scan"])
+	// The scan under the new category read the same cached blocks.
+	require.Equal(t, stats2.Levels, m.IterCategories["other"])
+}
+
+func TestIteratorPrefetch(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Levels = append(opts.Levels, LevelOptions{BlockSize: 64})
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 1000; i++ {
+		k := []byte(fmt.Sprintf("%04d", i))
+		require.NoError(t, d.Set(k, bytes.Repeat(k, 4), nil))
+		if i%300 == 0 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	require.NoError(t, d.Flush())
+
+	scan := func(iter *Iterator) (n int) {
+		for valid := iter.First(); valid; valid = iter.Next() {
+			require.Equal(t, bytes.Repeat(iter.Key(), 4), iter.Value())
+			n++
+		}
+		require.NoError(t, iter.Error())
+		return n
+	}
+
+	iter := d.NewIter(&IterOptions{PrefetchBlocks: 4})
+	require.Equal(t, 1000, scan(iter))
+	stats := iter.Stats()
+	require.Less(t, uint64(0), stats.InternalStats.Prefetch.Hits)
+	require.Contains(t, stats.String(), "(prefetch: (hits ")
+
+	// Disabling prefetching through SetOptions takes effect on the next
+	// positioning of the iterator.
+	iter.ResetStats()
+	iter.SetOptions(&IterOptions{})
+	require.Equal(t, 1000, scan(iter))
+	stats = iter.Stats()
+	require.Zero(t, stats.InternalStats.Prefetch)
+	require.NotContains(t, stats.String(), "prefetch")
+	require.NoError(t, iter.Close())
+}
+
+func TestIteratorKeysOnly(t *testing.T) {
+	opts := &Options{
+		FS:                 vfs.NewMem(),
+		Comparer:           testkeys.Comparer,
+		FormatMajorVersion: FormatNewest,
+	}
+	opts.Experimental.EnableValueBlocks = func() bool { return true }
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write several versions of each key, so that the older versions' values
+	// are stored in value blocks.
+	ks := testkeys.Alpha(2)
+	keyBuf := make([]byte, ks.MaxLen()+testkeys.MaxSuffixLen)
+	value := bytes.Repeat([]byte("v"), 100)
+	var keys []string
+	for i := 0; i < ks.Count(); i++ {
+		for v := 3; v > 0; v-- {
+			n := testkeys.WriteKeyAt(keyBuf, ks, i, v)
+			require.NoError(t, d.Set(keyBuf[:n], value, nil))
+			keys = append(keys, string(keyBuf[:n]))
+		}
+	}
+	require.NoError(t, d.Flush())
+	// A key with MERGE operands on top of a SET in a value block.
+	require.NoError(t, d.Merge([]byte("a@3"), []byte("m1"), nil))
+	require.NoError(t, d.Merge([]byte("a@3"), []byte("m2"), nil))
+
+	scan := func(iter *Iterator, reverse bool) (keys []string) {
+		var valid bool
+		if reverse {
+			valid = iter.Last()
+		} else {
+			valid = iter.First()
+		}
+		for valid {
+			v, err := iter.ValueAndErr()
+			require.NoError(t, err)
+			if iter.opts.KeysOnly {
+				require.Nil(t, v)
+				lv := iter.LazyValue()
+				require.Zero(t, lv.Len())
+			}
+			keys = append(keys, string(iter.Key()))
+			if reverse {
+				valid = iter.Prev()
+			} else {
+				valid = iter.Next()
+			}
+		}
+		require.NoError(t, iter.Error())
+		return keys
+	}
+
+	iter := d.NewIter(nil)
+	require.Equal(t, keys, scan(iter, false /* reverse */))
+	stats := iter.Stats()
+	require.Less(t, uint64(0), stats.InternalStats.SeparatedPointValue.ValueBytesFetched)
+	require.Zero(t, stats.ValueBytesAvoided)
+	require.NoError(t, iter.Close())
+
+	for _, reverse := range []bool{false, true} {
+		iter = d.NewIter(&IterOptions{KeysOnly: true})
+		got := scan(iter, reverse)
+		if reverse {
+			for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+				got[i], got[j] = got[j], got[i]
+			}
+		}
+		require.Equal(t, keys, got)
+		keysOnlyStats := iter.Stats()
+		require.Zero(t, keysOnlyStats.InternalStats.SeparatedPointValue.ValueBytesFetched)
+		require.Less(t, keysOnlyStats.InternalStats.BlockBytes, stats.InternalStats.BlockBytes)
+		// Only the values of the older versions of each key are stored in
+		// value blocks; the values stored alongside their keys were read
+		// regardless.
+		require.Equal(t, uint64(len(keys)*2/3*len(value)), keysOnlyStats.ValueBytesAvoided)
+		require.Contains(t, keysOnlyStats.String(), "(keys-only: (value-bytes-avoided ")
+		require.NoError(t, iter.Close())
+	}
+
+	// KeysOnly may be toggled through SetOptions.
+	iter = d.NewIter(&IterOptions{KeysOnly: true})
+	require.True(t, iter.First())
+	require.Nil(t, iter.Value())
+	iter.SetOptions(&IterOptions{})
+	require.True(t, iter.First())
+	require.Equal(t, append(value, "m1m2"...), iter.Value())
+	require.NoError(t, iter.Close())
+}
+
+// deletingValueMerger concatenates merge operands, deleting the key if any
+// operand is "del".
+type deletingValueMerger struct {
+	base.AppendValueMerger
+}
+
+func (m *deletingValueMerger) DeletableFinish(
+	includesBase bool,
+) ([]byte, bool, io.Closer, error) {
+	value, closer, err := m.Finish(includesBase)
+	return value, bytes.Contains(value, []byte("del")), closer, err
+}
+
+func TestIteratorKeysOnlyDeletableMerge(t *testing.T) {
+	// Only the keys beginning with "d" are merged by a DeletableValueMerger.
+	d, err := Open("", &Options{
+		FS: vfs.NewMem(),
+		Merger: &Merger{
+			Name: "pebble.concatenate",
+			Merge: func(key, value []byte) (ValueMerger, error) {
+				var m ValueMerger = &base.AppendValueMerger{}
+				if key[0] == 'd' {
+					m = &deletingValueMerger{}
+				}
+				return m, m.MergeNewer(value)
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Merge([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Merge([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Merge([]byte("d1"), []byte("1"), nil))
+	require.NoError(t, d.Merge([]byte("d1"), []byte("del"), nil))
+	require.NoError(t, d.Merge([]byte("d2"), []byte("1"), nil))
+	require.NoError(t, d.Merge([]byte("d2"), []byte("2"), nil))
+	require.NoError(t, d.Set([]byte("d3"), []byte("1"), nil))
+	require.NoError(t, d.Merge([]byte("d3"), []byte("del"), nil))
+	require.NoError(t, d.Set([]byte("e"), []byte("1"), nil))
+	require.NoError(t, d.Merge([]byte("e"), []byte("del"), nil))
+	require.NoError(t, d.Merge([]byte("e"), []byte("2"), nil))
+
+	for _, reverse := range []bool{false, true} {
+		iter := d.NewIter(&IterOptions{KeysOnly: true})
+		var keys []string
+		if reverse {
+			for valid := iter.Last(); valid; valid = iter.Prev() {
+				keys = append([]string{string(iter.Key())}, keys...)
+			}
+		} else {
+			for valid := iter.First(); valid; valid = iter.Next() {
+				keys = append(keys, string(iter.Key()))
+			}
+		}
+		require.NoError(t, iter.Error())
+		require.Equal(t, []string{"a", "d2", "e"}, keys, "reverse=%t", reverse)
+		require.NoError(t, iter.Close())
+	}
+}
+
 func TestIteratorBoundsLifetimes(t *testing.T) {
 	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
 	d := newPointTestkeysDatabase(t, testkeys.Alpha(2))
@@ -1719,6 +2057,7 @@ func TestIteratorStatsMerge(t *testing.T) {
 			ContainedPoints: 16,
 			SkippedPoints:   17,
 		},
+		ValueBytesAvoided: 18,
 	}
 	s.InternalStats.SeparatedPointValue.Count = 1
 	s.InternalStats.SeparatedPointValue.ValueBytes = 5
@@ -1742,6 +2081,7 @@ func TestIteratorStatsMerge(t *testing.T) {
 			ContainedPoints: 16,
 			SkippedPoints:   17,
 		},
+		ValueBytesAvoided: 18,
 	}
 	s2.InternalStats.SeparatedPointValue.Count = 2
 	s2.InternalStats.SeparatedPointValue.ValueBytes = 10
@@ -1766,6 +2106,7 @@ func TestIteratorStatsMerge(t *testing.T) {
 			ContainedPoints: 32,
 			SkippedPoints:   34,
 		},
+		ValueBytesAvoided: 36,
 	}
 	expected.InternalStats.SeparatedPointValue.Count = 3
 	expected.InternalStats.SeparatedPointValue.ValueBytes = 15
@@ -2003,7 +2344,7 @@ func newPointTestkeysDatabase(t *testing.T, ks testkeys.Keyspace) *DB {
 }
 
 func BenchmarkIteratorSeekGE(b *testing.B) {
-	m, keys := buildMemTable(b)
+	m, keys := buildMemTable(b, MemTableSkiplist)
 	iter := &Iterator{
 		comparer: *DefaultComparer,
 		iter:     m.newIter(nil),
@@ -2018,7 +2359,7 @@ func BenchmarkIteratorSeekGE(b *testing.B) {
 }
 
 func BenchmarkIteratorNext(b *testing.B) {
-	m, _ := buildMemTable(b)
+	m, _ := buildMemTable(b, MemTableSkiplist)
 	iter := &Iterator{
 		comparer: *DefaultComparer,
 		iter:     m.newIter(nil),
@@ -2034,7 +2375,7 @@ func BenchmarkIteratorNext(b *testing.B) {
 }
 
 func BenchmarkIteratorPrev(b *testing.B) {
-	m, _ := buildMemTable(b)
+	m, _ := buildMemTable(b, MemTableSkiplist)
 	iter := &Iterator{
 		comparer: *DefaultComparer,
 		iter:     m.newIter(nil),
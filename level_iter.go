@@ -53,6 +53,7 @@ type internalIterOpts struct {
 	bytesIterated      *uint64
 	stats              *base.InternalIteratorStats
 	boundLimitedFilter sstable.BoundLimitedBlockPropertyFilter
+	prefetcher         *sstable.Prefetcher
 }
 
 // levelIter provides a merged view of the sstables in a level.
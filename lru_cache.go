@@ -0,0 +1,123 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// lruCacheEntryOverhead approximates the memory used by an lruCacheEntry and
+// its map slot, beyond its key and value.
+const lruCacheEntryOverhead = 96
+
+// lruCache is a map of entries bounded by their approximate size, evicting
+// the least recently used entries once the size is exceeded. It underlies the
+// merge and row caches, which provide their own synchronization.
+type lruCache[V any] struct {
+	maxSize int64
+	entries map[string]*lruCacheEntry[V]
+	// head is the sentinel of a circular list of entries, ordered from most to
+	// least recently used.
+	head   lruCacheEntry[V]
+	size   int64
+	hits   int64
+	misses int64
+	// onEvict, if non-nil, is invoked with each entry evicted to make room for
+	// another.
+	onEvict func(e *lruCacheEntry[V])
+}
+
+type lruCacheEntry[V any] struct {
+	key        string
+	value      V
+	size       int64
+	prev, next *lruCacheEntry[V]
+}
+
+func (c *lruCache[V]) init(maxSize int64, onEvict func(e *lruCacheEntry[V])) {
+	c.maxSize = maxSize
+	c.onEvict = onEvict
+	c.clear()
+}
+
+// lruCacheEntrySize returns the approximate size of an lruCacheEntry with a
+// key and value of the provided lengths.
+func lruCacheEntrySize(keyLen, valueLen int) int64 {
+	return int64(keyLen + valueLen + lruCacheEntryOverhead)
+}
+
+// fits returns true if an entry with a key and value of the provided lengths
+// fits in the cache.
+func (c *lruCache[V]) fits(keyLen, valueLen int) bool {
+	return lruCacheEntrySize(keyLen, valueLen) <= c.maxSize
+}
+
+// lookup returns the entry with the provided key, or nil if there is none.
+// It does not affect the entry's recency, nor the cache's hits and misses.
+func (c *lruCache[V]) lookup(key []byte) *lruCacheEntry[V] {
+	return c.entries[string(key)]
+}
+
+// hit records a cache hit on e, making it the most recently used entry.
+func (c *lruCache[V]) hit(e *lruCacheEntry[V]) {
+	c.hits++
+	c.unlink(e)
+	c.pushFront(e)
+}
+
+// miss records a cache miss.
+func (c *lruCache[V]) miss() {
+	c.misses++
+}
+
+// add adds an entry, which must not already be present, evicting the least
+// recently used entries if the cache is then too large.
+func (c *lruCache[V]) add(key string, value V, valueLen int) {
+	e := &lruCacheEntry[V]{key: key, value: value, size: lruCacheEntrySize(len(key), valueLen)}
+	c.entries[key] = e
+	c.pushFront(e)
+	c.size += e.size
+	for c.size > c.maxSize && c.head.prev != &c.head {
+		victim := c.head.prev
+		if c.onEvict != nil {
+			c.onEvict(victim)
+		}
+		c.remove(victim)
+	}
+}
+
+// remove removes e from the cache.
+func (c *lruCache[V]) remove(e *lruCacheEntry[V]) {
+	c.unlink(e)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+// clear removes every entry from the cache, without invoking onEvict.
+func (c *lruCache[V]) clear() {
+	c.entries = make(map[string]*lruCacheEntry[V])
+	c.head.prev = &c.head
+	c.head.next = &c.head
+	c.size = 0
+}
+
+func (c *lruCache[V]) metrics() CacheMetrics {
+	return CacheMetrics{
+		Size:   c.size,
+		Count:  int64(len(c.entries)),
+		Hits:   c.hits,
+		Misses: c.misses,
+	}
+}
+
+// pushFront makes e the most recently used entry.
+func (c *lruCache[V]) pushFront(e *lruCacheEntry[V]) {
+	e.prev = &c.head
+	e.next = c.head.next
+	c.head.next.prev = e
+	c.head.next = e
+}
+
+func (c *lruCache[V]) unlink(e *lruCacheEntry[V]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache(t *testing.T) {
+	var evicted []string
+	var c lruCache[int]
+	c.init(3*lruCacheEntrySize(1, 1), func(e *lruCacheEntry[int]) {
+		evicted = append(evicted, e.key)
+	})
+	require.False(t, c.fits(1, 3*(1+1+lruCacheEntryOverhead)))
+
+	requireLookup := func(key string, expected int) {
+		t.Helper()
+		e := c.lookup([]byte(key))
+		if expected == 0 {
+			require.Nil(t, e)
+			c.miss()
+			return
+		}
+		require.NotNil(t, e)
+		require.Equal(t, expected, e.value)
+		c.hit(e)
+	}
+
+	c.add("a", 1, 1)
+	c.add("b", 2, 1)
+	c.add("c", 3, 1)
+	// Looking up a makes b the least recently used entry.
+	requireLookup("a", 1)
+	c.add("d", 4, 1)
+	require.Equal(t, []string{"b"}, evicted)
+	requireLookup("b", 0)
+
+	// A larger entry evicts as many entries as it needs to.
+	c.add("e", 5, 2)
+	require.Equal(t, []string{"b", "c", "a"}, evicted)
+	requireLookup("d", 4)
+	requireLookup("e", 5)
+
+	// Removed and cleared entries aren't evicted.
+	c.remove(c.lookup([]byte("d")))
+	require.Equal(t, CacheMetrics{Size: lruCacheEntrySize(1, 2), Count: 1, Hits: 3, Misses: 1}, c.metrics())
+	c.clear()
+	require.Equal(t, CacheMetrics{Hits: 3, Misses: 1}, c.metrics())
+	require.Equal(t, []string{"b", "c", "a"}, evicted)
+	requireLookup("e", 0)
+}
+
+// getForTest reads key from r, returning "<not found>" if the key doesn't
+// exist.
+func getForTest(t *testing.T, r Reader, key string) string {
+	t.Helper()
+	v, closer, err := r.Get([]byte(key))
+	if errors.Is(err, ErrNotFound) {
+		return "<not found>"
+	}
+	require.NoError(t, err)
+	defer closer.Close()
+	return string(v)
+}
+
+// requireCacheLookups invokes fn and checks the number of hits and misses it
+// recorded in the cache whose metrics are returned by metrics.
+func requireCacheLookups(
+	t *testing.T, metrics func() CacheMetrics, hits, misses int64, fn func(),
+) {
+	t.Helper()
+	before := metrics()
+	fn()
+	after := metrics()
+	require.Equal(t, hits, after.Hits-before.Hits, "hits")
+	require.Equal(t, misses, after.Misses-before.Misses, "misses")
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+)
+
+// ErrCancelledCompaction is returned by a manual compaction that was cancelled
+// before it completed.
+var ErrCancelledCompaction = errors.New("pebble: compaction cancelled")
+
+// ManualCompactionPriority determines how the compactions that make up a
+// manual compaction are scheduled relative to automatic compactions.
+type ManualCompactionPriority int8
+
+const (
+	// ManualCompactionPriorityHigh schedules the manual compaction's
+	// compactions ahead of any automatic compaction. This is the priority used
+	// by DB.Compact.
+	ManualCompactionPriorityHigh ManualCompactionPriority = iota
+	// ManualCompactionPriorityLow schedules the manual compaction's
+	// compactions only when there are compaction slots remaining once no more
+	// automatic compactions can be picked.
+	ManualCompactionPriorityLow
+)
+
+// String implements fmt.Stringer.
+func (p ManualCompactionPriority) String() string {
+	switch p {
+	case ManualCompactionPriorityHigh:
+		return "high"
+	case ManualCompactionPriorityLow:
+		return "low"
+	}
+	return "unknown"
+}
+
+// ManualCompactionOptions configures a manual compaction started through
+// DB.CompactWithOptions.
+type ManualCompactionOptions struct {
+	// Parallelize splits the compaction of each level into multiple
+	// non-overlapping compactions that may run concurrently.
+	Parallelize bool
+	// TargetLevel is the level into which the compacted range is moved. Every
+	// level above the target level is compacted into the level below it, so
+	// that once the manual compaction completes, no data within the range
+	// remains above the target level. Note that L0 is always compacted into the
+	// base level, which may be below the target level.
+	//
+	// The default value of zero compacts the range down to the lowest level
+	// containing data within the range, like DB.Compact.
+	TargetLevel int
+	// Priority determines the priority of the manual compaction relative to
+	// automatic compactions. The default is ManualCompactionPriorityHigh.
+	Priority ManualCompactionPriority
+}
+
+// ManualCompactionProgress describes the progress of a manual compaction.
+type ManualCompactionProgress struct {
+	// Level is the input level currently being compacted. Once the manual
+	// compaction is complete, Level is the level into which the range was
+	// compacted.
+	Level int
+	// CompactionsCompleted is the number of compactions that have completed
+	// successfully on behalf of the manual compaction.
+	CompactionsCompleted int64
+	// BytesRead is the number of bytes read from the inputs of the completed
+	// compactions.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written to the outputs of the
+	// completed compactions.
+	BytesWritten uint64
+	// FilesRemaining is an estimate of the number of files that remain to be
+	// compacted: the count of files overlapping the compaction's key range in
+	// the current input level and the levels below it that are still to be
+	// compacted.
+	FilesRemaining int
+}
+
+// manualCompactionState is shared between a manual compaction's goroutine, the
+// individual compactions performed on its behalf, and its ManualCompaction
+// handle.
+type manualCompactionState struct {
+	// cancelled is set once the manual compaction is cancelled. In-flight
+	// compactions observe it and abort.
+	cancelled atomic.Bool
+	// cancelledCh is closed once the manual compaction is cancelled, for
+	// in-flight compactions that wait rather than poll cancelled.
+	cancelledCh chan struct{}
+	cancelOnce  sync.Once
+	// level is the input level currently being compacted, and endLevel is the
+	// level above which all levels are compacted.
+	level    atomic.Int32
+	endLevel atomic.Int32
+	// Cumulative statistics of the completed compactions.
+	compactionsCompleted atomic.Int64
+	bytesRead            atomic.Uint64
+	bytesWritten         atomic.Uint64
+}
+
+func newManualCompactionState() *manualCompactionState {
+	return &manualCompactionState{cancelledCh: make(chan struct{})}
+}
+
+// cancel marks the manual compaction as cancelled.
+func (s *manualCompactionState) cancel() {
+	s.cancelOnce.Do(func() {
+		s.cancelled.Store(true)
+		close(s.cancelledCh)
+	})
+}
+
+// recordCompleted records the statistics of a successfully completed
+// compaction performed on behalf of the manual compaction.
+func (s *manualCompactionState) recordCompleted(c *compaction) {
+	s.compactionsCompleted.Add(1)
+	s.bytesRead.Add(c.bytesIterated)
+	s.bytesWritten.Add(uint64(c.bytesWritten))
+}
+
+// ManualCompaction is a handle to a manual compaction started through
+// DB.CompactWithOptions.
+type ManualCompaction struct {
+	d          *DB
+	start, end []byte
+	state      *manualCompactionState
+	cancel     context.CancelFunc
+	done       chan struct{}
+	// err is set before done is closed.
+	err error
+}
+
+// CompactWithOptions starts a manual compaction of the specified range of keys
+// in the database, returning a handle that may be used to wait for the
+// compaction, observe its progress, or cancel it. The compaction is cancelled
+// if ctx is cancelled.
+//
+// Cancellation aborts in-flight compactions performed on behalf of the manual
+// compaction, leaving their inputs in place, and drops its queued compactions.
+// Compactions that completed before cancellation are not undone.
+func (d *DB) CompactWithOptions(
+	ctx context.Context, start, end []byte, opts ManualCompactionOptions,
+) (*ManualCompaction, error) {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if err := d.validateManualCompaction(start, end, opts); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	m := &ManualCompaction{
+		d:      d,
+		start:  append([]byte(nil), start...),
+		end:    append([]byte(nil), end...),
+		state:  newManualCompactionState(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer cancel()
+		m.err = d.compactRange(ctx, m.start, m.end, opts, m.state)
+		close(m.done)
+	}()
+	return m, nil
+}
+
+// Done returns a channel that is closed once the manual compaction completes,
+// fails, or is cancelled.
+func (m *ManualCompaction) Done() <-chan struct{} {
+	return m.done
+}
+
+// Wait blocks until the manual compaction completes, fails, or is cancelled,
+// returning its error. If the manual compaction was cancelled, the error is
+// ErrCancelledCompaction.
+func (m *ManualCompaction) Wait() error {
+	<-m.done
+	return m.err
+}
+
+// Cancel cancels the manual compaction. In-flight compactions observe the
+// cancellation immediately, but Cancel does not wait for them to abort; use
+// Wait for that.
+func (m *ManualCompaction) Cancel() {
+	m.state.cancel()
+	m.cancel()
+}
+
+// Progress returns the current progress of the manual compaction.
+func (m *ManualCompaction) Progress() ManualCompactionProgress {
+	p := ManualCompactionProgress{
+		Level:                int(m.state.level.Load()),
+		CompactionsCompleted: m.state.compactionsCompleted.Load(),
+		BytesRead:            m.state.bytesRead.Load(),
+		BytesWritten:         m.state.bytesWritten.Load(),
+	}
+	endLevel := int(m.state.endLevel.Load())
+	d := m.d
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v := d.mu.versions.currentVersion()
+	for l := p.Level; l < endLevel && l < numLevels; l++ {
+		overlaps := v.Overlaps(l, d.cmp, m.start, m.end, false)
+		p.FilesRemaining += overlaps.Len()
+	}
+	return p
+}
+
+// cancelManualCompactions cancels the manual compaction with the provided
+// state: queued compactions are removed from the manual compaction queue and
+// report ErrCancelledCompaction, and in-flight compactions abort once they
+// observe the cancellation.
+func (d *DB) cancelManualCompactions(state *manualCompactionState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state.cancel()
+	queued := d.mu.compact.manual[:0]
+	for _, manual := range d.mu.compact.manual {
+		if manual.state == state {
+			manual.done <- ErrCancelledCompaction
+			continue
+		}
+		queued = append(queued, manual)
+	}
+	d.mu.compact.manual = queued
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManualCompactionWithOptions(t *testing.T) {
+	var d *DB
+	defer func() {
+		if d != nil {
+			require.NoError(t, d.Close())
+		}
+	}()
+	opts := (&Options{
+		FS:                          vfs.NewMem(),
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatNewest,
+	}).WithFSDefaults()
+
+	datadriven.RunTest(t, "testdata/manual_compaction_options", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "define":
+			if d != nil {
+				if err := d.Close(); err != nil {
+					return err.Error()
+				}
+			}
+			var err error
+			if d, err = runDBDefineCmd(td, opts); err != nil {
+				return err.Error()
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return d.mu.versions.currentVersion().DebugString(base.DefaultFormatter)
+
+		case "compact":
+			if len(td.CmdArgs) == 0 {
+				return "compact <start>-<end> [target=<level>] [priority=<high|low>] [parallel]"
+			}
+			parts := strings.Split(td.CmdArgs[0].Key, "-")
+			var copts ManualCompactionOptions
+			for _, arg := range td.CmdArgs[1:] {
+				switch arg.Key {
+				case "target":
+					td.ScanArgs(t, "target", &copts.TargetLevel)
+				case "priority":
+					switch arg.Vals[0] {
+					case "high":
+						copts.Priority = ManualCompactionPriorityHigh
+					case "low":
+						copts.Priority = ManualCompactionPriorityLow
+					default:
+						return fmt.Sprintf("unknown priority %q", arg.Vals[0])
+					}
+				case "parallel":
+					copts.Parallelize = true
+				default:
+					return fmt.Sprintf("unknown argument %q", arg.Key)
+				}
+			}
+			m, err := d.CompactWithOptions(context.Background(), []byte(parts[0]), []byte(parts[1]), copts)
+			if err != nil {
+				return err.Error()
+			}
+			if err := m.Wait(); err != nil {
+				return err.Error()
+			}
+			p := m.Progress()
+			var buf strings.Builder
+			fmt.Fprintf(&buf, "level=%d compactions=%d files-remaining=%d\n",
+				p.Level, p.CompactionsCompleted, p.FilesRemaining)
+			d.mu.Lock()
+			buf.WriteString(d.mu.versions.currentVersion().DebugString(base.DefaultFormatter))
+			d.mu.Unlock()
+			return buf.String()
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+// blockingCreateFS blocks the creation of sstables while blocking is enabled,
+// signaling on created each time a creation is blocked.
+type blockingCreateFS struct {
+	vfs.FS
+	blocking atomic.Bool
+	created  chan struct{}
+	unblock  chan struct{}
+}
+
+func (fs *blockingCreateFS) Create(name string) (vfs.File, error) {
+	if fs.blocking.Load() && strings.HasSuffix(name, ".sst") {
+		fs.created <- struct{}{}
+		<-fs.unblock
+	}
+	return fs.FS.Create(name)
+}
+
+func TestManualCompactionCancel(t *testing.T) {
+	fs := &blockingCreateFS{
+		FS:      vfs.NewMem(),
+		created: make(chan struct{}),
+		unblock: make(chan struct{}),
+	}
+	var backgroundErr atomic.Value
+	opts := &Options{
+		FS:                          fs,
+		DebugCheck:                  DebugCheckLevels,
+		DisableAutomaticCompactions: true,
+		EventListener: &EventListener{
+			BackgroundError: func(err error) { backgroundErr.Store(err) },
+		},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Write two overlapping L0 files, so that compacting them requires
+	// writing a new output (rather than a move compaction).
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), []byte("value"), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	lsm := func() string {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.mu.versions.currentVersion().String()
+	}
+	before := lsm()
+
+	// Start a manual compaction and wait until its compaction is in-flight,
+	// blocked creating its first output.
+	fs.blocking.Store(true)
+	m, err := d.CompactWithOptions(context.Background(), []byte("000"), []byte("100"), ManualCompactionOptions{})
+	require.NoError(t, err)
+	<-fs.created
+
+	// Cancel the manual compaction and allow the compaction to proceed. It
+	// should observe the cancellation and abort, leaving the LSM unchanged.
+	m.Cancel()
+	fs.blocking.Store(false)
+	close(fs.unblock)
+	require.True(t, errors.Is(m.Wait(), ErrCancelledCompaction))
+	require.Equal(t, before, lsm())
+	require.Nil(t, backgroundErr.Load())
+	require.Equal(t, int64(0), m.Progress().CompactionsCompleted)
+
+	// The input files are no longer compacting, so a subsequent manual
+	// compaction succeeds.
+	d.mu.Lock()
+	require.Equal(t, 0, d.mu.compact.compactingCount)
+	require.Equal(t, 0, len(d.mu.compact.manual))
+	d.mu.Unlock()
+	m, err = d.CompactWithOptions(context.Background(), []byte("000"), []byte("100"), ManualCompactionOptions{})
+	require.NoError(t, err)
+	require.NoError(t, m.Wait())
+	p := m.Progress()
+	require.Equal(t, int64(1), p.CompactionsCompleted)
+	require.Less(t, uint64(0), p.BytesRead)
+	require.Less(t, uint64(0), p.BytesWritten)
+	require.Equal(t, 0, p.FilesRemaining)
+	require.NotEqual(t, before, lsm())
+}
+
+func TestManualCompactionCancelQueued(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+
+	// Occupy the only compaction slot, so that the manual compaction remains
+	// queued until it's cancelled.
+	d.mu.Lock()
+	d.mu.compact.compactingCount++
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m, err := d.CompactWithOptions(ctx, []byte("a"), []byte("b"), ManualCompactionOptions{})
+	require.NoError(t, err)
+	func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for len(d.mu.compact.manual) == 0 {
+			d.mu.Unlock()
+			d.mu.Lock()
+		}
+	}()
+	cancel()
+	require.True(t, errors.Is(m.Wait(), ErrCancelledCompaction))
+
+	d.mu.Lock()
+	require.Equal(t, 0, len(d.mu.compact.manual))
+	d.mu.compact.compactingCount--
+	d.mu.Unlock()
+}
@@ -24,8 +24,8 @@ func memTableEntrySize(keyBytes, valueBytes int) uint64 {
 	return arenaskl.MaxNodeSize(uint32(keyBytes)+8, uint32(valueBytes))
 }
 
-// memTableEmptySize is the amount of allocated space in the arena when the
-// memtable is empty.
+// memTableEmptySize is the amount of allocated space in the arena when a
+// MemTableSkiplist memtable is empty. See MemTableRepresentation.emptySize.
 var memTableEmptySize = func() uint32 {
 	var pointSkl arenaskl.Skiplist
 	var rangeDelSkl arenaskl.Skiplist
@@ -42,12 +42,15 @@ var memTableEmptySize = func() uint32 {
 // via tombstones, but it is up to higher level code (see Iterator) to support
 // processing those tombstones.
 //
-// A memTable is implemented on top of a lock-free arena-backed skiplist. An
+// A memTable is implemented on top of lock-free arena-backed skiplists. An
 // arena is a fixed size contiguous chunk of memory (see
 // Options.MemTableSize). A memTable's memory consumption is thus fixed at the
 // time of creation (with the exception of the cached fragmented range
 // tombstones). The arena-backed skiplist provides both forward and reverse
-// links which makes forward and reverse iteration the same speed.
+// links which makes forward and reverse iteration the same speed. Point keys
+// are held in a memTableRep selected by Options.Experimental.
+// MemTableRepresentation, while range deletions and range keys are each held
+// in a single skiplist.
 //
 // A batch is "applied" to a memTable in a two step process: prepare(batch) ->
 // apply(batch). memTable.prepare() is not thread-safe and must be called with
@@ -67,7 +70,8 @@ type memTable struct {
 	formatKey   base.FormatKey
 	equal       Equal
 	arenaBuf    []byte
-	skl         arenaskl.Skiplist
+	arena       *arenaskl.Arena
+	points      memTableRep
 	rangeDelSkl arenaskl.Skiplist
 	rangeKeySkl arenaskl.Skiplist
 	// reserved tracks the amount of space used by the memtable, both by actual
@@ -86,6 +90,9 @@ type memTable struct {
 	// The current logSeqNum at the time the memtable was created. This is
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum uint64
+	// emptySize is the amount of allocated space in the arena when the
+	// memtable is empty.
+	emptySize uint32
 }
 
 // memTableOptions holds configuration used when creating a memTable. All of
@@ -139,10 +146,24 @@ func newMemTable(opts memTableOptions) *memTable {
 		m.arenaBuf = make([]byte, opts.size)
 	}
 
-	arena := arenaskl.NewArena(m.arenaBuf)
-	m.skl.Reset(arena, m.cmp)
-	m.rangeDelSkl.Reset(arena, m.cmp)
-	m.rangeKeySkl.Reset(arena, m.cmp)
+	m.arena = arenaskl.NewArena(m.arenaBuf)
+	switch opts.Experimental.MemTableRepresentation {
+	case MemTableHashSkiplist:
+		points := &hashSkiplistRep{
+			cmp:    m.cmp,
+			split:  opts.Comparer.Split,
+			logger: opts.Logger,
+		}
+		points.reset(m.arena, m.cmp)
+		m.points = points
+	default:
+		points := &skiplistRep{}
+		points.skl.Reset(m.arena, m.cmp)
+		m.points = points
+	}
+	m.rangeDelSkl.Reset(m.arena, m.cmp)
+	m.rangeKeySkl.Reset(m.arena, m.cmp)
+	m.emptySize = opts.Experimental.MemTableRepresentation.emptySize()
 	return m
 }
 
@@ -213,7 +234,7 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 		case InternalKeyKindIngestSST:
 			panic("pebble: cannot apply ingested sstable key kind to memtable")
 		default:
-			err = ins.Add(&m.skl, ikey, value)
+			err = m.points.add(&ins, ikey, value)
 		}
 		if err != nil {
 			return err
@@ -236,11 +257,11 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
 func (m *memTable) newIter(o *IterOptions) internalIterator {
-	return m.skl.NewIter(o.GetLowerBound(), o.GetUpperBound())
+	return m.points.newIter(o.GetLowerBound(), o.GetUpperBound())
 }
 
 func (m *memTable) newFlushIter(o *IterOptions, bytesFlushed *uint64) internalIterator {
-	return m.skl.NewFlushIter(bytesFlushed)
+	return m.points.newFlushIter(bytesFlushed)
 }
 
 func (m *memTable) newRangeDelIter(*IterOptions) keyspan.FragmentIterator {
@@ -264,7 +285,7 @@ func (m *memTable) containsRangeKeys() bool {
 }
 
 func (m *memTable) availBytes() uint32 {
-	a := m.skl.Arena()
+	a := m.arena
 	if m.writerRefs.Load() == 1 {
 		// If there are no other concurrent apply operations, we can update the
 		// reserved bytes setting to accurately reflect how many bytes of been
@@ -275,16 +296,16 @@ func (m *memTable) availBytes() uint32 {
 }
 
 func (m *memTable) inuseBytes() uint64 {
-	return uint64(m.skl.Size() - memTableEmptySize)
+	return uint64(m.arena.Size() - m.emptySize)
 }
 
 func (m *memTable) totalBytes() uint64 {
-	return uint64(m.skl.Arena().Capacity())
+	return uint64(m.arena.Capacity())
 }
 
 // empty returns whether the MemTable has no key/value pairs.
 func (m *memTable) empty() bool {
-	return m.skl.Size() == memTableEmptySize
+	return m.arena.Size() == m.emptySize
 }
 
 // A keySpanFrags holds a set of fragmented keyspan.Spans with a particular key
@@ -0,0 +1,304 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/arenaskl"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// MemTableRepresentation selects the in-memory data structure holding a
+// memtable's point keys. Range deletions and range keys are held in separate
+// skiplists regardless of the representation. All representations allocate
+// from the memtable's fixed size arena (see Options.MemTableSize).
+type MemTableRepresentation int8
+
+const (
+	// MemTableSkiplist holds point keys in a single skiplist. It is the
+	// default, and performs well for all access patterns.
+	MemTableSkiplist MemTableRepresentation = iota
+	// MemTableHashSkiplist partitions point keys into a fixed number of
+	// skiplists by the hash of their prefix (see Comparer.Split). Prefix seeks,
+	// including those performed by DB.Get, search a single smaller skiplist,
+	// and concurrent inserts of different prefixes contend less. All other
+	// iteration, including flushes, merges the skiplists and is significantly
+	// slower, so the representation is only suitable for workloads dominated
+	// by Get and prefix iteration.
+	MemTableHashSkiplist
+)
+
+// String implements fmt.Stringer.
+func (r MemTableRepresentation) String() string {
+	switch r {
+	case MemTableSkiplist:
+		return "skiplist"
+	case MemTableHashSkiplist:
+		return "hash-skiplist"
+	default:
+		return fmt.Sprintf("MemTableRepresentation(%d)", r)
+	}
+}
+
+func parseMemTableRepresentation(s string) (MemTableRepresentation, error) {
+	switch s {
+	case "skiplist":
+		return MemTableSkiplist, nil
+	case "hash-skiplist":
+		return MemTableHashSkiplist, nil
+	default:
+		return 0, errors.Errorf("pebble: unknown memtable representation: %q", errors.Safe(s))
+	}
+}
+
+// emptySize returns the amount of allocated space in the arena when a memtable
+// using the representation is empty.
+func (r MemTableRepresentation) emptySize() uint32 {
+	if r == MemTableHashSkiplist {
+		return hashSkiplistMemTableEmptySize
+	}
+	return memTableEmptySize
+}
+
+// memTableHashBuckets is the number of skiplists into which a
+// MemTableHashSkiplist memtable partitions point keys.
+const memTableHashBuckets = 64
+
+// hashSkiplistMemTableEmptySize is the amount of allocated space in the arena
+// when a MemTableHashSkiplist memtable is empty.
+var hashSkiplistMemTableEmptySize = func() uint32 {
+	var rangeDelSkl arenaskl.Skiplist
+	var rangeKeySkl arenaskl.Skiplist
+	arena := arenaskl.NewArena(make([]byte, 64<<10 /* 64 KB */))
+	rep := &hashSkiplistRep{}
+	rep.reset(arena, bytes.Compare)
+	rangeDelSkl.Reset(arena, bytes.Compare)
+	rangeKeySkl.Reset(arena, bytes.Compare)
+	return arena.Size()
+}()
+
+// memTableRep is the representation of a memtable's point keys. See
+// MemTableRepresentation.
+//
+// It is safe to call add, newIter and newFlushIter concurrently.
+type memTableRep interface {
+	// add adds a point key, returning arenaskl.ErrArenaFull if the arena is
+	// exhausted and arenaskl.ErrRecordExists if the key is already present.
+	// The inserter is used to speed up consecutive inserts by a single
+	// goroutine, and is not shared between goroutines.
+	add(ins *arenaskl.Inserter, key base.InternalKey, value []byte) error
+	// newIter returns an unpositioned iterator over the point keys within the
+	// provided bounds.
+	newIter(lower, upper []byte) internalIterator
+	// newFlushIter returns an iterator over all point keys which accumulates
+	// the number of bytes iterated into bytesFlushed. It supports only First
+	// and Next.
+	newFlushIter(bytesFlushed *uint64) internalIterator
+}
+
+// skiplistRep is the MemTableSkiplist representation.
+type skiplistRep struct {
+	skl arenaskl.Skiplist
+}
+
+var _ memTableRep = (*skiplistRep)(nil)
+
+func (r *skiplistRep) add(ins *arenaskl.Inserter, key base.InternalKey, value []byte) error {
+	return ins.Add(&r.skl, key, value)
+}
+
+func (r *skiplistRep) newIter(lower, upper []byte) internalIterator {
+	return r.skl.NewIter(lower, upper)
+}
+
+func (r *skiplistRep) newFlushIter(bytesFlushed *uint64) internalIterator {
+	return r.skl.NewFlushIter(bytesFlushed)
+}
+
+// hashSkiplistRep is the MemTableHashSkiplist representation. Since all keys
+// sharing a prefix land in the same bucket, and keys sharing a prefix are
+// contiguous in the key ordering, a bucket holds every key that a prefix seek
+// may return before the seek's prefix is exhausted.
+type hashSkiplistRep struct {
+	cmp     Compare
+	split   Split
+	logger  Logger
+	buckets [memTableHashBuckets]arenaskl.Skiplist
+}
+
+var _ memTableRep = (*hashSkiplistRep)(nil)
+
+func (r *hashSkiplistRep) reset(arena *arenaskl.Arena, cmp Compare) {
+	for i := range r.buckets {
+		r.buckets[i].Reset(arena, cmp)
+	}
+}
+
+// bucket returns the index of the bucket holding keys with the provided
+// prefix.
+func (r *hashSkiplistRep) bucket(prefix []byte) int {
+	return int(xxhash.Sum64(prefix) % memTableHashBuckets)
+}
+
+func (r *hashSkiplistRep) prefix(userKey []byte) []byte {
+	if r.split == nil {
+		return userKey
+	}
+	return userKey[:r.split(userKey)]
+}
+
+func (r *hashSkiplistRep) add(_ *arenaskl.Inserter, key base.InternalKey, value []byte) error {
+	// The inserter's cached splice is only useful for consecutive inserts into
+	// the same skiplist, so it is not used.
+	return r.buckets[r.bucket(r.prefix(key.UserKey))].Add(key, value)
+}
+
+func (r *hashSkiplistRep) newIter(lower, upper []byte) internalIterator {
+	return &hashSkiplistIter{rep: r, lower: lower, upper: upper}
+}
+
+func (r *hashSkiplistRep) newFlushIter(bytesFlushed *uint64) internalIterator {
+	iters := make([]internalIterator, len(r.buckets))
+	for i := range r.buckets {
+		iters[i] = r.buckets[i].NewFlushIter(bytesFlushed)
+	}
+	return newMergingIter(r.logger, &base.InternalIteratorStats{}, r.cmp, r.split, iters...)
+}
+
+// hashSkiplistIter iterates over a hashSkiplistRep. Prefix seeks are served by
+// the iterator of the prefix's bucket, while all other positioning operations
+// merge the iterators of every bucket. Bucket iterators are created lazily.
+type hashSkiplistIter struct {
+	rep          *hashSkiplistRep
+	lower, upper []byte
+	buckets      [memTableHashBuckets]*arenaskl.Iterator
+	merged       *mergingIter
+	stats        base.InternalIteratorStats
+	// iter is the iterator that was last positioned, either merged or one of
+	// buckets.
+	iter internalIterator
+}
+
+var _ internalIterator = (*hashSkiplistIter)(nil)
+
+func (i *hashSkiplistIter) bucketIter(b int) *arenaskl.Iterator {
+	if i.buckets[b] == nil {
+		i.buckets[b] = i.rep.buckets[b].NewIter(i.lower, i.upper)
+	}
+	return i.buckets[b]
+}
+
+func (i *hashSkiplistIter) mergedIter() internalIterator {
+	if i.merged == nil {
+		iters := make([]internalIterator, len(i.buckets))
+		for b := range i.buckets {
+			iters[b] = i.bucketIter(b)
+		}
+		i.merged = newMergingIter(i.rep.logger, &i.stats, i.rep.cmp, i.rep.split, iters...)
+	}
+	return i.merged
+}
+
+// use makes iter the positioned iterator, returning false if it differs from
+// the previously positioned iterator, in which case any optimization relying
+// on the iterator's previous position must not be used.
+func (i *hashSkiplistIter) use(iter internalIterator) bool {
+	same := i.iter == iter
+	i.iter = iter
+	return same
+}
+
+func (i *hashSkiplistIter) SeekGE(
+	key []byte, flags base.SeekGEFlags,
+) (*base.InternalKey, base.LazyValue) {
+	if !i.use(i.mergedIter()) {
+		flags = flags.DisableTrySeekUsingNext()
+	}
+	return i.iter.SeekGE(key, flags)
+}
+
+func (i *hashSkiplistIter) SeekPrefixGE(
+	prefix, key []byte, flags base.SeekGEFlags,
+) (*base.InternalKey, base.LazyValue) {
+	if !i.use(i.bucketIter(i.rep.bucket(prefix))) {
+		flags = flags.DisableTrySeekUsingNext()
+	}
+	return i.iter.SeekPrefixGE(prefix, key, flags)
+}
+
+func (i *hashSkiplistIter) SeekLT(
+	key []byte, flags base.SeekLTFlags,
+) (*base.InternalKey, base.LazyValue) {
+	i.use(i.mergedIter())
+	return i.iter.SeekLT(key, flags)
+}
+
+func (i *hashSkiplistIter) First() (*base.InternalKey, base.LazyValue) {
+	i.use(i.mergedIter())
+	return i.iter.First()
+}
+
+func (i *hashSkiplistIter) Last() (*base.InternalKey, base.LazyValue) {
+	i.use(i.mergedIter())
+	return i.iter.Last()
+}
+
+func (i *hashSkiplistIter) Next() (*base.InternalKey, base.LazyValue) {
+	return i.iter.Next()
+}
+
+func (i *hashSkiplistIter) NextPrefix(succKey []byte) (*base.InternalKey, base.LazyValue) {
+	return i.iter.NextPrefix(succKey)
+}
+
+func (i *hashSkiplistIter) Prev() (*base.InternalKey, base.LazyValue) {
+	// Reverse iteration is not permitted after a prefix seek, so the iterator
+	// is always the merged iterator.
+	return i.iter.Prev()
+}
+
+func (i *hashSkiplistIter) Error() error {
+	if i.iter == nil {
+		return nil
+	}
+	return i.iter.Error()
+}
+
+func (i *hashSkiplistIter) Close() error {
+	var err error
+	if i.merged != nil {
+		// Closing the merged iterator closes every bucket iterator.
+		err = i.merged.Close()
+	} else {
+		for _, iter := range i.buckets {
+			if iter != nil {
+				err = firstError(err, iter.Close())
+			}
+		}
+	}
+	*i = hashSkiplistIter{}
+	return err
+}
+
+func (i *hashSkiplistIter) SetBounds(lower, upper []byte) {
+	i.lower, i.upper = lower, upper
+	if i.merged != nil {
+		i.merged.SetBounds(lower, upper)
+		return
+	}
+	for _, iter := range i.buckets {
+		if iter != nil {
+			iter.SetBounds(lower, upper)
+		}
+	}
+}
+
+func (i *hashSkiplistIter) String() string {
+	return "memtable"
+}
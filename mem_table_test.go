@@ -19,6 +19,8 @@ import (
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/rangekey"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
 	"golang.org/x/sync/errgroup"
@@ -27,7 +29,8 @@ import (
 // get gets the value for the given key. It returns ErrNotFound if the DB does
 // not contain the key.
 func (m *memTable) get(key []byte) (value []byte, err error) {
-	it := m.skl.NewIter(nil, nil)
+	it := m.newIter(nil)
+	defer it.Close()
 	ikey, val := it.SeekGE(key, base.SeekGEFlagsNone)
 	if ikey == nil {
 		return nil, ErrNotFound
@@ -61,7 +64,8 @@ func (m *memTable) set(key InternalKey, value []byte) error {
 		m.rangeKeys.invalidate(1)
 		return nil
 	}
-	return m.skl.Add(key, value)
+	var ins arenaskl.Inserter
+	return m.points.add(&ins, key, value)
 }
 
 // count returns the number of entries in a DB.
@@ -389,8 +393,148 @@ func TestMemTableConcurrentDeleteRange(t *testing.T) {
 	}
 }
 
-func buildMemTable(b *testing.B) (*memTable, [][]byte) {
-	m := newMemTable(memTableOptions{})
+// TestMemTableRepresentations checks that each memtable representation
+// returns the same results as the default skiplist for randomized keys
+// sharing prefixes.
+func TestMemTableRepresentations(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	comparer := *testkeys.Comparer
+	newMem := func(r MemTableRepresentation) *memTable {
+		opts := &Options{Comparer: &comparer}
+		opts.Experimental.MemTableRepresentation = r
+		return newMemTable(memTableOptions{Options: opts})
+	}
+	ref := newMem(MemTableSkiplist)
+	hash := newMem(MemTableHashSkiplist)
+	require.True(t, hash.empty())
+	require.Zero(t, hash.inuseBytes())
+
+	ks := testkeys.Alpha(2)
+	randKey := func() []byte {
+		return testkeys.KeyAt(ks, rng.Intn(ks.Count()), rng.Intn(10))
+	}
+	for i := 0; i < 2000; i++ {
+		key := base.MakeInternalKey(randKey(), uint64(i), InternalKeyKindSet)
+		value := []byte(fmt.Sprint(i))
+		require.NoError(t, ref.set(key, value))
+		require.NoError(t, hash.set(key, value))
+	}
+	require.False(t, hash.empty())
+
+	// Flush iterators visit the same keys, and account for all of the bytes
+	// allocated for them.
+	var refKeys, hashKeys bytes.Buffer
+	scanInternalIter(&refKeys, ref.newFlushIter(nil, new(uint64)))
+	scanInternalIter(&hashKeys, hash.newFlushIter(nil, new(uint64)))
+	require.Equal(t, refKeys.String(), hashKeys.String())
+	require.Equal(t, hash.inuseBytes(), hash.bytesIterated(t))
+
+	format := func(k *InternalKey, v base.LazyValue) string {
+		if k == nil {
+			return "."
+		}
+		return fmt.Sprintf("%s:%s", k, v.InPlaceValue())
+	}
+	refIter, hashIter := ref.newIter(nil), hash.newIter(nil)
+	defer refIter.Close()
+	defer hashIter.Close()
+	// step applies op to both iterators, checks that they return the same
+	// key, and returns whether the iterators remain positioned. Iterators are
+	// never stepped once exhausted.
+	step := func(op func(internalIterator) (*InternalKey, base.LazyValue)) bool {
+		rk, rv := op(refIter)
+		hk, hv := op(hashIter)
+		require.Equal(t, format(rk, rv), format(hk, hv))
+		return rk != nil
+	}
+	next := func(it internalIterator) (*InternalKey, base.LazyValue) { return it.Next() }
+	prev := func(it internalIterator) (*InternalKey, base.LazyValue) { return it.Prev() }
+	for i := 0; i < 1000; i++ {
+		key := randKey()
+		switch rng.Intn(3) {
+		case 0:
+			// Both iterators return the same keys in both directions.
+			valid := step(func(it internalIterator) (*InternalKey, base.LazyValue) {
+				return it.SeekGE(key, base.SeekGEFlagsNone)
+			})
+			for j := 0; valid && j < 5; j++ {
+				valid = step(next)
+			}
+			for j := 0; valid && j < 5; j++ {
+				valid = step(prev)
+			}
+		case 1:
+			valid := step(func(it internalIterator) (*InternalKey, base.LazyValue) {
+				return it.SeekLT(key, base.SeekLTFlagsNone)
+			})
+			for j := 0; valid && j < 5; j++ {
+				valid = step(next)
+			}
+		case 2:
+			// Prefix seeks return the same keys until the prefix is
+			// exhausted.
+			prefix := key[:comparer.Split(key)]
+			rk, rv := refIter.SeekPrefixGE(prefix, key, base.SeekGEFlagsNone)
+			hk, hv := hashIter.SeekPrefixGE(prefix, key, base.SeekGEFlagsNone)
+			hasPrefix := func(k *InternalKey) bool {
+				return k != nil && bytes.Equal(prefix, k.UserKey[:comparer.Split(k.UserKey)])
+			}
+			for hasPrefix(rk) {
+				require.Equal(t, format(rk, rv), format(hk, hv))
+				rk, rv = refIter.Next()
+				hk, hv = hashIter.Next()
+			}
+			require.False(t, hasPrefix(hk))
+		}
+	}
+}
+
+func TestMemTableRepresentationDB(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem(), Comparer: testkeys.Comparer}
+	opts.Experimental.MemTableRepresentation = MemTableHashSkiplist
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.Contains(t, d.opts.String(), "mem_table_representation=hash-skiplist")
+
+	for _, key := range []string{"a@1", "b@2", "b@1", "c@3"} {
+		require.NoError(t, d.Set([]byte(key), []byte(key), nil))
+	}
+	require.NoError(t, d.Delete([]byte("c@3"), nil))
+	check := func() {
+		v, closer, err := d.Get([]byte("b@1"))
+		require.NoError(t, err)
+		require.Equal(t, "b@1", string(v))
+		require.NoError(t, closer.Close())
+		_, _, err = d.Get([]byte("c@3"))
+		require.ErrorIs(t, err, ErrNotFound)
+
+		var keys []string
+		iter := d.NewIter(nil)
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, []string{"a@1", "b@2", "b@1"}, keys)
+	}
+	check()
+	require.NoError(t, d.Flush())
+	check()
+
+	var parsed Options
+	require.NoError(t, parsed.Parse(d.opts.String(), nil))
+	require.Equal(t, MemTableHashSkiplist, parsed.Experimental.MemTableRepresentation)
+}
+
+var memTableRepresentations = []MemTableRepresentation{MemTableSkiplist, MemTableHashSkiplist}
+
+func buildMemTable(b *testing.B, r MemTableRepresentation) (*memTable, [][]byte) {
+	opts := &Options{}
+	opts.Experimental.MemTableRepresentation = r
+	m := newMemTable(memTableOptions{Options: opts})
 	var keys [][]byte
 	var ikey InternalKey
 	for i := 0; ; i++ {
@@ -404,41 +548,99 @@ func buildMemTable(b *testing.B) (*memTable, [][]byte) {
 	return m, keys
 }
 
+func BenchmarkMemTableAdd(b *testing.B) {
+	for _, r := range memTableRepresentations {
+		b.Run(r.String(), func(b *testing.B) {
+			opts := &Options{MemTableSize: 64 << 20}
+			opts.Experimental.MemTableRepresentation = r
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+			keys := make([][]byte, 1<<16)
+			for i := range keys {
+				keys[i] = []byte(fmt.Sprintf("%08d", rng.Uint32()))
+			}
+
+			var m *memTable
+			var ins arenaskl.Inserter
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if i%len(keys) == 0 {
+					b.StopTimer()
+					m = newMemTable(memTableOptions{Options: opts})
+					ins = arenaskl.Inserter{}
+					b.StartTimer()
+				}
+				ikey := base.MakeInternalKey(keys[i%len(keys)], uint64(i), InternalKeyKindSet)
+				if err := m.points.add(&ins, ikey, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMemTableIterSeekPrefixGE(b *testing.B) {
+	for _, r := range memTableRepresentations {
+		b.Run(r.String(), func(b *testing.B) {
+			m, keys := buildMemTable(b, r)
+			iter := m.newIter(nil)
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := keys[rng.Intn(len(keys))]
+				iter.SeekPrefixGE(key, key, base.SeekGEFlagsNone)
+			}
+		})
+	}
+}
+
 func BenchmarkMemTableIterSeekGE(b *testing.B) {
-	m, keys := buildMemTable(b)
-	iter := m.newIter(nil)
-	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	for _, r := range memTableRepresentations {
+		b.Run(r.String(), func(b *testing.B) {
+			m, keys := buildMemTable(b, r)
+			iter := m.newIter(nil)
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		iter.SeekGE(keys[rng.Intn(len(keys))], base.SeekGEFlagsNone)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				iter.SeekGE(keys[rng.Intn(len(keys))], base.SeekGEFlagsNone)
+			}
+		})
 	}
 }
 
 func BenchmarkMemTableIterNext(b *testing.B) {
-	m, _ := buildMemTable(b)
-	iter := m.newIter(nil)
-	_, _ = iter.First()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key, _ := iter.Next()
-		if key == nil {
-			key, _ = iter.First()
-		}
-		_ = key
+	for _, r := range memTableRepresentations {
+		b.Run(r.String(), func(b *testing.B) {
+			m, _ := buildMemTable(b, r)
+			iter := m.newIter(nil)
+			_, _ = iter.First()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key, _ := iter.Next()
+				if key == nil {
+					key, _ = iter.First()
+				}
+				_ = key
+			}
+		})
 	}
 }
 
 func BenchmarkMemTableIterPrev(b *testing.B) {
-	m, _ := buildMemTable(b)
-	iter := m.newIter(nil)
-	_, _ = iter.Last()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		key, _ := iter.Prev()
-		if key == nil {
-			key, _ = iter.Last()
-		}
-		_ = key
+	for _, r := range memTableRepresentations {
+		b.Run(r.String(), func(b *testing.B) {
+			m, _ := buildMemTable(b, r)
+			iter := m.newIter(nil)
+			_, _ = iter.Last()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key, _ := iter.Prev()
+				if key == nil {
+					key, _ = iter.Last()
+				}
+				_ = key
+			}
+		})
 	}
 }
@@ -0,0 +1,93 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// mergeCache caches the results of resolving MERGE keys during iteration,
+// allowing repeated reads of hot keys to skip folding their merge operands.
+// See Options.Experimental.MergeCacheSize.
+//
+// Entries are keyed by a user key and the sequence number of the key's newest
+// visible entry. The operands beneath a given entry never change: flushes and
+// compactions that fold operands together write the result at the sequence
+// number of the newest operand. The exception is the zeroing of sequence
+// numbers by compactions into the bottommost level, so results whose newest
+// entry has a zero sequence number are never cached.
+type mergeCache struct {
+	mu struct {
+		sync.Mutex
+		lru    lruCache[mergeCacheValue]
+		keyBuf []byte
+	}
+}
+
+type mergeCacheValue struct {
+	// value is the result of the merge, and is never mutated. It is nil if the
+	// merge's DeletableValueMerger indicated the key should be deleted.
+	value   []byte
+	deleted bool
+}
+
+func newMergeCache(maxSize int64) *mergeCache {
+	c := &mergeCache{}
+	c.mu.lru.init(maxSize, nil /* onEvict */)
+	return c
+}
+
+// cacheable returns true if the result of a merge whose newest operand has the
+// provided sequence number may be cached.
+func (c *mergeCache) cacheable(seqNum uint64) bool {
+	return c != nil && seqNum != 0 && seqNum&InternalKeySeqNumBatch == 0
+}
+
+// makeKeyLocked encodes the cache key for the provided user key and sequence
+// number into c.mu.keyBuf. c.mu must be held.
+func (c *mergeCache) makeKeyLocked(userKey []byte, seqNum uint64) []byte {
+	c.mu.keyBuf = binary.BigEndian.AppendUint64(append(c.mu.keyBuf[:0], userKey...), seqNum)
+	return c.mu.keyBuf
+}
+
+// get returns the cached result of the merge at the provided user key whose
+// newest operand has the provided sequence number.
+func (c *mergeCache) get(userKey []byte, seqNum uint64) (value []byte, deleted, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.mu.lru.lookup(c.makeKeyLocked(userKey, seqNum))
+	if e == nil {
+		c.mu.lru.miss()
+		return nil, false, false
+	}
+	c.mu.lru.hit(e)
+	return e.value.value, e.value.deleted, true
+}
+
+// add caches the result of a merge. The cache takes ownership of value, which
+// must not be mutated.
+func (c *mergeCache) add(userKey []byte, seqNum uint64, value []byte, deleted bool) {
+	if !c.mu.lru.fits(len(userKey)+8, len(value)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.makeKeyLocked(userKey, seqNum)
+	if e := c.mu.lru.lookup(key); e != nil {
+		// A concurrent reader resolved the same merge.
+		return
+	}
+	c.mu.lru.add(string(key), mergeCacheValue{value: value, deleted: deleted}, len(value))
+}
+
+func (c *mergeCache) metrics() CacheMetrics {
+	if c == nil {
+		return CacheMetrics{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mu.lru.metrics()
+}
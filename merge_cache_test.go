@@ -0,0 +1,259 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// countingMerger concatenates merge operands, counting the operands it
+// receives.
+type countingMerger struct {
+	base.AppendValueMerger
+	operands *int
+}
+
+func (m *countingMerger) MergeNewer(value []byte) error {
+	*m.operands++
+	return m.AppendValueMerger.MergeNewer(value)
+}
+
+func (m *countingMerger) MergeOlder(value []byte) error {
+	*m.operands++
+	return m.AppendValueMerger.MergeOlder(value)
+}
+
+func TestMergeCache(t *testing.T) {
+	var operands int
+	opts := &Options{
+		FS: vfs.NewMem(),
+		Merger: &Merger{
+			Name: "pebble.concatenate",
+			Merge: func(key, value []byte) (ValueMerger, error) {
+				m := &countingMerger{operands: &operands}
+				return m, m.MergeNewer(value)
+			},
+		},
+	}
+	opts.Experimental.MergeCacheSize = 1 << 20
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	mergeCacheMetrics := func() CacheMetrics { return d.Metrics().MergeCache }
+	// requireMerges reads key and checks its value and the number of operands
+	// merged by the read. Reads that merge no operands are served by the cache.
+	requireMerges := func(key, expected string, expectedOperands int) {
+		t.Helper()
+		hits, misses := int64(0), int64(1)
+		if expectedOperands == 0 {
+			hits, misses = 1, 0
+		}
+		operands = 0
+		requireCacheLookups(t, mergeCacheMetrics, hits, misses, func() {
+			require.Equal(t, expected, getForTest(t, d, key))
+		})
+		require.Equal(t, expectedOperands, operands)
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Merge([]byte("a"), []byte(fmt.Sprint(i)), nil))
+	}
+	requireMerges("a", "01234", 5)
+	// The result is now cached.
+	requireMerges("a", "01234", 0)
+	m := d.Metrics()
+	require.Equal(t, int64(1), m.MergeCache.Count)
+	require.Equal(t, int64(1), m.MergeCache.Hits)
+	require.Equal(t, int64(1), m.MergeCache.Misses)
+
+	// Iterators share the cache with Get, and step over the key's remaining
+	// operands.
+	require.NoError(t, d.Set([]byte("b"), []byte("x"), nil))
+	iter := d.NewIter(nil)
+	operands = 0
+	require.True(t, iter.First())
+	require.Equal(t, "01234", string(iter.Value()))
+	require.True(t, iter.Next())
+	require.Equal(t, "b", string(iter.Key()))
+	require.True(t, iter.Prev())
+	require.Equal(t, "01234", string(iter.Value()))
+	require.NoError(t, iter.Close())
+	// Reverse iteration does not use the cache.
+	require.Equal(t, 5, operands)
+
+	// A new operand changes the key's newest entry, so the cached result is
+	// not used.
+	require.NoError(t, d.Merge([]byte("a"), []byte("5"), nil))
+	requireMerges("a", "012345", 6)
+	requireMerges("a", "012345", 0)
+
+	// A snapshot continues to read its own cached result.
+	snap := d.NewSnapshot()
+	require.NoError(t, d.Merge([]byte("a"), []byte("6"), nil))
+	operands = 0
+	v, closer, err := snap.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "012345", string(v))
+	require.NoError(t, closer.Close())
+	require.Equal(t, 0, operands)
+	require.NoError(t, snap.Close())
+
+	// Reads through an indexed batch bypass the cache.
+	b := d.NewIndexedBatch()
+	require.NoError(t, b.Merge([]byte("a"), []byte("7"), nil))
+	for i := 0; i < 2; i++ {
+		operands = 0
+		v, closer, err = b.Get([]byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, "01234567", string(v))
+		require.NoError(t, closer.Close())
+		require.Equal(t, 8, operands)
+	}
+	require.NoError(t, b.Close())
+
+	// Flushes fold operands into an entry with the newest operand's sequence
+	// number, so the cached result remains valid.
+	requireMerges("a", "0123456", 7)
+	require.NoError(t, d.Flush())
+	requireMerges("a", "0123456", 0)
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+	requireMerges("a", "0123456", 0)
+
+	// Compactions into the bottommost level zero sequence numbers, which may
+	// give different results the same sequence number. Results of keys with a
+	// zero sequence number are not cached.
+	for i := 7; i < 9; i++ {
+		require.NoError(t, d.Merge([]byte("a"), []byte(fmt.Sprint(i)), nil))
+		require.NoError(t, d.Flush())
+		require.NoError(t, d.Compact([]byte("a"), []byte("b"), false /* parallelize */))
+		expected := "012345678"[:i+1]
+		for j := 0; j < 2; j++ {
+			operands = 0
+			requireCacheLookups(t, mergeCacheMetrics, 0, 0, func() {
+				require.Equal(t, expected, getForTest(t, d, "a"))
+			})
+			require.Equal(t, 1, operands)
+		}
+	}
+	require.NoError(t, d.Merge([]byte("a"), []byte("9"), nil))
+	requireMerges("a", "0123456789", 2)
+	requireMerges("a", "0123456789", 0)
+}
+
+func TestMergeCacheEviction(t *testing.T) {
+	const entrySize = 1 + 8 + 1 + lruCacheEntryOverhead
+	c := newMergeCache(2 * entrySize)
+	c.add([]byte("a"), 1, []byte("1"), false)
+	c.add([]byte("b"), 2, []byte("2"), false)
+	// Reading a makes b the least recently used entry.
+	v, deleted, ok := c.get([]byte("a"), 1)
+	require.True(t, ok)
+	require.False(t, deleted)
+	require.Equal(t, "1", string(v))
+	c.add([]byte("c"), 3, nil, true)
+
+	_, _, ok = c.get([]byte("b"), 2)
+	require.False(t, ok)
+	_, _, ok = c.get([]byte("a"), 2)
+	require.False(t, ok)
+	_, deleted, ok = c.get([]byte("c"), 3)
+	require.True(t, ok)
+	require.True(t, deleted)
+	_, _, ok = c.get([]byte("a"), 1)
+	require.True(t, ok)
+
+	m := c.metrics()
+	require.Equal(t, int64(2), m.Count)
+	require.Equal(t, int64(2*entrySize-1), m.Size)
+
+	require.True(t, c.cacheable(1))
+	require.False(t, c.cacheable(0))
+	require.False(t, c.cacheable(1|base.InternalKeySeqNumBatch))
+	require.False(t, (*mergeCache)(nil).cacheable(1))
+}
+
+// lazyLastValueMerger returns the newest merge operand, fetching only the
+// operands it needs to.
+type lazyLastValueMerger struct {
+	value   []byte
+	lazy    int
+	fetched int
+}
+
+func (m *lazyLastValueMerger) MergeNewer(value []byte) error {
+	m.value = append(m.value[:0], value...)
+	return nil
+}
+
+func (m *lazyLastValueMerger) MergeOlder(value []byte) error {
+	return nil
+}
+
+func (m *lazyLastValueMerger) MergeNewerLazy(value LazyValue) error {
+	m.lazy++
+	v, _, err := value.Value(nil)
+	if err != nil {
+		return err
+	}
+	m.fetched++
+	return m.MergeNewer(v)
+}
+
+func (m *lazyLastValueMerger) MergeOlderLazy(value LazyValue) error {
+	m.lazy++
+	return nil
+}
+
+func (m *lazyLastValueMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return m.value, nil, nil
+}
+
+func TestLazyValueMerger(t *testing.T) {
+	var mergers []*lazyLastValueMerger
+	d, err := Open("", &Options{
+		FS: vfs.NewMem(),
+		Merger: &Merger{
+			Name: "pebble.concatenate",
+			Merge: func(key, value []byte) (ValueMerger, error) {
+				m := &lazyLastValueMerger{}
+				mergers = append(mergers, m)
+				return m, m.MergeNewer(value)
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("0"), nil))
+	for i := 1; i < 4; i++ {
+		require.NoError(t, d.Merge([]byte("a"), []byte(fmt.Sprint(i)), nil))
+	}
+
+	iter := d.NewIter(nil)
+	defer func() { require.NoError(t, iter.Close()) }()
+
+	// Forward iteration receives the older operands, including the SET,
+	// lazily and never fetches them.
+	require.True(t, iter.First())
+	require.Equal(t, "3", string(iter.Value()))
+	require.Len(t, mergers, 1)
+	require.Equal(t, 3, mergers[0].lazy)
+	require.Equal(t, 0, mergers[0].fetched)
+
+	// Reverse iteration starts from the SET and receives the newer merge
+	// operands lazily.
+	require.True(t, iter.Last())
+	require.Equal(t, "3", string(iter.Value()))
+	require.Len(t, mergers, 2)
+	require.Equal(t, 3, mergers[1].lazy)
+	require.Equal(t, 3, mergers[1].fetched)
+}
@@ -22,9 +22,38 @@ type ValueMerger = base.ValueMerger
 // DeletableValueMerger exports the base.DeletableValueMerger type.
 type DeletableValueMerger = base.DeletableValueMerger
 
+// LazyValueMerger exports the base.LazyValueMerger type.
+type LazyValueMerger = base.LazyValueMerger
+
 // DefaultMerger exports the base.DefaultMerger variable.
 var DefaultMerger = base.DefaultMerger
 
+// mergeNewerLazy submits a newer operand to valueMerger, only fetching the
+// operand's value if valueMerger is not a LazyValueMerger.
+func mergeNewerLazy(valueMerger ValueMerger, value LazyValue) error {
+	if valueMerger2, ok := valueMerger.(LazyValueMerger); ok {
+		return valueMerger2.MergeNewerLazy(value)
+	}
+	v, _, err := value.Value(nil)
+	if err != nil {
+		return err
+	}
+	return valueMerger.MergeNewer(v)
+}
+
+// mergeOlderLazy submits an older operand to valueMerger, only fetching the
+// operand's value if valueMerger is not a LazyValueMerger.
+func mergeOlderLazy(valueMerger ValueMerger, value LazyValue) error {
+	if valueMerger2, ok := valueMerger.(LazyValueMerger); ok {
+		return valueMerger2.MergeOlderLazy(value)
+	}
+	v, _, err := value.Value(nil)
+	if err != nil {
+		return err
+	}
+	return valueMerger.MergeOlder(v)
+}
+
 func finishValueMerger(
 	valueMerger ValueMerger, includesBase bool,
 ) (value []byte, needDelete bool, closer io.Closer, err error) {
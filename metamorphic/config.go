@@ -64,6 +64,11 @@ type config struct {
 	// It's a dynamic randvar to roughly emulate workloads with MVCC timestamps,
 	// skewing towards most recent timestamps.
 	writeSuffixDist randvar.Dynamic
+	// singleDeleteMisuse configures the probability that a generated
+	// SingleDelete targets a key that has been set more than once or merged,
+	// producing an invalid history. It's zero by default, since such histories
+	// may legitimately differ across runs.
+	singleDeleteMisuse float64
 
 	// TODO(peter): unimplemented
 	// keyDist        randvar.Dynamic
@@ -109,6 +109,7 @@ func newGenerator(rng *rand.Rand, cfg config, km *keyManager) *generator {
 		iterCreationTimestamp: make(map[objID]int),
 		iterReaderID:          make(map[objID]objID),
 	}
+	km.allowSingleDeleteMisuse = cfg.singleDeleteMisuse > 0
 	// Note that the initOp fields are populated during generation.
 	g.ops = append(g.ops, g.init)
 	return g
@@ -1207,6 +1208,15 @@ func (g *generator) writerSingleDelete() {
 	}
 
 	writerID := g.liveWriters.rand(g.rng)
+	if g.cfg.singleDeleteMisuse > 0 && g.rng.Float64() < g.cfg.singleDeleteMisuse {
+		if keys := g.keyManager.ineligibleSingleDeleteKeys(); len(keys) > 0 {
+			g.add(&singleDeleteOp{
+				writerID: writerID,
+				key:      keys[g.rng.Intn(len(keys))],
+			})
+			return
+		}
+	}
 	key := g.randKeyToSingleDelete(writerID)
 	if key == nil {
 		return
@@ -152,3 +152,24 @@ func TestGeneratorRandom(t *testing.T) {
 		t.Logf("\nOps:\n%s", referenceOps)
 	}
 }
+
+func TestGeneratorSingleDeleteMisuse(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+	cfg := defaultConfig()
+	cfg.singleDeleteMisuse = 1
+	ops := generate(rng, 5000, cfg, newKeyManager())
+
+	// Replaying the generated ops through a key manager that does not permit
+	// misuse must encounter a SingleDelete of an ineligible key.
+	km := newKeyManager()
+	require.PanicsWithValue(t, "key ineligible for SingleDelete", func() {
+		for _, op := range ops {
+			for _, k := range opWrittenKeys(op) {
+				km.addNewKey(k)
+			}
+			km.update(op)
+		}
+	})
+}
@@ -129,6 +129,11 @@ func (m *keyMeta) mergeInto(keyManager *keyManager, other *keyMeta) {
 type keyManager struct {
 	comparer *base.Comparer
 
+	// allowSingleDeleteMisuse permits SingleDeletes of keys that are not
+	// eligible for them. Such SingleDeletes are tracked as if they were
+	// Deletes. See config.singleDeleteMisuse.
+	allowSingleDeleteMisuse bool
+
 	// metaTimestamp is used to provide a ordering over certain operations like
 	// iter creation, updates to keys. Keeping track of the timestamp allows us
 	// to make determinations such as whether a key will be visible to an
@@ -388,7 +393,14 @@ func (k *keyManager) update(o op) {
 		}
 	case *singleDeleteOp:
 		if !k.globalStateIndicatesEligibleForSingleDelete(s.key) {
-			panic("key ineligible for SingleDelete")
+			if !k.allowSingleDeleteMisuse {
+				panic("key ineligible for SingleDelete")
+			}
+			// The SingleDelete may or may not delete the key depending on how
+			// it meets the key's other writes, so conservatively track it as
+			// a Delete.
+			k.update(&deleteOp{writerID: s.writerID, key: s.key})
+			return
 		}
 		meta := k.getOrInit(s.writerID, s.key)
 		globalMeta := k.globalKeysMap[string(s.key)]
@@ -447,6 +459,22 @@ func (k *keyManager) eligibleWriteKeys() (keys [][]byte) {
 	return keys
 }
 
+// ineligibleSingleDeleteKeys returns a slice of keys that have been written
+// but cannot be safely single deleted. It's used to generate invalid
+// histories that misuse SingleDelete.
+func (k *keyManager) ineligibleSingleDeleteKeys() (keys [][]byte) {
+	for _, v := range k.globalKeysMap {
+		if v.singleDel || v.sets+v.merges == 0 || k.globalStateIndicatesEligibleForSingleDelete(v.key) {
+			continue
+		}
+		keys = append(keys, v.key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return k.comparer.Compare(keys[i], keys[j]) < 0
+	})
+	return keys
+}
+
 // eligibleSingleDeleteKeys returns a slice of keys that can be safely single
 // deleted, given the writer id.
 func (k *keyManager) eligibleSingleDeleteKeys(id objID) (keys [][]byte) {
@@ -42,6 +42,9 @@ type runAndCompareOptions struct {
 	traceFile         string
 	mutateTestOptions []func(*TestOptions)
 	customRuns        map[string]string
+	// singleDeleteMisuse is the probability with which generated
+	// SingleDeletes misuse SingleDelete. See GenerateSingleDeleteMisuse.
+	singleDeleteMisuse float64
 	runOnceOptions
 }
 
@@ -121,6 +124,21 @@ func AddCustomRun(name string, serializedOptions string) RunOption {
 	return closureOpt(func(ro *runAndCompareOptions) { ro.customRuns[name] = serializedOptions })
 }
 
+// GenerateSingleDeleteMisuse configures generation to produce, with the
+// provided probability, SingleDeletes of keys that have been set multiple
+// times or merged. All runs enable Options.Experimental.DetectSingleDeleteMisuse
+// so that the misuse is detected and logged. Since the outcome of misusing
+// SingleDelete depends on how writes meet in compactions, the histories of
+// the runs are not compared.
+type GenerateSingleDeleteMisuse float64
+
+func (p GenerateSingleDeleteMisuse) apply(ro *runAndCompareOptions) {
+	ro.singleDeleteMisuse = float64(p)
+	ro.mutateTestOptions = append(ro.mutateTestOptions, func(to *TestOptions) {
+		to.Opts.Experimental.DetectSingleDeleteMisuse = true
+	})
+}
+
 type closureOpt func(*runAndCompareOptions)
 
 func (f closureOpt) apply(ro *runAndCompareOptions) { f(ro) }
@@ -159,6 +177,7 @@ func RunAndCompare(t *testing.T, rootDir string, rOpts ...RunOption) {
 	// read by the child processes when performing a test run.
 	km := newKeyManager()
 	cfg := defaultConfig()
+	cfg.singleDeleteMisuse = runOpts.singleDeleteMisuse
 	if runOpts.previousOpsPath != "" {
 		// During cross-version testing, we load keys from an `ops` file
 		// produced by a metamorphic test run of an earlier Pebble version.
@@ -278,8 +297,9 @@ func RunAndCompare(t *testing.T, rootDir string, rOpts ...RunOption) {
 	// `execution` subtest ensures all the histories are available when we
 	// proceed to comparing against the base history.
 
-	// Don't bother comparing output if we've already failed.
-	if t.Failed() {
+	// Don't bother comparing output if we've already failed, or if the
+	// histories are expected to differ.
+	if t.Failed() || runOpts.singleDeleteMisuse > 0 {
 		return
 	}
 
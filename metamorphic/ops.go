@@ -589,7 +589,7 @@ func (o *ingestOp) collapseBatch(
 
 			var err error
 			switch key.Kind() {
-			case pebble.InternalKeyKindDelete:
+			case pebble.InternalKeyKindDelete, pebble.InternalKeyKindDeleteSized:
 				err = collapsed.Delete(key.UserKey, nil)
 			case pebble.InternalKeyKindSingleDelete:
 				err = collapsed.SingleDelete(key.UserKey, nil)
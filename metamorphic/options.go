@@ -413,6 +413,15 @@ func randomOptions(
 	if rng.Intn(2) == 0 {
 		opts.Experimental.DisableIngestAsFlushable = func() bool { return true }
 	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MergeCacheSize = 1 << uint(10+rng.Intn(11)) // 1KB - 1MB
+	}
+	if rng.Intn(4) == 0 {
+		opts.Experimental.RetainHistory = true
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.RowCacheSize = 1 << uint(10+rng.Intn(11)) // 1KB - 1MB
+	}
 	var lopts pebble.LevelOptions
 	lopts.BlockRestartInterval = 1 + rng.Intn(64)  // 1 - 64
 	lopts.BlockSize = 1 << uint(rng.Intn(24))      // 1 - 16MB
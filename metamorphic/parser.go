@@ -378,7 +378,9 @@ func (p *parser) parseArgs(op op, methodName string, args []interface{}) {
 
 		case *pebble.FormatMajorVersion:
 			_, lit := p.scanToken(token.INT)
-			val, err := strconv.ParseUint(lit, 0, 64)
+			// FormatMajorVersion.String zero-pads the version, so the literal
+			// must be parsed as base 10 rather than as octal.
+			val, err := strconv.ParseUint(lit, 10, 64)
 			if err != nil {
 				panic(err)
 			}
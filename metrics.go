@@ -21,6 +21,25 @@ import (
 // CacheMetrics holds metrics for the block and table cache.
 type CacheMetrics = cache.Metrics
 
+// CacheBlockKind identifies the kind of a block in the block cache.
+// CacheMetrics.BlockKinds is indexed by CacheBlockKind.
+type CacheBlockKind = cache.BlockKind
+
+// The kinds of blocks in the block cache.
+const (
+	CacheBlockKindUnknown  = cache.UnknownBlock
+	CacheBlockKindData     = cache.DataBlock
+	CacheBlockKindValue    = cache.ValueBlock
+	CacheBlockKindIndex    = cache.IndexBlock
+	CacheBlockKindFilter   = cache.FilterBlock
+	CacheBlockKindMetadata = cache.MetadataBlock
+	NumCacheBlockKinds     = cache.NumBlockKinds
+)
+
+// CacheBlockKindMetrics holds the block cache hits and misses of a kind of
+// block.
+type CacheBlockKindMetrics = cache.BlockKindMetrics
+
 // FilterMetrics holds metrics for the filter policy
 type FilterMetrics = sstable.FilterMetrics
 
@@ -90,7 +109,50 @@ type LevelMetrics struct {
 		// LevelMetrics.format, but are available to sophisticated clients.
 		BytesWrittenDataBlocks  uint64
 		BytesWrittenValueBlocks uint64
+		// FileAges is a histogram of the ages of the sstables in this level,
+		// derived from their creation times. FileAges[i] counts the files
+		// younger than FileAgeBuckets[i] (and at least as old as
+		// FileAgeBuckets[i-1]); the final entry counts the files at least as old
+		// as the last bucket bound. Files without a recorded creation time are
+		// not counted. Not printed by LevelMetrics.format.
+		FileAges [len(FileAgeBuckets) + 1]int64
+	}
+}
+
+// FileAgeBuckets holds the upper bounds of the buckets of the
+// LevelMetrics.Additional.FileAges histogram.
+var FileAgeBuckets = [...]time.Duration{
+	time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+}
+
+// fileAgeBucket returns the index of the FileAges bucket for a file of the
+// given age.
+func fileAgeBucket(age time.Duration) int {
+	for i, bound := range FileAgeBuckets {
+		if age < bound {
+			return i
+		}
 	}
+	return len(FileAgeBuckets)
+}
+
+// fileAgesForLevel returns a histogram of the ages of the files within the
+// level, relative to now. See LevelMetrics.Additional.FileAges.
+func fileAgesForLevel(
+	v *version, level int, now time.Time,
+) (ages [len(FileAgeBuckets) + 1]int64) {
+	iter := v.Levels[level].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		if f.CreationTime == 0 {
+			continue
+		}
+		ages[fileAgeBucket(now.Sub(time.Unix(f.CreationTime, 0)))]++
+	}
+	return ages
 }
 
 // Add updates the counter metrics for the level.
@@ -110,6 +172,9 @@ func (m *LevelMetrics) Add(u *LevelMetrics) {
 	m.Additional.BytesWrittenDataBlocks += u.Additional.BytesWrittenDataBlocks
 	m.Additional.BytesWrittenValueBlocks += u.Additional.BytesWrittenValueBlocks
 	m.Additional.ValueBlocksSize += u.Additional.ValueBlocksSize
+	for i := range m.Additional.FileAges {
+		m.Additional.FileAges[i] += u.Additional.FileAges[i]
+	}
 }
 
 // WriteAmp computes the write amplification for compactions at this
@@ -166,6 +231,10 @@ type Metrics struct {
 		ReadCount        int64
 		RewriteCount     int64
 		MultiLevelCount  int64
+		// TombstoneDensityCount is the number of compactions of tombstone-dense
+		// tables triggered by reads. It's not included in the formatted
+		// per-compaction type counts.
+		TombstoneDensityCount int64
 		// An estimate of the number of bytes that need to be compacted for the LSM
 		// to reach a stable state.
 		EstimatedDebt uint64
@@ -254,6 +323,20 @@ type Metrics struct {
 
 	TableCache CacheMetrics
 
+	// MergeCache holds metrics for the cache of resolved MERGE keys. See
+	// Options.Experimental.MergeCacheSize.
+	MergeCache CacheMetrics
+
+	// RowCache holds metrics for the cache of the results of DB.Get. See
+	// Options.Experimental.RowCacheSize.
+	RowCache CacheMetrics
+
+	// IterCategories breaks down the sstable blocks loaded by iterators by
+	// IterOptions.Category, and by LSM level. Iterators without a category are
+	// reported under the empty category. An iterator's block reads are
+	// included once it's closed, or its stats are reset.
+	IterCategories map[string]LevelBlockReadStats
+
 	// Count of the number of open sstable iterators.
 	TableIters int64
 
@@ -489,6 +572,13 @@ func (m *Metrics) SafeFormat(w redact.SafePrinter, _ rune) {
 		redact.Safe(m.Table.ZombieCount),
 		humanize.IEC.Uint64(m.Table.ZombieSize))
 	formatCacheMetrics(w, &m.BlockCache, "bcache")
+	w.Printf("  bkind %8.1f%% %6.1f%% %6.1f%% %6.1f%% %6.1f%%  %s\n",
+		redact.Safe(m.BlockCache.BlockKinds[CacheBlockKindData].HitRate()),
+		redact.Safe(m.BlockCache.BlockKinds[CacheBlockKindValue].HitRate()),
+		redact.Safe(m.BlockCache.BlockKinds[CacheBlockKindIndex].HitRate()),
+		redact.Safe(m.BlockCache.BlockKinds[CacheBlockKindFilter].HitRate()),
+		redact.Safe(m.BlockCache.BlockKinds[CacheBlockKindMetadata].HitRate()),
+		redact.SafeString(`(hit-rate: data, value, index, filter, metadata)`))
 	formatCacheMetrics(w, &m.TableCache, "tcache")
 	w.Printf("  snaps %9d %7s %7d  (score == earliest seq num)\n",
 		redact.Safe(m.Snapshots.Count),
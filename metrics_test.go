@@ -24,6 +24,10 @@ func TestMetricsFormat(t *testing.T) {
 	m.BlockCache.Count = 2
 	m.BlockCache.Hits = 3
 	m.BlockCache.Misses = 4
+	for k := CacheBlockKindData; k < NumCacheBlockKinds; k++ {
+		m.BlockCache.BlockKinds[k].Hits = int64(k)
+		m.BlockCache.BlockKinds[k].Misses = 1
+	}
 	m.Compact.Count = 5
 	m.Compact.DefaultCount = 27
 	m.Compact.DeleteOnlyCount = 28
@@ -97,6 +101,7 @@ compact         5     6 B     7 B       2                          (size == esti
 zmemtbl        14    13 B
    ztbl        16    15 B
  bcache         2     1 B   42.9%  (score == hit-rate)
+  bkind     50.0%   66.7%   75.0%   80.0%   83.3%  (hit-rate: data, value, index, filter, metadata)
  tcache        18    17 B   48.7%  (score == hit-rate)
   snaps         4       -    1024  (score == earliest seq num)
  titers        21
@@ -292,6 +297,7 @@ compact         0     0 B     0 B       0                          (size == esti
 zmemtbl         0     0 B
    ztbl         0     0 B
  bcache         0     0 B    0.0%  (score == hit-rate)
+  bkind      0.0%    0.0%    0.0%    0.0%    0.0%  (hit-rate: data, value, index, filter, metadata)
  tcache         0     0 B    0.0%  (score == hit-rate)
   snaps         0       -       0  (score == earliest seq num)
  titers         0
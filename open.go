@@ -146,7 +146,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		merge:               opts.Merger.Merge,
 		split:               opts.Comparer.Split,
 		abbreviatedKey:      opts.Comparer.AbbreviatedKey,
-		largeBatchThreshold: (opts.MemTableSize - int(memTableEmptySize)) / 2,
+		largeBatchThreshold: (opts.MemTableSize - int(opts.Experimental.MemTableRepresentation.emptySize())) / 2,
 		fileLock:            fileLock,
 		dataDir:             dataDir,
 		walDir:              walDir,
@@ -168,6 +168,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			// the tableCache, and if there are no other references to
 			// the tableCache, then the tableCache will also release its
 			// reference to the cache.
+			if d.rowCache != nil {
+				d.rowCache.close()
+			}
 			opts.Cache.Unref()
 
 			if d.tableCache != nil {
@@ -191,14 +194,25 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	}()
 
 	d.commit = newCommitPipeline(commitEnv{
-		logSeqNum:     &d.mu.versions.logSeqNum,
-		visibleSeqNum: &d.mu.versions.visibleSeqNum,
-		apply:         d.commitApply,
-		write:         d.commitWrite,
+		logSeqNum:       &d.mu.versions.logSeqNum,
+		visibleSeqNum:   &d.mu.versions.visibleSeqNum,
+		apply:           d.commitApply,
+		write:           d.commitWrite,
+		checkConditions: d.commitCheckConditions,
+		waitForRoom:     d.commitWaitForRoom,
 	})
 	d.deletionLimiter = rate.NewLimiter(
 		rate.Limit(d.opts.Experimental.MinDeletionRate),
 		d.opts.Experimental.MinDeletionRate)
+	if d.opts.Experimental.WriteThrottleRate > 0 {
+		d.writeThrottle = newWriteThrottle(d.opts.Experimental.WriteThrottleRate)
+	}
+	if d.opts.Experimental.MergeCacheSize > 0 {
+		d.mergeCache = newMergeCache(d.opts.Experimental.MergeCacheSize)
+	}
+	if d.opts.Experimental.RowCacheSize > 0 {
+		d.rowCache = newRowCache(d.opts.Experimental.RowCacheSize, d.opts.Cache)
+	}
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
 	if d.mu.mem.nextSize > initialMemTableSize {
@@ -379,6 +393,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		}
 	}
 	d.mu.versions.visibleSeqNum.Store(d.mu.versions.logSeqNum.Load())
+	if opts.Experimental.RetainHistory {
+		d.mu.snapshots.historyHorizon = d.mu.versions.visibleSeqNum.Load()
+	}
 
 	if !d.opts.ReadOnly {
 		// Create an empty .log file.
@@ -431,10 +448,17 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 			Buckets: FsyncLatencyBuckets,
 		})
 
+		// The format major version is ratcheted to opts.FormatMajorVersion
+		// below, before any records are written to the new WAL.
+		walVers := d.mu.formatVers.vers
+		if opts.FormatMajorVersion > walVers {
+			walVers = opts.FormatMajorVersion
+		}
 		logWriterConfig := record.LogWriterConfig{
 			WALMinSyncInterval: d.opts.WALMinSyncInterval,
 			WALFsyncLatency:    d.mu.log.metrics.fsyncLatency,
 			QueueSemChan:       d.commit.logSyncQSem,
+			Compression:        d.walCompression(walVers),
 		}
 		d.mu.log.LogWriter = record.NewLogWriter(logFile, newLogNum, logWriterConfig)
 		d.mu.versions.metrics.WAL.Files++
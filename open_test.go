@@ -161,7 +161,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000013.014",
+			"marker.format-version.000016.017",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -995,6 +995,41 @@ func TestOpenWALReplayReadOnlySeqNums(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestOpenWALCompression(t *testing.T) {
+	value := bytes.Repeat([]byte(`{"field":"value"}`), 100)
+	run := func(fmv FormatMajorVersion, c Compression) uint64 {
+		mem := vfs.NewMem()
+		opts := &Options{FS: mem, FormatMajorVersion: fmv}
+		opts.Experimental.WALCompression = c
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%03d", i)), value, nil))
+		}
+		bytesWritten := d.Metrics().WAL.BytesWritten
+		require.NoError(t, d.Close())
+
+		// Reopening the DB replays the WAL.
+		d, err = Open("", opts)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			v, closer, err := d.Get([]byte(fmt.Sprintf("%03d", i)))
+			require.NoError(t, err)
+			require.Equal(t, value, v)
+			require.NoError(t, closer.Close())
+		}
+		require.NoError(t, d.Close())
+		return bytesWritten
+	}
+
+	uncompressed := run(FormatWALCompression, NoCompression)
+	// WAL records are only compressed at FormatWALCompression.
+	require.Equal(t, uncompressed, run(FormatWALCompression-1, ZstdCompression))
+	for _, c := range []Compression{SnappyCompression, ZstdCompression} {
+		require.Less(t, run(FormatWALCompression, c), uncompressed/4, c.String())
+	}
+}
+
 func TestOpenWALReplayMemtableGrowth(t *testing.T) {
 	mem := vfs.NewMem()
 	const memTableSize = 64 * 1024 * 1024
@@ -171,6 +171,31 @@ type IterOptions struct {
 	// existing is not low or if we just expect a one-time Seek (where loading the
 	// data block directly is better).
 	UseL6Filters bool
+	// PrefetchBlocks configures the iterator to asynchronously prefetch up to
+	// PrefetchBlocks data blocks (and value blocks) ahead of each sstable it
+	// scans sequentially, overlapping I/O with iteration. Prefetching begins
+	// once an sstable iterator loads two consecutive blocks, and prefetched
+	// blocks are discarded if the iterator moves elsewhere, e.g. due to a seek.
+	// Prefetched blocks are read into the block cache. Zero disables
+	// prefetching.
+	PrefetchBlocks int
+	// PrefetchMemoryBudget bounds the bytes of prefetched blocks the iterator
+	// may pin in the block cache at any time, across all the sstables it reads.
+	// Zero uses a default of 1MB. Only used if PrefetchBlocks is non-zero.
+	PrefetchMemoryBudget int64
+	// Category is a caller-defined label for the iterator, e.g. identifying
+	// the kind of query it serves. The sstable blocks loaded by iterators are
+	// aggregated by category in Metrics.IterCategories.
+	Category string
+	// KeysOnly configures the iterator to only surface keys, for scans that
+	// never look at values. Value, ValueAndErr and LazyValue return empty
+	// values, and values stored apart from their keys, such as in sstable value
+	// blocks, are never read. MERGE keys are surfaced without merging their
+	// operands, unless the Merger returns a DeletableValueMerger, in which case
+	// the operands must be merged to determine whether the key exists. The
+	// length of the values stored apart from their keys that were not
+	// retrieved is reported in IteratorStats.ValueBytesAvoided.
+	KeysOnly bool
 
 	// Internal options.
 
@@ -573,6 +598,26 @@ type Options struct {
 		// NOTE: callers should take care to not mutate the key being validated.
 		KeyValidationFunc func(userKey []byte) error
 
+		// OutputPartitioner, if non-nil, defines boundaries in the user key
+		// space that no flush or compaction output sstable may span. It is
+		// passed the first user key of a new output sstable and returns the
+		// smallest partition boundary strictly greater than that key, or nil if
+		// the key falls within the last partition. The output sstable is
+		// finished before the first key greater than or equal to the returned
+		// boundary, and any range deletions or range keys that straddle the
+		// boundary are truncated to it. Outputs continue to be split according
+		// to the level's TargetFileSize within each partition.
+		//
+		// Partitioning outputs at boundaries such as tenant prefixes or table
+		// IDs allows later range deletions and ingestions that are aligned with
+		// those boundaries to touch as few sstables as possible. Note that
+		// ingested sstables and files moved between levels are not split.
+		//
+		// NOTE: the boundary returned must be strictly greater than the key
+		// passed in, according to the Comparer; returning a smaller or equal
+		// key results in a panic.
+		OutputPartitioner func(userKey []byte) []byte
+
 		// ValidateOnIngest schedules validation of sstables after they have
 		// been ingested.
 		//
@@ -612,6 +657,157 @@ type Options struct {
 		// The default value is 1, which results in no scaling of point tombstones.
 		PointTombstoneWeight float64
 
+		// PeriodicCompactionAge is the age beyond which an sstable is rewritten in
+		// place by a rewrite compaction, even if no other compaction heuristic
+		// would select it. An sstable's age is derived from the creation time
+		// recorded in its file metadata; sstables with no recorded creation time
+		// are never considered. Periodic compactions are picked at the lowest
+		// compaction-picking priority, after files marked for compaction, and
+		// are only considered when the compaction picker runs (i.e. following a
+		// flush or the completion of another compaction).
+		//
+		// The default value is 0, which disables periodic compactions.
+		PeriodicCompactionAge time.Duration
+
+		// TombstoneDenseBlockRatio enables tombstone density compactions. When
+		// positive, a built-in block property collector classifies each data
+		// block written by flushes and compactions as tombstone-dense if at
+		// least this fraction of its point keys are point tombstones, and table
+		// stats record the fraction of each table's data blocks that are
+		// tombstone-dense (see TableStats.TombstoneDenseBlocksRatio).
+		//
+		// Tombstone density compactions are triggered by reads: when a closed
+		// iterator reports at least TombstoneDenseReadThreshold internal steps
+		// beyond the steps it returned to the user, the compaction picker
+		// compacts the densest tombstone-dense table overlapping the iterator's
+		// bounds into the next level.
+		//
+		// The default value is 0, which disables tombstone density compactions.
+		TombstoneDenseBlockRatio float64
+
+		// TombstoneDenseCompactionThreshold is the fraction of a table's data
+		// blocks that must be tombstone-dense for the table to be considered
+		// tombstone-dense, and eligible for a tombstone density compaction.
+		//
+		// The default value is 0.1.
+		TombstoneDenseCompactionThreshold float64
+
+		// TombstoneDenseReadThreshold is the number of internal iterator steps in
+		// excess of the steps returned to the user (i.e. skipped keys, most
+		// commonly tombstones and the keys they delete) that an iterator must
+		// perform to trigger a tombstone density compaction.
+		//
+		// The default value is 1000.
+		TombstoneDenseReadThreshold int
+
+		// WriteThrottleRate enables gradual throttling of writes as the DB
+		// approaches a write stall, and is the rate, in bytes per second, at
+		// which batches are admitted once throttling begins. The DB's throttling
+		// level rises from 0 to 1 as the L0 read amplification rises from
+		// L0SlowdownWritesThreshold to L0StopWritesThreshold, as the bytes in
+		// use by the memtable queue rise from MemTableSlowdownWritesThreshold to
+		// MemTableStopWritesThreshold memtables' worth, or as the estimated
+		// compaction debt rises from CompactionDebtSlowdownThreshold to
+		// CompactionDebtThrottleLimit, whichever is highest. The admitted rate
+		// falls proportionally with the throttling level, to 1% of
+		// WriteThrottleRate at level 1.
+		//
+		// The default value is 0, which disables write throttling.
+		WriteThrottleRate int64
+
+		// L0SlowdownWritesThreshold is the L0 read amplification at which writes
+		// begin to be throttled. See WriteThrottleRate.
+		//
+		// The default value is halfway between L0CompactionThreshold and
+		// L0StopWritesThreshold.
+		L0SlowdownWritesThreshold int
+
+		// MemTableSlowdownWritesThreshold is the number of bytes in use by the
+		// memtable queue, in multiples of MemTableSize, at which writes begin to
+		// be throttled. The mutable memtable counts only the bytes written to it
+		// so far. See WriteThrottleRate.
+		//
+		// The default value is MemTableStopWritesThreshold-1, so that writes are
+		// throttled increasingly as the last memtable before a stall fills.
+		MemTableSlowdownWritesThreshold int
+
+		// CompactionDebtSlowdownThreshold is the estimated compaction debt, in
+		// bytes, at which writes begin to be throttled, and
+		// CompactionDebtThrottleLimit the debt at which the throttling level
+		// reaches 1. Unlike the L0 and memtable limits, compaction debt never
+		// stops writes entirely. See WriteThrottleRate.
+		//
+		// The default value of CompactionDebtSlowdownThreshold is 0, which
+		// disables throttling due to compaction debt. The default value of
+		// CompactionDebtThrottleLimit is twice CompactionDebtSlowdownThreshold.
+		CompactionDebtSlowdownThreshold uint64
+		CompactionDebtThrottleLimit     uint64
+
+		// MemTableRepresentation selects the data structure holding the point
+		// keys of memtables. The default, MemTableSkiplist, performs well for
+		// all access patterns. MemTableHashSkiplist speeds up Get and prefix
+		// iteration at the expense of all other iteration, including flushes.
+		MemTableRepresentation MemTableRepresentation
+
+		// WALCompression is the algorithm used to compress WAL records, either
+		// SnappyCompression or ZstdCompression. Records that do not compress
+		// well are written uncompressed. Compression only takes effect for
+		// WALs created once the format major version is at least
+		// FormatWALCompression, since earlier versions cannot read compressed
+		// records. The default, DefaultCompression, and NoCompression leave
+		// WAL records uncompressed.
+		WALCompression Compression
+
+		// DetectSingleDeleteMisuse enables the detection of SingleDelete misuse
+		// by flushes and compactions. A SingleDelete is misused if the key it
+		// deletes was Set more than once, or Merged, since the key's last
+		// deletion (see Writer.SingleDelete). Misuse is only detected when the
+		// SingleDelete and the offending keys meet within a single flush or
+		// compaction. Each misuse detected is reported to
+		// EventListener.SingleDeleteMisuse.
+		DetectSingleDeleteMisuse bool
+
+		// FailOnSingleDeleteMisuse, if DetectSingleDeleteMisuse is also true,
+		// fails flushes and compactions that detect the misuse of a
+		// SingleDelete with an error marked with ErrSingleDeleteMisuse, rather
+		// than writing possibly incorrect output. Failed flushes and
+		// compactions are retried, so a misuse will eventually stall writes or
+		// leave L0 unbounded. Intended for testing.
+		FailOnSingleDeleteMisuse bool
+
+		// MergeCacheSize is the capacity, in bytes, of a cache of the results
+		// of resolving MERGE keys during reads, allowing repeated reads of keys
+		// with many merge operands to skip re-merging their operands. Results
+		// are cached by key and the sequence number of the key's newest visible
+		// entry, so a cached result remains valid until the key is next
+		// written. Reads through an indexed batch, and iterators configured
+		// with a TableFilter, PointKeyFilters or range key masking, bypass the
+		// cache.
+		//
+		// The default value is 0, which disables the merge cache.
+		MergeCacheSize int64
+
+		// RowCacheSize is the capacity, in bytes, of a cache of the results of
+		// DB.Get, allowing repeated reads of hot keys to skip the memtables and
+		// sstables. Cached results are invalidated as keys are written. A range
+		// deletion or an ingestion invalidates the entire cache. The capacity
+		// is reserved from the block cache (see Options.Cache), whose effective
+		// size is reduced accordingly. Reads through batches and snapshots
+		// bypass the cache.
+		//
+		// The default value is 0, which disables the row cache.
+		RowCacheSize int64
+
+		// RetainHistory enables reads of the DB as of past sequence numbers
+		// through DB.NewIterAt and DB.GetAt. Flushes and compactions retain
+		// every version of a key whose sequence number is at or above the
+		// DB's history horizon, which the application advances through
+		// DB.SetHistoryHorizon. The horizon is initialized to the DB's visible
+		// sequence number when it's opened, so history is never retained
+		// across a restart. Retaining history increases space amplification
+		// in proportion to the write rate and the width of the window.
+		RetainHistory bool
+
 		// EnableValueBlocks is used to decide whether to enable writing
 		// TableFormatPebblev3 sstables. WARNING: do not return true yet, since
 		// support for TableFormatPebblev3 is incomplete and not production ready.
@@ -651,6 +847,14 @@ type Options struct {
 		// be reading this file. This FS is expected to have slower read/write
 		// performance than the default FS above.
 		SharedStorage shared.Storage
+
+		// CompactionJobRunner, if set, is used to offload compactions whose inputs
+		// all reside on SharedStorage to another process, typically a
+		// CompactionWorker opened on the same SharedStorage. The runner's outputs
+		// are attached to this DB's object provider and installed in place of the
+		// inputs. Flushes, compactions out of L0, multi-level compactions and
+		// compactions with inputs on local storage are always run locally.
+		CompactionJobRunner CompactionJobRunner
 	}
 
 	// Filters is a map from filter policy name to filter policy. It is used for
@@ -1032,6 +1236,21 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.Experimental.PointTombstoneWeight == 0 {
 		o.Experimental.PointTombstoneWeight = 1
 	}
+	if o.Experimental.TombstoneDenseCompactionThreshold <= 0 {
+		o.Experimental.TombstoneDenseCompactionThreshold = 0.1
+	}
+	if o.Experimental.TombstoneDenseReadThreshold <= 0 {
+		o.Experimental.TombstoneDenseReadThreshold = 1000
+	}
+	if o.Experimental.L0SlowdownWritesThreshold <= 0 {
+		o.Experimental.L0SlowdownWritesThreshold = (o.L0CompactionThreshold + o.L0StopWritesThreshold) / 2
+	}
+	if o.Experimental.MemTableSlowdownWritesThreshold <= 0 {
+		o.Experimental.MemTableSlowdownWritesThreshold = o.MemTableStopWritesThreshold - 1
+	}
+	if o.Experimental.CompactionDebtThrottleLimit == 0 {
+		o.Experimental.CompactionDebtThrottleLimit = 2 * o.Experimental.CompactionDebtSlowdownThreshold
+	}
 
 	if o.Experimental.MultiLevelCompactionHueristic == nil {
 		o.Experimental.MultiLevelCompactionHueristic = NoMultiLevel{}
@@ -1155,6 +1374,9 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
 	fmt.Fprintf(&buf, "  min_deletion_rate=%d\n", o.Experimental.MinDeletionRate)
 	fmt.Fprintf(&buf, "  merger=%s\n", o.Merger.Name)
+	if o.Experimental.PeriodicCompactionAge > 0 {
+		fmt.Fprintf(&buf, "  periodic_compaction_age=%s\n", o.Experimental.PeriodicCompactionAge)
+	}
 	fmt.Fprintf(&buf, "  point_tombstone_weight=%f\n", o.Experimental.PointTombstoneWeight)
 	fmt.Fprintf(&buf, "  read_compaction_rate=%d\n", o.Experimental.ReadCompactionRate)
 	fmt.Fprintf(&buf, "  read_sampling_multiplier=%d\n", o.Experimental.ReadSamplingMultiplier)
@@ -1170,11 +1392,44 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "%s", o.TablePropertyCollectors[i]().Name())
 	}
 	fmt.Fprintf(&buf, "]\n")
+	if o.Experimental.TombstoneDenseBlockRatio > 0 {
+		fmt.Fprintf(&buf, "  tombstone_dense_block_ratio=%f\n", o.Experimental.TombstoneDenseBlockRatio)
+		fmt.Fprintf(&buf, "  tombstone_dense_compaction_threshold=%f\n", o.Experimental.TombstoneDenseCompactionThreshold)
+		fmt.Fprintf(&buf, "  tombstone_dense_read_threshold=%d\n", o.Experimental.TombstoneDenseReadThreshold)
+	}
 	fmt.Fprintf(&buf, "  validate_on_ingest=%t\n", o.Experimental.ValidateOnIngest)
+	if c := o.Experimental.WALCompression; c == SnappyCompression || c == ZstdCompression {
+		fmt.Fprintf(&buf, "  wal_compression=%s\n", c)
+	}
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
 	fmt.Fprintf(&buf, "  max_writer_concurrency=%d\n", o.Experimental.MaxWriterConcurrency)
 	fmt.Fprintf(&buf, "  force_writer_parallelism=%t\n", o.Experimental.ForceWriterParallelism)
+	if o.Experimental.WriteThrottleRate > 0 {
+		fmt.Fprintf(&buf, "  write_throttle_rate=%d\n", o.Experimental.WriteThrottleRate)
+		fmt.Fprintf(&buf, "  l0_slowdown_writes_threshold=%d\n", o.Experimental.L0SlowdownWritesThreshold)
+		fmt.Fprintf(&buf, "  mem_table_slowdown_writes_threshold=%d\n", o.Experimental.MemTableSlowdownWritesThreshold)
+		fmt.Fprintf(&buf, "  compaction_debt_slowdown_threshold=%d\n", o.Experimental.CompactionDebtSlowdownThreshold)
+		fmt.Fprintf(&buf, "  compaction_debt_throttle_limit=%d\n", o.Experimental.CompactionDebtThrottleLimit)
+	}
+	if o.Experimental.MemTableRepresentation != MemTableSkiplist {
+		fmt.Fprintf(&buf, "  mem_table_representation=%s\n", o.Experimental.MemTableRepresentation)
+	}
+	if o.Experimental.MergeCacheSize > 0 {
+		fmt.Fprintf(&buf, "  merge_cache_size=%d\n", o.Experimental.MergeCacheSize)
+	}
+	if o.Experimental.RetainHistory {
+		fmt.Fprintln(&buf, "  retain_history=true")
+	}
+	if o.Experimental.RowCacheSize > 0 {
+		fmt.Fprintf(&buf, "  row_cache_size=%d\n", o.Experimental.RowCacheSize)
+	}
+	if o.Experimental.DetectSingleDeleteMisuse {
+		fmt.Fprintln(&buf, "  detect_single_delete_misuse=true")
+	}
+	if o.Experimental.FailOnSingleDeleteMisuse {
+		fmt.Fprintln(&buf, "  fail_on_single_delete_misuse=true")
+	}
 
 	// Private options.
 	//
@@ -1404,6 +1659,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 			case "min_flush_rate":
 				// Do nothing; option existed in older versions of pebble, and
 				// may be meaningful again eventually.
+			case "periodic_compaction_age":
+				o.Experimental.PeriodicCompactionAge, err = time.ParseDuration(value)
 			case "point_tombstone_weight":
 				o.Experimental.PointTombstoneWeight, err = strconv.ParseFloat(value, 64)
 			case "strict_wal_tail":
@@ -1434,8 +1691,49 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 			case "table_property_collectors":
 				// TODO(peter): set o.TablePropertyCollectors
+			case "tombstone_dense_block_ratio":
+				o.Experimental.TombstoneDenseBlockRatio, err = strconv.ParseFloat(value, 64)
+			case "tombstone_dense_compaction_threshold":
+				o.Experimental.TombstoneDenseCompactionThreshold, err = strconv.ParseFloat(value, 64)
+			case "tombstone_dense_read_threshold":
+				o.Experimental.TombstoneDenseReadThreshold, err = strconv.Atoi(value)
 			case "validate_on_ingest":
 				o.Experimental.ValidateOnIngest, err = strconv.ParseBool(value)
+			case "write_throttle_rate":
+				o.Experimental.WriteThrottleRate, err = strconv.ParseInt(value, 10, 64)
+			case "l0_slowdown_writes_threshold":
+				o.Experimental.L0SlowdownWritesThreshold, err = strconv.Atoi(value)
+			case "mem_table_slowdown_writes_threshold":
+				o.Experimental.MemTableSlowdownWritesThreshold, err = strconv.Atoi(value)
+			case "compaction_debt_slowdown_threshold":
+				o.Experimental.CompactionDebtSlowdownThreshold, err = strconv.ParseUint(value, 10, 64)
+			case "compaction_debt_throttle_limit":
+				o.Experimental.CompactionDebtThrottleLimit, err = strconv.ParseUint(value, 10, 64)
+			case "mem_table_representation":
+				o.Experimental.MemTableRepresentation, err = parseMemTableRepresentation(value)
+			case "merge_cache_size":
+				o.Experimental.MergeCacheSize, err = strconv.ParseInt(value, 10, 64)
+			case "retain_history":
+				o.Experimental.RetainHistory, err = strconv.ParseBool(value)
+			case "row_cache_size":
+				o.Experimental.RowCacheSize, err = strconv.ParseInt(value, 10, 64)
+			case "detect_single_delete_misuse":
+				o.Experimental.DetectSingleDeleteMisuse, err = strconv.ParseBool(value)
+			case "fail_on_single_delete_misuse":
+				o.Experimental.FailOnSingleDeleteMisuse, err = strconv.ParseBool(value)
+			case "wal_compression":
+				switch value {
+				case "Default":
+					o.Experimental.WALCompression = DefaultCompression
+				case "NoCompression":
+					o.Experimental.WALCompression = NoCompression
+				case "Snappy":
+					o.Experimental.WALCompression = SnappyCompression
+				case "ZSTD":
+					o.Experimental.WALCompression = ZstdCompression
+				default:
+					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
+				}
 			case "wal_dir":
 				o.WALDir = value
 			case "wal_bytes_per_sync":
@@ -1580,6 +1878,11 @@ func (o *Options) Validate() error {
 		fmt.Fprintf(&buf, "MemTableStopWritesThreshold (%d) must be >= 2\n",
 			o.MemTableStopWritesThreshold)
 	}
+	if r := o.Experimental.MemTableRepresentation; r != MemTableSkiplist &&
+		uint64(o.MemTableSize) <= uint64(r.emptySize()) {
+		fmt.Fprintf(&buf, "MemTableSize (%s) must be > %s for the %s memtable representation\n",
+			humanize.Uint64(uint64(o.MemTableSize)), humanize.Uint64(uint64(r.emptySize())), r)
+	}
 	if o.FormatMajorVersion > FormatNewest {
 		fmt.Fprintf(&buf, "FormatMajorVersion (%d) must be <= %d\n",
 			o.FormatMajorVersion, FormatNewest)
@@ -1622,6 +1925,12 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 		}
 		writerOpts.TablePropertyCollectors = o.TablePropertyCollectors
 		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
+		if ratio := o.Experimental.TombstoneDenseBlockRatio; ratio > 0 {
+			// NB: Copy the slice to avoid appending to the user's collectors.
+			writerOpts.BlockPropertyCollectors = append(
+				o.BlockPropertyCollectors[:len(o.BlockPropertyCollectors):len(o.BlockPropertyCollectors)],
+				func() BlockPropertyCollector { return sstable.NewTombstoneDensityCollector(ratio) })
+		}
 	}
 	if format >= sstable.TableFormatPebblev3 {
 		writerOpts.ShortAttributeExtractor = o.Experimental.ShortAttributeExtractor
@@ -103,4 +103,5 @@ func (d *DB) updateReadStateLocked(checker func(*DB) error) {
 	if old != nil {
 		old.unrefLocked()
 	}
+	d.updateWriteThrottleLocked()
 }
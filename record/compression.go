@@ -0,0 +1,106 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/golang/snappy"
+)
+
+// Compression is the algorithm used by a LogWriter to compress records. These
+// values are part of the wire format and should not be changed.
+type Compression uint8
+
+const (
+	// NoCompression leaves records uncompressed.
+	NoCompression Compression = iota
+	// SnappyCompression compresses records with Snappy.
+	SnappyCompression
+	// ZstdCompression compresses records with Zstandard.
+	ZstdCompression
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "NoCompression"
+	case SnappyCompression:
+		return "Snappy"
+	case ZstdCompression:
+		return "ZSTD"
+	default:
+		return fmt.Sprintf("Compression(%d)", c)
+	}
+}
+
+// minCompressedRecordSize is the size below which records are never
+// compressed, as the savings would be outweighed by the cost of compression
+// and the compressed payload's header.
+const minCompressedRecordSize = 64
+
+// compress appends the compressed payload of p, including its header, to dst.
+// It returns false if compression does not shrink p by at least 12.5%, in
+// which case the record should be written uncompressed.
+func compress(c Compression, dst, p []byte) ([]byte, bool) {
+	if len(p) < minCompressedRecordSize {
+		return dst, false
+	}
+	dst = append(dst[:0], byte(c))
+	dst = binary.AppendUvarint(dst, uint64(len(p)))
+	switch c {
+	case SnappyCompression:
+		n := len(dst)
+		if m := n + snappy.MaxEncodedLen(len(p)); cap(dst) < m {
+			dst = append(make([]byte, 0, m), dst...)
+		}
+		encoded := snappy.Encode(dst[n:cap(dst)], p)
+		dst = dst[:n+len(encoded)]
+	case ZstdCompression:
+		dst = encodeZstd(dst, p)
+	default:
+		return dst[:0], false
+	}
+	return dst, len(dst) < len(p)-len(p)/8
+}
+
+// decompress appends the decompressed contents of a compressed record's
+// payload to dst.
+func decompress(dst, payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, ErrInvalidCompressedRecord
+	}
+	c := Compression(payload[0])
+	n, varIntLen := binary.Uvarint(payload[1:])
+	if varIntLen <= 0 {
+		return nil, ErrInvalidCompressedRecord
+	}
+	data := payload[1+varIntLen:]
+	if cap(dst) < int(n) {
+		dst = make([]byte, 0, n)
+	}
+	var decoded []byte
+	var err error
+	switch c {
+	case SnappyCompression:
+		decoded, err = snappy.Decode(dst[:n], data)
+	case ZstdCompression:
+		decoded, err = decodeZstd(dst[:n], data)
+	default:
+		return nil, errors.Mark(
+			errors.Errorf("pebble/record: unknown record compression: %d", errors.Safe(c)),
+			ErrInvalidCompressedRecord)
+	}
+	if err != nil {
+		return nil, errors.Mark(err, ErrInvalidCompressedRecord)
+	}
+	if len(decoded) != int(n) {
+		return nil, ErrInvalidCompressedRecord
+	}
+	return decoded, nil
+}
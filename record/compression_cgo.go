@@ -0,0 +1,32 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build cgo
+// +build cgo
+
+package record
+
+import "github.com/DataDog/zstd"
+
+// decodeZstd decompresses b with the Zstandard algorithm into decodedBuf,
+// whose length should be the decompressed size.
+func decodeZstd(decodedBuf, b []byte) ([]byte, error) {
+	return zstd.Decompress(decodedBuf, b)
+}
+
+// encodeZstd appends the compression of b with the Zstandard algorithm at the
+// default compression level (level 3) to dst.
+func encodeZstd(dst, b []byte) []byte {
+	n := len(dst)
+	if m := n + zstd.CompressBound(len(b)); cap(dst) < m {
+		dst = append(make([]byte, 0, m), dst...)
+	}
+	encoded, err := zstd.CompressLevel(dst[n:cap(dst)], b, 3)
+	if err != nil {
+		// Compression only fails if the destination is too small, which
+		// CompressBound precludes.
+		panic(err)
+	}
+	return append(dst[:n], encoded...)
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build !cgo
+// +build !cgo
+
+package record
+
+import (
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdCoders holds an encoder and decoder shared by all goroutines, as
+// EncodeAll and DecodeAll are safe for concurrent use and records are small.
+var zstdCoders struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func initZstdCoders() {
+	zstdCoders.once.Do(func() {
+		zstdCoders.encoder, _ = zstd.NewWriter(nil)
+		zstdCoders.decoder, _ = zstd.NewReader(nil)
+	})
+}
+
+// decodeZstd decompresses b with the Zstandard algorithm into decodedBuf,
+// whose length should be the decompressed size.
+func decodeZstd(decodedBuf, b []byte) ([]byte, error) {
+	initZstdCoders()
+	return zstdCoders.decoder.DecodeAll(b, decodedBuf[:0])
+}
+
+// encodeZstd appends the compression of b with the Zstandard algorithm at the
+// default compression level (level 3) to dst.
+func encodeZstd(dst, b []byte) []byte {
+	initZstdCoders()
+	return zstdCoders.encoder.EncodeAll(b, dst)
+}
@@ -47,15 +47,22 @@ const (
 	SyncConcurrency = 1 << syncConcurrencyBits
 )
 
+// SyncWaiter is notified once a record passed to LogWriter.SyncRecord has
+// been synced, or syncing it has failed. *sync.WaitGroup implements
+// SyncWaiter.
+type SyncWaiter interface {
+	Done()
+}
+
 type syncSlot struct {
-	wg  *sync.WaitGroup
+	wg  SyncWaiter
 	err *error
 }
 
 // syncQueue is a lock-free fixed-size single-producer, single-consumer
 // queue. The single-producer can push to the head, and the single-consumer can
 // pop multiple values from the tail. Popping calls Done() on each of the
-// available *sync.WaitGroup elements.
+// available SyncWaiter elements.
 type syncQueue struct {
 	// headTail packs together a 32-bit head index and a 32-bit tail index. Both
 	// are indexes into slots modulo len(slots)-1.
@@ -90,7 +97,7 @@ func (q *syncQueue) unpack(ptrs uint64) (head, tail uint32) {
 	return
 }
 
-func (q *syncQueue) push(wg *sync.WaitGroup, err *error) {
+func (q *syncQueue) push(wg SyncWaiter, err *error) {
 	ptrs := atomic.LoadUint64(&q.headTail)
 	head, tail := q.unpack(ptrs)
 	if (tail+uint32(len(q.slots)))&(1<<dequeueBits-1) == head {
@@ -299,6 +306,12 @@ type LogWriter struct {
 
 	// See the comment for LogWriterConfig.QueueSemChan.
 	queueSemChan chan struct{}
+
+	// compression is the algorithm used to compress records, and
+	// compressedBuf the buffer holding the compressed payload of the record
+	// being written.
+	compression   Compression
+	compressedBuf []byte
 }
 
 // LogWriterConfig is a struct used for configuring new LogWriters
@@ -310,6 +323,10 @@ type LogWriterConfig struct {
 	// the syncQueue from overflowing (which will cause a panic). All production
 	// code ensures this is non-nil.
 	QueueSemChan chan struct{}
+	// Compression is the algorithm used to compress records. Records that do
+	// not compress well are written uncompressed. Compressed records can only
+	// be read by Readers that support compressed chunk types.
+	Compression Compression
 }
 
 // CapAllocatedBlocks is the maximum number of blocks allocated by the
@@ -333,6 +350,7 @@ func NewLogWriter(w io.Writer, logNum base.FileNum, logWriterConfig LogWriterCon
 			return time.AfterFunc(d, f)
 		},
 		queueSemChan: logWriterConfig.QueueSemChan,
+		compression:  logWriterConfig.Compression,
 	}
 	r.free.cond.L = &r.free.Mutex
 	r.free.blocks = make([]*block, 0, CapAllocatedBlocks)
@@ -670,11 +688,11 @@ func (w *LogWriter) WriteRecord(p []byte) (int64, error) {
 
 // SyncRecord writes a complete record. If wg!= nil the record will be
 // asynchronously persisted to the underlying writer and done will be called on
-// the wait group upon completion. Returns the offset just past the end of the
+// the waiter upon completion. Returns the offset just past the end of the
 // record.
 // External synchronisation provided by commitPipeline.mu.
 func (w *LogWriter) SyncRecord(
-	p []byte, wg *sync.WaitGroup, err *error,
+	p []byte, wg SyncWaiter, err *error,
 ) (logSize int64, waitDuration time.Duration, err2 error) {
 	if w.err != nil {
 		return -1, 0, w.err
@@ -684,9 +702,16 @@ func (w *LogWriter) SyncRecord(
 	// possibly be generated for VersionEdits stored in the MANIFEST. While the
 	// MANIFEST is currently written using Writer, it is good to support the same
 	// semantics with LogWriter.
+	var compressed bool
+	if w.compression != NoCompression {
+		w.compressedBuf, compressed = compress(w.compression, w.compressedBuf, p)
+		if compressed {
+			p = w.compressedBuf
+		}
+	}
 	for i := 0; i == 0 || len(p) > 0; i++ {
 		var wd time.Duration
-		p, wd = w.emitFragment(i, p)
+		p, wd = w.emitFragment(i, p, compressed)
 		waitDuration += wd
 	}
 
@@ -727,7 +752,9 @@ func (w *LogWriter) emitEOFTrailer() {
 	atomic.StoreInt32(&b.written, i+int32(recyclableHeaderSize))
 }
 
-func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte, waitDuration time.Duration) {
+func (w *LogWriter) emitFragment(
+	n int, p []byte, compressed bool,
+) (remainingP []byte, waitDuration time.Duration) {
 	b := w.block
 	i := b.written
 	first := n == 0
@@ -746,6 +773,9 @@ func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte, waitDurati
 			b.buf[i+6] = recyclableMiddleChunkType
 		}
 	}
+	if compressed {
+		b.buf[i+6] += recyclableCompressedFullChunkType - recyclableFullChunkType
+	}
 
 	binary.LittleEndian.PutUint32(b.buf[i+7:i+11], w.logNum)
 
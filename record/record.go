@@ -94,6 +94,21 @@
 // (i.e. full, first, middle, last). The CRC is computed over the type, log
 // number, and payload.
 //
+// Records written by a LogWriter configured with a Compression may be
+// compressed. A compressed record is written using 4 further "compressed
+// recyclable" chunk types that again map to the legacy chunk types, and which
+// share the recyclable chunk format. The payload of a compressed record, once
+// its chunks are reassembled, is:
+//
+//	+-----------------+-------------------------+--- ... ---+
+//	| Compression (1B)| Decompressed size (var) | Data      |
+//	+-----------------+-------------------------+--- ... ---+
+//
+// Compression identifies the algorithm (see Compression), and the
+// decompressed size is a uvarint. Readers decompress records transparently.
+// Readers that predate compressed chunk types treat them as invalid chunks,
+// so compression must only be enabled once all readers of a log support it.
+//
 // The wire format allows for limited recovery in the face of data corruption:
 // on a format error (such as a checksum mismatch), the reader moves to the
 // next block and looks for the next full or first chunk.
@@ -124,6 +139,11 @@ const (
 	recyclableFirstChunkType  = 6
 	recyclableMiddleChunkType = 7
 	recyclableLastChunkType   = 8
+
+	recyclableCompressedFullChunkType   = 9
+	recyclableCompressedFirstChunkType  = 10
+	recyclableCompressedMiddleChunkType = 11
+	recyclableCompressedLastChunkType   = 12
 )
 
 const (
@@ -148,6 +168,10 @@ var (
 	// header, length, or checksum. This usually occurs when a log is recycled,
 	// but can also occur due to corruption.
 	ErrInvalidChunk = base.CorruptionErrorf("pebble/record: invalid chunk")
+
+	// ErrInvalidCompressedRecord is returned if a compressed record's chunks
+	// are valid, but its payload cannot be decompressed.
+	ErrInvalidCompressedRecord = base.CorruptionErrorf("pebble/record: invalid compressed record")
 )
 
 // IsInvalidRecord returns true if the error matches one of the error types
@@ -178,6 +202,18 @@ type Reader struct {
 	recovering bool
 	// last is whether the current chunk is the last chunk of the record.
 	last bool
+	// compressed is whether the current record is compressed, and
+	// chunkCompressed whether the current chunk is.
+	compressed      bool
+	chunkCompressed bool
+	// decodedSeq is the sequence number of the record held in decoded. The
+	// unread portion of a compressed record's decompressed payload is
+	// decoded[decodedPos:].
+	decodedSeq int
+	decodedPos int
+	decoded    []byte
+	// compressedBuf holds a compressed record's reassembled payload.
+	compressedBuf []byte
 	// err is any accumulated error.
 	err error
 	// buf is the buffer.
@@ -224,7 +260,8 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 			}
 
 			headerSize := legacyHeaderSize
-			if chunkType >= recyclableFullChunkType && chunkType <= recyclableLastChunkType {
+			compressed := false
+			if chunkType >= recyclableFullChunkType && chunkType <= recyclableCompressedLastChunkType {
 				headerSize = recyclableHeaderSize
 				if r.end+headerSize > r.n {
 					return ErrInvalidChunk
@@ -242,6 +279,10 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					return ErrInvalidChunk
 				}
 
+				if chunkType >= recyclableCompressedFullChunkType {
+					compressed = true
+					chunkType -= (recyclableCompressedFullChunkType - recyclableFullChunkType)
+				}
 				chunkType -= (recyclableFullChunkType - 1)
 			}
 
@@ -266,7 +307,9 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 				if chunkType != fullChunkType && chunkType != firstChunkType {
 					continue
 				}
+				r.compressed = compressed
 			}
+			r.chunkCompressed = compressed
 			r.last = chunkType == fullChunkType || chunkType == lastChunkType
 			r.recovering = false
 			return nil
@@ -396,11 +439,14 @@ func (x singleReader) Read(p []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
+	if r.compressed {
+		return r.readCompressed(p, x.seq)
+	}
 	for r.begin == r.end {
 		if r.last {
 			return 0, io.EOF
 		}
-		if r.err = r.nextChunk(false); r.err != nil {
+		if r.err = r.nextRecordChunk(); r.err != nil {
 			return 0, r.err
 		}
 	}
@@ -409,6 +455,46 @@ func (x singleReader) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// nextRecordChunk reads the next chunk of the current record.
+func (r *Reader) nextRecordChunk() error {
+	if err := r.nextChunk(false); err != nil {
+		return err
+	}
+	if r.chunkCompressed != r.compressed {
+		// A record's chunks are either all compressed or all uncompressed.
+		return ErrInvalidChunk
+	}
+	return nil
+}
+
+// readCompressed reads from the decompressed payload of the current record,
+// reassembling and decompressing it on the first read.
+func (r *Reader) readCompressed(p []byte, seq int) (int, error) {
+	if r.decodedSeq != seq {
+		r.compressedBuf = r.compressedBuf[:0]
+		for {
+			r.compressedBuf = append(r.compressedBuf, r.buf[r.begin:r.end]...)
+			r.begin = r.end
+			if r.last {
+				break
+			}
+			if r.err = r.nextRecordChunk(); r.err != nil {
+				return 0, r.err
+			}
+		}
+		if r.decoded, r.err = decompress(r.decoded[:0], r.compressedBuf); r.err != nil {
+			return 0, r.err
+		}
+		r.decodedSeq, r.decodedPos = seq, 0
+	}
+	if r.decodedPos == len(r.decoded) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.decoded[r.decodedPos:])
+	r.decodedPos += n
+	return n, nil
+}
+
 // Writer writes records to an underlying io.Writer.
 type Writer struct {
 	// w is the underlying writer.
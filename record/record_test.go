@@ -16,6 +16,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
@@ -1062,3 +1063,92 @@ func BenchmarkRecordWrite(b *testing.B) {
 		})
 	}
 }
+
+func TestCompressedRecords(t *testing.T) {
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	var records [][]byte
+	for i := 0; i < 200; i++ {
+		switch i % 4 {
+		case 0:
+			// Small records are never compressed.
+			records = append(records, []byte(fmt.Sprintf("%04d", i)))
+		case 1:
+			// Compressible records, some of which span multiple blocks.
+			n := rng.Intn(4 * blockSize)
+			records = append(records, bytes.Repeat([]byte(`{"key":"value"},`), n/16+4))
+		case 2:
+			// Incompressible records are written uncompressed.
+			b := make([]byte, rng.Intn(2*blockSize)+minCompressedRecordSize)
+			_, _ = rng.Read(b)
+			records = append(records, b)
+		case 3:
+			records = append(records, nil)
+		}
+	}
+
+	write := func(c Compression) []byte {
+		var buf bytes.Buffer
+		w := NewLogWriter(&buf, 1, LogWriterConfig{
+			WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			Compression:     c,
+		})
+		for _, rec := range records {
+			_, err := w.WriteRecord(rec)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	uncompressed := write(NoCompression)
+	for _, c := range []Compression{NoCompression, SnappyCompression, ZstdCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			log := write(c)
+			if c != NoCompression {
+				require.Less(t, len(log), len(uncompressed)*3/4)
+			}
+
+			r := NewReader(bytes.NewReader(log), 1)
+			for i, rec := range records {
+				rr, err := r.Next()
+				require.NoError(t, err)
+				if i%5 == 0 {
+					// Skipping over records leaves the reader positioned at the
+					// next record.
+					continue
+				}
+				x, err := io.ReadAll(rr)
+				require.NoError(t, err)
+				require.Equal(t, len(rec), len(x), "record %d", i)
+				require.True(t, bytes.Equal(rec, x), "record %d", i)
+			}
+			_, err := r.Next()
+			require.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewLogWriter(&buf, 1, LogWriterConfig{
+			WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			Compression:     SnappyCompression,
+		})
+		_, err := w.WriteRecord(records[1])
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		// Corrupt the compression algorithm and fix up the chunk's checksum.
+		log := buf.Bytes()
+		require.Equal(t, byte(recyclableCompressedFullChunkType), log[6])
+		log[recyclableHeaderSize] = 0xff
+		length := binary.LittleEndian.Uint16(log[4:6])
+		binary.LittleEndian.PutUint32(log[0:4],
+			crc.New(log[6:recyclableHeaderSize+int(length)]).Value())
+
+		r := NewReader(bytes.NewReader(log), 1)
+		rr, err := r.Next()
+		require.NoError(t, err)
+		_, err = io.ReadAll(rr)
+		require.True(t, errors.Is(err, ErrInvalidCompressedRecord), "%v", err)
+	})
+}
@@ -12,6 +12,7 @@ package replay
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
@@ -1042,6 +1043,15 @@ func loadFlushedSSTableKeys(
 			err = b.Merge(bufs.keys[i].UserKey, bufs.keys[i].value, nil)
 		case base.InternalKeyKindSingleDelete:
 			err = b.SingleDelete(bufs.keys[i].UserKey, nil)
+		case base.InternalKeyKindDeleteSized:
+			// The value holds the size of the deleted entry, including its
+			// key.
+			v, _ := binary.Uvarint(bufs.keys[i].value)
+			var deletedValueSize uint32
+			if keyLen := uint64(len(bufs.keys[i].UserKey)); v > keyLen {
+				deletedValueSize = uint32(v - keyLen)
+			}
+			err = b.DeleteSized(bufs.keys[i].UserKey, deletedValueSize, nil)
 		case base.InternalKeyKindRangeDelete:
 			err = b.DeleteRange(bufs.keys[i].UserKey, bufs.keys[i].value, nil)
 		case base.InternalKeyKindRangeKeySet, base.InternalKeyKindRangeKeyUnset, base.InternalKeyKindRangeKeyDelete:
@@ -0,0 +1,181 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/pebble/internal/cache"
+)
+
+// rowCache caches the results of DB.Get, allowing reads of hot keys to skip
+// the memtables and sstables entirely. See Options.Experimental.RowCacheSize.
+//
+// A row records the result of reading a user key at a visible sequence number,
+// and remains valid for reads at any later sequence number until the key is
+// next written. Writes invalidate the rows of the keys they write as they're
+// applied, before they become visible, by replacing the rows with markers
+// holding the sequence number of the write. A marker prevents a concurrent
+// read that began before the write became visible from caching its outdated
+// result. Once a marker is evicted, the sequence number of its write is
+// folded into invalidatedSeqNum, which conservatively prevents caching the
+// result of any read at an earlier sequence number. Range deletions and
+// ingestions invalidate the entire cache in the same way.
+//
+// Compactions and flushes never change the result of a read, so they don't
+// invalidate the cache.
+type rowCache struct {
+	// releaseReservation releases the memory reserved from the block cache for
+	// the row cache.
+	releaseReservation func()
+	mu                 struct {
+		sync.Mutex
+		lru lruCache[rowCacheValue]
+		// invalidatedSeqNum is the largest sequence number of a write whose
+		// invalidation is no longer recorded by a marker. The results of reads
+		// at sequence numbers less than or equal to it may not be cached.
+		invalidatedSeqNum uint64
+	}
+}
+
+type rowCacheValue struct {
+	// value is the value of the key, and is never mutated. It is nil if the
+	// key was not found, or if the entry is a marker.
+	value []byte
+	found bool
+	// marker is set if the entry records the invalidation of the key by a
+	// write, rather than the result of a read.
+	marker bool
+	// seqNum is the sequence number the row was read at, or the sequence
+	// number of the write that invalidated the key if the entry is a marker.
+	seqNum uint64
+}
+
+// newRowCache returns a rowCache of the provided size, reserving the memory
+// from c.
+func newRowCache(maxSize int64, c *cache.Cache) *rowCache {
+	rc := &rowCache{
+		releaseReservation: c.Reserve(int(maxSize)),
+	}
+	rc.mu.lru.init(maxSize, rc.evictedLocked)
+	return rc
+}
+
+// get returns the cached result of reading userKey at seqNum.
+func (c *rowCache) get(userKey []byte, seqNum uint64) (value []byte, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.mu.lru.lookup(userKey)
+	if e == nil || e.value.marker || e.value.seqNum > seqNum {
+		c.mu.lru.miss()
+		return nil, false, false
+	}
+	c.mu.lru.hit(e)
+	return e.value.value, e.value.found, true
+}
+
+// add caches the result of reading userKey at seqNum. The cache takes
+// ownership of value, which must not be mutated.
+func (c *rowCache) add(userKey []byte, seqNum uint64, value []byte, found bool) {
+	if !c.mu.lru.fits(len(userKey), len(value)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seqNum <= c.mu.invalidatedSeqNum {
+		return
+	}
+	if prev := c.mu.lru.lookup(userKey); prev != nil {
+		if prev.value.seqNum >= seqNum {
+			// Either the key was written at a sequence number the read didn't
+			// observe, or a concurrent reader cached a result at least as
+			// recent.
+			return
+		}
+		c.mu.lru.remove(prev)
+	}
+	c.mu.lru.add(string(userKey), rowCacheValue{value: value, found: found, seqNum: seqNum}, len(value))
+}
+
+// invalidateBatch invalidates the keys written by b, which has been assigned
+// its sequence numbers but is not yet visible.
+func (c *rowCache) invalidateBatch(b *Batch) {
+	seqNum := b.SeqNum() + uint64(b.Count()) - 1
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for r := b.Reader(); ; {
+		kind, ukey, _, ok := r.Next()
+		if !ok {
+			return
+		}
+		switch kind {
+		case InternalKeyKindSet, InternalKeyKindSetWithDelete, InternalKeyKindMerge,
+			InternalKeyKindDelete, InternalKeyKindDeleteSized, InternalKeyKindSingleDelete:
+			c.invalidateLocked(ukey, seqNum)
+		case InternalKeyKindRangeDelete:
+			c.invalidateAllLocked(seqNum)
+			return
+		}
+	}
+}
+
+func (c *rowCache) invalidateLocked(userKey []byte, seqNum uint64) {
+	if e := c.mu.lru.lookup(userKey); e != nil {
+		if e.value.marker && e.value.seqNum >= seqNum {
+			return
+		}
+		c.mu.lru.remove(e)
+	}
+	c.mu.lru.add(string(userKey), rowCacheValue{marker: true, seqNum: seqNum}, 0 /* valueLen */)
+}
+
+// invalidateAll invalidates every key, for a write at seqNum that's not yet
+// visible.
+func (c *rowCache) invalidateAll(seqNum uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateAllLocked(seqNum)
+}
+
+func (c *rowCache) invalidateAllLocked(seqNum uint64) {
+	for _, e := range c.mu.lru.entries {
+		if e.value.marker && e.value.seqNum > seqNum {
+			seqNum = e.value.seqNum
+		}
+	}
+	if seqNum > c.mu.invalidatedSeqNum {
+		c.mu.invalidatedSeqNum = seqNum
+	}
+	c.mu.lru.clear()
+}
+
+// evictedLocked is invoked with the entries evicted from the cache. The
+// invalidation recorded by an evicted marker is folded into
+// invalidatedSeqNum.
+func (c *rowCache) evictedLocked(e *lruCacheEntry[rowCacheValue]) {
+	if e.value.marker && e.value.seqNum > c.mu.invalidatedSeqNum {
+		c.mu.invalidatedSeqNum = e.value.seqNum
+	}
+}
+
+func (c *rowCache) metrics() CacheMetrics {
+	if c == nil {
+		return CacheMetrics{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mu.lru.metrics()
+}
+
+// close releases the memory reserved from the block cache.
+func (c *rowCache) close() {
+	c.releaseReservation()
+}
+
+// noopCloser is returned as the io.Closer of values that don't need to be
+// released, such as those served from the row cache.
+type noopCloser struct{}
+
+func (noopCloser) Close() error { return nil }
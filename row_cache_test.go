@@ -0,0 +1,150 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowCache(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.RowCacheSize = 1 << 20
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// requireGet reads key, and checks its value and whether the read was
+	// served by the row cache.
+	requireGet := func(key, expected string, hit bool) {
+		t.Helper()
+		hits, misses := int64(0), int64(1)
+		if hit {
+			hits, misses = 1, 0
+		}
+		requireCacheLookups(t, func() CacheMetrics { return d.Metrics().RowCache }, hits, misses, func() {
+			require.Equal(t, expected, getForTest(t, d, key))
+		})
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	requireGet("a", "1", false)
+	requireGet("a", "1", true)
+	requireGet("b", "<not found>", false)
+	requireGet("b", "<not found>", true)
+
+	// Writes invalidate the cached rows of their keys.
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	requireGet("a", "2", false)
+	requireGet("b", "1", false)
+	requireGet("a", "2", true)
+	b := d.NewBatch()
+	require.NoError(t, b.Delete([]byte("a"), nil))
+	require.NoError(t, b.Merge([]byte("b"), []byte("2"), nil))
+	require.NoError(t, b.Commit(nil))
+	requireGet("a", "<not found>", false)
+	requireGet("b", "12", false)
+	requireGet("b", "12", true)
+
+	// Flushes and compactions don't invalidate the cache.
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false /* parallelize */))
+	requireGet("a", "<not found>", true)
+	requireGet("b", "12", true)
+
+	// Reads through snapshots and batches bypass the cache.
+	s := d.NewSnapshot()
+	require.NoError(t, d.Set([]byte("b"), []byte("3"), nil))
+	require.Equal(t, "12", getForTest(t, s, "b"))
+	require.NoError(t, s.Close())
+	b = d.NewIndexedBatch()
+	require.NoError(t, b.Set([]byte("b"), []byte("4"), nil))
+	require.Equal(t, "4", getForTest(t, b, "b"))
+	require.NoError(t, b.Close())
+	requireGet("b", "3", false)
+	requireGet("b", "3", true)
+
+	// Range deletions and ingestions invalidate the entire cache.
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	requireGet("c", "1", false)
+	require.NoError(t, d.DeleteRange([]byte("x"), []byte("y"), nil))
+	requireGet("b", "3", false)
+	requireGet("c", "1", false)
+	f, err := d.opts.FS.Create("ext")
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{})
+	require.NoError(t, w.Set([]byte("c"), []byte("2")))
+	require.NoError(t, w.Close())
+	require.NoError(t, d.Ingest([]string{"ext"}))
+	requireGet("b", "3", false)
+	requireGet("c", "2", false)
+	requireGet("c", "2", true)
+}
+
+func TestRowCacheInvalidation(t *testing.T) {
+	c := cache.New(1 << 20)
+	defer c.Unref()
+	const entrySize = 1 + 1 + lruCacheEntryOverhead
+	rc := newRowCache(3*entrySize, c)
+	defer rc.close()
+
+	requireGet := func(key string, seqNum uint64, expected string) {
+		t.Helper()
+		v, _, ok := rc.get([]byte(key), seqNum)
+		if expected == "" {
+			require.False(t, ok)
+			return
+		}
+		require.True(t, ok)
+		require.Equal(t, expected, string(v))
+	}
+
+	// A row is valid for reads at its sequence number or later.
+	rc.add([]byte("a"), 10, []byte("1"), true)
+	requireGet("a", 9, "")
+	requireGet("a", 12, "1")
+
+	// A write at #12, not yet visible to reads at #12, invalidates the row,
+	// and prevents a concurrent read at #12 from caching its result.
+	rc.mu.Lock()
+	rc.invalidateLocked([]byte("a"), 12)
+	rc.mu.Unlock()
+	requireGet("a", 12, "")
+	rc.add([]byte("a"), 12, []byte("1"), true)
+	requireGet("a", 12, "")
+	// A read that observed the write may be cached.
+	rc.add([]byte("a"), 13, []byte("2"), true)
+	requireGet("a", 13, "2")
+
+	// Evicting a marker prevents caching any result read before its write.
+	rc.mu.Lock()
+	rc.invalidateLocked([]byte("b"), 20)
+	rc.mu.Unlock()
+	rc.add([]byte("c"), 21, []byte("3"), true)
+	rc.add([]byte("d"), 21, []byte("4"), true)
+	rc.add([]byte("e"), 21, []byte("5"), true)
+	require.Equal(t, uint64(20), rc.mu.invalidatedSeqNum)
+	rc.add([]byte("b"), 20, []byte("1"), true)
+	requireGet("b", 20, "")
+	rc.add([]byte("b"), 21, []byte("2"), true)
+	requireGet("b", 21, "2")
+
+	// Invalidating all keys accounts for outstanding markers.
+	rc.mu.Lock()
+	rc.invalidateLocked([]byte("f"), 40)
+	rc.mu.Unlock()
+	rc.invalidateAll(30)
+	require.Equal(t, int64(0), rc.metrics().Count)
+	rc.add([]byte("b"), 35, []byte("3"), true)
+	requireGet("b", 35, "")
+	rc.add([]byte("b"), 41, []byte("3"), true)
+	requireGet("b", 41, "3")
+}
@@ -8,7 +8,9 @@ import (
 	"context"
 	"io"
 	"math"
+	"sync"
 
+	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/keyspan"
 )
 
@@ -23,6 +25,10 @@ type Snapshot struct {
 
 	// The next/prev link for the snapshotList doubly-linked list of snapshots.
 	prev, next *Snapshot
+
+	// efos is non-nil if the snapshot backs an EventuallyFileOnlySnapshot
+	// that has yet to transition to a file-only snapshot.
+	efos *EventuallyFileOnlySnapshot
 }
 
 var _ Reader = (*Snapshot)(nil)
@@ -38,7 +44,7 @@ func (s *Snapshot) Get(key []byte) ([]byte, io.Closer, error) {
 	if s.db == nil {
 		panic(ErrClosed)
 	}
-	return s.db.getInternal(key, nil /* batch */, s)
+	return s.db.getInternal(key, nil /* batch */, snapshotIterOpts{seqNum: s.seqNum})
 }
 
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
@@ -54,7 +60,18 @@ func (s *Snapshot) NewIterWithContext(ctx context.Context, o *IterOptions) *Iter
 	if s.db == nil {
 		panic(ErrClosed)
 	}
-	return s.db.newIter(ctx, nil /* batch */, s, o)
+	return s.db.newIter(ctx, nil /* batch */, snapshotIterOpts{seqNum: s.seqNum}, o)
+}
+
+// SplitRange returns up to n-1 keys that split the range [start, end) into
+// subranges of roughly equal size. See DB.SplitRange. The split keys are
+// derived from the DB's current version, which holds every key visible to the
+// snapshot that has been flushed.
+func (s *Snapshot) SplitRange(start, end []byte, n int) ([][]byte, error) {
+	if s.db == nil {
+		panic(ErrClosed)
+	}
+	return s.db.SplitRange(start, end, n)
 }
 
 // ScanInternal scans all internal keys within the specified bounds, truncating
@@ -74,17 +91,8 @@ func (s *Snapshot) ScanInternal(
 	if s.db == nil {
 		panic(ErrClosed)
 	}
-	iter := s.db.newInternalIter(s, &scanInternalOptions{
-		IterOptions: IterOptions{
-			KeyTypes:   IterKeyTypePointsAndRanges,
-			LowerBound: lower,
-			UpperBound: upper,
-		},
-		skipSharedLevels: visitSharedFile != nil,
-	})
-	defer iter.close()
-
-	return scanInternalImpl(ctx, lower, upper, iter, visitPointKey, visitRangeDel, visitRangeKey, visitSharedFile)
+	return s.db.scanInternalAt(ctx, snapshotIterOpts{seqNum: s.seqNum}, lower, upper,
+		visitPointKey, visitRangeDel, visitRangeKey, visitSharedFile)
 }
 
 // Close closes the snapshot, releasing its resources. Close must be called.
@@ -108,6 +116,234 @@ func (s *Snapshot) Close() error {
 	return nil
 }
 
+// snapshotIterOpts describes the view of the DB observed by a read.
+type snapshotIterOpts struct {
+	// seqNum is the sequence number the read observes. If zero, the read
+	// observes the DB's visible sequence number at the time of the read.
+	seqNum uint64
+	// readState, if non-nil, is a referenced readState observed by the read in
+	// place of the DB's current readState. The read takes ownership of the
+	// reference.
+	readState *readState
+}
+
+// KeyRange encodes a key range in user key space. A KeyRange's Start is
+// inclusive while its End is exclusive.
+type KeyRange struct {
+	Start, End []byte
+}
+
+// EventuallyFileOnlySnapshot (EFOS) provides a read-only point-in-time view of
+// the keys within a set of key ranges. Reads of keys outside of the key
+// ranges are not guaranteed to observe a consistent view.
+//
+// An EFOS begins as a regular Snapshot, requiring compactions to preserve
+// the versions of keys it may read. Once the memtables containing keys within
+// its key ranges that are visible to the snapshot are flushed, the EFOS
+// transitions to a file-only snapshot: it references the sstables of the
+// current Version, and no longer constrains compactions, which may then drop
+// old versions of keys anywhere in the keyspace. The sstables it references
+// are not deleted while it's open, so a long-lived file-only snapshot holds on
+// to the disk space of the sstables removed by compactions since its
+// transition.
+type EventuallyFileOnlySnapshot struct {
+	db     *DB
+	seqNum uint64
+	// keyRanges are the key ranges protected by the snapshot.
+	keyRanges []KeyRange
+	// transitioned is closed once the snapshot transitions to a file-only
+	// snapshot.
+	transitioned chan struct{}
+
+	mu struct {
+		sync.Mutex
+		// snap is the Snapshot backing the EFOS before its transition to a
+		// file-only snapshot. Nil once the EFOS transitions.
+		snap *Snapshot
+		// readState is the readState of the file-only snapshot, referencing the
+		// Version current at the time of the transition and no memtables. Nil
+		// before the EFOS transitions.
+		readState *readState
+	}
+}
+
+var _ Reader = (*EventuallyFileOnlySnapshot)(nil)
+
+// canTransitionLocked returns true if no memtable contains keys within the
+// snapshot's key ranges that are visible to the snapshot. DB.mu must be held.
+func (es *EventuallyFileOnlySnapshot) canTransitionLocked() bool {
+	d := es.db
+	meta := make([]*fileMetadata, len(es.keyRanges))
+	for i, kr := range es.keyRanges {
+		meta[i] = &fileMetadata{
+			Smallest: base.MakeInternalKey(kr.Start, InternalKeySeqNumMax, InternalKeyKindMax),
+			Largest:  base.MakeExclusiveSentinelKey(InternalKeyKindRangeDelete, kr.End),
+		}
+	}
+	for _, mem := range d.mu.mem.queue {
+		// Memtables holding only keys newer than the snapshot need not be
+		// flushed.
+		if mem.logSeqNum >= es.seqNum {
+			continue
+		}
+		if ingestMemtableOverlaps(d.cmp, mem, meta) {
+			return false
+		}
+	}
+	return true
+}
+
+// transitionLocked transitions the snapshot to a file-only snapshot,
+// referencing the current Version. DB.mu must be held.
+func (es *EventuallyFileOnlySnapshot) transitionLocked() {
+	d := es.db
+	current := d.mu.versions.currentVersion()
+	current.Ref()
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.mu.readState = &readState{db: d, refcnt: 1, current: current}
+	if es.mu.snap != nil {
+		d.mu.snapshots.remove(es.mu.snap)
+		es.mu.snap = nil
+	}
+	close(es.transitioned)
+}
+
+// maybeTransitionSnapshotsToFileOnlyLocked transitions the
+// EventuallyFileOnlySnapshots whose key ranges no longer overlap memtables
+// to file-only snapshots. DB.mu must be held.
+func (d *DB) maybeTransitionSnapshotsToFileOnlyLocked() {
+	earliest := d.mu.snapshots.earliest()
+	for s := d.mu.snapshots.root.next; s != &d.mu.snapshots.root; {
+		next := s.next
+		if s.efos != nil && s.efos.canTransitionLocked() {
+			s.efos.transitionLocked()
+		}
+		s = next
+	}
+	// Compactions may be able to drop keys that were pinned by the snapshots.
+	if d.mu.snapshots.earliest() > earliest {
+		d.maybeScheduleCompactionPicker(pickElisionOnly)
+	}
+}
+
+// snapshotIterOpts returns the view of the DB observed by reads of the
+// snapshot. The returned readState is referenced.
+func (es *EventuallyFileOnlySnapshot) snapshotIterOpts() snapshotIterOpts {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.db == nil {
+		panic(ErrClosed)
+	}
+	// The readState must be loaded while holding es.mu, ensuring the snapshot
+	// doesn't concurrently transition. Otherwise, the read may observe the
+	// output of compactions that dropped keys visible to the snapshot.
+	if es.mu.readState != nil {
+		es.mu.readState.ref()
+		return snapshotIterOpts{seqNum: es.seqNum, readState: es.mu.readState}
+	}
+	return snapshotIterOpts{seqNum: es.seqNum, readState: es.db.loadReadState()}
+}
+
+// Get gets the value for the given key. It returns ErrNotFound if the
+// snapshot does not contain the key.
+//
+// The caller should not modify the contents of the returned slice, but it is
+// safe to modify the contents of the argument after Get returns. The returned
+// slice will remain valid until the returned Closer is closed. On success, the
+// caller MUST call closer.Close() or a memory leak will occur.
+func (es *EventuallyFileOnlySnapshot) Get(key []byte) ([]byte, io.Closer, error) {
+	return es.db.getInternal(key, nil /* batch */, es.snapshotIterOpts())
+}
+
+// NewIter returns an iterator that is unpositioned (Iterator.Valid() will
+// return false). The iterator can be positioned via a call to SeekGE,
+// SeekLT, First or Last.
+func (es *EventuallyFileOnlySnapshot) NewIter(o *IterOptions) *Iterator {
+	return es.NewIterWithContext(context.Background(), o)
+}
+
+// NewIterWithContext is like NewIter, and additionally accepts a context for
+// tracing.
+func (es *EventuallyFileOnlySnapshot) NewIterWithContext(
+	ctx context.Context, o *IterOptions,
+) *Iterator {
+	return es.db.newIter(ctx, nil /* batch */, es.snapshotIterOpts(), o)
+}
+
+// ScanInternal scans all internal keys within the specified bounds, truncating
+// any rangedels and rangekeys to those bounds. See Snapshot.ScanInternal.
+func (es *EventuallyFileOnlySnapshot) ScanInternal(
+	ctx context.Context,
+	lower, upper []byte,
+	visitPointKey func(key *InternalKey, value LazyValue) error,
+	visitRangeDel func(start, end []byte, seqNum uint64) error,
+	visitRangeKey func(start, end []byte, keys []keyspan.Key) error,
+	visitSharedFile func(sst *SharedSSTMeta) error,
+) error {
+	return es.db.scanInternalAt(ctx, es.snapshotIterOpts(), lower, upper,
+		visitPointKey, visitRangeDel, visitRangeKey, visitSharedFile)
+}
+
+// IsFileOnly returns true if the snapshot has transitioned to a file-only
+// snapshot.
+func (es *EventuallyFileOnlySnapshot) IsFileOnly() bool {
+	select {
+	case <-es.transitioned:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitForFileOnlySnapshot flushes the memtables if necessary, and waits for the
+// snapshot to transition to a file-only snapshot, or for ctx to be done.
+func (es *EventuallyFileOnlySnapshot) WaitForFileOnlySnapshot(ctx context.Context) error {
+	if es.IsFileOnly() {
+		return nil
+	}
+	if _, err := es.db.AsyncFlush(); err != nil {
+		return err
+	}
+	select {
+	case <-es.transitioned:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the snapshot, releasing its resources. Close must be called.
+// Failure to do so will result in a tiny memory leak and a large leak of
+// resources on disk due to the entries and sstables the snapshot is
+// preventing from being deleted.
+func (es *EventuallyFileOnlySnapshot) Close() error {
+	d := es.db
+	if d == nil {
+		panic(ErrClosed)
+	}
+	d.mu.Lock()
+	es.mu.Lock()
+	snap, rs := es.mu.snap, es.mu.readState
+	es.mu.snap, es.mu.readState = nil, nil
+	es.db = nil
+	es.mu.Unlock()
+	if snap != nil {
+		d.mu.snapshots.remove(snap)
+		// If snap was the previous earliest snapshot, we might be able to
+		// reclaim disk space by dropping obsolete records that were pinned by
+		// it.
+		if e := d.mu.snapshots.earliest(); e > snap.seqNum {
+			d.maybeScheduleCompactionPicker(pickElisionOnly)
+		}
+	}
+	d.mu.Unlock()
+	if rs != nil {
+		rs.unref()
+	}
+	return nil
+}
+
 type snapshotList struct {
 	root Snapshot
 }
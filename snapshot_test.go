@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -348,3 +349,80 @@ func TestNewSnapshotRace(t *testing.T) {
 	wg.Wait()
 	require.NoError(t, d.Close())
 }
+
+func TestEventuallyFileOnlySnapshot(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	get := func(r Reader, key string) string {
+		v, closer, err := r.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	scan := func(r Reader) string {
+		iter := r.NewIter(nil)
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, fmt.Sprintf("%s:%s", iter.Key(), iter.Value()))
+		}
+		require.NoError(t, iter.Close())
+		return strings.Join(keys, " ")
+	}
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("m"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+
+	// The memtable doesn't overlap [m, n), so the snapshot is immediately
+	// file-only.
+	efos1 := d.NewEventuallyFileOnlySnapshot([]KeyRange{{Start: []byte("m"), End: []byte("n")}})
+	require.True(t, efos1.IsFileOnly())
+	// The memtable overlaps [a, b).
+	efos2 := d.NewEventuallyFileOnlySnapshot([]KeyRange{{Start: []byte("a"), End: []byte("b")}})
+	require.False(t, efos2.IsFileOnly())
+	require.Equal(t, 1, d.Metrics().Snapshots.Count)
+
+	require.NoError(t, d.Set([]byte("a"), []byte("3"), nil))
+	require.NoError(t, d.Set([]byte("m"), []byte("3"), nil))
+	require.Equal(t, "1", get(efos1, "m"))
+	require.Equal(t, "2", get(efos2, "a"))
+	require.Equal(t, "a:2 m:1", scan(efos2))
+
+	// Flushing the memtable transitions the snapshot.
+	require.NoError(t, efos2.WaitForFileOnlySnapshot(context.Background()))
+	require.True(t, efos2.IsFileOnly())
+	m := d.Metrics()
+	require.Equal(t, 0, m.Snapshots.Count)
+
+	// Compactions no longer preserve the versions read by the snapshots, but
+	// the snapshots continue to read them from the sstables they reference.
+	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false /* parallelize */))
+	require.Equal(t, m.Snapshots.PinnedKeys, d.Metrics().Snapshots.PinnedKeys)
+	require.Equal(t, "1", get(efos1, "m"))
+	require.Equal(t, "2", get(efos2, "a"))
+	require.Equal(t, "a:2 m:1", scan(efos2))
+	require.Equal(t, "a:3 m:3", scan(d))
+
+	var points []string
+	require.NoError(t, efos2.ScanInternal(context.Background(), []byte("a"), []byte("b"),
+		func(key *InternalKey, value LazyValue) error {
+			v, _, err := value.Value(nil)
+			require.NoError(t, err)
+			points = append(points, fmt.Sprintf("%s:%s", key.UserKey, v))
+			return nil
+		}, nil, nil, nil))
+	require.Equal(t, []string{"a:2"}, points)
+
+	require.NoError(t, efos1.Close())
+	require.NoError(t, efos2.Close())
+	require.Panics(t, func() { efos2.NewIter(nil) })
+}
@@ -536,6 +536,47 @@ func (i *blockIter) readEntry() {
 	i.nextOffset = int32(uintptr(ptr)-uintptr(i.ptr)) + int32(value)
 }
 
+// peekValues appends the values of up to n entries following the current
+// entry to dst, without repositioning the iterator. It must only be called when
+// the iterator is positioned by a forward positioning method.
+//
+// If upper is non-nil, peeking stops after the first entry whose key has a
+// user key at or above upper. This is intended for index blocks, in which
+// the entries following such a separator only index keys beyond upper. Index
+// blocks do not prefix compress their keys, so peeking also stops at an entry
+// whose key is prefix compressed.
+func (i *blockIter) peekValues(dst [][]byte, n int, upper []byte) [][]byte {
+	for offset := i.nextOffset; len(dst) < n && offset < i.restarts; {
+		b := i.data[offset:i.restarts]
+		shared, n1 := binary.Uvarint(b)
+		if n1 <= 0 || (upper != nil && shared != 0) {
+			break
+		}
+		unshared, n2 := binary.Uvarint(b[n1:])
+		if n2 <= 0 {
+			break
+		}
+		valueLen, n3 := binary.Uvarint(b[n1+n2:])
+		if n3 <= 0 {
+			break
+		}
+		start := n1 + n2 + n3 + int(unshared)
+		end := start + int(valueLen)
+		if end > len(b) {
+			break
+		}
+		dst = append(dst, b[start:end])
+		offset += int32(end)
+		if upper != nil {
+			key := base.DecodeInternalKey(b[n1+n2+n3 : start])
+			if i.cmp(key.UserKey, upper) >= 0 {
+				break
+			}
+		}
+	}
+	return dst
+}
+
 func (i *blockIter) readFirstKey() error {
 	ptr := i.ptr
 
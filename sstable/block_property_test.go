@@ -19,8 +19,11 @@ import (
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 )
 
@@ -240,6 +243,79 @@ func TestBlockIntervalCollector(t *testing.T) {
 	require.Equal(t, interval{5, 150}, decoded)
 }
 
+func TestTombstoneDensityCollector(t *testing.T) {
+	c := NewTombstoneDensityCollector(0.5)
+	require.Equal(t, TombstoneDensityCollectorName, c.Name())
+	addKeys := func(kinds ...InternalKeyKind) {
+		for i, kind := range kinds {
+			require.NoError(t, c.Add(base.MakeInternalKey([]byte{byte('a' + i)}, 1, kind), nil))
+		}
+	}
+	finishDataBlock := func() tombstoneDensity {
+		encoded, err := c.FinishDataBlock(nil)
+		require.NoError(t, err)
+		var decoded tombstoneDensity
+		require.NoError(t, decoded.decode(encoded))
+		return decoded
+	}
+
+	// A data block with half of its point keys deleted is dense. Range keys
+	// and range deletions do not count towards the block's keys.
+	addKeys(InternalKeyKindSet, InternalKeyKindDelete, base.InternalKeyKindRangeKeySet,
+		InternalKeyKindRangeDelete)
+	require.Equal(t, tombstoneDensity{denseBlocks: 1, blocks: 1}, finishDataBlock())
+	c.AddPrevDataBlockToIndexBlock()
+	// A data block with a minority of tombstones is not.
+	addKeys(InternalKeyKindSet, InternalKeyKindMerge, InternalKeyKindSingleDelete)
+	require.Equal(t, tombstoneDensity{blocks: 1}, finishDataBlock())
+	encodedIndexBlock, err := c.FinishIndexBlock(nil)
+	require.NoError(t, err)
+	var decoded tombstoneDensity
+	require.NoError(t, decoded.decode(encodedIndexBlock))
+	require.Equal(t, tombstoneDensity{denseBlocks: 1, blocks: 1}, decoded)
+	c.AddPrevDataBlockToIndexBlock()
+	addKeys(InternalKeyKindSingleDelete)
+	require.Equal(t, tombstoneDensity{denseBlocks: 1, blocks: 1}, finishDataBlock())
+	c.AddPrevDataBlockToIndexBlock()
+	encodedIndexBlock, err = c.FinishIndexBlock(nil)
+	require.NoError(t, err)
+	require.NoError(t, decoded.decode(encodedIndexBlock))
+	require.Equal(t, tombstoneDensity{denseBlocks: 1, blocks: 2}, decoded)
+	encodedTable, err := c.FinishTable(nil)
+	require.NoError(t, err)
+	require.NoError(t, decoded.decode(encodedTable))
+	require.Equal(t, tombstoneDensity{denseBlocks: 2, blocks: 3}, decoded)
+
+	// Write a table with the collector, with a single key per data block, and
+	// read the table property.
+	f, err := vfs.NewMem().Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize: 1,
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			func() BlockPropertyCollector { return NewTombstoneDensityCollector(0.5) },
+		},
+		TableFormat: TableFormatPebblev2,
+	})
+	for i, kind := range []InternalKeyKind{InternalKeyKindDelete, InternalKeyKindSet,
+		InternalKeyKindDelete, InternalKeyKindSingleDelete} {
+		require.NoError(t, w.Add(base.MakeInternalKey([]byte{byte('a' + i)}, 1, kind), nil))
+	}
+	require.NoError(t, w.Close())
+	meta, err := w.Metadata()
+	require.NoError(t, err)
+	denseBlocks, blocks, ok, err := ReadTombstoneDensity(&meta.Properties)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(3), denseBlocks)
+	require.Equal(t, uint64(4), blocks)
+
+	// A table written without the collector has no property.
+	_, _, ok, err = ReadTombstoneDensity(&Properties{})
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
 func TestBlockIntervalFilter(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -1316,7 +1392,7 @@ func runBlockPropsCmd(r *Reader, td *datadriven.TestData) string {
 		// block that bhp points to, along with its block properties.
 		if twoLevelIndex {
 			subiter := &blockIter{}
-			subIndex, err := r.readBlock(context.Background(), bhp.BlockHandle, nil, nil, nil)
+			subIndex, err := r.readBlock(context.Background(), bhp.BlockHandle, cache.IndexBlock, nil, nil, nil)
 			if err != nil {
 				return err.Error()
 			}
@@ -4,7 +4,12 @@
 
 package sstable
 
-import "sync/atomic"
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/bytealloc"
+)
 
 // FilterMetrics holds metrics for the filter policy.
 type FilterMetrics struct {
@@ -66,6 +71,10 @@ type filterWriter interface {
 type tableFilterReader struct {
 	policy  FilterPolicy
 	metrics *FilterMetricsTracker
+	// partitioned is set if the table's filter is partitioned, in which case
+	// the filter block is the filter index block locating the partitions. See
+	// partitionedFilterWriter.
+	partitioned bool
 }
 
 func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
@@ -75,6 +84,14 @@ func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
 	}
 }
 
+// recordHit records that the filter excluded a key without consulting the
+// filter policy.
+func (f *tableFilterReader) recordHit() {
+	if f.metrics != nil {
+		f.metrics.hits.Add(1)
+	}
+}
+
 func (f *tableFilterReader) mayContain(data, key []byte) bool {
 	mayContain := f.policy.MayContain(TableFilter, data, key)
 	if f.metrics != nil {
@@ -120,3 +137,81 @@ func (f *tableFilterWriter) metaName() string {
 func (f *tableFilterWriter) policyName() string {
 	return f.policy.Name()
 }
+
+// partitionedFilterWriter builds the filter of a TableFormatPebblev4 table.
+// If the table's index is partitioned, the filter is partitioned along with
+// it: the writer finishes a filter partition whenever it finishes an index
+// partition, and the partitions are written as separate blocks along with a
+// filter index block mapping the largest user key of each partition to the
+// partition's block handle. A point read then only needs to load the filter
+// index and a single partition, rather than the entire table's filter.
+//
+// If the index isn't partitioned, a single table filter is written as usual.
+type partitionedFilterWriter struct {
+	policy FilterPolicy
+	writer FilterWriter
+	// count is the count of the number of keys added to the current partition.
+	count int
+	// partitions holds the finished partitions, which are written when the
+	// table is finished.
+	partitions []filterPartition
+	sepAlloc   bytealloc.A
+}
+
+type filterPartition struct {
+	// sep is the largest user key added to the partition.
+	sep   []byte
+	block []byte
+}
+
+func newPartitionedFilterWriter(policy FilterPolicy) *partitionedFilterWriter {
+	return &partitionedFilterWriter{
+		policy: policy,
+		writer: policy.NewWriter(TableFilter),
+	}
+}
+
+func (f *partitionedFilterWriter) addKey(key []byte) {
+	f.count++
+	f.writer.AddKey(key)
+}
+
+// finishPartition finishes the current partition, whose largest user key is
+// sep.
+func (f *partitionedFilterWriter) finishPartition(sep []byte) {
+	if f.count == 0 {
+		return
+	}
+	p := filterPartition{block: f.writer.Finish(nil)}
+	f.sepAlloc, p.sep = f.sepAlloc.Copy(sep)
+	f.partitions = append(f.partitions, p)
+	f.writer = f.policy.NewWriter(TableFilter)
+	f.count = 0
+}
+
+// partitioned returns true if at least one partition has been finished.
+func (f *partitionedFilterWriter) partitioned() bool {
+	return len(f.partitions) > 0
+}
+
+// finish returns the table filter of an unpartitioned filter.
+func (f *partitionedFilterWriter) finish() ([]byte, error) {
+	if f.partitioned() {
+		return nil, errors.AssertionFailedf("pebble: finishing a partitioned filter as a table filter")
+	}
+	if f.count == 0 {
+		return nil, nil
+	}
+	return f.writer.Finish(nil), nil
+}
+
+func (f *partitionedFilterWriter) metaName() string {
+	if f.partitioned() {
+		return "partitionedfilter." + f.policy.Name()
+	}
+	return "fullfilter." + f.policy.Name()
+}
+
+func (f *partitionedFilterWriter) policyName() string {
+	return f.policy.Name()
+}
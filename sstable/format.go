@@ -27,8 +27,12 @@ const (
 	// supporting value blocks adds a 1 byte prefix to each value. After
 	// thorough experimentation and some production experience, this may change.
 	TableFormatPebblev3 // Value blocks.
+	// TableFormatPebblev4 subsumes TableFormatPebblev3, and partitions the
+	// filters of tables with two-level indexes, building a filter per index
+	// partition so that point reads only load the filter partition they need.
+	TableFormatPebblev4 // Partitioned filters.
 
-	TableFormatMax = TableFormatPebblev3
+	TableFormatMax = TableFormatPebblev4
 )
 
 // ParseTableFormat parses the given magic bytes and version into its
@@ -52,6 +56,8 @@ func ParseTableFormat(magic []byte, version uint32) (TableFormat, error) {
 			return TableFormatPebblev2, nil
 		case 3:
 			return TableFormatPebblev3, nil
+		case 4:
+			return TableFormatPebblev4, nil
 		default:
 			return TableFormatUnspecified, base.CorruptionErrorf(
 				"pebble/table: unsupported pebble format version %d", errors.Safe(version),
@@ -77,6 +83,8 @@ func (f TableFormat) AsTuple() (string, uint32) {
 		return pebbleDBMagic, 2
 	case TableFormatPebblev3:
 		return pebbleDBMagic, 3
+	case TableFormatPebblev4:
+		return pebbleDBMagic, 4
 	default:
 		panic("sstable: unknown table format version tuple")
 	}
@@ -95,6 +103,8 @@ func (f TableFormat) String() string {
 		return "(Pebble,v2)"
 	case TableFormatPebblev3:
 		return "(Pebble,v3)"
+	case TableFormatPebblev4:
+		return "(Pebble,v4)"
 	default:
 		panic("sstable: unknown table format version tuple")
 	}
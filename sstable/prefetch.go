@@ -0,0 +1,288 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/objiotracing"
+)
+
+// Prefetcher configures the asynchronous prefetching of blocks by sstable
+// iterators. A Prefetcher is shared by all the sstable iterators beneath a
+// single top-level iterator, which bounds the memory pinned by their prefetched
+// blocks.
+//
+// An sstable iterator that loads blocks sequentially, each block directly
+// following the last one it loaded, reads the next blocks of the same kind
+// (data blocks, or value blocks) in background goroutines. Prefetched blocks
+// are inserted into the block cache, and remain pinned until the iterator
+// loads them or moves elsewhere, e.g. due to a seek, at which point the reads
+// of the blocks that are still in flight are cancelled. Prefetching works for
+// any objstorage.Readable, both local files and shared objects.
+type Prefetcher struct {
+	blocks int
+	budget int64
+	inUse  atomic.Int64
+}
+
+// NewPrefetcher returns a Prefetcher that prefetches up to blocks blocks ahead
+// of each iterator, pinning at most budget bytes of prefetched blocks across
+// all iterators sharing it.
+func NewPrefetcher(blocks int, budget int64) *Prefetcher {
+	return &Prefetcher{blocks: blocks, budget: budget}
+}
+
+// reserve reserves n bytes of the budget, returning false if the reservation
+// would exceed the budget.
+func (p *Prefetcher) reserve(n int64) bool {
+	if p.inUse.Add(n) > p.budget {
+		p.inUse.Add(-n)
+		return false
+	}
+	return true
+}
+
+func (p *Prefetcher) release(n int64) {
+	p.inUse.Add(-n)
+}
+
+// prefetchedBlock is a block read, or being read, by a background goroutine.
+type prefetchedBlock struct {
+	p    *Prefetcher
+	bh   BlockHandle
+	done chan struct{}
+	// ctx is the context of the block's read, and cancel cancels it once the
+	// block is abandoned.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// reserved is the number of bytes of the Prefetcher's budget reserved for
+	// the block. It's initially the block's on-disk length, and is adjusted to
+	// the size of the cached block once it's read.
+	reserved int64
+
+	mu struct {
+		sync.Mutex
+		// read is set once the goroutine reading the block completes, at which
+		// point handle and err are populated.
+		read   bool
+		handle cache.Handle
+		err    error
+		// abandoned is set if the iterator no longer needs the block, making
+		// the goroutine reading the block responsible for releasing it.
+		abandoned bool
+	}
+}
+
+// abandon releases the block, or cancels its read and arranges for the
+// goroutine reading the block to release it.
+func (b *prefetchedBlock) abandon() {
+	b.cancel()
+	b.mu.Lock()
+	b.mu.abandoned = true
+	read := b.mu.read
+	b.mu.Unlock()
+	if read {
+		b.release()
+	}
+}
+
+func (b *prefetchedBlock) release() {
+	b.mu.handle.Release()
+	b.mu.handle = cache.Handle{}
+	b.p.release(b.reserved)
+}
+
+// blockHandlePeeker provides the handles of the blocks that an iterator will
+// load next, if it continues to iterate forward.
+type blockHandlePeeker interface {
+	// peekBlockHandles appends the handles of up to n blocks following the
+	// most recently loaded block to dst.
+	peekBlockHandles(dst []BlockHandle, n int) []BlockHandle
+}
+
+// blockPrefetchQueue prefetches the blocks of a single kind for an sstable
+// iterator. See Prefetcher.
+type blockPrefetchQueue struct {
+	p         *Prefetcher
+	r         *Reader
+	kind      cache.BlockKind
+	pri       cache.Priority
+	blockType objiotracing.BlockType
+	ctx       context.Context
+	cancel    context.CancelFunc
+	// pending holds the blocks being prefetched, ordered by offset.
+	pending []*prefetchedBlock
+	// last is the handle of the block most recently loaded through the queue.
+	last    BlockHandle
+	handles []BlockHandle
+	wg      sync.WaitGroup
+}
+
+func (q *blockPrefetchQueue) init(
+	ctx context.Context,
+	p *Prefetcher,
+	r *Reader,
+	kind cache.BlockKind,
+	pri cache.Priority,
+	blockType objiotracing.BlockType,
+) {
+	q.p = p
+	q.r = r
+	q.kind = kind
+	q.pri = pri
+	q.blockType = blockType
+	q.ctx, q.cancel = context.WithCancel(objiotracing.WithBlockType(ctx, blockType))
+}
+
+// readBlock returns the block with the provided handle, using the prefetched
+// block if there is one. If the block directly follows the previous block
+// loaded through the queue, readBlock begins prefetching the blocks that
+// peeker reports will follow it.
+func (q *blockPrefetchQueue) readBlock(
+	ctx context.Context,
+	bh BlockHandle,
+	readHandle objstorage.ReadHandle,
+	stats *base.InternalIteratorStats,
+	peeker blockHandlePeeker,
+) (cache.Handle, error) {
+	sequential := q.last != (BlockHandle{}) &&
+		bh.Offset == q.last.Offset+q.last.Length+blockTrailerLen
+	q.last = bh
+
+	// Abandon the prefetched blocks preceding bh, which the iterator skipped.
+	for len(q.pending) > 0 && q.pending[0].bh.Offset < bh.Offset {
+		q.pending[0].abandon()
+		q.pending = q.pending[1:]
+	}
+	if len(q.pending) > 0 && q.pending[0].bh == bh {
+		b := q.pending[0]
+		q.pending = q.pending[1:]
+		waitStartTime := time.Now()
+		<-b.done
+		waitDuration := time.Since(waitStartTime)
+		b.mu.Lock()
+		h, err := b.mu.handle, b.mu.err
+		b.mu.handle = cache.Handle{}
+		b.mu.Unlock()
+		// The block is no longer pinned on behalf of the queue.
+		b.p.release(b.reserved)
+		if err == nil {
+			if stats != nil {
+				stats.BlockBytes += bh.Length
+				stats.BlockCacheMisses++
+				// Only the time spent waiting for the block to be read
+				// delays the iterator.
+				stats.BlockReadDuration += waitDuration
+				stats.Prefetch.Hits++
+			}
+			q.prefetch(bh, peeker)
+			return h, nil
+		}
+		// Fall back to reading the block synchronously.
+	} else if !sequential {
+		// The iterator moved elsewhere, e.g. due to a seek.
+		q.abandonAll()
+	}
+	if sequential && stats != nil {
+		stats.Prefetch.Misses++
+	}
+	h, err := q.r.readBlockWithPriority(ctx, bh, q.kind, q.pri, nil /* transform */, readHandle, stats)
+	if err == nil && sequential {
+		q.prefetch(bh, peeker)
+	}
+	return h, err
+}
+
+// prefetch begins prefetching the blocks following bh, until the queue holds
+// the Prefetcher's configured number of blocks or the budget is exhausted.
+func (q *blockPrefetchQueue) prefetch(bh BlockHandle, peeker blockHandlePeeker) {
+	n := q.p.blocks - len(q.pending)
+	if n <= 0 {
+		return
+	}
+	q.handles = peeker.peekBlockHandles(q.handles[:0], q.p.blocks)
+	after := bh.Offset
+	if len(q.pending) > 0 {
+		after = q.pending[len(q.pending)-1].bh.Offset
+	}
+	for _, h := range q.handles {
+		if n == 0 {
+			break
+		}
+		if h.Offset <= after {
+			continue
+		}
+		if !q.p.reserve(int64(h.Length)) {
+			break
+		}
+		b := &prefetchedBlock{
+			p:        q.p,
+			bh:       h,
+			done:     make(chan struct{}),
+			reserved: int64(h.Length),
+		}
+		b.ctx, b.cancel = context.WithCancel(q.ctx)
+		q.pending = append(q.pending, b)
+		n--
+		q.wg.Add(1)
+		go q.read(b)
+	}
+}
+
+// read reads the provided block into the block cache. It runs in its own
+// goroutine. The read is skipped if the block was abandoned before the
+// goroutine began reading it.
+func (q *blockPrefetchQueue) read(b *prefetchedBlock) {
+	defer q.wg.Done()
+	defer b.cancel()
+	var h cache.Handle
+	err := b.ctx.Err()
+	if err == nil {
+		h, err = q.r.readBlockWithPriority(
+			b.ctx, b.bh, q.kind, q.pri, nil /* transform */, nil /* readHandle */, nil /* stats */)
+	}
+	if err == nil {
+		// Account for the block's decompressed size.
+		size := int64(len(h.Get()))
+		q.p.inUse.Add(size - b.reserved)
+		b.reserved = size
+	}
+	b.mu.Lock()
+	b.mu.read = true
+	b.mu.handle, b.mu.err = h, err
+	abandoned := b.mu.abandoned
+	b.mu.Unlock()
+	close(b.done)
+	if abandoned {
+		b.release()
+	}
+}
+
+// abandonAll abandons all the blocks being prefetched, cancelling the reads
+// that are in flight.
+func (q *blockPrefetchQueue) abandonAll() {
+	for _, b := range q.pending {
+		b.abandon()
+	}
+	q.pending = q.pending[:0]
+}
+
+// close cancels any blocks being prefetched and waits for their goroutines to
+// exit, after which the Reader may be closed.
+func (q *blockPrefetchQueue) close() {
+	if q.p == nil {
+		return
+	}
+	q.cancel()
+	q.abandonAll()
+	q.wg.Wait()
+}
@@ -0,0 +1,307 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/internal/testkeys"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// scanTable returns the keys and values of the table read by iter, starting
+// from the key at which iter is positioned.
+func scanTable(
+	t *testing.T, key *InternalKey, value base.LazyValue, iter Iterator, n int,
+) (keys, values []string) {
+	for ; key != nil && len(keys) < n; key, value = iter.Next() {
+		v, _, err := value.Value(nil)
+		require.NoError(t, err)
+		keys = append(keys, string(key.UserKey))
+		values = append(values, string(v))
+	}
+	require.NoError(t, iter.Error())
+	return keys, values
+}
+
+func TestPrefetch(t *testing.T) {
+	for _, indexBlockSize := range []int{100, math.MaxInt32} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			r := buildTestTable(t, 2000, 100, indexBlockSize, NoCompression)
+			defer r.Close()
+
+			scan := func(p *Prefetcher, seekKey []byte) ([]string, base.InternalIteratorStats) {
+				var stats base.InternalIteratorStats
+				iter, err := r.NewIterWithOptions(context.Background(),
+					nil /* lower */, nil /* upper */, nil /* filterer */, false, /* useFilterBlock */
+					&stats, TrivialReaderProvider{Reader: r}, IterOptions{Prefetcher: p})
+				require.NoError(t, err)
+				defer func() { require.NoError(t, iter.Close()) }()
+				key, value := iter.First()
+				keys, _ := scanTable(t, key, value, iter, 500)
+				if seekKey != nil {
+					// Seeking discards the blocks prefetched ahead of the
+					// previous position.
+					key, value = iter.SeekGE(seekKey, base.SeekGEFlagsNone)
+					seekKeys, _ := scanTable(t, key, value, iter, math.MaxInt)
+					keys = append(keys, seekKeys...)
+				}
+				return keys, stats
+			}
+
+			seekKey := make([]byte, 8)
+			seekKey[7] = 0x80
+			expected, expectedStats := scan(nil, seekKey)
+			require.Zero(t, expectedStats.Prefetch)
+
+			p := NewPrefetcher(4, 1<<20)
+			keys, stats := scan(p, seekKey)
+			require.Equal(t, expected, keys)
+			require.Less(t, uint64(0), stats.Prefetch.Hits)
+			require.Equal(t, expectedStats.BlockBytes, stats.BlockBytes)
+			// All the prefetched blocks are released by the time the iterator
+			// is closed.
+			require.Zero(t, p.inUse.Load())
+
+			// A Prefetcher without the budget for a single block never
+			// prefetches.
+			p = NewPrefetcher(4, 1)
+			keys, stats = scan(p, nil)
+			require.Equal(t, expected[:500], keys)
+			require.Zero(t, stats.Prefetch.Hits)
+			require.Less(t, uint64(0), stats.Prefetch.Misses)
+			require.Zero(t, p.inUse.Load())
+		})
+	}
+}
+
+func TestPrefetchValueBlocks(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:   100,
+		Comparer:    testkeys.Comparer,
+		Compression: NoCompression,
+		TableFormat: TableFormatPebblev3,
+	})
+	ks := testkeys.Alpha(2)
+	keyBuf := make([]byte, ks.MaxLen()+testkeys.MaxSuffixLen)
+	for i := 0; i < 200; i++ {
+		// Older versions of each key are written to value blocks.
+		for ts := 3; ts >= 1; ts-- {
+			n := testkeys.WriteKeyAt(keyBuf, ks, i, ts)
+			require.NoError(t, w.Set(keyBuf[:n], bytes.Repeat(keyBuf[:n], 10)))
+		}
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	readable, err := NewSimpleReadable(f)
+	require.NoError(t, err)
+	c := cache.New(128 << 20)
+	defer c.Unref()
+	r, err := NewReader(readable, ReaderOptions{Cache: c, Comparer: testkeys.Comparer})
+	require.NoError(t, err)
+	defer r.Close()
+	require.Less(t, uint64(1), r.Properties.NumValueBlocks)
+
+	scan := func(p *Prefetcher) (keys, values []string, stats base.InternalIteratorStats) {
+		iter, err := r.NewIterWithOptions(context.Background(),
+			nil /* lower */, nil /* upper */, nil /* filterer */, false, /* useFilterBlock */
+			&stats, TrivialReaderProvider{Reader: r}, IterOptions{Prefetcher: p})
+		require.NoError(t, err)
+		key, value := iter.First()
+		keys, values = scanTable(t, key, value, iter, math.MaxInt)
+		require.NoError(t, iter.Close())
+		return keys, values, stats
+	}
+	expectedKeys, expectedValues, _ := scan(nil)
+	p := NewPrefetcher(2, 1<<20)
+	keys, values, stats := scan(p)
+	require.Equal(t, expectedKeys, keys)
+	require.Equal(t, expectedValues, values)
+	require.Less(t, uint64(0), stats.Prefetch.Hits)
+	require.Zero(t, p.inUse.Load())
+}
+
+// blockingReadable is a Readable whose reads at or beyond an offset block
+// until their context is cancelled, once blocking is set.
+type blockingReadable struct {
+	objstorage.Readable
+	offset    int64
+	blocking  atomic.Bool
+	started   chan struct{}
+	cancelled atomic.Int32
+}
+
+func (r *blockingReadable) ReadAt(ctx context.Context, p []byte, off int64) error {
+	if !r.blocking.Load() || off < r.offset {
+		return r.Readable.ReadAt(ctx, p, off)
+	}
+	select {
+	case r.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	r.cancelled.Add(1)
+	return ctx.Err()
+}
+
+func TestPrefetchCancelledOnSeek(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:   100,
+		Compression: NoCompression,
+	})
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, w.Set([]byte(fmt.Sprintf("%05d", i)), bytes.Repeat([]byte("v"), 20)))
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	simple, err := NewSimpleReadable(f)
+	require.NoError(t, err)
+	readable := &blockingReadable{Readable: simple, started: make(chan struct{}, 1)}
+	c := cache.New(128 << 20)
+	defer c.Unref()
+	r, err := NewReader(readable, ReaderOptions{Cache: c})
+	require.NoError(t, err)
+	defer r.Close()
+	l, err := r.Layout()
+	require.NoError(t, err)
+	require.Less(t, 4, len(l.Data))
+	// The iterator reads the data blocks through a read handle, so only the
+	// prefetches of the blocks following the second one block.
+	readable.offset = int64(l.Data[2].Offset)
+
+	p := NewPrefetcher(2, 1<<20)
+	iter, err := r.NewIterWithOptions(context.Background(),
+		nil /* lower */, nil /* upper */, nil /* filterer */, false, /* useFilterBlock */
+		nil /* stats */, TrivialReaderProvider{Reader: r}, IterOptions{Prefetcher: p})
+	require.NoError(t, err)
+	key, _ := iter.First()
+	readable.blocking.Store(true)
+	// Iterate until loading the second data block starts prefetching the
+	// blocks following it.
+	pending := func() int {
+		switch i := iter.(type) {
+		case *singleLevelIterator:
+			return len(i.dataPrefetch.pending)
+		case *twoLevelIterator:
+			return len(i.dataPrefetch.pending)
+		}
+		return 0
+	}
+	for pending() == 0 {
+		require.NotNil(t, key)
+		key, _ = iter.Next()
+	}
+	<-readable.started
+	require.Zero(t, readable.cancelled.Load())
+
+	// Seeking cancels the in-flight reads.
+	seekKey := append([]byte(nil), key.UserKey...)
+	key, _ = iter.SeekGE(seekKey, base.SeekGEFlagsNone)
+	require.Equal(t, seekKey, key.UserKey)
+	require.Eventually(t, func() bool {
+		return readable.cancelled.Load() > 0
+	}, 10*time.Second, time.Millisecond)
+	require.NoError(t, iter.Close())
+	require.Zero(t, p.inUse.Load())
+}
+
+func TestPrefetchWithinUpperBound(t *testing.T) {
+	for _, indexBlockSize := range []int{100, math.MaxInt32} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+				BlockSize:      100,
+				IndexBlockSize: indexBlockSize,
+				Compression:    NoCompression,
+			})
+			for i := 0; i < 1000; i++ {
+				require.NoError(t, w.Set([]byte(fmt.Sprintf("%05d", i)), bytes.Repeat([]byte("v"), 20)))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			readable, err := NewSimpleReadable(f)
+			require.NoError(t, err)
+			c := cache.New(128 << 20)
+			defer c.Unref()
+			r, err := NewReader(readable, ReaderOptions{Cache: c})
+			require.NoError(t, err)
+			defer r.Close()
+			l, err := r.Layout()
+			require.NoError(t, err)
+			require.Less(t, 20, len(l.Data))
+
+			singleLevel := func(iter Iterator) *singleLevelIterator {
+				switch i := iter.(type) {
+				case *singleLevelIterator:
+					return i
+				case *twoLevelIterator:
+					return &i.singleLevelIterator
+				}
+				t.Fatalf("unexpected iterator type %T", iter)
+				return nil
+			}
+
+			// Find the data block containing the upper bound. The blocks
+			// following it only contain keys beyond the upper bound, so they
+			// must never be prefetched.
+			upper := []byte("00100")
+			iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+			require.NoError(t, err)
+			key, _ := iter.SeekGE(upper, base.SeekGEFlagsNone)
+			require.Equal(t, upper, key.UserKey)
+			lastOffset := singleLevel(iter).dataBH.Offset
+			require.NoError(t, iter.Close())
+			require.Less(t, lastOffset, l.Data[len(l.Data)-1].Offset)
+
+			p := NewPrefetcher(8, 1<<20)
+			iter, err = r.NewIterWithOptions(context.Background(),
+				nil /* lower */, upper, nil /* filterer */, false, /* useFilterBlock */
+				nil /* stats */, TrivialReaderProvider{Reader: r}, IterOptions{Prefetcher: p})
+			require.NoError(t, err)
+			pending := func() []*prefetchedBlock {
+				return singleLevel(iter).dataPrefetch.pending
+			}
+			n := 0
+			prefetched := false
+			for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+				n++
+				for _, b := range pending() {
+					prefetched = true
+					require.LessOrEqual(t, b.bh.Offset, lastOffset)
+				}
+			}
+			require.NoError(t, iter.Error())
+			require.Equal(t, 100, n)
+			require.True(t, prefetched)
+			require.NoError(t, iter.Close())
+			require.Zero(t, p.inUse.Load())
+		})
+	}
+}
@@ -110,6 +110,9 @@ type Properties struct {
 	NumDeletions uint64 `prop:"rocksdb.deleted.keys"`
 	// The number of entries in this table.
 	NumEntries uint64 `prop:"rocksdb.num.entries"`
+	// The number of filter partitions, if the filter is partitioned. Only
+	// serialized if > 0.
+	NumFilterPartitions uint64 `prop:"pebble.num.filter-partitions"`
 	// The number of merge operands in the table.
 	NumMergeOperands uint64 `prop:"rocksdb.merge.operands"`
 	// The number of range deletions in this table.
@@ -120,6 +123,9 @@ type Properties struct {
 	NumRangeKeySets uint64 `prop:"pebble.num.range-key-sets"`
 	// The number of RANGEKEYUNSETs in this table.
 	NumRangeKeyUnsets uint64 `prop:"pebble.num.range-key-unsets"`
+	// The number of DELSIZED point tombstones in this table. These are also
+	// included in NumDeletions. Only serialized if > 0.
+	NumSizedDeletions uint64 `prop:"pebble.num.deletions.sized"`
 	// The number of value blocks in this table. Only serialized if > 0.
 	NumValueBlocks uint64 `prop:"pebble.num.value-blocks"`
 	// The number of values stored in value blocks. Only serialized if > 0.
@@ -136,6 +142,12 @@ type Properties struct {
 	PropertyCollectorNames string `prop:"rocksdb.property.collectors"`
 	// Total raw key size.
 	RawKeySize uint64 `prop:"rocksdb.raw.key.size"`
+	// Total raw key size of point tombstones (DEL, SINGLEDEL and DELSIZED).
+	// Only serialized if NumSizedDeletions > 0.
+	RawPointTombstoneKeySize uint64 `prop:"pebble.raw.point-tombstone.key.size"`
+	// Sum of the sizes of the entries deleted by DELSIZED point tombstones, as
+	// declared by their writers. Only serialized if NumSizedDeletions > 0.
+	RawPointTombstoneValueSize uint64 `prop:"pebble.raw.point-tombstone.value.size"`
 	// Total raw rangekey key size.
 	RawRangeKeyKeySize uint64 `prop:"pebble.raw.range-key.key.size"`
 	// Total raw rangekey value size.
@@ -354,6 +366,14 @@ func (p *Properties) save(w *rawBlockWriter) {
 		p.saveUvarint(m, unsafe.Offsetof(p.RawRangeKeyKeySize), p.RawRangeKeyKeySize)
 		p.saveUvarint(m, unsafe.Offsetof(p.RawRangeKeyValueSize), p.RawRangeKeyValueSize)
 	}
+	if p.NumSizedDeletions > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.NumSizedDeletions), p.NumSizedDeletions)
+		p.saveUvarint(m, unsafe.Offsetof(p.RawPointTombstoneKeySize), p.RawPointTombstoneKeySize)
+		p.saveUvarint(m, unsafe.Offsetof(p.RawPointTombstoneValueSize), p.RawPointTombstoneValueSize)
+	}
+	if p.NumFilterPartitions > 0 {
+		p.saveUvarint(m, unsafe.Offsetof(p.NumFilterPartitions), p.NumFilterPartitions)
+	}
 	if p.NumValueBlocks > 0 {
 		p.saveUvarint(m, unsafe.Offsetof(p.NumValueBlocks), p.NumValueBlocks)
 	}
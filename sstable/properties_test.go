@@ -61,43 +61,47 @@ func TestPropertiesLoad(t *testing.T) {
 
 func TestPropertiesSave(t *testing.T) {
 	expected := &Properties{
-		ColumnFamilyID:           1,
-		ColumnFamilyName:         "column family name",
-		ComparerName:             "comparator name",
-		CompressionName:          "compression name",
-		CompressionOptions:       "compression option",
-		CreationTime:             2,
-		DataSize:                 3,
-		ExternalFormatVersion:    4,
-		FilterPolicyName:         "filter policy name",
-		FilterSize:               5,
-		FixedKeyLen:              6,
-		FormatVersion:            7,
-		GlobalSeqNum:             8,
-		IndexKeyIsUserKey:        9,
-		IndexPartitions:          10,
-		IndexSize:                11,
-		IndexType:                12,
-		IndexValueIsDeltaEncoded: 13,
-		MergerName:               "merge operator name",
-		NumDataBlocks:            14,
-		NumDeletions:             15,
-		NumEntries:               16,
-		NumMergeOperands:         17,
-		NumRangeDeletions:        18,
-		NumRangeKeyDels:          19,
-		NumRangeKeySets:          20,
-		NumRangeKeyUnsets:        21,
-		NumValueBlocks:           22,
-		NumValuesInValueBlocks:   23,
-		OldestKeyTime:            24,
-		PrefixExtractorName:      "prefix extractor name",
-		PrefixFiltering:          true,
-		PropertyCollectorNames:   "prefix collector names",
-		RawKeySize:               25,
-		RawValueSize:             26,
-		TopLevelIndexSize:        27,
-		WholeKeyFiltering:        true,
+		ColumnFamilyID:             1,
+		ColumnFamilyName:           "column family name",
+		ComparerName:               "comparator name",
+		CompressionName:            "compression name",
+		CompressionOptions:         "compression option",
+		CreationTime:               2,
+		DataSize:                   3,
+		ExternalFormatVersion:      4,
+		FilterPolicyName:           "filter policy name",
+		FilterSize:                 5,
+		FixedKeyLen:                6,
+		FormatVersion:              7,
+		GlobalSeqNum:               8,
+		IndexKeyIsUserKey:          9,
+		IndexPartitions:            10,
+		IndexSize:                  11,
+		IndexType:                  12,
+		IndexValueIsDeltaEncoded:   13,
+		MergerName:                 "merge operator name",
+		NumDataBlocks:              14,
+		NumDeletions:               15,
+		NumEntries:                 16,
+		NumFilterPartitions:        32,
+		NumMergeOperands:           17,
+		NumRangeDeletions:          18,
+		NumRangeKeyDels:            19,
+		NumRangeKeySets:            20,
+		NumRangeKeyUnsets:          21,
+		NumSizedDeletions:          29,
+		NumValueBlocks:             22,
+		NumValuesInValueBlocks:     23,
+		OldestKeyTime:              24,
+		PrefixExtractorName:        "prefix extractor name",
+		PrefixFiltering:            true,
+		PropertyCollectorNames:     "prefix collector names",
+		RawKeySize:                 25,
+		RawPointTombstoneKeySize:   30,
+		RawPointTombstoneValueSize: 31,
+		RawValueSize:               26,
+		TopLevelIndexSize:          27,
+		WholeKeyFiltering:          true,
 		UserProperties: map[string]string{
 			"user-prop-a": "1",
 			"user-prop-b": "2",
@@ -127,6 +131,10 @@ func TestPropertiesSave(t *testing.T) {
 		if props.IndexPartitions == 0 {
 			props.TopLevelIndexSize = 0
 		}
+		if props.NumSizedDeletions == 0 {
+			props.RawPointTombstoneKeySize = 0
+			props.RawPointTombstoneValueSize = 0
+		}
 		check1(&props)
 	}
 }
@@ -214,6 +214,14 @@ type singleLevelIterator struct {
 	// part of the sstable than data blocks.
 	vbRH         objstorage.ReadHandle
 	vbRHPrealloc objstorageprovider.PreallocatedReadHandle
+	// dataCachePri is the priority with which the data and value blocks read
+	// by the iterator are cached.
+	dataCachePri cache.Priority
+	// dataPrefetch and vbPrefetch prefetch data and value blocks when the
+	// iterator is configured with a Prefetcher.
+	dataPrefetch blockPrefetchQueue
+	vbPrefetch   blockPrefetchQueue
+	peekBuf      [][]byte
 	err          error
 	closeHook    func(i Iterator) error
 	stats        *base.InternalIteratorStats
@@ -418,7 +426,7 @@ func (i *singleLevelIterator) init(
 		return err
 	}
 	i.dataRH = objstorageprovider.UsePreallocatedReadHandle(ctx, r.readable, &i.dataRHPrealloc)
-	if r.tableFormat == TableFormatPebblev3 {
+	if r.tableFormat >= TableFormatPebblev3 {
 		if r.Properties.NumValueBlocks > 0 {
 			// NB: we cannot avoid this ~248 byte allocation, since valueBlockReader
 			// can outlive the singleLevelIterator due to be being embedded in a
@@ -453,6 +461,53 @@ func (i *singleLevelIterator) setupForCompaction() {
 	}
 }
 
+// initPrefetch configures the iterator to prefetch data and value blocks when
+// loading blocks sequentially. It should be called after init is called.
+func (i *singleLevelIterator) initPrefetch(p *Prefetcher) {
+	i.dataPrefetch.init(i.ctx, p, i.reader, cache.DataBlock, i.dataCachePri, objiotracing.DataBlock)
+	if i.vbReader != nil {
+		i.vbPrefetch.init(i.ctx, p, i.reader, cache.ValueBlock, i.dataCachePri, objiotracing.ValueBlock)
+	}
+}
+
+// cancelPrefetches abandons the blocks being prefetched, cancelling the reads
+// that are in flight. It's called when the iterator is repositioned, since
+// the blocks following its previous position are unlikely to be needed.
+func (i *singleLevelIterator) cancelPrefetches() {
+	if i.dataPrefetch.p != nil {
+		i.dataPrefetch.abandonAll()
+	}
+	if i.vbPrefetch.p != nil {
+		i.vbPrefetch.abandonAll()
+	}
+}
+
+// peekBlockHandles implements the blockHandlePeeker interface, returning the
+// handles of the data blocks following the current position of the index
+// iterator. Blocks excluded by the iterator's block property filters, and
+// blocks containing only keys at or above the iterator's upper bound, are
+// omitted.
+func (i *singleLevelIterator) peekBlockHandles(dst []BlockHandle, n int) []BlockHandle {
+	if i.upper != nil && i.cmp(i.index.Key().UserKey, i.upper) >= 0 {
+		// The current block is the last containing keys below the upper bound.
+		return dst
+	}
+	i.peekBuf = i.index.peekValues(i.peekBuf[:0], n, i.upper)
+	for _, v := range i.peekBuf {
+		bhp, err := decodeBlockHandleWithProperties(v)
+		if err != nil {
+			break
+		}
+		if i.bpfs != nil {
+			if intersects, err := i.bpfs.intersects(bhp.Props); err != nil || intersects == blockExcluded {
+				continue
+			}
+		}
+		dst = append(dst, bhp.BlockHandle)
+	}
+	return dst
+}
+
 func (i *singleLevelIterator) resetForReuse() singleLevelIterator {
 	return singleLevelIterator{
 		index: i.index.resetForReuse(),
@@ -539,7 +594,13 @@ func (i *singleLevelIterator) loadBlock(dir int8) loadBlockResult {
 		// blockIntersects
 	}
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.DataBlock)
-	block, err := i.reader.readBlock(ctx, i.dataBH, nil /* transform */, i.dataRH, i.stats)
+	var block cache.Handle
+	if i.dataPrefetch.p != nil {
+		block, err = i.dataPrefetch.readBlock(ctx, i.dataBH, i.dataRH, i.stats, i)
+	} else {
+		block, err = i.reader.readBlockWithPriority(
+			ctx, i.dataBH, cache.DataBlock, i.dataCachePri, nil /* transform */, i.dataRH, i.stats)
+	}
 	if err != nil {
 		i.err = err
 		return loadBlockFailed
@@ -560,7 +621,10 @@ func (i *singleLevelIterator) readBlockForVBR(
 	ctx context.Context, h BlockHandle, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.ValueBlock)
-	return i.reader.readBlock(ctx, h, nil, i.vbRH, stats)
+	if i.vbPrefetch.p != nil && h != i.vbReader.vbih.h {
+		return i.vbPrefetch.readBlock(ctx, h, i.vbRH, stats, i.vbReader)
+	}
+	return i.reader.readBlockWithPriority(ctx, h, cache.ValueBlock, i.dataCachePri, nil, i.vbRH, stats)
 }
 
 // resolveMaybeExcluded is invoked when the block-property filterer has found
@@ -723,6 +787,9 @@ func (i *singleLevelIterator) recordOffset() uint64 {
 func (i *singleLevelIterator) SeekGE(
 	key []byte, flags base.SeekGEFlags,
 ) (*InternalKey, base.LazyValue) {
+	if !flags.TrySeekUsingNext() {
+		i.cancelPrefetches()
+	}
 	if flags.TrySeekUsingNext() {
 		// The i.exhaustedBounds comparison indicates that the upper bound was
 		// reached. The i.data.isDataInvalidated() indicates that the sstable was
@@ -872,6 +939,9 @@ func (i *singleLevelIterator) seekGEHelper(
 func (i *singleLevelIterator) SeekPrefixGE(
 	prefix, key []byte, flags base.SeekGEFlags,
 ) (*base.InternalKey, base.LazyValue) {
+	if !flags.TrySeekUsingNext() {
+		i.cancelPrefetches()
+	}
 	k, v := i.seekPrefixGE(prefix, key, flags, i.useFilter)
 	return k, v
 }
@@ -892,14 +962,12 @@ func (i *singleLevelIterator) seekPrefixGE(
 		}
 		i.lastBloomFilterMatched = false
 		// Check prefix bloom filter.
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats)
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(i.ctx, i.stats, prefix, key)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -946,6 +1014,7 @@ func (i *singleLevelIterator) seekPrefixGE(
 func (i *singleLevelIterator) SeekLT(
 	key []byte, flags base.SeekLTFlags,
 ) (*InternalKey, base.LazyValue) {
+	i.cancelPrefetches()
 	i.exhaustedBounds = 0
 	i.err = nil // clear cached iteration error
 	boundsCmp := i.boundsCmp
@@ -1052,6 +1121,7 @@ func (i *singleLevelIterator) First() (*InternalKey, base.LazyValue) {
 	if i.lower != nil {
 		panic("singleLevelIterator.First() used despite lower bound")
 	}
+	i.cancelPrefetches()
 	i.positionedUsingLatestBounds = true
 	i.maybeFilteredKeysSingleLevel = false
 	return i.firstInternal()
@@ -1110,6 +1180,7 @@ func (i *singleLevelIterator) Last() (*InternalKey, base.LazyValue) {
 	if i.upper != nil {
 		panic("singleLevelIterator.Last() used despite upper bound")
 	}
+	i.cancelPrefetches()
 	i.positionedUsingLatestBounds = true
 	i.maybeFilteredKeysSingleLevel = false
 	return i.lastInternal()
@@ -1387,6 +1458,10 @@ func firstError(err0, err1 error) error {
 // Close implements internalIterator.Close, as documented in the pebble
 // package.
 func (i *singleLevelIterator) Close() error {
+	// Wait for any prefetching goroutines to exit before the close hook
+	// releases the Reader.
+	i.dataPrefetch.close()
+	i.vbPrefetch.close()
 	var err error
 	if i.closeHook != nil {
 		err = firstError(err, i.closeHook(i))
@@ -1597,7 +1672,7 @@ func (i *twoLevelIterator) loadIndex(dir int8) loadBlockResult {
 		// blockIntersects
 	}
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.MetadataBlock)
-	indexBlock, err := i.reader.readBlock(ctx, bhp.BlockHandle, nil /* transform */, nil /* readHandle */, i.stats)
+	indexBlock, err := i.reader.readBlock(ctx, bhp.BlockHandle, cache.IndexBlock, nil /* transform */, nil /* readHandle */, i.stats)
 	if err != nil {
 		i.err = err
 		return loadBlockFailed
@@ -1704,7 +1779,7 @@ func (i *twoLevelIterator) init(
 		return err
 	}
 	i.dataRH = r.readable.NewReadHandle(ctx)
-	if r.tableFormat == TableFormatPebblev3 {
+	if r.tableFormat >= TableFormatPebblev3 {
 		if r.Properties.NumValueBlocks > 0 {
 			i.vbReader = &valueBlockReader{
 				ctx:    ctx,
@@ -1746,6 +1821,9 @@ func (i *twoLevelIterator) MaybeFilteredKeys() bool {
 func (i *twoLevelIterator) SeekGE(
 	key []byte, flags base.SeekGEFlags,
 ) (*InternalKey, base.LazyValue) {
+	if !flags.TrySeekUsingNext() {
+		i.cancelPrefetches()
+	}
 	err := i.err
 	i.err = nil // clear cached iteration error
 
@@ -1884,6 +1962,9 @@ func (i *twoLevelIterator) SeekGE(
 func (i *twoLevelIterator) SeekPrefixGE(
 	prefix, key []byte, flags base.SeekGEFlags,
 ) (*base.InternalKey, base.LazyValue) {
+	if !flags.TrySeekUsingNext() {
+		i.cancelPrefetches()
+	}
 	// NOTE: prefix is only used for bloom filter checking and not later work in
 	// this method. Hence, we can use the existing iterator position if the last
 	// SeekPrefixGE did not fail bloom filter matching.
@@ -1910,14 +1991,12 @@ func (i *twoLevelIterator) SeekPrefixGE(
 			flags = flags.DisableTrySeekUsingNext()
 		}
 		i.lastBloomFilterMatched = false
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats)
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(i.ctx, i.stats, prefix, key)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, base.LazyValue{}
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -2049,6 +2128,7 @@ func (i *twoLevelIterator) SeekPrefixGE(
 func (i *twoLevelIterator) SeekLT(
 	key []byte, flags base.SeekLTFlags,
 ) (*InternalKey, base.LazyValue) {
+	i.cancelPrefetches()
 	i.exhaustedBounds = 0
 	i.err = nil // clear cached iteration error
 	// Seek optimization only applies until iterator is first positioned after SetBounds.
@@ -2121,6 +2201,7 @@ func (i *twoLevelIterator) First() (*InternalKey, base.LazyValue) {
 	if i.lower != nil {
 		panic("twoLevelIterator.First() used despite lower bound")
 	}
+	i.cancelPrefetches()
 	i.exhaustedBounds = 0
 	i.maybeFilteredKeysTwoLevel = false
 	i.err = nil // clear cached iteration error
@@ -2164,6 +2245,7 @@ func (i *twoLevelIterator) Last() (*InternalKey, base.LazyValue) {
 	if i.upper != nil {
 		panic("twoLevelIterator.Last() used despite upper bound")
 	}
+	i.cancelPrefetches()
 	i.exhaustedBounds = 0
 	i.maybeFilteredKeysTwoLevel = false
 	i.err = nil // clear cached iteration error
@@ -2350,6 +2432,10 @@ func (i *twoLevelIterator) skipBackward() (*InternalKey, base.LazyValue) {
 // Close implements internalIterator.Close, as documented in the pebble
 // package.
 func (i *twoLevelIterator) Close() error {
+	// Wait for any prefetching goroutines to exit before the close hook
+	// releases the Reader.
+	i.dataPrefetch.close()
+	i.vbPrefetch.close()
 	var err error
 	if i.closeHook != nil {
 		err = firstError(err, i.closeHook(i))
@@ -2641,6 +2727,33 @@ func (r *Reader) NewIterWithBlockPropertyFiltersAndContext(
 	stats *base.InternalIteratorStats,
 	rp ReaderProvider,
 ) (Iterator, error) {
+	return r.NewIterWithOptions(ctx, lower, upper, filterer, useFilterBlock, stats, rp, IterOptions{})
+}
+
+// IterOptions holds the optional parameters of the iterators created by
+// Reader.NewIterWithOptions.
+type IterOptions struct {
+	// Prefetcher, if non-nil, enables the asynchronous prefetching of blocks.
+	// See Prefetcher.
+	Prefetcher *Prefetcher
+	// HighCachePriority causes the data and value blocks read by the iterator
+	// to be cached with high priority, retaining them in the block cache in
+	// preference to the blocks read by other iterators. Index, filter and other
+	// metadata blocks are always cached with high priority.
+	HighCachePriority bool
+}
+
+// NewIterWithOptions is similar to NewIterWithBlockPropertyFiltersAndContext
+// and additionally accepts IterOptions.
+func (r *Reader) NewIterWithOptions(
+	ctx context.Context,
+	lower, upper []byte,
+	filterer *BlockPropertiesFilterer,
+	useFilterBlock bool,
+	stats *base.InternalIteratorStats,
+	rp ReaderProvider,
+	opts IterOptions,
+) (Iterator, error) {
 
 	// NB: pebble.tableCache wraps the returned iterator with one which performs
 	// reference counting on the Reader, preventing the Reader from being closed
@@ -2651,6 +2764,12 @@ func (r *Reader) NewIterWithBlockPropertyFiltersAndContext(
 		if err != nil {
 			return nil, err
 		}
+		if opts.HighCachePriority {
+			i.dataCachePri = cache.HighPriority
+		}
+		if opts.Prefetcher != nil {
+			i.initPrefetch(opts.Prefetcher)
+		}
 		return i, nil
 	}
 
@@ -2659,6 +2778,12 @@ func (r *Reader) NewIterWithBlockPropertyFiltersAndContext(
 	if err != nil {
 		return nil, err
 	}
+	if opts.HighCachePriority {
+		i.dataCachePri = cache.HighPriority
+	}
+	if opts.Prefetcher != nil {
+		i.initPrefetch(opts.Prefetcher)
+	}
 	return i, nil
 }
 
@@ -2759,24 +2884,71 @@ func (r *Reader) readIndex(
 	ctx context.Context, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.MetadataBlock)
-	return r.readBlock(ctx, r.indexBH, nil, nil, stats)
+	return r.readBlock(ctx, r.indexBH, cache.IndexBlock, nil, nil, stats)
 }
 
 func (r *Reader) readFilter(
 	ctx context.Context, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.FilterBlock)
-	return r.readBlock(ctx, r.filterBH, nil /* transform */, nil /* readHandle */, stats)
+	return r.readBlock(ctx, r.filterBH, cache.FilterBlock, nil /* transform */, nil /* readHandle */, stats)
+}
+
+// filterMayContain consults the table's filter, returning false if the table
+// contains no keys with the provided prefix that are greater than or equal to
+// key. If the filter is partitioned, only the filter index and the partition
+// that would contain such keys are read.
+func (r *Reader) filterMayContain(
+	ctx context.Context, stats *base.InternalIteratorStats, prefix, key []byte,
+) (bool, error) {
+	filterH, err := r.readFilter(ctx, stats)
+	if err != nil {
+		return false, err
+	}
+	if !r.tableFilter.partitioned {
+		mayContain := r.tableFilter.mayContain(filterH.Get(), prefix)
+		filterH.Release()
+		return mayContain, nil
+	}
+
+	// Find the first partition whose largest key is >= key. Any key >= key
+	// with the prefix either belongs to that partition, or to a later
+	// partition, in which case the partition's largest key lies between the
+	// two keys, and so also has the prefix.
+	var iter blockIter
+	if err := iter.initHandle(r.Compare, filterH, 0 /* globalSeqNum */); err != nil {
+		return false, err
+	}
+	ikey, val := iter.SeekGE(key, base.SeekGEFlagsNone)
+	if ikey == nil {
+		// The table contains no keys >= key.
+		r.tableFilter.recordHit()
+		return false, iter.Close()
+	}
+	bh, n := decodeBlockHandle(val.InPlaceValue())
+	if err := iter.Close(); err != nil {
+		return false, err
+	}
+	if n == 0 || n != len(val.InPlaceValue()) {
+		return false, base.CorruptionErrorf("pebble/table: invalid filter partition handle")
+	}
+	partitionH, err := r.readBlock(ctx, bh, cache.FilterBlock, nil /* transform */, nil /* readHandle */, stats)
+	if err != nil {
+		return false, err
+	}
+	mayContain := r.tableFilter.mayContain(partitionH.Get(), prefix)
+	partitionH.Release()
+	return mayContain, nil
 }
 
 func (r *Reader) readRangeDel(stats *base.InternalIteratorStats) (cache.Handle, error) {
 	ctx := objiotracing.WithBlockType(context.Background(), objiotracing.MetadataBlock)
-	return r.readBlock(ctx, r.rangeDelBH, r.rangeDelTransform, nil /* readHandle */, stats)
+	return r.readBlock(ctx, r.rangeDelBH, cache.MetadataBlock, r.rangeDelTransform, nil /* readHandle */, stats)
 }
 
 func (r *Reader) readRangeKey(stats *base.InternalIteratorStats) (cache.Handle, error) {
 	ctx := objiotracing.WithBlockType(context.Background(), objiotracing.MetadataBlock)
-	return r.readBlock(ctx, r.rangeKeyBH, nil /* transform */, nil /* readHandle */, stats)
+	return r.readBlock(ctx, r.rangeKeyBH, cache.MetadataBlock, nil /* transform */, nil /* readHandle */, stats)
 }
 
 func checkChecksum(
@@ -2801,21 +2973,52 @@ func checkChecksum(
 	return nil
 }
 
-// readBlock reads and decompresses a block from disk into memory.
+// defaultCachePriority returns the priority with which a block of the provided
+// kind is cached, unless the iterator reading it specifies otherwise. Index,
+// filter and other metadata blocks are cached with cache.HighPriority, and
+// data and value blocks with cache.LowPriority.
+func defaultCachePriority(kind cache.BlockKind) cache.Priority {
+	switch kind {
+	case cache.IndexBlock, cache.FilterBlock, cache.MetadataBlock:
+		return cache.HighPriority
+	}
+	return cache.LowPriority
+}
+
+// readBlock reads and decompresses a block from disk into memory, caching it
+// with the default priority for its kind. The kind of the block also
+// determines the cache metrics its hit or miss is recorded under.
 func (r *Reader) readBlock(
 	ctx context.Context,
 	bh BlockHandle,
+	kind cache.BlockKind,
 	transform blockTransform,
 	readHandle objstorage.ReadHandle,
 	stats *base.InternalIteratorStats,
 ) (handle cache.Handle, _ error) {
-	if h := r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset); h.Get() != nil {
+	return r.readBlockWithPriority(
+		ctx, bh, kind, defaultCachePriority(kind), transform, readHandle, stats)
+}
+
+// readBlockWithPriority is like readBlock, but caches the block with the
+// provided priority.
+func (r *Reader) readBlockWithPriority(
+	ctx context.Context,
+	bh BlockHandle,
+	kind cache.BlockKind,
+	pri cache.Priority,
+	transform blockTransform,
+	readHandle objstorage.ReadHandle,
+	stats *base.InternalIteratorStats,
+) (handle cache.Handle, _ error) {
+	if h := r.opts.Cache.GetBlock(r.cacheID, r.fileNum, bh.Offset, kind); h.Get() != nil {
 		if readHandle != nil {
 			readHandle.RecordCacheHit(ctx, int64(bh.Offset), int64(bh.Length+blockTrailerLen))
 		}
 		if stats != nil {
 			stats.BlockBytes += bh.Length
 			stats.BlockBytesInCache += bh.Length
+			stats.BlockCacheHits++
 		}
 		return h, nil
 	}
@@ -2843,6 +3046,7 @@ func (r *Reader) readBlock(
 			bh.Length+blockTrailerLen, readDuration.String())
 	}
 	if stats != nil {
+		stats.BlockCacheMisses++
 		stats.BlockReadDuration += readDuration
 	}
 	if err != nil {
@@ -2888,7 +3092,7 @@ func (r *Reader) readBlock(
 		stats.BlockBytes += bh.Length
 	}
 
-	h := r.opts.Cache.Set(r.cacheID, r.fileNum, bh.Offset, v)
+	h := r.opts.Cache.SetWithPriority(r.cacheID, r.fileNum, bh.Offset, v, pri)
 	return h, nil
 }
 
@@ -2937,7 +3141,7 @@ func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
 
 func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 	b, err := r.readBlock(
-		context.Background(), metaindexBH, nil /* transform */, nil /* readHandle */, nil /* stats */)
+		context.Background(), metaindexBH, cache.MetadataBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
 	if err != nil {
 		return err
 	}
@@ -2980,7 +3184,7 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 
 	if bh, ok := meta[metaPropertiesName]; ok {
 		b, err = r.readBlock(
-			context.Background(), bh, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			context.Background(), bh, cache.MetadataBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
 		if err != nil {
 			return err
 		}
@@ -3007,10 +3211,12 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 
 	for name, fp := range r.opts.Filters {
 		types := []struct {
-			ftype  FilterType
-			prefix string
+			ftype       FilterType
+			prefix      string
+			partitioned bool
 		}{
-			{TableFilter, "fullfilter."},
+			{TableFilter, "fullfilter.", false},
+			{TableFilter, "partitionedfilter.", true},
 		}
 		var done bool
 		for _, t := range types {
@@ -3020,6 +3226,7 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 				switch t.ftype {
 				case TableFilter:
 					r.tableFilter = newTableFilterReader(fp)
+					r.tableFilter.partitioned = t.partitioned
 				default:
 					return base.CorruptionErrorf("unknown filter type: %v", errors.Safe(t.ftype))
 				}
@@ -3086,7 +3293,7 @@ func (r *Reader) Layout() (*Layout, error) {
 			l.Index = append(l.Index, indexBH.BlockHandle)
 
 			subIndex, err := r.readBlock(context.Background(),
-				indexBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+				indexBH.BlockHandle, cache.IndexBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
 			if err != nil {
 				return nil, err
 			}
@@ -3107,8 +3314,24 @@ func (r *Reader) Layout() (*Layout, error) {
 			*iter = iter.resetForReuse()
 		}
 	}
+	if r.tableFilter != nil && r.tableFilter.partitioned {
+		filterH, err := r.readBlock(context.Background(), r.filterBH, cache.FilterBlock, nil, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		iter, _ := newBlockIter(r.Compare, filterH.Get())
+		for key, value := iter.First(); key != nil; key, value = iter.Next() {
+			bh, n := decodeBlockHandle(value.InPlaceValue())
+			if n == 0 || n != len(value.InPlaceValue()) {
+				filterH.Release()
+				return nil, base.CorruptionErrorf("pebble/table: corrupt filter index entry")
+			}
+			l.FilterPartitions = append(l.FilterPartitions, bh)
+		}
+		filterH.Release()
+	}
 	if r.valueBIH.h.Length != 0 {
-		vbiH, err := r.readBlock(context.Background(), r.valueBIH.h, nil, nil, nil)
+		vbiH, err := r.readBlock(context.Background(), r.valueBIH.h, cache.MetadataBlock, nil, nil, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -3159,6 +3382,7 @@ func (r *Reader) ValidateBlockChecksums() error {
 		blocks[i] = l.Data[i].BlockHandle
 	}
 	blocks = append(blocks, l.Index...)
+	blocks = append(blocks, l.FilterPartitions...)
 	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
 
 	// Sorting by offset ensures we are performing a sequential scan of the
@@ -3179,7 +3403,7 @@ func (r *Reader) ValidateBlockChecksums() error {
 		}
 
 		// Read the block, which validates the checksum.
-		h, err := r.readBlock(context.Background(), bh, nil, rh, nil)
+		h, err := r.readBlock(context.Background(), bh, cache.UnknownBlock, nil, rh, nil)
 		if err != nil {
 			return err
 		}
@@ -3242,7 +3466,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 			return 0, errCorruptIndexEntry
 		}
 		startIdxBlock, err := r.readBlock(context.Background(),
-			startIdxBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			startIdxBH.BlockHandle, cache.IndexBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
 		if err != nil {
 			return 0, err
 		}
@@ -3263,7 +3487,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 				return 0, errCorruptIndexEntry
 			}
 			endIdxBlock, err := r.readBlock(context.Background(),
-				endIdxBH.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+				endIdxBH.BlockHandle, cache.IndexBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
 			if err != nil {
 				return 0, err
 			}
@@ -3321,6 +3545,102 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		endBH.Offset + endBH.Length + blockTrailerLen - startBH.Offset), nil
 }
 
+// DataBlockBoundary describes a data block of an sstable by its index
+// separator, which sorts at or after every key in the block and before every
+// key in the following block.
+type DataBlockBoundary struct {
+	// Separator is the user key of the block's index separator.
+	Separator []byte
+	// Length is the length of the block on disk, excluding its trailer.
+	Length uint64
+}
+
+// DataBlockBoundaries returns the boundaries of the data blocks that may
+// contain keys within [start, end), in key order. Only index blocks are read.
+func (r *Reader) DataBlockBoundaries(start, end []byte) ([]DataBlockBoundary, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	indexH, err := r.readIndex(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer indexH.Release()
+
+	var boundaries []DataBlockBoundary
+	// appendFrom appends the boundaries of the data blocks indexed by iter,
+	// starting from its current position, and returns true once it reaches the
+	// first block extending to end.
+	appendFrom := func(iter *blockIter, key *InternalKey, val base.LazyValue) (bool, error) {
+		for ; key != nil; key, val = iter.Next() {
+			bh, err := decodeBlockHandleWithProperties(val.InPlaceValue())
+			if err != nil {
+				return false, errCorruptIndexEntry
+			}
+			boundaries = append(boundaries, DataBlockBoundary{
+				Separator: append([]byte(nil), key.UserKey...),
+				Length:    bh.Length,
+			})
+			if r.Compare(key.UserKey, end) >= 0 {
+				return true, nil
+			}
+		}
+		return false, iter.Error()
+	}
+
+	if r.Properties.IndexPartitions == 0 {
+		iter, err := newBlockIter(r.Compare, indexH.Get())
+		if err != nil {
+			return nil, err
+		}
+		key, val := iter.SeekGE(start, base.SeekGEFlagsNone)
+		if _, err := appendFrom(iter, key, val); err != nil {
+			return nil, err
+		}
+		return boundaries, nil
+	}
+
+	topIter, err := newBlockIter(r.Compare, indexH.Get())
+	if err != nil {
+		return nil, err
+	}
+	first := true
+	for key, val := topIter.SeekGE(start, base.SeekGEFlagsNone); key != nil; key, val = topIter.Next() {
+		bh, err := decodeBlockHandleWithProperties(val.InPlaceValue())
+		if err != nil {
+			return nil, errCorruptIndexEntry
+		}
+		done, err := func() (bool, error) {
+			indexBlock, err := r.readBlock(context.Background(),
+				bh.BlockHandle, cache.IndexBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			if err != nil {
+				return false, err
+			}
+			defer indexBlock.Release()
+			iter, err := newBlockIter(r.Compare, indexBlock.Get())
+			if err != nil {
+				return false, err
+			}
+			var key *InternalKey
+			var val base.LazyValue
+			if first {
+				key, val = iter.SeekGE(start, base.SeekGEFlagsNone)
+			} else {
+				key, val = iter.First()
+			}
+			return appendFrom(iter, key, val)
+		}()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return boundaries, nil
+		}
+		first = false
+	}
+	return boundaries, topIter.Error()
+}
+
 // TableFormat returns the format version for the table.
 func (r *Reader) TableFormat() (TableFormat, error) {
 	if r.err != nil {
@@ -3417,18 +3737,21 @@ type Layout struct {
 	// ValidateBlockChecksums, which validates a static list of BlockHandles
 	// referenced in this struct.
 
-	Data       []BlockHandleWithProperties
-	Index      []BlockHandle
-	TopIndex   BlockHandle
-	Filter     BlockHandle
-	RangeDel   BlockHandle
-	RangeKey   BlockHandle
-	ValueBlock []BlockHandle
-	ValueIndex BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
-	Format     TableFormat
+	Data     []BlockHandleWithProperties
+	Index    []BlockHandle
+	TopIndex BlockHandle
+	Filter   BlockHandle
+	// FilterPartitions is only populated for partitioned filters, in which
+	// case Filter is the filter index block.
+	FilterPartitions []BlockHandle
+	RangeDel         BlockHandle
+	RangeKey         BlockHandle
+	ValueBlock       []BlockHandle
+	ValueIndex       BlockHandle
+	Properties       BlockHandle
+	MetaIndex        BlockHandle
+	Footer           BlockHandle
+	Format           TableFormat
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -3452,7 +3775,12 @@ func (l *Layout) Describe(
 	if l.TopIndex.Length != 0 {
 		blocks = append(blocks, block{l.TopIndex, "top-index"})
 	}
-	if l.Filter.Length != 0 {
+	if len(l.FilterPartitions) > 0 {
+		for i := range l.FilterPartitions {
+			blocks = append(blocks, block{l.FilterPartitions[i], "filter-partition"})
+		}
+		blocks = append(blocks, block{l.Filter, "filter-index"})
+	} else if l.Filter.Length != 0 {
 		blocks = append(blocks, block{l.Filter, "filter"})
 	}
 	if l.RangeDel.Length != 0 {
@@ -3492,7 +3820,7 @@ func (l *Layout) Describe(
 		if !verbose {
 			continue
 		}
-		if b.name == "filter" {
+		if b.name == "filter" || b.name == "filter-partition" {
 			continue
 		}
 
@@ -3539,7 +3867,7 @@ func (l *Layout) Describe(
 		}
 
 		h, err := r.readBlock(
-			context.Background(), b.BlockHandle, nil /* transform */, nil /* readHandle */, nil /* stats */)
+			context.Background(), b.BlockHandle, cache.UnknownBlock, nil /* transform */, nil /* readHandle */, nil /* stats */)
 		if err != nil {
 			fmt.Fprintf(w, "  [err: %s]\n", err)
 			continue
@@ -3604,7 +3932,7 @@ func (l *Layout) Describe(
 				formatIsRestart(iter.data, iter.restarts, iter.numRestarts, iter.offset)
 				if fmtRecord != nil {
 					fmt.Fprintf(w, "              ")
-					if l.Format != TableFormatPebblev3 {
+					if l.Format < TableFormatPebblev3 {
 						fmtRecord(key, value.InPlaceValue())
 					} else {
 						// InPlaceValue() will succeed even for data blocks where the
@@ -3631,7 +3959,7 @@ func (l *Layout) Describe(
 			}
 			formatRestarts(iter.data, iter.restarts, iter.numRestarts)
 			formatTrailer()
-		case "index", "top-index":
+		case "index", "top-index", "filter-index":
 			iter, _ := newBlockIter(r.Compare, h.Get())
 			for key, value := iter.First(); key != nil; key, value = iter.Next() {
 				bh, err := decodeBlockHandleWithProperties(value.InPlaceValue())
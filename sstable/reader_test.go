@@ -400,7 +400,7 @@ func indexLayoutString(t *testing.T, r *Reader) string {
 		fmt.Fprintf(&buf, " %s: size %d\n", string(key.UserKey), bh.Length)
 		if twoLevelIndex {
 			b, err := r.readBlock(
-				context.Background(), bh.BlockHandle, nil, nil, nil)
+				context.Background(), bh.BlockHandle, cache.IndexBlock, nil, nil, nil)
 			require.NoError(t, err)
 			defer b.Release()
 			iter2, err := newBlockIter(r.Compare, b.Get())
@@ -1054,6 +1054,161 @@ func TestReader_TableFormat(t *testing.T) {
 	}
 }
 
+func TestReaderDataBlockBoundaries(t *testing.T) {
+	key := func(i uint64) []byte {
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, i)
+		return k
+	}
+	for _, indexBlockSize := range []int{100, math.MaxInt32} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			r := buildTestTable(t, 2000, 100, indexBlockSize, NoCompression)
+			defer r.Close()
+			require.Equal(t, indexBlockSize == 100, r.Properties.IndexPartitions > 0)
+
+			all, err := r.DataBlockBoundaries(key(0), key(math.MaxUint64))
+			require.NoError(t, err)
+			require.Equal(t, int(r.Properties.NumDataBlocks), len(all))
+			var size uint64
+			for i, b := range all {
+				if i > 0 {
+					require.Less(t, r.Compare(all[i-1].Separator, b.Separator), 0)
+				}
+				size += b.Length + blockTrailerLen
+			}
+			require.Equal(t, r.Properties.DataSize, size)
+
+			// The boundaries of a subrange are those of the blocks from the
+			// block containing start through the block containing end.
+			start, end := key(500), key(1000)
+			sub, err := r.DataBlockBoundaries(start, end)
+			require.NoError(t, err)
+			i := 0
+			for r.Compare(all[i].Separator, start) < 0 {
+				i++
+			}
+			j := i
+			for r.Compare(all[j].Separator, end) < 0 {
+				j++
+			}
+			require.Equal(t, all[i:j+1], sub)
+
+			// A range beyond the table has no boundaries.
+			none, err := r.DataBlockBoundaries(key(math.MaxUint64-1), key(math.MaxUint64))
+			require.NoError(t, err)
+			require.Empty(t, none)
+		})
+	}
+}
+
+func TestReaderCachePriority(t *testing.T) {
+	for _, pri := range []cache.Priority{cache.LowPriority, cache.HighPriority} {
+		t.Run(pri.String(), func(t *testing.T) {
+			r := buildTestTable(t, 2000, 100, 100, NoCompression)
+			defer r.Close()
+			require.Greater(t, r.Properties.IndexPartitions, uint64(0))
+			before := r.opts.Cache.Metrics()
+
+			iter, err := r.NewIterWithOptions(
+				context.Background(), nil /* lower */, nil /* upper */, nil /* filterer */, true, /* useFilterBlock */
+				nil /* stats */, nil /* rp */, IterOptions{HighCachePriority: pri == cache.HighPriority})
+			require.NoError(t, err)
+			for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+			}
+			require.NoError(t, iter.Close())
+
+			// The data blocks and the index blocks, including the top-level
+			// index block, are recorded under their kinds.
+			m := r.opts.Cache.Metrics()
+			misses := func(kind cache.BlockKind) int64 {
+				return m.BlockKinds[kind].Misses - before.BlockKinds[kind].Misses
+			}
+			require.Equal(t, int64(r.Properties.NumDataBlocks), misses(cache.DataBlock))
+			require.Equal(t, int64(r.Properties.IndexPartitions+1), misses(cache.IndexBlock))
+
+			// Index blocks are always cached with high priority, and data blocks
+			// with the priority requested by the iterator's options.
+			highSize := m.HighPrioritySize - before.HighPrioritySize
+			require.Greater(t, highSize, int64(0))
+			if pri == cache.HighPriority {
+				require.Greater(t, highSize, int64(r.Properties.DataSize))
+			} else {
+				require.LessOrEqual(t, highSize, int64(r.Properties.IndexSize))
+			}
+		})
+	}
+}
+
+func TestReaderPartitionedFilter(t *testing.T) {
+	provider, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(vfs.NewMem(), "" /* dirName */))
+	require.NoError(t, err)
+	defer provider.Close()
+	f0, _, err := provider.Create(context.Background(), base.FileTypeTable, base.FileNum(0).DiskFileNum(), objstorage.CreateOptions{})
+	require.NoError(t, err)
+
+	filter := bloom.FilterPolicy(10)
+	w := NewWriter(f0, WriterOptions{
+		BlockSize:      100,
+		IndexBlockSize: 100,
+		FilterPolicy:   filter,
+		TableFormat:    TableFormatPebblev4,
+	})
+	// Only even keys are written, so that odd keys are absent from the table.
+	const numKeys = 2000
+	key := func(i uint64) []byte {
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, i)
+		return k
+	}
+	for i := uint64(0); i < numKeys; i += 2 {
+		require.NoError(t, w.Set(key(i), []byte("value")))
+	}
+	require.NoError(t, w.Close())
+
+	f1, err := provider.OpenForReading(context.Background(), base.FileTypeTable, base.FileNum(0).DiskFileNum(), objstorage.OpenOptions{})
+	require.NoError(t, err)
+	c := cache.New(128 << 20)
+	defer c.Unref()
+	var metrics FilterMetricsTracker
+	r, err := NewReader(f1, ReaderOptions{
+		Cache:   c,
+		Filters: map[string]FilterPolicy{filter.Name(): filter},
+	}, &metrics)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.Greater(t, r.Properties.IndexPartitions, uint64(1))
+	require.Equal(t, r.Properties.IndexPartitions, r.Properties.NumFilterPartitions)
+	require.NoError(t, r.ValidateBlockChecksums())
+
+	l, err := r.Layout()
+	require.NoError(t, err)
+	require.Equal(t, int(r.Properties.NumFilterPartitions), len(l.FilterPartitions))
+	var buf bytes.Buffer
+	l.Describe(&buf, true /* verbose */, r, nil /* fmtRecord */)
+	require.Contains(t, buf.String(), "filter-index")
+	require.Contains(t, buf.String(), "filter-partition")
+
+	iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+	require.NoError(t, err)
+	defer iter.Close()
+	for i := uint64(0); i < numKeys; i++ {
+		k := key(i)
+		ikey, _ := iter.SeekPrefixGE(k, k, base.SeekGEFlagsNone)
+		if i%2 == 0 {
+			require.NotNil(t, ikey)
+			require.Equal(t, k, ikey.UserKey)
+		} else {
+			require.Nil(t, ikey)
+		}
+	}
+	// Every present key is a filter miss, and the majority of the absent keys
+	// are excluded by the filter partitions.
+	m := metrics.Load()
+	require.Equal(t, int64(numKeys), m.Hits+m.Misses)
+	require.Greater(t, m.Hits, int64(numKeys/2*9/10))
+}
+
 func buildTestTable(
 	t *testing.T, numEntries uint64, blockSize, indexBlockSize int, compression Compression,
 ) *Reader {
@@ -120,8 +120,13 @@ func rewriteKeySuffixesInBlocks(
 	}
 
 	// Copy over the filter block if it exists (rewriteDataBlocksToWriter will
-	// already have ensured this is valid if it exists).
-	if w.filter != nil && l.Filter.Length > 0 {
+	// already have ensured this is valid if it exists). A partitioned filter's
+	// partitions are copied, and its index is rebuilt with the rewritten keys.
+	if f, ok := w.filter.(*partitionedFilterWriter); ok && len(l.FilterPartitions) > 0 {
+		if err := rewriteFilterPartitions(r, f, l.Filter, from, to, w.split); err != nil {
+			return nil, TableFormatUnspecified, errors.Wrap(err, "rewriting filter partitions")
+		}
+	} else if w.filter != nil && l.Filter.Length > 0 {
 		filterBlock, _, err := readBlockBuf(r, l.Filter, nil)
 		if err != nil {
 			return nil, TableFormatUnspecified, errors.Wrap(err, "reading filter")
@@ -223,7 +228,7 @@ func rewriteBlocks(
 			// in the block, which includes the 1-byte prefix. This is fine since bw
 			// also does not know about the prefix and will preserve it in bw.add.
 			v := val.InPlaceValue()
-			if invariants.Enabled && r.tableFormat == TableFormatPebblev3 &&
+			if invariants.Enabled && r.tableFormat >= TableFormatPebblev3 &&
 				key.Kind() == InternalKeyKindSet {
 				if len(v) < 1 {
 					return errors.Errorf("value has no prefix")
@@ -380,6 +385,43 @@ func rewriteDataBlocksToWriter(
 	return nil
 }
 
+// rewriteFilterPartitions copies the partitions of the partitioned filter
+// whose index block is filterBH to f. The partitions themselves are copied
+// unmodified since the filter only contains key prefixes, but the suffix of
+// the key each partition is indexed by is replaced.
+func rewriteFilterPartitions(
+	r *Reader, f *partitionedFilterWriter, filterBH BlockHandle, from, to []byte, split Split,
+) error {
+	indexBlock, _, err := readBlockBuf(r, filterBH, nil)
+	if err != nil {
+		return err
+	}
+	iter, err := newBlockIter(r.Compare, indexBlock)
+	if err != nil {
+		return err
+	}
+	var sep []byte
+	for key, value := iter.First(); key != nil; key, value = iter.Next() {
+		bh, n := decodeBlockHandle(value.InPlaceValue())
+		if n == 0 || n != len(value.InPlaceValue()) {
+			return base.CorruptionErrorf("pebble/table: corrupt filter index entry")
+		}
+		partition, _, err := readBlockBuf(r, bh, nil)
+		if err != nil {
+			return err
+		}
+		si := split(key.UserKey)
+		if !bytes.Equal(key.UserKey[si:], from) {
+			return errors.Errorf("key has suffix %q, expected %q", key.UserKey[si:], from)
+		}
+		sep = append(append(sep[:0], key.UserKey[:si]...), to...)
+		p := filterPartition{block: partition}
+		f.sepAlloc, p.sep = f.sepAlloc.Copy(sep)
+		f.partitions = append(f.partitions, p)
+	}
+	return iter.Close()
+}
+
 func rewriteRangeKeyBlockToWriter(r *Reader, w *Writer, from, to []byte) error {
 	iter, err := r.NewRawRangeKeyIter()
 	if err != nil {
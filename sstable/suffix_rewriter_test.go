@@ -2,6 +2,7 @@ package sstable
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -139,6 +140,62 @@ func TestRewriteSuffixProps(t *testing.T) {
 	}
 }
 
+func TestRewriteSuffixPartitionedFilter(t *testing.T) {
+	from, to := []byte("_212"), []byte("_646")
+	wOpts := WriterOptions{
+		FilterPolicy:   bloom.FilterPolicy(10),
+		Comparer:       test4bSuffixComparer,
+		IndexBlockSize: 1 << 10,
+		TableFormat:    TableFormatPebblev4,
+	}
+	const keyCount = 1e4
+	sst := make4bSuffixTestSST(t, wOpts, from, keyCount, 0 /* rangeKeys */)
+	readerOpts := ReaderOptions{
+		Comparer: test4bSuffixComparer,
+		Filters:  map[string]base.FilterPolicy{wOpts.FilterPolicy.Name(): wOpts.FilterPolicy},
+	}
+	r, err := NewMemReader(sst, readerOpts)
+	require.NoError(t, err)
+	defer r.Close()
+	require.Greater(t, r.Properties.NumFilterPartitions, uint64(1))
+
+	var sstBytes [2][]byte
+	for i, byBlocks := range []bool{false, true} {
+		rewrittenSST := &memFile{}
+		if byBlocks {
+			_, _, err := rewriteKeySuffixesInBlocks(r, rewrittenSST, wOpts, from, to, 8)
+			require.NoError(t, err)
+		} else {
+			_, err := RewriteKeySuffixesViaWriter(r, rewrittenSST, wOpts, from, to)
+			require.NoError(t, err)
+		}
+		sstBytes[i] = rewrittenSST.Data()
+
+		rRewritten, err := NewMemReader(rewrittenSST.Data(), readerOpts)
+		require.NoError(t, err)
+		require.True(t, rRewritten.tableFilter.partitioned)
+		require.Equal(t, r.Properties.NumFilterPartitions, rRewritten.Properties.NumFilterPartitions)
+		layout, err := rRewritten.Layout()
+		require.NoError(t, err)
+		require.Len(t, layout.FilterPartitions, int(r.Properties.NumFilterPartitions))
+
+		// Every rewritten key is found through the filter.
+		key := make([]byte, 28)
+		copy(key[24:], to)
+		for j := 0; j < keyCount; j++ {
+			binary.BigEndian.PutUint64(key[:8], 123)
+			binary.BigEndian.PutUint64(key[8:16], 456)
+			binary.BigEndian.PutUint64(key[16:], uint64(j))
+			mayContain, err := rRewritten.filterMayContain(context.Background(), nil /* stats */, key[:24], key)
+			require.NoError(t, err)
+			require.True(t, mayContain)
+		}
+		require.NoError(t, rRewritten.Close())
+	}
+	// Both methods of rewriting should produce the same result.
+	require.Equal(t, sstBytes[0], sstBytes[1])
+}
+
 // memFile is a file-like struct that buffers all data written to it in memory.
 // Implements the objstorage.Writable interface.
 type memFile struct {
@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/kr/pretty"
@@ -694,7 +695,7 @@ func TestMetaIndexEntriesSorted(t *testing.T) {
 	r, err := newReader(f, ReaderOptions{})
 	require.NoError(t, err)
 
-	b, err := r.readBlock(context.Background(), r.metaIndexBH, nil, nil, nil)
+	b, err := r.readBlock(context.Background(), r.metaIndexBH, cache.MetadataBlock, nil, nil, nil)
 	require.NoError(t, err)
 	defer b.Release()
 
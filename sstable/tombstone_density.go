@@ -0,0 +1,155 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+)
+
+// TombstoneDensityCollectorName is the name of the built-in block property
+// collector that records the density of point tombstones within data blocks.
+const TombstoneDensityCollectorName = "pebble.tombstone-density"
+
+// tombstoneDensity is the property value of the tombstone density collector:
+// the number of data blocks that are tombstone-dense, and the total number of
+// data blocks. A data block's property has a blocks count of one.
+type tombstoneDensity struct {
+	denseBlocks uint64
+	blocks      uint64
+}
+
+func (t tombstoneDensity) encode(buf []byte) []byte {
+	if t.blocks == 0 {
+		return buf
+	}
+	var encoded [binary.MaxVarintLen64 * 2]byte
+	n := binary.PutUvarint(encoded[:], t.denseBlocks)
+	n += binary.PutUvarint(encoded[n:], t.blocks)
+	return append(buf, encoded[:n]...)
+}
+
+func (t *tombstoneDensity) decode(buf []byte) error {
+	if len(buf) == 0 {
+		*t = tombstoneDensity{}
+		return nil
+	}
+	var n int
+	t.denseBlocks, n = binary.Uvarint(buf)
+	if n <= 0 {
+		return base.CorruptionErrorf("cannot decode tombstone density dense blocks: %x", buf)
+	}
+	buf = buf[n:]
+	t.blocks, n = binary.Uvarint(buf)
+	if n <= 0 || n != len(buf) || t.denseBlocks > t.blocks {
+		return base.CorruptionErrorf("cannot decode tombstone density blocks: %x", buf)
+	}
+	return nil
+}
+
+func (t *tombstoneDensity) add(x tombstoneDensity) {
+	t.denseBlocks += x.denseBlocks
+	t.blocks += x.blocks
+}
+
+// tombstoneDensityCollector is a BlockPropertyCollector that classifies each
+// data block as tombstone-dense if the fraction of its point keys that are
+// point tombstones (DEL or SINGLEDEL) is at least the configured ratio. The
+// index block and table properties count the tombstone-dense data blocks
+// beneath them.
+type tombstoneDensityCollector struct {
+	ratio float64
+	// Counts of the point keys and point tombstones added to the current
+	// data block.
+	keys       uint64
+	tombstones uint64
+
+	block tombstoneDensity
+	index tombstoneDensity
+	table tombstoneDensity
+}
+
+var _ BlockPropertyCollector = (*tombstoneDensityCollector)(nil)
+
+// NewTombstoneDensityCollector constructs the built-in block property
+// collector that records which data blocks are tombstone-dense: data blocks
+// in which at least the provided fraction of point keys are point tombstones.
+// The collector's property may be read using ReadTombstoneDensity.
+func NewTombstoneDensityCollector(ratio float64) BlockPropertyCollector {
+	return &tombstoneDensityCollector{ratio: ratio}
+}
+
+// Name implements the BlockPropertyCollector interface.
+func (c *tombstoneDensityCollector) Name() string {
+	return TombstoneDensityCollectorName
+}
+
+// Add implements the BlockPropertyCollector interface.
+func (c *tombstoneDensityCollector) Add(key InternalKey, value []byte) error {
+	switch kind := key.Kind(); {
+	case rangekey.IsRangeKey(kind) || kind == InternalKeyKindRangeDelete:
+		// Range keys and range deletions are not stored in data blocks.
+	case kind == InternalKeyKindDelete || kind == InternalKeyKindSingleDelete ||
+		kind == InternalKeyKindDeleteSized:
+		c.keys++
+		c.tombstones++
+	default:
+		c.keys++
+	}
+	return nil
+}
+
+// FinishDataBlock implements the BlockPropertyCollector interface.
+func (c *tombstoneDensityCollector) FinishDataBlock(buf []byte) ([]byte, error) {
+	c.block = tombstoneDensity{blocks: 1}
+	if c.keys > 0 && float64(c.tombstones) >= c.ratio*float64(c.keys) {
+		c.block.denseBlocks = 1
+	}
+	c.keys, c.tombstones = 0, 0
+	c.table.add(c.block)
+	return c.block.encode(buf), nil
+}
+
+// AddPrevDataBlockToIndexBlock implements the BlockPropertyCollector
+// interface.
+func (c *tombstoneDensityCollector) AddPrevDataBlockToIndexBlock() {
+	c.index.add(c.block)
+	c.block = tombstoneDensity{}
+}
+
+// FinishIndexBlock implements the BlockPropertyCollector interface.
+func (c *tombstoneDensityCollector) FinishIndexBlock(buf []byte) ([]byte, error) {
+	buf = c.index.encode(buf)
+	c.index = tombstoneDensity{}
+	return buf, nil
+}
+
+// FinishTable implements the BlockPropertyCollector interface.
+func (c *tombstoneDensityCollector) FinishTable(buf []byte) ([]byte, error) {
+	return c.table.encode(buf), nil
+}
+
+// ReadTombstoneDensity reads the table property written by the tombstone
+// density collector, returning the number of tombstone-dense data blocks and
+// the total number of data blocks in the table. The returned ok is false if
+// the table was not written with the collector.
+func ReadTombstoneDensity(props *Properties) (denseBlocks, blocks uint64, ok bool, err error) {
+	prop, ok := props.UserProperties[TombstoneDensityCollectorName]
+	if !ok {
+		return 0, 0, false, nil
+	}
+	if len(prop) < 1 {
+		return 0, 0, false, base.CorruptionErrorf(
+			"block properties for %s is corrupted", TombstoneDensityCollectorName)
+	}
+	// The first byte is the collector's shortID.
+	var t tombstoneDensity
+	if err := t.decode([]byte(prop[1:])); err != nil {
+		return 0, 0, false, err
+	}
+	return t.denseBlocks, t.blocks, true, nil
+}
@@ -19,7 +19,7 @@ import (
 	"golang.org/x/exp/rand"
 )
 
-// Value blocks are supported in TableFormatPebblev3.
+// Value blocks are supported in TableFormatPebblev3 and later formats.
 //
 // Value blocks are a mechanism designed for sstables storing MVCC data, where
 // there can be many versions of a key that need to be kept, but only the
@@ -685,7 +685,7 @@ func (bpwc blockProviderWhenClosed) readBlockForVBR(
 	ctx context.Context, h BlockHandle, stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	ctx = objiotracing.WithBlockType(ctx, objiotracing.ValueBlock)
-	return bpwc.r.readBlock(ctx, h, nil, nil, stats)
+	return bpwc.r.readBlock(ctx, h, cache.ValueBlock, nil, nil, stats)
 }
 
 // ReaderProvider supports the implementation of blockProviderWhenClosed.
@@ -735,8 +735,11 @@ type valueBlockReader struct {
 	valueBlockPtr unsafe.Pointer
 	valueCache    cache.Handle
 	lazyFetcher   base.LazyFetcher
-	closed        bool
-	bufToMangle   []byte
+	// loadingBlockNum is the number of the value block being loaded, used to
+	// determine the value blocks to prefetch.
+	loadingBlockNum uint32
+	closed          bool
+	bufToMangle     []byte
 }
 
 func (r *valueBlockReader) getLazyValueForPrefixAndValueHandle(handle []byte) base.LazyValue {
@@ -840,6 +843,7 @@ func (r *valueBlockReader) getValueInternal(handle []byte, valLen int32) (val []
 		if err != nil {
 			return nil, err
 		}
+		r.loadingBlockNum = vh.blockNum
 		vbCacheHandle, err := r.bpOpen.readBlockForVBR(r.ctx, vbh, r.stats)
 		if err != nil {
 			return nil, err
@@ -856,6 +860,22 @@ func (r *valueBlockReader) getValueInternal(handle []byte, valLen int32) (val []
 	return r.valueBlock[vh.offsetInBlock : vh.offsetInBlock+vh.valueLen], nil
 }
 
+// peekBlockHandles implements the blockHandlePeeker interface, returning the
+// handles of the value blocks following the value block being loaded.
+func (r *valueBlockReader) peekBlockHandles(dst []BlockHandle, n int) []BlockHandle {
+	indexEntryLen :=
+		int(r.vbih.blockNumByteLength + r.vbih.blockOffsetByteLength + r.vbih.blockLengthByteLength)
+	numBlocks := uint32(len(r.vbiBlock) / indexEntryLen)
+	for blockNum := r.loadingBlockNum + 1; blockNum < numBlocks && len(dst) < n; blockNum++ {
+		h, err := r.getBlockHandle(blockNum)
+		if err != nil {
+			break
+		}
+		dst = append(dst, h)
+	}
+	return dst
+}
+
 func (r *valueBlockReader) getBlockHandle(blockNum uint32) (BlockHandle, error) {
 	indexEntryLen :=
 		int(r.vbih.blockNumByteLength + r.vbih.blockOffsetByteLength + r.vbih.blockLengthByteLength)
@@ -932,6 +932,22 @@ func (w *Writer) addPoint(key InternalKey, value []byte) error {
 	switch key.Kind() {
 	case InternalKeyKindDelete, InternalKeyKindSingleDelete:
 		w.props.NumDeletions++
+		w.props.RawPointTombstoneKeySize += uint64(len(key.UserKey))
+	case InternalKeyKindDeleteSized:
+		var size uint64
+		if len(value) > 0 {
+			var n int
+			size, n = binary.Uvarint(value)
+			if n <= 0 {
+				w.err = errors.Newf("%s key's value (%x) does not parse as uvarint",
+					errors.Safe(key.Kind().String()), value)
+				return w.err
+			}
+		}
+		w.props.NumDeletions++
+		w.props.NumSizedDeletions++
+		w.props.RawPointTombstoneKeySize += uint64(len(key.UserKey))
+		w.props.RawPointTombstoneValueSize += size
 	case InternalKeyKindMerge:
 		w.props.NumMergeOperands++
 	}
@@ -1318,6 +1334,7 @@ func (w *Writer) flush(key InternalKey) error {
 		if err != nil {
 			return err
 		}
+		w.finishFilterPartition(prevKey.UserKey)
 	}
 
 	// We've called BlockPropertyCollector.FinishDataBlock, and, if necessary,
@@ -1462,6 +1479,19 @@ func (w *Writer) addIndexEntry(
 	return nil
 }
 
+// finishFilterPartition finishes the current filter partition if the filter
+// is partitioned, when the index block is flushed. The partition holds the
+// keys of the data blocks up to and including the most recently finished
+// block, whose largest user key is sep. Note that the most recently finished
+// data block is indexed by the next index block, so the filter partitions
+// trail the index partitions by a block, which is fine since the filter
+// partitions are located through their own index.
+func (w *Writer) finishFilterPartition(sep []byte) {
+	if f, ok := w.filter.(*partitionedFilterWriter); ok {
+		f.finishPartition(sep)
+	}
+}
+
 func (w *Writer) addPrevDataBlockToIndexBlockProps() {
 	for i := range w.blockPropCollectors {
 		w.blockPropCollectors[i].AddPrevDataBlockToIndexBlock()
@@ -1497,6 +1527,7 @@ func (w *Writer) addIndexEntrySync(
 		if err != nil {
 			return err
 		}
+		w.finishFilterPartition(prevKey.UserKey)
 	}
 
 	err = w.addIndexEntry(sep, bhp, tmp, flushableIndexBlock, w.indexBlock, 0, props)
@@ -1636,6 +1667,28 @@ func (w *Writer) writeTwoLevelIndex() (BlockHandle, error) {
 	return w.writeBlock(w.topLevelIndexBlock.finish(), w.compression, &w.blockBuf)
 }
 
+// writePartitionedFilter writes the partitions of a partitioned filter, and
+// the filter index block locating them, returning the handle of the filter
+// index block.
+func (w *Writer) writePartitionedFilter(f *partitionedFilterWriter) (BlockHandle, error) {
+	var index blockWriter
+	index.restartInterval = 1
+	for i := range f.partitions {
+		p := &f.partitions[i]
+		bh, err := w.writeBlock(p.block, NoCompression, &w.blockBuf)
+		if err != nil {
+			return BlockHandle{}, err
+		}
+		w.props.FilterSize += bh.Length
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		index.add(base.MakeInternalKey(p.sep, 0, base.InternalKeyKindSeparator), w.blockBuf.tmp[:n])
+	}
+	w.props.NumFilterPartitions = uint64(len(f.partitions))
+	b := index.finish()
+	w.props.FilterSize += uint64(len(b))
+	return w.writeBlock(b, NoCompression, &w.blockBuf)
+}
+
 func compressAndChecksum(b []byte, compression Compression, blockBuf *blockBuf) []byte {
 	// Compress the buffer, discarding the result if the improvement isn't at
 	// least 12.5%.
@@ -1804,7 +1857,18 @@ func (w *Writer) Close() (err error) {
 	// Write the filter block.
 	var metaindex rawBlockWriter
 	metaindex.restartInterval = 1
-	if w.filter != nil {
+	if f, ok := w.filter.(*partitionedFilterWriter); ok && f.partitioned() {
+		if w.meta.HasPointKeys {
+			f.finishPartition(w.meta.LargestPoint.UserKey)
+		}
+		bh, err := w.writePartitionedFilter(f)
+		if err != nil {
+			return err
+		}
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.blockBuf.tmp[:n])
+		w.props.FilterPolicyName = w.filter.policyName()
+	} else if w.filter != nil {
 		b, err := w.filter.finish()
 		if err != nil {
 			return err
@@ -2109,7 +2173,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			Format: o.Comparer.FormatKey,
 		},
 	}
-	if w.tableFormat == TableFormatPebblev3 {
+	if w.tableFormat >= TableFormatPebblev3 {
 		w.shortAttributeExtractor = o.ShortAttributeExtractor
 		w.requiredInPlaceValueBound = o.RequiredInPlaceValueBound
 		w.valueBlockWriter = newValueBlockWriter(
@@ -2145,7 +2209,11 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 	if o.FilterPolicy != nil {
 		switch o.FilterType {
 		case TableFilter:
-			w.filter = newTableFilterWriter(o.FilterPolicy)
+			if w.tableFormat >= TableFormatPebblev4 {
+				w.filter = newPartitionedFilterWriter(o.FilterPolicy)
+			} else {
+				w.filter = newTableFilterWriter(o.FilterPolicy)
+			}
 			if w.split != nil {
 				w.props.PrefixExtractorName = o.Comparer.Name
 				w.props.PrefixFiltering = true
@@ -396,23 +396,28 @@ func (c *tableCacheShard) newIters(
 
 	var iter sstable.Iterator
 	useFilter := true
+	iterOpts := sstable.IterOptions{Prefetcher: internalOpts.prefetcher}
 	if opts != nil {
 		useFilter = manifest.LevelToInt(opts.level) != 6 || opts.UseL6Filters
 		ctx = objiotracing.WithLevel(ctx, manifest.LevelToInt(opts.level))
+		// Every read must consult the L0 files overlapping its keys, so their
+		// data blocks are cached with high priority.
+		iterOpts.HighCachePriority = manifest.LevelToInt(opts.level) == 0
 	}
 	tableFormat, err := v.reader.TableFormat()
 	if err != nil {
 		return nil, nil, err
 	}
 	var rp sstable.ReaderProvider
-	if tableFormat == sstable.TableFormatPebblev3 && v.reader.Properties.NumValueBlocks > 0 {
+	if tableFormat >= sstable.TableFormatPebblev3 && v.reader.Properties.NumValueBlocks > 0 {
 		rp = &tableCacheShardReaderProvider{c: c, file: file, dbOpts: dbOpts}
 	}
 	if internalOpts.bytesIterated != nil {
 		iter, err = v.reader.NewCompactionIter(internalOpts.bytesIterated, rp)
 	} else {
-		iter, err = v.reader.NewIterWithBlockPropertyFiltersAndContext(
-			ctx, opts.GetLowerBound(), opts.GetUpperBound(), filterer, useFilter, internalOpts.stats, rp)
+		iter, err = v.reader.NewIterWithOptions(
+			ctx, opts.GetLowerBound(), opts.GetUpperBound(), filterer, useFilter, internalOpts.stats, rp,
+			iterOpts)
 	}
 	if err != nil {
 		if rangeDelIter != nil {
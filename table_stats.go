@@ -285,6 +285,13 @@ func (d *DB) loadTableStats(
 			// picking.
 			stats.NumRangeKeySets = r.Properties.NumRangeKeySets
 			stats.ValueBlocksSize = r.Properties.ValueBlocksSize
+			denseBlocks, blocks, ok, err := sstable.ReadTombstoneDensity(&r.Properties)
+			if err != nil {
+				return err
+			}
+			if ok && blocks > 0 {
+				stats.TombstoneDenseBlocksRatio = float64(denseBlocks) / float64(blocks)
+			}
 			return
 		})
 	if err != nil {
@@ -589,8 +596,9 @@ func maybeSetStatsFromProperties(meta physicalMeta, props *sstable.Properties) b
 	// PointDeletionsBytesEstimate statistic using our limited knowledge. The
 	// table stats collector can populate the stats and calculate an average
 	// of value size of all the tables beneath the table in the LSM, which
-	// will be more accurate.
-	if props.NumDeletions > props.NumEntries/10 {
+	// will be more accurate. Sized point deletions carry the size of the
+	// data they delete and don't require an estimate.
+	if props.NumDeletions-props.NumSizedDeletions > props.NumEntries/10 {
 		return false
 	}
 
@@ -630,8 +638,18 @@ func pointDeletionsBytesEstimate(props *sstable.Properties, avgKeySize, avgValSi
 	// because point tombstones can slow range iterations even when they don't
 	// cover a key. It may be beneficial in the future to more accurately
 	// estimate which tombstones cover keys and which do not.
+	//
+	// Sized point tombstones (DELSIZED) record the size of the key and value
+	// they delete, so no estimate is necessary: compacting them reclaims the
+	// tombstone's key and the deleted entry. These sizes are uncompressed.
 	numPointDels := props.NumPointDeletions()
-	return numPointDels*avgKeySize + numPointDels*(avgKeySize+avgValSize)
+	numUnsizedDels := numPointDels - props.NumSizedDeletions
+	estimate := numUnsizedDels*avgKeySize + numUnsizedDels*(avgKeySize+avgValSize)
+	if props.NumSizedDeletions > 0 {
+		avgTombstoneKeySize := props.RawPointTombstoneKeySize / numPointDels
+		estimate += props.NumSizedDeletions*avgTombstoneKeySize + props.RawPointTombstoneValueSize
+	}
+	return estimate
 }
 
 func estimateEntrySizes(
@@ -143,6 +143,54 @@ func TestTableStats(t *testing.T) {
 	})
 }
 
+func TestTableStatsDeleteSized(t *testing.T) {
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		FormatMajorVersion:          FormatDeleteSized - 1,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// DeleteSized requires FormatDeleteSized.
+	require.Panics(t, func() { _ = d.DeleteSized([]byte("a"), 1, nil) })
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatDeleteSized))
+
+	const numKeys = 10
+	const valueSize = 100
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i))
+		require.NoError(t, d.Set(key, bytes.Repeat([]byte("v"), valueSize), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("key"), []byte("key999"), false))
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i))
+		require.NoError(t, d.DeleteSized(key, valueSize, nil))
+	}
+	_, _, err = d.Get([]byte("key000"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, d.Flush())
+
+	// The flushed table's estimate is the sum of the tombstones' keys and the
+	// keys and values they delete.
+	d.mu.Lock()
+	d.waitTableStats()
+	files := d.mu.versions.currentVersion().Levels[0].Slice()
+	d.mu.Unlock()
+	require.Equal(t, 1, files.Len())
+	iter := files.Iter()
+	f := iter.First()
+	require.True(t, f.StatsValid())
+	const keySize = len("key000")
+	require.Equal(t, uint64(numKeys*(keySize+keySize+valueSize)), f.Stats.PointDeletionsBytesEstimate)
+
+	// Compacting the tombstones into the deleted keys drops both.
+	require.NoError(t, d.Compact([]byte("key"), []byte("key999"), false))
+	require.Zero(t, d.Metrics().Total().NumFiles)
+}
+
 func TestTableRangeDeletionIter(t *testing.T) {
 	var m *fileMetadata
 	cmp := base.DefaultComparer.Compare
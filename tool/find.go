@@ -356,7 +356,8 @@ func (f *findT) searchLogs(stdout io.Writer, searchKey []byte, refs []findRef) [
 						base.InternalKeyKindSet,
 						base.InternalKeyKindMerge,
 						base.InternalKeyKindSingleDelete,
-						base.InternalKeyKindSetWithDelete:
+						base.InternalKeyKindSetWithDelete,
+						base.InternalKeyKindDeleteSized:
 						if cmp(searchKey, ikey.UserKey) != 0 {
 							continue
 						}
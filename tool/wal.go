@@ -6,6 +6,7 @@ package tool
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 
@@ -141,6 +142,9 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
 					case base.InternalKeyKindSingleDelete:
 						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
+					case base.InternalKeyKindDeleteSized:
+						v, _ := binary.Uvarint(value)
+						fmt.Fprintf(stdout, "%s,%d", w.fmtKey.fn(ukey), v)
 					case base.InternalKeyKindSetWithDelete:
 						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
 					case base.InternalKeyKindRangeDelete:
@@ -0,0 +1,345 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// TxnConflictError is returned by Txn.Commit if a key read by the transaction
+// was written by another commit after the transaction's snapshot was taken.
+// The transaction's writes are not applied.
+type TxnConflictError struct {
+	// Key is a user key read by the transaction that was concurrently written.
+	Key []byte
+}
+
+// Error implements the error interface.
+func (e *TxnConflictError) Error() string {
+	return fmt.Sprintf("pebble: transaction conflict on key %q", e.Key)
+}
+
+// Txn is an optimistic transaction. A Txn reads from a consistent snapshot of
+// the DB overlaid with its own buffered writes, and records the keys and key
+// ranges it reads. At commit time, the commit pipeline verifies that none of
+// the keys read by the transaction were written after its snapshot was taken,
+// failing the commit with a TxnConflictError otherwise. Transactions that only
+// write never conflict, and transactions that do not write always commit, since
+// their reads are consistent with their snapshot.
+//
+// Conflicts are detected for point keys, range deletions and range keys.
+// Reads through an iterator record the iterator's bounds, so iterators should
+// be bounded as tightly as possible to avoid spurious conflicts.
+//
+// A Txn is not safe for concurrent use. Iterators opened on a Txn must be
+// closed before the Txn is committed or closed.
+type Txn struct {
+	db    *DB
+	snap  *Snapshot
+	batch *Batch
+	reads []txnRead
+}
+
+// txnRead records a span of user keys read by a transaction. A nil start or
+// end indicates that the span is unbounded in that direction.
+type txnRead struct {
+	start, end []byte
+	// endInclusive is true if end is included in the span, which is the case
+	// for reads of a single key.
+	endInclusive bool
+}
+
+// TxnSavepoint identifies a point in a transaction's sequence of writes. See
+// Txn.RollbackToSavepoint.
+type TxnSavepoint struct {
+	len   int
+	count uint32
+}
+
+var _ Reader = (*Txn)(nil)
+
+// NewTxn returns a new optimistic transaction reading at the current state of
+// the DB.
+func (d *DB) NewTxn() *Txn {
+	return &Txn{
+		db:    d,
+		snap:  d.NewSnapshot(),
+		batch: d.NewIndexedBatch(),
+	}
+}
+
+// Get gets the value for the given key, as of the transaction's snapshot and
+// including the transaction's own writes. It returns ErrNotFound if the key is
+// not found. The key is recorded as read, whether or not it is found.
+//
+// The caller should not modify the contents of the returned slice, but it is
+// safe to modify the contents of the argument after Get returns. The returned
+// slice will remain valid until the returned Closer is closed. On success, the
+// caller MUST call closer.Close() or a memory leak will occur.
+func (t *Txn) Get(key []byte) ([]byte, io.Closer, error) {
+	key = append([]byte(nil), key...)
+	t.reads = append(t.reads, txnRead{start: key, end: key, endInclusive: true})
+	return t.db.getInternal(key, t.batch, snapshotIterOpts{seqNum: t.snap.seqNum})
+}
+
+// NewIter returns an iterator over the transaction's snapshot, including the
+// transaction's own writes. The key range within the iterator's bounds is
+// recorded as read.
+//
+// The iterator must be closed before the transaction is committed or closed.
+func (t *Txn) NewIter(o *IterOptions) *Iterator {
+	return t.NewIterWithContext(context.Background(), o)
+}
+
+// NewIterWithContext is like NewIter, and additionally accepts a context for
+// tracing.
+func (t *Txn) NewIterWithContext(ctx context.Context, o *IterOptions) *Iterator {
+	r := txnRead{}
+	if lower := o.GetLowerBound(); lower != nil {
+		r.start = append([]byte(nil), lower...)
+	}
+	if upper := o.GetUpperBound(); upper != nil {
+		r.end = append([]byte(nil), upper...)
+	}
+	t.reads = append(t.reads, r)
+	return t.db.newIter(ctx, t.batch, snapshotIterOpts{seqNum: t.snap.seqNum}, o)
+}
+
+// Set sets the value for the given key, buffering the write until the
+// transaction is committed.
+func (t *Txn) Set(key, value []byte) error {
+	return t.batch.Set(key, value, nil)
+}
+
+// Merge adds an action to the transaction that merges the value at key with
+// the new value.
+func (t *Txn) Merge(key, value []byte) error {
+	return t.batch.Merge(key, value, nil)
+}
+
+// Delete deletes the value for the given key.
+func (t *Txn) Delete(key []byte) error {
+	return t.batch.Delete(key, nil)
+}
+
+// SingleDelete adds an action to the transaction that single deletes the entry
+// for key. See Writer.SingleDelete for more details on the semantics of
+// SingleDelete.
+func (t *Txn) SingleDelete(key []byte) error {
+	return t.batch.SingleDelete(key, nil)
+}
+
+// DeleteRange deletes all of the point keys in the range [start,end) (i.e.,
+// inclusive on start, exclusive on end).
+func (t *Txn) DeleteRange(start, end []byte) error {
+	return t.batch.DeleteRange(start, end, nil)
+}
+
+// Savepoint returns a savepoint that may be used to roll back the writes the
+// transaction performs after this call.
+func (t *Txn) Savepoint() TxnSavepoint {
+	return TxnSavepoint{len: len(t.batch.data), count: t.batch.Count()}
+}
+
+// RollbackToSavepoint discards the writes the transaction performed after the
+// provided savepoint was taken. Reads performed after the savepoint remain
+// recorded, since their results may have influenced the writes that precede
+// the savepoint.
+func (t *Txn) RollbackToSavepoint(sp TxnSavepoint) error {
+	if sp.len > len(t.batch.data) || sp.count > t.batch.Count() {
+		return errors.New("pebble: invalid transaction savepoint")
+	}
+	// Batch indexes cannot be truncated, so the batch is reset and its writes
+	// preceding the savepoint are reapplied.
+	var prefix Batch
+	if sp.len > 0 {
+		prefix.data = append([]byte(nil), t.batch.data[:sp.len]...)
+		prefix.setCount(sp.count)
+	}
+	t.batch.Reset()
+	return t.batch.Apply(&prefix, nil)
+}
+
+// Commit applies the transaction's writes to the DB, if none of the keys read
+// by the transaction were written since its snapshot was taken. Otherwise it
+// returns a TxnConflictError and discards the writes. The transaction is
+// closed regardless of the outcome.
+func (t *Txn) Commit(opts *WriteOptions) error {
+	t.batch.commitCheck = t.checkConflicts
+	err := t.db.Apply(t.batch, opts)
+	return firstError(err, t.Close())
+}
+
+// Close discards the transaction's writes and releases its snapshot.
+func (t *Txn) Close() error {
+	if t.snap == nil {
+		return nil
+	}
+	err := t.snap.Close()
+	err = firstError(err, t.batch.Close())
+	t.snap, t.batch = nil, nil
+	return err
+}
+
+// checkConflicts returns a TxnConflictError if any key within the spans read
+// by the transaction has been written at a sequence number newer than the
+// transaction's snapshot, and at least minSeqNum. It is called by the commit
+// pipeline before the transaction's batch is sequenced: first without blocking
+// other commits, and then once all previously sequenced commits are visible,
+// with a minSeqNum limiting the check to the commits that became visible in
+// the meantime.
+func (t *Txn) checkConflicts(minSeqNum uint64) error {
+	seqNum := t.snap.seqNum
+	if minSeqNum > seqNum {
+		seqNum = minSeqNum
+	}
+	key, err := t.db.findWriteSince(t.reads, seqNum)
+	if err != nil {
+		return err
+	}
+	if key != nil {
+		return &TxnConflictError{Key: key}
+	}
+	return nil
+}
+
+// findWriteSince returns a user key within the provided read spans that has
+// been written at or above seqNum, or nil if there is no such key. Memtables
+// and sstables containing no keys at or above seqNum are skipped, so finding
+// the writes of recent commits is cheap.
+func (d *DB) findWriteSince(reads []txnRead, seqNum uint64) ([]byte, error) {
+	if len(reads) == 0 {
+		return nil, nil
+	}
+	rs := d.loadReadState()
+	defer rs.unref()
+
+	for i, mem := range rs.memtables {
+		// Every key within a memtable is older than the next memtable.
+		if i+1 < len(rs.memtables) && rs.memtables[i+1].logSeqNum <= seqNum {
+			continue
+		}
+		for j := range reads {
+			key, err := d.findWriteSinceInSource(&reads[j], seqNum, mem.newIter(nil), mem.newRangeDelIter(nil),
+				mem.newRangeKeyIter(nil))
+			if key != nil || err != nil {
+				return key, err
+			}
+		}
+	}
+	for level := 0; level < numLevels; level++ {
+		for i := range reads {
+			r := &reads[i]
+			var files manifest.LevelIterator
+			if r.start == nil || r.end == nil {
+				files = rs.current.Levels[level].Iter()
+			} else {
+				overlaps := rs.current.Overlaps(level, d.cmp, r.start, r.end, !r.endInclusive)
+				files = overlaps.Iter()
+			}
+			for f := files.First(); f != nil; f = files.Next() {
+				// Sstables containing no keys newer than seqNum cannot
+				// contain a write.
+				if f.LargestSeqNum < seqNum {
+					continue
+				}
+				pointIter, rangeDelIter, err := d.newIters(context.Background(), f, nil, internalIterOpts{})
+				if err != nil {
+					return nil, err
+				}
+				var rangeKeyIter keyspan.FragmentIterator
+				if f.HasRangeKeys {
+					if rangeKeyIter, err = d.tableNewRangeKeyIter(f, nil); err != nil {
+						_ = pointIter.Close()
+						if rangeDelIter != nil {
+							_ = rangeDelIter.Close()
+						}
+						return nil, err
+					}
+				}
+				key, err := d.findWriteSinceInSource(r, seqNum, pointIter, rangeDelIter, rangeKeyIter)
+				if key != nil || err != nil {
+					return key, err
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// findWriteSinceInSource returns a user key within the read span r of a
+// memtable or sstable that has been written at or above seqNum, closing the
+// provided iterators. The span iterators may be nil.
+func (d *DB) findWriteSinceInSource(
+	r *txnRead,
+	seqNum uint64,
+	pointIter internalIterator,
+	rangeDelIter, rangeKeyIter keyspan.FragmentIterator,
+) (found []byte, err error) {
+	setFound := func(key []byte) {
+		if r.start != nil && d.cmp(key, r.start) < 0 {
+			key = r.start
+		}
+		found = append([]byte(nil), key...)
+	}
+
+	var k *InternalKey
+	if r.start == nil {
+		k, _ = pointIter.First()
+	} else {
+		k, _ = pointIter.SeekGE(r.start, base.SeekGEFlagsNone)
+	}
+	for ; k != nil && r.beforeEnd(d.cmp, k.UserKey); k, _ = pointIter.Next() {
+		if k.SeqNum() >= seqNum {
+			setFound(k.UserKey)
+			break
+		}
+	}
+	err = firstError(err, pointIter.Close())
+
+	for _, iter := range [2]keyspan.FragmentIterator{rangeDelIter, rangeKeyIter} {
+		if iter == nil {
+			continue
+		}
+		if found == nil && err == nil {
+			var s *keyspan.Span
+			if r.start == nil {
+				s = iter.First()
+			} else {
+				s = iter.SeekGE(r.start)
+			}
+		spans:
+			for ; s != nil && r.beforeEnd(d.cmp, s.Start); s = iter.Next() {
+				for i := range s.Keys {
+					if s.Keys[i].SeqNum() >= seqNum {
+						setFound(s.Start)
+						break spans
+					}
+				}
+			}
+		}
+		err = firstError(err, iter.Close())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// beforeEnd returns true if the key does not lie beyond the end of the span.
+func (r *txnRead) beforeEnd(cmp Compare, key []byte) bool {
+	if r.end == nil {
+		return true
+	}
+	c := cmp(key, r.end)
+	return c < 0 || (r.endInclusive && c == 0)
+}
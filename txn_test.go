@@ -0,0 +1,260 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnConflicts(t *testing.T) {
+	get := func(txn *Txn, key string) string {
+		v, closer, err := txn.Get([]byte(key))
+		if errors.Is(err, ErrNotFound) {
+			return ""
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	requireConflict := func(err error, key string) {
+		var conflict *TxnConflictError
+		require.True(t, errors.As(err, &conflict), "expected conflict, got %v", err)
+		require.Equal(t, key, string(conflict.Key))
+	}
+
+	for _, flush := range []bool{false, true} {
+		t.Run(fmt.Sprintf("flush=%t", flush), func(t *testing.T) {
+			d, err := Open("", &Options{FS: vfs.NewMem()})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+
+			require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+			require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+
+			maybeFlush := func() {
+				if flush {
+					require.NoError(t, d.Flush())
+				}
+			}
+
+			// A concurrent write to a key read by the transaction conflicts.
+			txn := d.NewTxn()
+			require.Equal(t, "1", get(txn, "a"))
+			require.NoError(t, txn.Set([]byte("b"), []byte("2")))
+			require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+			maybeFlush()
+			requireConflict(txn.Commit(nil), "a")
+			_, closer, err := d.Get([]byte("b"))
+			require.ErrorIs(t, err, ErrNotFound)
+			require.Nil(t, closer)
+
+			// Reads of missing keys are recorded too.
+			txn = d.NewTxn()
+			require.Equal(t, "", get(txn, "b"))
+			require.NoError(t, txn.Set([]byte("c"), []byte("3")))
+			require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+			maybeFlush()
+			requireConflict(txn.Commit(nil), "b")
+
+			// A concurrent write to a key that was not read does not conflict.
+			txn = d.NewTxn()
+			require.Equal(t, "1", get(txn, "c"))
+			require.NoError(t, txn.Set([]byte("c"), []byte("2")))
+			require.NoError(t, d.Set([]byte("d"), []byte("1"), nil))
+			maybeFlush()
+			require.NoError(t, txn.Commit(nil))
+			v, closer, err := d.Get([]byte("c"))
+			require.NoError(t, err)
+			require.Equal(t, "2", string(v))
+			require.NoError(t, closer.Close())
+
+			// A concurrent write within the bounds of an iterator conflicts.
+			txn = d.NewTxn()
+			iter := txn.NewIter(&IterOptions{LowerBound: []byte("e"), UpperBound: []byte("g")})
+			require.False(t, iter.First())
+			require.NoError(t, iter.Close())
+			require.NoError(t, txn.Set([]byte("a"), []byte("3")))
+			require.NoError(t, d.Set([]byte("g"), []byte("1"), nil))
+			maybeFlush()
+			require.NoError(t, d.Set([]byte("f"), []byte("1"), nil))
+			maybeFlush()
+			requireConflict(txn.Commit(nil), "f")
+
+			// A concurrent range deletion overlapping a read key conflicts.
+			txn = d.NewTxn()
+			require.Equal(t, "1", get(txn, "f"))
+			require.NoError(t, txn.Set([]byte("a"), []byte("3")))
+			require.NoError(t, d.DeleteRange([]byte("e"), []byte("z"), nil))
+			maybeFlush()
+			requireConflict(txn.Commit(nil), "f")
+		})
+	}
+}
+
+func TestTxnSavepoint(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	txn := d.NewTxn()
+	empty := txn.Savepoint()
+	require.NoError(t, txn.Set([]byte("a"), []byte("1")))
+	sp := txn.Savepoint()
+	require.NoError(t, txn.Set([]byte("b"), []byte("1")))
+	require.NoError(t, txn.Delete([]byte("a")))
+
+	require.NoError(t, txn.RollbackToSavepoint(sp))
+	v, closer, err := txn.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+	_, _, err = txn.Get([]byte("b"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Writes may continue after a rollback, and the rolled back savepoint
+	// remains usable.
+	require.NoError(t, txn.Set([]byte("c"), []byte("1")))
+	require.NoError(t, txn.RollbackToSavepoint(sp))
+	require.NoError(t, txn.Set([]byte("d"), []byte("1")))
+	require.Error(t, txn.RollbackToSavepoint(TxnSavepoint{len: 1 << 20}))
+	require.NoError(t, txn.Commit(nil))
+
+	var keys []string
+	iter := d.NewIter(nil)
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"a", "d"}, keys)
+
+	txn = d.NewTxn()
+	require.NoError(t, txn.Set([]byte("e"), []byte("1")))
+	require.NoError(t, txn.RollbackToSavepoint(empty))
+	require.NoError(t, txn.Commit(nil))
+	_, _, err = d.Get([]byte("e"))
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+// TestTxnConcurrentIncrements runs concurrent read-modify-write transactions
+// incrementing a counter, retrying on conflicts, and checks that no increment
+// is lost.
+func TestTxnConcurrentIncrements(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	const workers = 4
+	const increments = 50
+	key := []byte("counter")
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; {
+				txn := d.NewTxn()
+				var count int
+				v, closer, err := txn.Get(key)
+				if err == nil {
+					count, err = strconv.Atoi(string(v))
+					closer.Close()
+				} else if errors.Is(err, ErrNotFound) {
+					err = nil
+				}
+				if err == nil {
+					err = txn.Set(key, []byte(strconv.Itoa(count+1)))
+				}
+				if err != nil {
+					_ = txn.Close()
+					errs <- err
+					return
+				}
+				err = txn.Commit(nil)
+				var conflict *TxnConflictError
+				if errors.As(err, &conflict) {
+					continue
+				} else if err != nil {
+					errs <- err
+					return
+				}
+				n++
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	v, closer, err := d.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(workers*increments), string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestTxnConflictCheckConcurrentWriter(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	const n = 10000
+	for i := 0; i < n; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%05d", i)), []byte("1"), nil))
+	}
+	require.NoError(t, d.Flush())
+
+	// The transaction reads the entire keyspace.
+	txn := d.NewTxn()
+	iter := txn.NewIter(nil)
+	count := 0
+	for valid := iter.First(); valid; valid = iter.Next() {
+		count++
+	}
+	require.Equal(t, n, count)
+	require.NoError(t, iter.Close())
+	require.NoError(t, txn.Set([]byte("total"), []byte(strconv.Itoa(count))))
+
+	// While the bulk of the conflict check runs, another writer commits a key
+	// read by the transaction. The writer must not be blocked by the check,
+	// and the write must be detected as a conflict once the check completes.
+	checkConflicts := txn.checkConflicts
+	var checks []uint64
+	txn.batch.commitCheck = func(minSeqNum uint64) error {
+		checks = append(checks, minSeqNum)
+		err := checkConflicts(minSeqNum)
+		if minSeqNum == 0 {
+			done := make(chan error)
+			go func() { done <- d.Set([]byte("00042"), []byte("2"), nil) }()
+			select {
+			case err := <-done:
+				require.NoError(t, err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("concurrent writer blocked by the conflict check")
+			}
+		}
+		return err
+	}
+	err = d.Apply(txn.batch, nil)
+	var conflict *TxnConflictError
+	require.True(t, errors.As(err, &conflict), "expected conflict, got %v", err)
+	require.Equal(t, "00042", string(conflict.Key))
+	require.NoError(t, txn.Close())
+
+	// The check without blocking other commits is followed by a check of the
+	// writes that were committed concurrently.
+	require.Equal(t, 2, len(checks))
+	require.Zero(t, checks[0])
+	require.Less(t, uint64(0), checks[1])
+}
@@ -640,6 +640,10 @@ func (vs *versionSet) incrementCompactions(kind compactionKind, extraLevels []*c
 	case compactionKindRewrite:
 		vs.metrics.Compact.Count++
 		vs.metrics.Compact.RewriteCount++
+
+	case compactionKindTombstoneDensity:
+		vs.metrics.Compact.Count++
+		vs.metrics.Compact.TombstoneDensityCount++
 	}
 	if len(extraLevels) > 0 {
 		vs.metrics.Compact.MultiLevelCount++
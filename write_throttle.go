@@ -0,0 +1,183 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/rate"
+)
+
+// writeThrottleSteps is the number of discrete steps into which the throttling
+// level is divided when reporting changes to the EventListener.
+const writeThrottleSteps = 10
+
+// writeThrottle delays commits as the DB approaches a write stall, admitting
+// batches through a token bucket on bytes whose rate falls as the throttling
+// level rises. See Options.Experimental.WriteThrottleRate.
+type writeThrottle struct {
+	rate    float64
+	limiter *rate.Limiter
+	// throttling is set while the throttling level is positive, allowing
+	// commits to skip the limiter while writes are not throttled.
+	throttling atomic.Bool
+
+	// The following fields are protected by DB.mu.
+	level float64
+	step  int
+	// versionLevel is the throttling level due to the current version's L0
+	// read amplification and compaction debt, and versionReason its reason.
+	// They're recomputed only when the read state changes, while the level due
+	// to the memtable queue is recomputed as the mutable memtable fills.
+	versionLevel  float64
+	versionReason string
+}
+
+func newWriteThrottle(bytesPerSec int64) *writeThrottle {
+	burst := bytesPerSec
+	if burst > math.MaxInt32 {
+		burst = math.MaxInt32
+	}
+	return &writeThrottle{
+		rate:    float64(bytesPerSec),
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSec), int(burst)),
+	}
+}
+
+// wait blocks until a batch of n bytes is admitted, returning the duration of
+// the delay. If ctx is done first, the batch's reservation is cancelled and
+// ctx's error is returned.
+func (t *writeThrottle) wait(ctx context.Context, n int) (time.Duration, error) {
+	if !t.throttling.Load() {
+		return 0, nil
+	}
+	if burst := t.limiter.Burst(); n > burst {
+		n = burst
+	}
+	now := time.Now()
+	r := t.limiter.ReserveN(now, n)
+	delay := r.DelayFrom(now)
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		r.Cancel()
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// setLevel sets the throttling level, returning true if it crossed into a
+// different reporting step. DB.mu must be held.
+func (t *writeThrottle) setLevel(level float64) bool {
+	if level == t.level {
+		return false
+	}
+	t.level = level
+	if level > 0 {
+		t.limiter.SetLimit(rate.Limit(t.admittedRate(level)))
+	}
+	t.throttling.Store(level > 0)
+	step := int(math.Ceil(level * writeThrottleSteps))
+	if step == t.step {
+		return false
+	}
+	t.step = step
+	return true
+}
+
+// admittedRate returns the rate, in bytes per second, at which batches are
+// admitted at the provided throttling level.
+func (t *writeThrottle) admittedRate(level float64) float64 {
+	return t.rate * math.Max(1-level, 0.01)
+}
+
+// throttleFraction returns the fraction of the way that v lies between the
+// slowdown and stop thresholds, clamped to [0,1].
+func throttleFraction(v, slowdown, stop float64) float64 {
+	switch {
+	case v >= stop:
+		return 1
+	case v <= slowdown:
+		return 0
+	default:
+		return (v - slowdown) / (stop - slowdown)
+	}
+}
+
+// updateWriteThrottleLocked recomputes the write throttling level from the
+// current L0 read amplification, memtable queue and compaction debt. It is
+// called whenever the read state changes. DB.mu must be held.
+func (d *DB) updateWriteThrottleLocked() {
+	t := d.writeThrottle
+	if t == nil {
+		return
+	}
+	o := d.opts
+	t.versionLevel, t.versionReason = 0, ""
+	consider := func(l float64, r string) {
+		if l > t.versionLevel {
+			t.versionLevel, t.versionReason = l, r
+		}
+	}
+	if v := d.mu.versions.currentVersion(); v != nil && v.L0Sublevels != nil {
+		consider(throttleFraction(float64(v.L0Sublevels.ReadAmplification()),
+			float64(o.Experimental.L0SlowdownWritesThreshold), float64(o.L0StopWritesThreshold)),
+			"L0 read amplification")
+	}
+	if o.Experimental.CompactionDebtSlowdownThreshold > 0 && d.mu.versions.picker != nil {
+		consider(throttleFraction(float64(d.mu.versions.picker.estimatedCompactionDebt(0)),
+			float64(o.Experimental.CompactionDebtSlowdownThreshold),
+			float64(o.Experimental.CompactionDebtThrottleLimit)),
+			"compaction debt")
+	}
+	d.updateMemTableWriteThrottleLocked()
+}
+
+// updateMemTableWriteThrottleLocked recomputes the write throttling level from
+// the bytes in use by the memtable queue, combined with the level last
+// computed from the current version. It is called as batches are written, so
+// that the level rises as the mutable memtable fills. DB.mu must be held.
+func (d *DB) updateMemTableWriteThrottleLocked() {
+	t := d.writeThrottle
+	if t == nil {
+		return
+	}
+	o := d.opts
+	level, reason := t.versionLevel, t.versionReason
+
+	// Immutable memtables hold their entire arena until they're flushed, while
+	// the mutable memtable counts only the bytes written to it so far. Writes
+	// stall once the mutable memtable fills while the queue holds
+	// MemTableStopWritesThreshold memtables' worth of bytes.
+	var memSize uint64
+	for _, e := range d.mu.mem.queue {
+		if e.flushable == d.mu.mem.mutable {
+			memSize += d.mu.mem.mutable.inuseBytes()
+		} else {
+			memSize += e.totalBytes()
+		}
+	}
+	if l := throttleFraction(float64(memSize),
+		float64(o.Experimental.MemTableSlowdownWritesThreshold)*float64(o.MemTableSize),
+		float64(o.MemTableStopWritesThreshold)*float64(o.MemTableSize)); l > level {
+		level, reason = l, "memtable queue size"
+	}
+
+	if t.setLevel(level) {
+		info := WriteThrottleInfo{Level: level, Reason: reason}
+		if level > 0 {
+			info.Rate = int64(t.admittedRate(level))
+		}
+		o.EventListener.WriteThrottleChanged(info)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottleFraction(t *testing.T) {
+	testCases := []struct {
+		v, slowdown, stop float64
+		want              float64
+	}{
+		{v: 0, slowdown: 4, stop: 8, want: 0},
+		{v: 4, slowdown: 4, stop: 8, want: 0},
+		{v: 5, slowdown: 4, stop: 8, want: 0.25},
+		{v: 8, slowdown: 4, stop: 8, want: 1},
+		{v: 20, slowdown: 4, stop: 8, want: 1},
+		// A slowdown threshold beyond the stop threshold stops writes without
+		// throttling them first.
+		{v: 8, slowdown: 10, stop: 8, want: 1},
+		{v: 7, slowdown: 10, stop: 8, want: 0},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.want, throttleFraction(tc.v, tc.slowdown, tc.stop),
+			"v=%f slowdown=%f stop=%f", tc.v, tc.slowdown, tc.stop)
+	}
+}
+
+func TestWriteThrottle(t *testing.T) {
+	const throttleRate = 1 << 20
+	var events []WriteThrottleInfo
+	opts := &Options{
+		FS:                          vfs.NewMem(),
+		DisableAutomaticCompactions: true,
+		L0CompactionThreshold:       2,
+		L0StopWritesThreshold:       10,
+		MemTableSize:                4 << 20,
+		EventListener: &EventListener{
+			WriteThrottleChanged: func(info WriteThrottleInfo) {
+				events = append(events, info)
+			},
+		},
+	}
+	opts.Experimental.WriteThrottleRate = throttleRate
+	opts.Experimental.L0SlowdownWritesThreshold = 2
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	commit := func(valueSize int) BatchCommitStats {
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte("a"), bytes.Repeat([]byte("v"), valueSize), nil))
+		require.NoError(t, b.Commit(nil))
+		stats := b.CommitStats()
+		require.NoError(t, b.Close())
+		return stats
+	}
+
+	// Writes are not throttled while L0 read amplification is below the
+	// slowdown threshold.
+	for i := 0; i < 2; i++ {
+		require.Zero(t, commit(1).WriteThrottleDuration)
+		require.NoError(t, d.Flush())
+	}
+	require.Empty(t, events)
+
+	// Each additional L0 sublevel raises the throttling level.
+	for i := 0; i < 2; i++ {
+		commit(1)
+		require.NoError(t, d.Flush())
+	}
+	var levels []string
+	for _, e := range events {
+		require.Equal(t, "L0 read amplification", e.Reason)
+		levels = append(levels, fmt.Sprintf("%.3f", e.Level))
+	}
+	require.Equal(t, []string{"0.125", "0.250"}, levels)
+	require.Equal(t, int64(0.75*throttleRate), events[1].Rate)
+
+	// Once the limiter's burst is exhausted, commits are delayed.
+	commit(throttleRate)
+	require.Less(t, int64(0), int64(commit(10<<10).WriteThrottleDuration))
+
+	// Compacting L0 releases the throttle.
+	require.NoError(t, d.Compact([]byte("a"), []byte("b"), false))
+	require.Equal(t, WriteThrottleInfo{Reason: ""}, events[len(events)-1])
+	require.Equal(t, "write throttle released", events[len(events)-1].String())
+	require.Zero(t, commit(1).WriteThrottleDuration)
+}
+
+func TestWriteThrottleMemTable(t *testing.T) {
+	var events []WriteThrottleInfo
+	opts := &Options{
+		FS:           vfs.NewMem(),
+		MemTableSize: initialMemTableSize,
+		EventListener: &EventListener{
+			WriteThrottleChanged: func(info WriteThrottleInfo) {
+				events = append(events, info)
+			},
+		},
+	}
+	opts.Experimental.WriteThrottleRate = 1 << 30
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.Equal(t, 1, d.opts.Experimental.MemTableSlowdownWritesThreshold)
+
+	setFlushing := func(flushing bool) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.mu.compact.flushing = flushing
+		d.maybeScheduleFlush()
+	}
+	// Disable any flushes, re-enabling them before the DB is closed.
+	setFlushing(true)
+	defer setFlushing(false)
+	queueLen := func() int {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return len(d.mu.mem.queue)
+	}
+
+	value := bytes.Repeat([]byte("v"), 8<<10)
+	var i int
+	set := func() {
+		require.NoError(t, d.Set([]byte(fmt.Sprint(i)), value, nil))
+		i++
+	}
+
+	// Writes are not throttled while the first memtable fills.
+	for queueLen() == 1 {
+		set()
+	}
+	require.Empty(t, events)
+
+	// Once the first memtable is queued for flushing, the throttling level
+	// rises as the mutable memtable fills. Fill three quarters of it, short of
+	// a stall.
+	for n := 3 * i / 4; n > 0; n-- {
+		set()
+	}
+	require.GreaterOrEqual(t, len(events), 5)
+	for j, e := range events {
+		require.Equal(t, "memtable queue size", e.Reason)
+		require.Less(t, 0.0, e.Level)
+		require.Greater(t, 1.0, e.Level)
+		if j > 0 {
+			require.Less(t, events[j-1].Level, e.Level)
+		}
+	}
+	require.Equal(t, 2, queueLen())
+
+	// Flushing the queued memtables releases the throttle.
+	setFlushing(false)
+	require.NoError(t, d.Flush())
+	require.Equal(t, WriteThrottleInfo{Reason: ""}, events[len(events)-1])
+}